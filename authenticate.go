@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/auth"
+)
+
+var errMissingScope = errors.New("token is missing the required scope")
+
+// authenticate func identifies the user making the request from either an access token (JWT)
+// or a personal access token, the token must hold the scope
+func (cfg *apiConfig) authenticate(r *http.Request, scope string) (uuid.UUID, *auth.Claims, error) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+
+	var claims *auth.Claims
+	if auth.IsAPIToken(token) {
+		claims, err = cfg.validateAPIToken(r.Context(), token)
+	} else {
+		claims, err = auth.ParseJWT(token, cfg.jwtSecret)
+		if err == nil && cfg.denylist.IsRevoked(claims) {
+			err = auth.ErrTokenRevoked
+		}
+	}
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+
+	if !claims.HasScope(scope) {
+		return uuid.Nil, nil, fmt.Errorf("%w: %v", errMissingScope, scope)
+	}
+	userId, err := claims.UserID()
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+	return userId, claims, nil
+}
+
+// validateAPIToken func looks up a personal access token and returns claims holding its scopes
+func (cfg *apiConfig) validateAPIToken(ctx context.Context, token string) (*auth.Claims, error) {
+	apiToken, err := cfg.store.GetValidAPIToken(ctx, auth.HashToken(token))
+	if err != nil {
+		return nil, fmt.Errorf("invalid personal access token: %v", err)
+	}
+	if err := cfg.store.TouchAPIToken(ctx, apiToken.ID); err != nil {
+		return nil, fmt.Errorf("couldn't update personal access token: %v", err)
+	}
+	return &auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: apiToken.UserID.String()},
+		Scopes:           apiToken.Scopes,
+	}, nil
+}
+
+// respondWithAuthErr func responds with 403 when the token lacks a scope and with 401 otherwise
+func respondWithAuthErr(w http.ResponseWriter, err error) {
+	if errors.Is(err, errMissingScope) {
+		respondWithErr(w, http.StatusForbidden, "Forbidden; "+err.Error(), err)
+		return
+	}
+	respondWithErr(w, http.StatusUnauthorized, "Unauthorized", err)
+}
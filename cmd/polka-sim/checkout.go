@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const chirpyRedPlan = "chirpy_red"
+
+// checkout is the billing side of polka: it keeps the period end of every subscription it sold
+// and turns what the user does into webhook events
+type checkout struct {
+	dispatcher *dispatcher
+	period     time.Duration
+
+	mu         sync.Mutex
+	periodEnds map[uuid.UUID]time.Time
+}
+
+func newCheckout(d *dispatcher, period time.Duration) *checkout {
+	return &checkout{
+		dispatcher: d,
+		period:     period,
+		periodEnds: map[uuid.UUID]time.Time{},
+	}
+}
+
+func (c *checkout) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", c.handlerPage)
+	mux.HandleFunc("POST /checkout", c.handlerEvent(c.upgrade))
+	mux.HandleFunc("POST /renew", c.handlerEvent(c.renew))
+	mux.HandleFunc("POST /fail", c.handlerEvent(c.fail))
+	mux.HandleFunc("POST /cancel", c.handlerEvent(c.cancel))
+	return mux
+}
+
+// handlerEvent func returns a handler that queues the event built for the user_id form (or query) value
+func (c *checkout) handlerEvent(build func(userID uuid.UUID, r *http.Request) event) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := uuid.Parse(r.FormValue("user_id"))
+		if err != nil {
+			http.Error(w, "user_id must be the id of a chirpy user", http.StatusBadRequest)
+			return
+		}
+		ev := build(userID, r)
+		ev.ID = "evt_" + uuid.NewString()
+		ev.CreatedAt = time.Now().UTC()
+		ev.Data.UserID = userID
+		ev.Data.Plan = chirpyRedPlan
+		c.dispatcher.enqueue(ev)
+		log.Printf("queued %v %v for user %v", ev.Event, ev.ID, userID)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(ev)
+	}
+}
+
+// upgrade func starts a new subscription
+func (c *checkout) upgrade(userID uuid.UUID, _ *http.Request) event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	periodEnd := time.Now().UTC().Add(c.period)
+	c.periodEnds[userID] = periodEnd
+	return event{Event: "user.upgraded", Data: eventData{CurrentPeriodEnd: &periodEnd}}
+}
+
+// renew func charges the next period, it starts now if the current one is over
+func (c *checkout) renew(userID uuid.UUID, _ *http.Request) event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	periodStart := c.periodEnds[userID]
+	if now := time.Now().UTC(); periodStart.Before(now) {
+		periodStart = now
+	}
+	periodEnd := periodStart.Add(c.period)
+	c.periodEnds[userID] = periodEnd
+	return event{Event: "subscription.renewed", Data: eventData{CurrentPeriodEnd: &periodEnd}}
+}
+
+// fail func reports that the renewal payment was declined
+func (c *checkout) fail(_ uuid.UUID, _ *http.Request) event {
+	return event{Event: "subscription.payment_failed"}
+}
+
+// cancel func ends the subscription at the end of the period, or right away with immediately=true
+func (c *checkout) cancel(userID uuid.UUID, r *http.Request) event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cancelAt, ok := c.periodEnds[userID]
+	if !ok || r.FormValue("immediately") == "true" {
+		cancelAt = time.Now().UTC()
+	}
+	return event{Event: "subscription.canceled", Data: eventData{CancelAt: &cancelAt}}
+}
+
+var checkoutPage = template.Must(template.New("checkout").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Polka checkout</title></head>
+<body>
+  <h1>Polka checkout</h1>
+  <p>Webhooks go to {{.Target}}</p>
+  <form method="post">
+    <label>Chirpy user id <input name="user_id" size="40" required></label>
+    <p>
+      <button formaction="/checkout">Buy Chirpy Red</button>
+      <button formaction="/renew">Renew</button>
+      <button formaction="/fail">Decline the renewal</button>
+      <button formaction="/cancel">Cancel at the end of the period</button>
+      <button formaction="/cancel?immediately=true">Cancel now</button>
+    </p>
+  </form>
+</body>
+</html>
+`))
+
+func (c *checkout) handlerPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	checkoutPage.Execute(w, struct{ Target string }{c.dispatcher.target})
+}
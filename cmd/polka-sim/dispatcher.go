@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/webhook"
+)
+
+// event is a webhook event as polka sends it
+type event struct {
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"` // when it happened, unlike the timestamp of the signature it's the same for every attempt
+	Data      eventData `json:"data"`
+}
+
+type eventData struct {
+	UserID           uuid.UUID  `json:"user_id"`
+	Plan             string     `json:"plan"`
+	CurrentPeriodEnd *time.Time `json:"current_period_end,omitempty"`
+	CancelAt         *time.Time `json:"cancel_at,omitempty"`
+}
+
+// faults are the delivery problems injected on purpose, chirpy has to cope with all of them
+type faults struct {
+	Duplicates float64       // probability that an event is sent twice
+	Reorder    float64       // probability that an event is held back and sent after the next one
+	MaxDelay   time.Duration // events wait a random time up to this before they're sent
+}
+
+// dispatcher sends the events one at a time in the order they're queued, unless a fault says otherwise
+type dispatcher struct {
+	target        string
+	key           string
+	sender        webhook.Sender
+	faults        faults
+	retries       int           // attempts after the first one when chirpy doesn't answer with 2xx
+	retryBase     time.Duration // the delay between retries doubles from it
+	reorderWindow time.Duration // how long a held back event waits for the next one before it's sent anyway
+	rand          *rand.Rand    // only used by the run goroutine
+	queue         chan event
+}
+
+func newDispatcher(target, key string, f faults, retries int, seed uint64) *dispatcher {
+	return &dispatcher{
+		target: target,
+		key:    key,
+		sender: webhook.Sender{
+			Client:          &http.Client{Timeout: 10 * time.Second},
+			TimestampHeader: "X-Polka-Timestamp",
+			SignatureHeader: "X-Polka-Signature",
+		},
+		faults:        f,
+		retries:       retries,
+		retryBase:     time.Second,
+		reorderWindow: 10 * time.Second,
+		rand:          rand.New(rand.NewPCG(seed, seed)),
+		queue:         make(chan event, 100),
+	}
+}
+
+func (d *dispatcher) enqueue(ev event) {
+	d.queue <- ev
+}
+
+// run func sends the queued events until ctx is done
+func (d *dispatcher) run(ctx context.Context) {
+	var held *event
+	for {
+		var flush <-chan time.Time
+		if held != nil {
+			flush = time.After(d.reorderWindow)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-flush:
+			d.deliver(ctx, *held)
+			held = nil
+		case ev := <-d.queue:
+			if held == nil && d.chance(d.faults.Reorder) {
+				log.Printf("holding back %v %v, it's sent after the next event", ev.Event, ev.ID)
+				held = &ev
+				continue
+			}
+			d.deliver(ctx, ev)
+			if held != nil {
+				d.deliver(ctx, *held)
+				held = nil
+			}
+		}
+	}
+}
+
+// deliver func sends an event after its delay, and a second time if it's duplicated
+func (d *dispatcher) deliver(ctx context.Context, ev event) {
+	if d.faults.MaxDelay > 0 {
+		delay := time.Duration(d.rand.Int64N(int64(d.faults.MaxDelay)))
+		log.Printf("delaying %v %v by %v", ev.Event, ev.ID, delay.Round(time.Millisecond))
+		sleep(ctx, delay)
+	}
+	d.send(ctx, ev)
+	if d.chance(d.faults.Duplicates) {
+		log.Printf("sending %v %v again", ev.Event, ev.ID)
+		d.send(ctx, ev)
+	}
+}
+
+// send func posts an event, it's retried like polka does when chirpy doesn't acknowledge it.
+// every attempt is signed when it's sent, so delayed events still pass the timestamp check
+func (d *dispatcher) send(ctx context.Context, ev event) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("couldn't encode %v: %v", ev.ID, err)
+		return
+	}
+	for attempt := 0; attempt <= d.retries; attempt++ {
+		if attempt > 0 {
+			sleep(ctx, webhook.Backoff(attempt, d.retryBase, time.Minute))
+		}
+		status, err := d.sender.Send(ctx, d.target, d.key, body, nil, time.Now())
+		if err == nil {
+			log.Printf("sent %v %v for user %v: %d", ev.Event, ev.ID, ev.Data.UserID, status)
+			return
+		}
+		log.Printf("couldn't send %v %v (attempt %d): %v", ev.Event, ev.ID, attempt+1, err)
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (d *dispatcher) chance(probability float64) bool {
+	return probability > 0 && d.rand.Float64() < probability
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
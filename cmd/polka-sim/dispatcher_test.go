@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/webhook"
+)
+
+// receiver is a chirpy stand-in that records the ids of the events it accepted, in order
+type receiver struct {
+	mu       sync.Mutex
+	ids      []string
+	failures int // requests answered with 500 before accepting any
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	verifier := webhook.Verifier{Secrets: []string{"polka-key"}, Tolerance: time.Minute}
+	if err := verifier.Verify(body, r.Header.Get("X-Polka-Timestamp"), r.Header.Get("X-Polka-Signature"), time.Now()); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	ev := event{}
+	if err := json.Unmarshal(body, &ev); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.failures > 0 {
+		rc.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rc.ids = append(rc.ids, ev.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rc *receiver) received() []string {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return slices.Clone(rc.ids)
+}
+
+func TestDispatcher(t *testing.T) {
+	tests := []struct {
+		name     string
+		faults   faults
+		failures int
+		want     []string
+	}{
+		{
+			name: "In order",
+			want: []string{"evt_1", "evt_2", "evt_3"},
+		},
+		{
+			name:   "Duplicates",
+			faults: faults{Duplicates: 1},
+			want:   []string{"evt_1", "evt_1", "evt_2", "evt_2", "evt_3", "evt_3"},
+		},
+		{
+			name:   "Reordered",
+			faults: faults{Reorder: 1},
+			want:   []string{"evt_2", "evt_1", "evt_3"},
+		},
+		{
+			name:   "Delayed",
+			faults: faults{MaxDelay: 10 * time.Millisecond},
+			want:   []string{"evt_1", "evt_2", "evt_3"},
+		},
+		{
+			name:     "Retried until acknowledged",
+			failures: 2,
+			want:     []string{"evt_1", "evt_2", "evt_3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := &receiver{failures: tt.failures}
+			server := httptest.NewServer(rc)
+			defer server.Close()
+
+			d := newDispatcher(server.URL, "polka-key", tt.faults, 3, 1)
+			d.retryBase = time.Millisecond
+			d.reorderWindow = 20 * time.Millisecond
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go d.run(ctx)
+
+			userID := uuid.New()
+			for _, id := range []string{"evt_1", "evt_2", "evt_3"} {
+				d.enqueue(event{ID: id, Event: "subscription.renewed", Data: eventData{UserID: userID, Plan: chirpyRedPlan}})
+			}
+
+			deadline := time.Now().Add(2 * time.Second)
+			for len(rc.received()) < len(tt.want) && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+			if got := rc.received(); !slices.Equal(got, tt.want) {
+				t.Errorf("received %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+// polka-sim is a local stand-in for polka, the payment provider: a tiny checkout server that sends
+// signed subscription webhooks to chirpy. the faults of a real provider (duplicates, events out of order,
+// late events) can be injected to see how chirpy copes with them.
+//
+//	go run ./cmd/polka-sim -duplicates 0.3 -reorder 0.3 -delay 5s
+//	curl -X POST localhost:8090/checkout -d user_id=<chirpy user id>
+//
+// or open http://localhost:8090 in a browser
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	// the key is usually in the .env of chirpy, it's optional since it can be passed with -key
+	godotenv.Load()
+
+	addr := flag.String("addr", "localhost:8090", "address of the checkout server")
+	target := flag.String("target", "http://localhost:8080/api/polka/webhooks", "webhook url of chirpy")
+	key := flag.String("key", os.Getenv("POLKA_KEY"), "secret the webhooks are signed with, POLKA_KEY by default")
+	period := flag.Duration("period", 30*24*time.Hour, "length of a billing period, short periods help to test expiry")
+	duplicates := flag.Float64("duplicates", 0, "probability (0 to 1) that an event is sent twice")
+	reorder := flag.Float64("reorder", 0, "probability (0 to 1) that an event is held back and sent after the next one")
+	delay := flag.Duration("delay", 0, "maximum random delay before an event is sent")
+	retries := flag.Int("retries", 3, "retries of an event chirpy doesn't answer with 2xx")
+	seed := flag.Uint64("seed", 0, "seed of the injected faults, random by default")
+	flag.Parse()
+
+	if *key == "" {
+		log.Fatal("make sure you set -key or POLKA_KEY")
+	}
+	if *duplicates < 0 || *duplicates > 1 || *reorder < 0 || *reorder > 1 {
+		log.Fatal("-duplicates and -reorder must be between 0 and 1")
+	}
+	if *seed == 0 {
+		*seed = rand.Uint64()
+	}
+
+	d := newDispatcher(*target, *key, faults{Duplicates: *duplicates, Reorder: *reorder, MaxDelay: *delay}, *retries, *seed)
+	go d.run(context.Background())
+
+	log.Printf("polka checkout on http://%v, sending webhooks to %v (seed %d)", *addr, *target, *seed)
+	log.Fatal(http.ListenAndServe(*addr, newCheckout(d, *period).routes()))
+}
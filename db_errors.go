@@ -0,0 +1,10 @@
+package main
+
+import (
+	"github.com/h0dy/http-server/internal/store"
+)
+
+// isUniqueViolation func reports whether err comes from a unique constraint of the database
+func isUniqueViolation(err error) bool {
+	return store.IsConflict(err)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/auth"
+	"github.com/h0dy/http-server/internal/database"
+	"github.com/h0dy/http-server/internal/mail"
+	"github.com/h0dy/http-server/internal/store"
+)
+
+// accountDeletionGracePeriod is how long a deleted account can be restored before it's purged
+const accountDeletionGracePeriod = 30 * 24 * time.Hour
+
+// handlerDeleteAccount func schedules the deletion of the user's account, the current password is required (a
+// recent provider login for the users without a password). the user is logged out everywhere and can restore the
+// account during the grace period
+func (cfg *apiConfig) handlerDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Password string `json:"password"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	defer r.Body.Close()
+
+	data := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Couldn't decode the json data", err)
+		return
+	}
+
+	userID, claims, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	user, err := cfg.store.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithErr(w, http.StatusNotFound, "Couldn't find the user", err)
+		return
+	}
+	if err := cfg.checkReauthentication(r.Context(), user, data.Password, claims); err != nil {
+		respondWithReauthErr(w, err, "Incorrect password")
+		return
+	}
+	// the users without a password restore their account by logging in with the provider
+	howToRestore := "Restore the account with your email and password before then."
+	if user.HashedPassword == "" {
+		howToRestore = "Restore the account by logging in with your identity provider before then."
+	}
+
+	user, err = cfg.scheduleAccountDeletion(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithErr(w, http.StatusConflict, "The account is already scheduled for deletion", err)
+		return
+	}
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't delete the account", err)
+		return
+	}
+	// access tokens (JWT) of the user, the refresh tokens and personal access tokens are revoked with the deletion
+	if err := cfg.revokeUserTokens(r.Context(), userID); err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't revoke the access tokens", err)
+		return
+	}
+
+	// the deletion is done, a notice that couldn't be sent is only logged
+	if err := cfg.mailer.Send(r.Context(), mail.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy account will be deleted",
+		Body: fmt.Sprintf(
+			"Your Chirpy account and all its data will be deleted on %v.\n\nChanged your mind? %v",
+			user.DeleteAfter.Time.Format(time.RFC1123), howToRestore,
+		),
+	}); err != nil {
+		log.Printf("couldn't send the deletion notice to user %v: %v", userID, err)
+	}
+
+	respondWithJson(w, http.StatusOK, userFromDB(user))
+}
+
+// scheduleAccountDeletion func schedules the deletion of the account and revokes its refresh tokens and personal
+// access tokens, sql.ErrNoRows means it was already scheduled
+func (cfg *apiConfig) scheduleAccountDeletion(ctx context.Context, userID uuid.UUID) (database.User, error) {
+	var user database.User
+	err := cfg.store.InTx(ctx, func(tx store.Store) error {
+		var err error
+		user, err = tx.ScheduleUserDeletion(ctx, database.ScheduleUserDeletionParams{
+			ID:          userID,
+			DeleteAfter: sql.NullTime{Time: time.Now().UTC().Add(accountDeletionGracePeriod), Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		if err := tx.RevokeUserRefreshTokens(ctx, userID); err != nil {
+			return fmt.Errorf("couldn't revoke the refresh tokens: %v", err)
+		}
+		if err := tx.RevokeUserAPITokens(ctx, userID); err != nil {
+			return fmt.Errorf("couldn't revoke the personal access tokens: %v", err)
+		}
+		return nil
+	})
+	return user, err
+}
+
+// handlerRestoreAccount func cancels the deletion of an account during the grace period and logs the user in,
+// personal access tokens revoked by the deletion stay revoked. the users without a password restore their account
+// with a provider login instead, GET /api/login/oidc?restore=true
+func (cfg *apiConfig) handlerRestoreAccount(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	defer r.Body.Close()
+
+	data := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Couldn't decode the json data", err)
+		return
+	}
+
+	user, err := cfg.store.GetUserByEmail(r.Context(), data.Email)
+	if err != nil {
+		respondWithErr(w, http.StatusUnauthorized, "Incorrect credential; incorrect email or password", err)
+		return
+	}
+	if err := auth.CheckPasswordHash(data.Password, user.HashedPassword); err != nil {
+		respondWithErr(w, http.StatusUnauthorized, "Incorrect credential; incorrect email or password", err)
+		return
+	}
+
+	user, err = cfg.store.RestoreUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, "The account isn't scheduled for deletion", err)
+		return
+	}
+	cfg.respondWithLogin(w, r, user)
+}
+
+// purgeDeletedAccounts func deletes the accounts whose grace period is over, everything of the users (chirps,
+// sessions, follows, notifications including the ones about their chirps, data export archives, ...) goes with them
+// through the ON DELETE CASCADE foreign keys. avatars are external urls, so there is no other file to clean up
+func (cfg *apiConfig) purgeDeletedAccounts(ctx context.Context) {
+	purged, err := cfg.store.PurgeDeletedUsers(ctx)
+	if err != nil {
+		log.Printf("error in purging deleted accounts: %v", err)
+		return
+	}
+	if purged > 0 {
+		log.Printf("purged %d deleted accounts", purged)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/auth"
+	"github.com/h0dy/http-server/internal/database"
+)
+
+// roles that admins can assign to users
+var assignableRoles = []string{auth.RoleAdmin, auth.RoleModerator}
+
+// bootstrapAdmin func gives the admin role to the user with the email
+func (cfg *apiConfig) bootstrapAdmin(ctx context.Context, email string) error {
+	user, err := cfg.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	return cfg.store.AssignUserRole(ctx, database.AssignUserRoleParams{
+		UserID: user.ID,
+		Role:   auth.RoleAdmin,
+	})
+}
+
+// handlerAdminGetUsers func lists a page of all the users, it requires the users:manage permission
+func (cfg *apiConfig) handlerAdminGetUsers(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		User
+		Roles []string `json:"roles"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	users, err := cfg.store.GetUsers(r.Context(), database.GetUsersParams{
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve users", err)
+		return
+	}
+
+	usersJson := []response{}
+	for _, user := range users {
+		roles, err := cfg.store.GetUserRoles(r.Context(), user.ID)
+		if err != nil {
+			respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve user roles", err)
+			return
+		}
+		if roles == nil {
+			roles = []string{}
+		}
+		usersJson = append(usersJson, response{
+			User:  userFromDB(user),
+			Roles: roles,
+		})
+	}
+	respondWithJson(w, http.StatusOK, usersJson)
+}
+
+// handlerAdminDeleteUser func deletes a user with all their data, it requires the users:manage permission
+func (cfg *apiConfig) handlerAdminDeleteUser(w http.ResponseWriter, r *http.Request) {
+	userId, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Invalid user id", err)
+		return
+	}
+
+	deleted, err := cfg.store.DeleteUser(r.Context(), userId)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't delete the user", err)
+		return
+	}
+	if deleted == 0 {
+		respondWithErr(w, http.StatusNotFound, "Couldn't find the user", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerAdminAssignRole func gives a role to a user, it requires the users:manage permission.
+// the role shows up in the user's access token the next time it's issued
+func (cfg *apiConfig) handlerAdminAssignRole(w http.ResponseWriter, r *http.Request) {
+	userId, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Invalid user id", err)
+		return
+	}
+	role := r.PathValue("role")
+	if !slices.Contains(assignableRoles, role) {
+		respondWithErr(w, http.StatusBadRequest, "Unknown role", nil)
+		return
+	}
+
+	if err := cfg.store.AssignUserRole(r.Context(), database.AssignUserRoleParams{
+		UserID: userId,
+		Role:   role,
+	}); err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't assign the role", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerAdminRemoveRole func takes a role away from a user, it requires the users:manage permission.
+// the access tokens of the user are revoked so the permissions of the role can't be used anymore
+func (cfg *apiConfig) handlerAdminRemoveRole(w http.ResponseWriter, r *http.Request) {
+	userId, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Invalid user id", err)
+		return
+	}
+
+	// an admin can't lock themselves out
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok {
+		if adminId, err := claims.UserID(); err == nil && adminId == userId && r.PathValue("role") == auth.RoleAdmin {
+			respondWithErr(w, http.StatusBadRequest, "You can't remove your own admin role", nil)
+			return
+		}
+	}
+
+	removed, err := cfg.store.RemoveUserRole(r.Context(), database.RemoveUserRoleParams{
+		UserID: userId,
+		Role:   r.PathValue("role"),
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't remove the role", err)
+		return
+	}
+	if removed == 0 {
+		respondWithErr(w, http.StatusNotFound, "User doesn't have this role", nil)
+		return
+	}
+	// the permissions of the role are in the access tokens of the user, they have to get new ones without them
+	if err := cfg.revokeUserTokens(r.Context(), userId); err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't revoke the access tokens", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/auth"
+	"github.com/h0dy/http-server/internal/database"
+)
+
+const maxAPITokenNameLength = 50
+
+type APIToken struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"` // nil means the token never expires
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+func apiTokenFromDB(apiToken database.ApiToken) APIToken {
+	res := APIToken{
+		ID:        apiToken.ID,
+		CreatedAt: apiToken.CreatedAt,
+		Name:      apiToken.Name,
+		Scopes:    apiToken.Scopes,
+	}
+	if apiToken.ExpiresAt.Valid {
+		res.ExpiresAt = &apiToken.ExpiresAt.Time
+	}
+	if apiToken.LastUsedAt.Valid {
+		res.LastUsedAt = &apiToken.LastUsedAt.Time
+	}
+	return res
+}
+
+// handlerCreateAPIToken func creates a named personal access token for bots and API clients,
+// the token itself is only returned once, only its hash is stored
+func (cfg *apiConfig) handlerCreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	type reqBody struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"` // optional
+	}
+	type response struct {
+		APIToken
+		Token string `json:"token"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	defer r.Body.Close()
+
+	userId, _, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	data := reqBody{}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Couldn't decode the json data", err)
+		return
+	}
+	data.Name = strings.TrimSpace(data.Name)
+	if data.Name == "" || len(data.Name) > maxAPITokenNameLength {
+		respondWithErr(w, http.StatusBadRequest, "Make sure to provide a token name of at most 50 characters", nil)
+		return
+	}
+	if !auth.ValidAPITokenScopes(data.Scopes) {
+		respondWithErr(w, http.StatusBadRequest, "Scopes must be some of: "+strings.Join(auth.APITokenScopes, ", "), nil)
+		return
+	}
+	if data.ExpiresAt != nil && !data.ExpiresAt.After(time.Now()) {
+		respondWithErr(w, http.StatusBadRequest, "Expiry must be in the future", nil)
+		return
+	}
+
+	token, tokenHash := auth.MakeAPIToken()
+	apiToken, err := cfg.store.CreateAPIToken(r.Context(), database.CreateAPITokenParams{
+		UserID:    userId,
+		Name:      data.Name,
+		TokenHash: tokenHash,
+		Scopes:    data.Scopes,
+		ExpiresAt: toNullTime(data.ExpiresAt),
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't create the token", err)
+		return
+	}
+	respondWithJson(w, http.StatusCreated, response{
+		APIToken: apiTokenFromDB(apiToken),
+		Token:    token,
+	})
+}
+
+func (cfg *apiConfig) handlerGetAPITokens(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	apiTokens, err := cfg.store.GetAPITokens(r.Context(), userId)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve tokens", err)
+		return
+	}
+	apiTokensJson := []APIToken{}
+	for _, apiToken := range apiTokens {
+		apiTokensJson = append(apiTokensJson, apiTokenFromDB(apiToken))
+	}
+	respondWithJson(w, http.StatusOK, apiTokensJson)
+}
+
+func (cfg *apiConfig) handlerRevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	tokenId, err := uuid.Parse(r.PathValue("tokenID"))
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Invalid token id", err)
+		return
+	}
+
+	userId, _, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	revoked, err := cfg.store.RevokeAPIToken(r.Context(), database.RevokeAPITokenParams{
+		ID:     tokenId,
+		UserID: userId,
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't revoke the token", err)
+		return
+	}
+	if revoked == 0 {
+		respondWithErr(w, http.StatusNotFound, "Couldn't find the token", sql.ErrNoRows)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
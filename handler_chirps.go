@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"sort"
 	"time"
@@ -10,14 +13,55 @@ import (
 	"github.com/google/uuid"
 	"github.com/h0dy/http-server/internal/auth"
 	"github.com/h0dy/http-server/internal/database"
+	"github.com/h0dy/http-server/internal/store"
 )
 
 type Chirp struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserID    uuid.UUID `json:"user_id"`
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Body      string     `json:"body"`
+	UserID    uuid.UUID  `json:"user_id"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` // only set for chirps in the trash
+	Author    *Author    `json:"author"`
+	Poll      *Poll      `json:"poll,omitempty"`
+}
+
+// chirpsToJson func converts database chirps into their json response, with their author and poll.
+// viewerID is the user making the request (uuid.Nil if anonymous), it decides whether poll results are shown
+func (cfg *apiConfig) chirpsToJson(ctx context.Context, chirps []database.Chirp, viewerID uuid.UUID) ([]Chirp, error) {
+	chirpIDs := make([]uuid.UUID, 0, len(chirps))
+	userIDs := make([]uuid.UUID, 0, len(chirps))
+	for _, chirp := range chirps {
+		chirpIDs = append(chirpIDs, chirp.ID)
+		userIDs = append(userIDs, chirp.UserID)
+	}
+	authors, err := cfg.getAuthors(ctx, userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't retrieve authors: %v", err)
+	}
+	polls, err := cfg.getChirpPolls(ctx, chirpIDs, viewerID)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't retrieve polls: %v", err)
+	}
+
+	chirpsJson := []Chirp{}
+	for _, chirp := range chirps {
+		res := Chirp{
+			ID:        chirp.ID,
+			CreatedAt: chirp.CreatedAt,
+			UpdatedAt: chirp.UpdatedAt,
+			Body:      chirp.Body,
+			UserID:    chirp.UserID,
+			Author:    authors[chirp.UserID],
+			Poll:      polls[chirp.ID],
+		}
+		if chirp.DeletedAt.Valid {
+			res.DeletedAt = &chirp.DeletedAt.Time
+		}
+		chirpsJson = append(chirpsJson, res)
+	}
+	return chirpsJson, nil
 }
 
 // validateChirp func cleans the chirp(text) and validate the chirp if it's longer  than 140 characters
@@ -33,20 +77,16 @@ func validateChirp(body string) (string, error) {
 
 func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request) {
 	type reqBody struct {
-		Body string `json:"body"`
+		Body string      `json:"body"`
+		Poll *pollParams `json:"poll"` // optional
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	defer r.Body.Close()
 
-	authToken, err := auth.GetBearerToken(r.Header) // get the token from the header
-	if err != nil {
-		respondWithErr(w, http.StatusUnauthorized, "Unauthorized", err)
-		return
-	}
-	userId, err := auth.ValidateJWT(authToken, cfg.jwtSecret) // validate the token
+	userId, _, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
 	if err != nil {
-		respondWithErr(w, http.StatusUnauthorized, "Unauthorized", err)
+		respondWithAuthErr(w, err)
 		return
 	}
 
@@ -63,21 +103,46 @@ func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	chirp, err := cfg.db.CreateChirp(r.Context(), database.CreateChirpParams{
-		Body:   cleaned_body,
-		UserID: userId,
+	var pollOptions []string
+	if data.Poll != nil {
+		pollOptions, err = validatePoll(*data.Poll, time.Now().UTC())
+		if err != nil {
+			respondWithErr(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+	}
+
+	// the chirp and its poll are created together
+	var chirp database.Chirp
+	err = cfg.store.InTx(r.Context(), func(tx store.Store) error {
+		chirp, err = tx.CreateChirp(r.Context(), database.CreateChirpParams{
+			Body:   cleaned_body,
+			UserID: userId,
+		})
+		if err != nil {
+			return err
+		}
+		if data.Poll != nil {
+			if err := createPoll(r.Context(), tx, chirp.ID, pollOptions, data.Poll.ClosesAt); err != nil {
+				return err
+			}
+		}
+		if err := enqueueWebhook(r.Context(), tx, userId, webhookChirpCreated, webhookChirpFromDB(chirp)); err != nil {
+			return err
+		}
+		return enqueueMentionWebhooks(r.Context(), tx, chirp)
 	})
 	if err != nil {
 		respondWithErr(w, http.StatusInternalServerError, "Couldn't create chirp", err)
 		return
 	}
-	respondWithJson(w, http.StatusCreated, Chirp{
-		ID:        chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body:      chirp.Body,
-		UserID:    chirp.UserID,
-	})
+
+	chirpsJson, err := cfg.chirpsToJson(r.Context(), []database.Chirp{chirp}, userId)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve the chirp", err)
+		return
+	}
+	respondWithJson(w, http.StatusCreated, chirpsJson[0])
 }
 
 func (cfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
@@ -90,7 +155,7 @@ func (cfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
 		validAuthorId = false
 	}
 
-	chirps, err := cfg.db.GetAllChirps(r.Context(), uuid.NullUUID{
+	chirps, err := cfg.store.GetAllChirps(r.Context(), uuid.NullUUID{
 		UUID:  authorId,
 		Valid: validAuthorId,
 	})
@@ -108,15 +173,10 @@ func (cfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 
-	chirpsJson := []Chirp{}
-	for _, chirp := range chirps {
-		chirpsJson = append(chirpsJson, Chirp{
-			ID:        chirp.ID,
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
-			Body:      chirp.Body,
-			UserID:    chirp.UserID,
-		})
+	chirpsJson, err := cfg.chirpsToJson(r.Context(), chirps, cfg.viewerID(r))
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve chirps", err)
+		return
 	}
 	respondWithJson(w, http.StatusOK, chirpsJson)
 
@@ -130,18 +190,17 @@ func (cfg *apiConfig) handlerGetSingleChirp(w http.ResponseWriter, r *http.Reque
 	}
 	w.Header().Set("Content-Type", "application/json")
 
-	chirp, err := cfg.db.GetChirp(r.Context(), chirpId)
+	chirp, err := cfg.store.GetChirp(r.Context(), chirpId)
 	if err != nil {
 		respondWithErr(w, http.StatusNotFound, "Couldn't retrieve the chirp", err)
 		return
 	}
-	respondWithJson(w, http.StatusOK, Chirp{
-		ID:        chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body:      chirp.Body,
-		UserID:    chirp.UserID,
-	})
+	chirpsJson, err := cfg.chirpsToJson(r.Context(), []database.Chirp{chirp}, cfg.viewerID(r))
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve the chirp", err)
+		return
+	}
+	respondWithJson(w, http.StatusOK, chirpsJson[0])
 }
 
 func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request) {
@@ -151,28 +210,46 @@ func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	accessToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithErr(w, http.StatusUnauthorized, "Unauthorized", err)
-		return
-	}
-
-	userId, err := auth.ValidateJWT(accessToken, cfg.jwtSecret)
+	userId, claims, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
 	if err != nil {
-		respondWithErr(w, http.StatusUnauthorized, "Unauthorized", err)
+		respondWithAuthErr(w, err)
 		return
 	}
 
-	chirp, err := cfg.db.GetChirp(r.Context(), chirpId)
+	chirp, err := cfg.store.GetChirp(r.Context(), chirpId)
 	if err != nil {
-		respondWithErr(w, http.StatusNotFound, "Chirp not found", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithErr(w, http.StatusNotFound, "Chirp not found", err)
+			return
+		}
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve the chirp", err)
 		return
 	}
-	if chirp.UserID != userId {
+	// moderators can delete any chirp, other users only their own
+	if chirp.UserID != userId && !claims.HasScope(auth.PermissionDeleteAnyChirp) {
 		respondWithErr(w, http.StatusForbidden, "chirp owner doesn't match access token's id", err)
 		return
 	}
 
-	cfg.db.DeleteChirpById(r.Context(), chirpId)
+	err = cfg.store.InTx(r.Context(), func(tx store.Store) error {
+		// move the chirp to the trash, the author can restore it until it gets purged unless a moderator deleted it
+		deleted, err := tx.SoftDeleteChirp(r.Context(), database.SoftDeleteChirpParams{ID: chirpId, DeletedBy: userId})
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return sql.ErrNoRows
+		}
+		// the author is told even when a moderator deleted the chirp
+		return enqueueWebhook(r.Context(), tx, chirp.UserID, webhookChirpDeleted, webhookChirpFromDB(chirp))
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithErr(w, http.StatusNotFound, "Chirp not found", err)
+			return
+		}
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't delete the chirp", err)
+		return
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
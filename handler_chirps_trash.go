@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/auth"
+	"github.com/h0dy/http-server/internal/database"
+)
+
+// chirpTrashRetention is how long a deleted chirp stays in the trash before it gets purged
+const chirpTrashRetention = 30 * 24 * time.Hour
+
+// handlerGetTrashedChirps func lists the deleted chirps of the user that can still be restored
+func (cfg *apiConfig) handlerGetTrashedChirps(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _, err := cfg.authenticate(r, auth.ScopeChirpsRead)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	chirps, err := cfg.store.GetTrashedChirps(r.Context(), database.GetTrashedChirpsParams{
+		UserID: userId,
+		Cutoff: time.Now().UTC().Add(-chirpTrashRetention),
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve trashed chirps", err)
+		return
+	}
+
+	chirpsJson, err := cfg.chirpsToJson(r.Context(), chirps, userId)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve trashed chirps", err)
+		return
+	}
+	respondWithJson(w, http.StatusOK, chirpsJson)
+}
+
+// handlerRestoreChirp func moves a chirp of the user out of the trash
+func (cfg *apiConfig) handlerRestoreChirp(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	chirpId, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Invalid chirp id", err)
+		return
+	}
+
+	userId, _, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	chirp, err := cfg.store.RestoreChirp(r.Context(), database.RestoreChirpParams{
+		ID:     chirpId,
+		UserID: userId,
+		Cutoff: time.Now().UTC().Add(-chirpTrashRetention),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithErr(w, http.StatusNotFound, "Couldn't find the chirp in your trash", err)
+			return
+		}
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't restore the chirp", err)
+		return
+	}
+	chirpsJson, err := cfg.chirpsToJson(r.Context(), []database.Chirp{chirp}, userId)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve the chirp", err)
+		return
+	}
+	respondWithJson(w, http.StatusOK, chirpsJson[0])
+}
+
+// purgeTrashedChirps func permanently deletes the chirps that stayed in the trash longer than chirpTrashRetention
+func (cfg *apiConfig) purgeTrashedChirps(ctx context.Context) {
+	purged, err := cfg.store.PurgeTrashedChirps(ctx, time.Now().UTC().Add(-chirpTrashRetention))
+	if err != nil {
+		log.Printf("error in purging trashed chirps: %v", err)
+		return
+	}
+	if purged > 0 {
+		log.Printf("purged %d trashed chirps", purged)
+	}
+}
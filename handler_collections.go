@@ -0,0 +1,372 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/auth"
+	"github.com/h0dy/http-server/internal/database"
+)
+
+const maxCollectionNameLength = 50
+
+type Collection struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Name      string    `json:"name"`
+}
+
+type Bookmark struct {
+	ChirpID      uuid.UUID `json:"chirp_id"`
+	BookmarkedAt time.Time `json:"bookmarked_at"`
+	Available    bool      `json:"available"`       // false once the chirp got deleted
+	Chirp        *Chirp    `json:"chirp,omitempty"` // only set while the chirp is available
+}
+
+// validateCollectionName func trims the name of a collection and checks its length
+func validateCollectionName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("make sure to provide a collection name")
+	}
+	if len(name) > maxCollectionNameLength {
+		return "", errors.New("collection name is too long")
+	}
+	return name, nil
+}
+
+func collectionFromDB(collection database.Collection) Collection {
+	return Collection{
+		ID:        collection.ID,
+		CreatedAt: collection.CreatedAt,
+		UpdatedAt: collection.UpdatedAt,
+		Name:      collection.Name,
+	}
+}
+
+func (cfg *apiConfig) handlerCreateCollection(w http.ResponseWriter, r *http.Request) {
+	type reqBody struct {
+		Name string `json:"name"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	defer r.Body.Close()
+
+	userId, _, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	data := reqBody{}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Couldn't decode the json data", err)
+		return
+	}
+	name, err := validateCollectionName(data.Name)
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	collection, err := cfg.store.CreateCollection(r.Context(), database.CreateCollectionParams{
+		UserID: userId,
+		Name:   name,
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			respondWithErr(w, http.StatusConflict, "You already have a collection with this name", err)
+			return
+		}
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't create collection", err)
+		return
+	}
+	respondWithJson(w, http.StatusCreated, collectionFromDB(collection))
+}
+
+func (cfg *apiConfig) handlerGetCollections(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _, err := cfg.authenticate(r, auth.ScopeChirpsRead)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	collections, err := cfg.store.GetCollections(r.Context(), userId)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve collections", err)
+		return
+	}
+	collectionsJson := []Collection{}
+	for _, collection := range collections {
+		collectionsJson = append(collectionsJson, collectionFromDB(collection))
+	}
+	respondWithJson(w, http.StatusOK, collectionsJson)
+}
+
+func (cfg *apiConfig) handlerRenameCollection(w http.ResponseWriter, r *http.Request) {
+	type reqBody struct {
+		Name string `json:"name"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	defer r.Body.Close()
+
+	collectionId, err := uuid.Parse(r.PathValue("collectionID"))
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Invalid collection id", err)
+		return
+	}
+
+	userId, _, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	data := reqBody{}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Couldn't decode the json data", err)
+		return
+	}
+	name, err := validateCollectionName(data.Name)
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	collection, err := cfg.store.RenameCollection(r.Context(), database.RenameCollectionParams{
+		Name:   name,
+		ID:     collectionId,
+		UserID: userId,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithErr(w, http.StatusNotFound, "Couldn't find the collection", err)
+			return
+		}
+		if isUniqueViolation(err) {
+			respondWithErr(w, http.StatusConflict, "You already have a collection with this name", err)
+			return
+		}
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't rename collection", err)
+		return
+	}
+	respondWithJson(w, http.StatusOK, collectionFromDB(collection))
+}
+
+func (cfg *apiConfig) handlerDeleteCollection(w http.ResponseWriter, r *http.Request) {
+	collectionId, err := uuid.Parse(r.PathValue("collectionID"))
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Invalid collection id", err)
+		return
+	}
+
+	userId, _, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	deleted, err := cfg.store.DeleteCollection(r.Context(), database.DeleteCollectionParams{
+		ID:     collectionId,
+		UserID: userId,
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't delete collection", err)
+		return
+	}
+	if deleted == 0 {
+		respondWithErr(w, http.StatusNotFound, "Couldn't find the collection", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerAddBookmark func bookmarks a chirp into a collection of the user, adding it twice is a no-op
+func (cfg *apiConfig) handlerAddBookmark(w http.ResponseWriter, r *http.Request) {
+	type reqBody struct {
+		ChirpID uuid.UUID `json:"chirp_id"`
+	}
+
+	defer r.Body.Close()
+
+	collectionId, err := uuid.Parse(r.PathValue("collectionID"))
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Invalid collection id", err)
+		return
+	}
+
+	userId, _, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	data := reqBody{}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Couldn't decode the json data", err)
+		return
+	}
+
+	if _, err := cfg.store.GetCollection(r.Context(), database.GetCollectionParams{
+		ID:     collectionId,
+		UserID: userId,
+	}); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithErr(w, http.StatusNotFound, "Couldn't find the collection", err)
+			return
+		}
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve the collection", err)
+		return
+	}
+	if _, err := cfg.store.GetChirp(r.Context(), data.ChirpID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithErr(w, http.StatusNotFound, "Chirp not found", err)
+			return
+		}
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve the chirp", err)
+		return
+	}
+
+	if err := cfg.store.AddBookmark(r.Context(), database.AddBookmarkParams{
+		CollectionID: collectionId,
+		ChirpID:      data.ChirpID,
+	}); err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't add bookmark", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerRemoveBookmark(w http.ResponseWriter, r *http.Request) {
+	collectionId, err := uuid.Parse(r.PathValue("collectionID"))
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Invalid collection id", err)
+		return
+	}
+	chirpId, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Invalid chirp id", err)
+		return
+	}
+
+	userId, _, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	if _, err := cfg.store.GetCollection(r.Context(), database.GetCollectionParams{
+		ID:     collectionId,
+		UserID: userId,
+	}); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithErr(w, http.StatusNotFound, "Couldn't find the collection", err)
+			return
+		}
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve the collection", err)
+		return
+	}
+
+	removed, err := cfg.store.RemoveBookmark(r.Context(), database.RemoveBookmarkParams{
+		CollectionID: collectionId,
+		ChirpID:      chirpId,
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't remove bookmark", err)
+		return
+	}
+	if removed == 0 {
+		respondWithErr(w, http.StatusNotFound, "Couldn't find the bookmark", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerGetBookmarks func lists a page of the bookmarks in a collection, newest first
+func (cfg *apiConfig) handlerGetBookmarks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	collectionId, err := uuid.Parse(r.PathValue("collectionID"))
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Invalid collection id", err)
+		return
+	}
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	userId, _, err := cfg.authenticate(r, auth.ScopeChirpsRead)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	if _, err := cfg.store.GetCollection(r.Context(), database.GetCollectionParams{
+		ID:     collectionId,
+		UserID: userId,
+	}); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithErr(w, http.StatusNotFound, "Couldn't find the collection", err)
+			return
+		}
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve the collection", err)
+		return
+	}
+
+	bookmarks, err := cfg.store.GetBookmarks(r.Context(), database.GetBookmarksParams{
+		CollectionID: collectionId,
+		Limit:        limit,
+		Offset:       offset,
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve bookmarks", err)
+		return
+	}
+
+	availableChirps := []database.Chirp{}
+	for _, bookmark := range bookmarks {
+		if bookmark.Available {
+			availableChirps = append(availableChirps, database.Chirp{
+				ID:        bookmark.ChirpID,
+				CreatedAt: bookmark.ChirpCreatedAt.Time,
+				UpdatedAt: bookmark.ChirpUpdatedAt.Time,
+				Body:      bookmark.Body.String,
+				UserID:    bookmark.UserID.UUID,
+			})
+		}
+	}
+	chirpsJson, err := cfg.chirpsToJson(r.Context(), availableChirps, userId)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve bookmarks", err)
+		return
+	}
+
+	bookmarksJson := []Bookmark{}
+	for _, bookmark := range bookmarks {
+		res := Bookmark{
+			ChirpID:      bookmark.ChirpID,
+			BookmarkedAt: bookmark.BookmarkedAt,
+			Available:    bookmark.Available,
+		}
+		if bookmark.Available {
+			res.Chirp = &chirpsJson[0]
+			chirpsJson = chirpsJson[1:]
+		}
+		bookmarksJson = append(bookmarksJson, res)
+	}
+	respondWithJson(w, http.StatusOK, bookmarksJson)
+}
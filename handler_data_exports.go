@@ -0,0 +1,448 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/auth"
+	"github.com/h0dy/http-server/internal/database"
+	"github.com/h0dy/http-server/internal/mail"
+)
+
+const (
+	dataExportPending = "pending"
+	dataExportReady   = "ready"
+	dataExportFailed  = "failed"
+
+	dataExportRetention = 7 * 24 * time.Hour // how long an archive can be downloaded
+	dataExportLease     = 10 * time.Minute   // longer than a batch can take, an export left pending is generated again after it
+)
+
+// DataExport is an archive of the personal data of the user
+type DataExport struct {
+	ID          uuid.UUID  `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Status      string     `json:"status"` // pending, ready or failed
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at"` // the archive can't be downloaded after this time
+}
+
+func dataExportFromDB(export database.GetDataExportsRow) DataExport {
+	res := DataExport{
+		ID:        export.ID,
+		CreatedAt: export.CreatedAt,
+		Status:    export.Status,
+	}
+	if export.CompletedAt.Valid {
+		res.CompletedAt = &export.CompletedAt.Time
+	}
+	if export.ExpiresAt.Valid {
+		res.ExpiresAt = &export.ExpiresAt.Time
+	}
+	return res
+}
+
+// userData is the personal data of a user, every field is a json file of the export archive
+type userData struct {
+	Profile       exportProfile
+	Chirps        []Chirp
+	Drafts        []ChirpDraft
+	Following     []exportFollow
+	Followers     []exportFollow
+	Bookmarks     []exportBookmark
+	PollVotes     []exportPollVote
+	Notifications []Notification
+	Sessions      []Session
+	APITokens     []APIToken
+	Identities    []exportIdentity
+	Subscription  *exportSubscription // nil if the user never subscribed
+}
+
+type exportProfile struct {
+	User
+	Roles []string `json:"roles"`
+}
+
+type exportFollow struct {
+	UserID     uuid.UUID `json:"user_id"`
+	Handle     string    `json:"handle"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+type exportBookmark struct {
+	Collection   string    `json:"collection"`
+	ChirpID      uuid.UUID `json:"chirp_id"`
+	BookmarkedAt time.Time `json:"bookmarked_at"`
+}
+
+type exportPollVote struct {
+	ChirpID uuid.UUID `json:"chirp_id"`
+	Option  string    `json:"option"`
+	VotedAt time.Time `json:"voted_at"`
+}
+
+type exportSubscription struct {
+	Plan             string     `json:"plan"`
+	Status           string     `json:"status"`
+	CurrentPeriodEnd time.Time  `json:"current_period_end"`
+	CancelAt         *time.Time `json:"cancel_at"`
+}
+
+type exportIdentity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// handlerCreateDataExport func asks for an archive of the user's data, it's generated in the background
+func (cfg *apiConfig) handlerCreateDataExport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	export, err := cfg.store.CreateDataExport(r.Context(), userId)
+	if isUniqueViolation(err) {
+		respondWithErr(w, http.StatusConflict, "An export is already being generated", err)
+		return
+	}
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't create the export", err)
+		return
+	}
+	respondWithJson(w, http.StatusAccepted, dataExportFromDB(database.GetDataExportsRow(export)))
+}
+
+func (cfg *apiConfig) handlerGetDataExports(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	exports, err := cfg.store.GetDataExports(r.Context(), userId)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve the exports", err)
+		return
+	}
+	exportsJson := []DataExport{}
+	for _, export := range exports {
+		exportsJson = append(exportsJson, dataExportFromDB(export))
+	}
+	respondWithJson(w, http.StatusOK, exportsJson)
+}
+
+// handlerDownloadDataExport func downloads the zip archive of an export once it's ready
+func (cfg *apiConfig) handlerDownloadDataExport(w http.ResponseWriter, r *http.Request) {
+	exportId, err := uuid.Parse(r.PathValue("exportID"))
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Invalid export id", err)
+		return
+	}
+
+	userId, _, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	export, err := cfg.store.GetDataExportArchive(r.Context(), database.GetDataExportArchiveParams{
+		ID:     exportId,
+		UserID: userId,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithErr(w, http.StatusNotFound, "Couldn't find the export", err)
+		return
+	}
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve the export", err)
+		return
+	}
+	if status, msg := dataExportUnavailable(export, time.Now().UTC()); status != 0 {
+		respondWithErr(w, status, msg, nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="chirpy-export-%v.zip"`, exportId))
+	w.WriteHeader(http.StatusOK)
+	w.Write(export.Archive)
+}
+
+// dataExportUnavailable func returns the status code and the message of the error when the archive of the export
+// can't be downloaded, 0 when it can. an expired archive is gone even if it wasn't purged yet
+func dataExportUnavailable(export database.GetDataExportArchiveRow, now time.Time) (int, string) {
+	switch {
+	case export.Status == dataExportPending:
+		return http.StatusConflict, "The export isn't ready yet"
+	case export.Status == dataExportFailed:
+		return http.StatusGone, "The export failed; request a new one"
+	case export.ExpiresAt.Valid && !export.ExpiresAt.Time.After(now):
+		return http.StatusGone, "The export expired; request a new one"
+	}
+	return 0, ""
+}
+
+func (cfg *apiConfig) generateDataExports(ctx context.Context) {
+	generated, err := cfg.generateDataExportsBatch(ctx, 10)
+	if err != nil {
+		log.Printf("error in generating data exports: %v", err)
+		return
+	}
+	if generated > 0 {
+		log.Printf("generated %d data exports", generated)
+	}
+}
+
+// generateDataExportsBatch func generates the archives of up to limit pending exports, they're leased so the other
+// servers skip them meanwhile. an export whose data can't be collected is marked as failed
+func (cfg *apiConfig) generateDataExportsBatch(ctx context.Context, limit int32) (int, error) {
+	now := time.Now().UTC()
+	exports, err := cfg.store.ClaimDataExports(ctx, database.ClaimDataExportsParams{
+		LeaseUntil: now.Add(dataExportLease),
+		Now:        now,
+		Limit:      limit,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("couldn't claim pending exports: %v", err)
+	}
+
+	ready := []uuid.UUID{} // users to notify
+	for _, export := range exports {
+		status := dataExportReady
+		archive, err := cfg.buildUserDataArchive(ctx, export.UserID)
+		if err != nil {
+			log.Printf("export %v failed: %v", export.ID, err)
+			status, archive = dataExportFailed, nil
+		}
+		if err := cfg.store.CompleteDataExport(ctx, database.CompleteDataExportParams{
+			ID:        export.ID,
+			Status:    status,
+			Archive:   archive,
+			ExpiresAt: sql.NullTime{Time: time.Now().UTC().Add(dataExportRetention), Valid: true},
+		}); err != nil {
+			return 0, fmt.Errorf("couldn't complete export %v: %v", export.ID, err)
+		}
+		if status == dataExportReady {
+			ready = append(ready, export.UserID)
+		}
+	}
+
+	for _, userID := range ready {
+		user, err := cfg.store.GetUserByID(ctx, userID)
+		if err == nil {
+			err = cfg.mailer.Send(ctx, mail.Message{
+				To:      user.Email,
+				Subject: "Your Chirpy data export is ready",
+				Body:    fmt.Sprintf("The archive of your Chirpy data is ready, you can download it from your account for %v.", dataExportRetention),
+			})
+		}
+		if err != nil {
+			log.Printf("couldn't notify user %v of their data export: %v", userID, err)
+		}
+	}
+	return len(exports), nil
+}
+
+// buildUserDataArchive func collects the personal data of the user into a zip archive
+func (cfg *apiConfig) buildUserDataArchive(ctx context.Context, userID uuid.UUID) ([]byte, error) {
+	data, err := cfg.collectUserData(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return buildExportArchive(data, time.Now().UTC())
+}
+
+// collectUserData func gathers everything stored about the user
+func (cfg *apiConfig) collectUserData(ctx context.Context, userID uuid.UUID) (userData, error) {
+	// empty lists are written as [] rather than null
+	data := userData{
+		Drafts:        []ChirpDraft{},
+		Following:     []exportFollow{},
+		Followers:     []exportFollow{},
+		Bookmarks:     []exportBookmark{},
+		PollVotes:     []exportPollVote{},
+		Notifications: []Notification{},
+		Sessions:      []Session{},
+		APITokens:     []APIToken{},
+		Identities:    []exportIdentity{},
+	}
+
+	user, err := cfg.store.GetUserByID(ctx, userID)
+	if err != nil {
+		return data, fmt.Errorf("couldn't retrieve the user: %v", err)
+	}
+	roles, err := cfg.store.GetUserRoles(ctx, userID)
+	if err != nil {
+		return data, fmt.Errorf("couldn't retrieve the roles: %v", err)
+	}
+	data.Profile = exportProfile{User: userFromDB(user), Roles: roles}
+
+	chirps, err := cfg.store.ExportChirps(ctx, userID)
+	if err != nil {
+		return data, fmt.Errorf("couldn't retrieve the chirps: %v", err)
+	}
+	data.Chirps, err = cfg.chirpsToJson(ctx, chirps, userID)
+	if err != nil {
+		return data, err
+	}
+
+	drafts, err := cfg.store.GetChirpDrafts(ctx, userID)
+	if err != nil {
+		return data, fmt.Errorf("couldn't retrieve the drafts: %v", err)
+	}
+	for _, draft := range drafts {
+		data.Drafts = append(data.Drafts, draftFromDB(draft))
+	}
+
+	following, err := cfg.store.ExportFollowing(ctx, userID)
+	if err != nil {
+		return data, fmt.Errorf("couldn't retrieve the followed users: %v", err)
+	}
+	for _, follow := range following {
+		data.Following = append(data.Following, exportFollow{UserID: follow.ID, Handle: follow.Handle.String, FollowedAt: follow.CreatedAt})
+	}
+	followers, err := cfg.store.ExportFollowers(ctx, userID)
+	if err != nil {
+		return data, fmt.Errorf("couldn't retrieve the followers: %v", err)
+	}
+	for _, follow := range followers {
+		data.Followers = append(data.Followers, exportFollow{UserID: follow.ID, Handle: follow.Handle.String, FollowedAt: follow.CreatedAt})
+	}
+
+	bookmarks, err := cfg.store.ExportBookmarks(ctx, userID)
+	if err != nil {
+		return data, fmt.Errorf("couldn't retrieve the bookmarks: %v", err)
+	}
+	for _, bookmark := range bookmarks {
+		data.Bookmarks = append(data.Bookmarks, exportBookmark{Collection: bookmark.Collection, ChirpID: bookmark.ChirpID, BookmarkedAt: bookmark.CreatedAt})
+	}
+
+	votes, err := cfg.store.ExportPollVotes(ctx, userID)
+	if err != nil {
+		return data, fmt.Errorf("couldn't retrieve the poll votes: %v", err)
+	}
+	for _, vote := range votes {
+		data.PollVotes = append(data.PollVotes, exportPollVote{ChirpID: vote.ChirpID, Option: vote.Option, VotedAt: vote.CreatedAt})
+	}
+
+	notifications, err := cfg.store.ExportNotifications(ctx, userID)
+	if err != nil {
+		return data, fmt.Errorf("couldn't retrieve the notifications: %v", err)
+	}
+	for _, notification := range notifications {
+		data.Notifications = append(data.Notifications, notificationFromDB(notification))
+	}
+
+	sessions, err := cfg.store.GetSessions(ctx, userID)
+	if err != nil {
+		return data, fmt.Errorf("couldn't retrieve the sessions: %v", err)
+	}
+	for _, session := range sessions {
+		data.Sessions = append(data.Sessions, sessionFromDB(session, uuid.Nil))
+	}
+
+	apiTokens, err := cfg.store.GetAPITokens(ctx, userID)
+	if err != nil {
+		return data, fmt.Errorf("couldn't retrieve the personal access tokens: %v", err)
+	}
+	for _, apiToken := range apiTokens {
+		data.APITokens = append(data.APITokens, apiTokenFromDB(apiToken))
+	}
+
+	identities, err := cfg.store.ExportUserIdentities(ctx, userID)
+	if err != nil {
+		return data, fmt.Errorf("couldn't retrieve the linked identities: %v", err)
+	}
+	for _, identity := range identities {
+		data.Identities = append(data.Identities, exportIdentity{
+			Provider:  identity.Provider,
+			Subject:   identity.Subject,
+			Email:     identity.Email,
+			CreatedAt: identity.CreatedAt,
+		})
+	}
+
+	sub, err := cfg.store.GetSubscription(ctx, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return data, fmt.Errorf("couldn't retrieve the subscription: %v", err)
+	}
+	if err == nil {
+		data.Subscription = &exportSubscription{Plan: sub.Plan, Status: sub.Status, CurrentPeriodEnd: sub.CurrentPeriodEnd}
+		if sub.CancelAt.Valid {
+			data.Subscription.CancelAt = &sub.CancelAt.Time
+		}
+	}
+	return data, nil
+}
+
+// buildExportArchive func writes the data as a zip archive of json files, one per kind of data
+func buildExportArchive(data userData, createdAt time.Time) ([]byte, error) {
+	files := []struct {
+		name  string
+		value any
+	}{
+		{"profile.json", data.Profile},
+		{"chirps.json", data.Chirps},
+		{"drafts.json", data.Drafts},
+		{"following.json", data.Following},
+		{"followers.json", data.Followers},
+		{"bookmarks.json", data.Bookmarks},
+		{"poll_votes.json", data.PollVotes},
+		{"notifications.json", data.Notifications},
+		{"sessions.json", data.Sessions},
+		{"api_tokens.json", data.APITokens},
+		{"identities.json", data.Identities},
+		{"subscription.json", data.Subscription},
+	}
+
+	buf := bytes.Buffer{}
+	archive := zip.NewWriter(&buf)
+	for _, file := range files {
+		content, err := json.MarshalIndent(file.value, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("couldn't encode %v: %v", file.name, err)
+		}
+		writer, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     file.name,
+			Method:   zip.Deflate,
+			Modified: createdAt,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := writer.Write(content); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (cfg *apiConfig) purgeExpiredDataExports(ctx context.Context) {
+	purged, err := cfg.store.PurgeExpiredDataExports(ctx)
+	if err != nil {
+		log.Printf("error in purging expired data exports: %v", err)
+		return
+	}
+	if purged > 0 {
+		log.Printf("purged %d expired data exports", purged)
+	}
+}
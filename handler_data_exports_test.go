@@ -0,0 +1,110 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/database"
+)
+
+func TestBuildExportArchive(t *testing.T) {
+	createdAt := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	userID := uuid.New()
+	data := userData{
+		Profile: exportProfile{User: User{ID: userID, Email: "user@example.com"}, Roles: []string{"admin"}},
+		Chirps:  []Chirp{{ID: uuid.New(), Body: "first chirp", UserID: userID}},
+		Drafts:  []ChirpDraft{},
+	}
+
+	archive, err := buildExportArchive(data, createdAt)
+	if err != nil {
+		t.Fatalf("buildExportArchive() error = %v", err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("the archive isn't a valid zip: %v", err)
+	}
+
+	files := map[string][]byte{}
+	names := []string{}
+	for _, file := range reader.File {
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatalf("couldn't open %v: %v", file.Name, err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("couldn't read %v: %v", file.Name, err)
+		}
+		if !file.Modified.Equal(createdAt) {
+			t.Errorf("%v modified at %v, want %v", file.Name, file.Modified, createdAt)
+		}
+		files[file.Name] = content
+		names = append(names, file.Name)
+	}
+
+	expected := []string{
+		"profile.json", "chirps.json", "drafts.json", "following.json", "followers.json", "bookmarks.json",
+		"poll_votes.json", "notifications.json", "sessions.json", "api_tokens.json", "identities.json",
+		"subscription.json",
+	}
+	if !slices.Equal(names, expected) {
+		t.Fatalf("archive files = %v, want %v", names, expected)
+	}
+
+	profile := exportProfile{}
+	if err := json.Unmarshal(files["profile.json"], &profile); err != nil {
+		t.Fatalf("couldn't decode profile.json: %v", err)
+	}
+	if profile.ID != userID || profile.Email != "user@example.com" || !slices.Equal(profile.Roles, []string{"admin"}) {
+		t.Errorf("profile.json = %+v, want the profile of the user", profile)
+	}
+
+	chirps := []Chirp{}
+	if err := json.Unmarshal(files["chirps.json"], &chirps); err != nil {
+		t.Fatalf("couldn't decode chirps.json: %v", err)
+	}
+	if len(chirps) != 1 || chirps[0].Body != "first chirp" {
+		t.Errorf("chirps.json = %+v, want the chirp of the user", chirps)
+	}
+
+	if got := string(files["drafts.json"]); got != "[]" {
+		t.Errorf("drafts.json = %v, want []", got)
+	}
+	if got := string(files["subscription.json"]); got != "null" {
+		t.Errorf("subscription.json = %v, want null for a user who never subscribed", got)
+	}
+}
+
+func TestDataExportUnavailable(t *testing.T) {
+	now := time.Date(2025, 1, 8, 12, 0, 0, 0, time.UTC)
+	expiresAt := func(t time.Time) sql.NullTime { return sql.NullTime{Time: t, Valid: true} }
+	tests := []struct {
+		name       string
+		export     database.GetDataExportArchiveRow
+		wantStatus int
+	}{
+		{name: "Ready", export: database.GetDataExportArchiveRow{Status: dataExportReady, ExpiresAt: expiresAt(now.Add(time.Hour))}},
+		{name: "Pending", export: database.GetDataExportArchiveRow{Status: dataExportPending}, wantStatus: http.StatusConflict},
+		{name: "Failed", export: database.GetDataExportArchiveRow{Status: dataExportFailed, ExpiresAt: expiresAt(now.Add(time.Hour))}, wantStatus: http.StatusGone},
+		{name: "Expired, not purged yet", export: database.GetDataExportArchiveRow{Status: dataExportReady, ExpiresAt: expiresAt(now.Add(-time.Hour))}, wantStatus: http.StatusGone},
+		{name: "Expiring now", export: database.GetDataExportArchiveRow{Status: dataExportReady, ExpiresAt: expiresAt(now)}, wantStatus: http.StatusGone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, msg := dataExportUnavailable(tt.export, now); status != tt.wantStatus {
+				t.Errorf("dataExportUnavailable() = %d %q, want %d", status, msg, tt.wantStatus)
+			}
+		})
+	}
+}
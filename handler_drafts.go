@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/auth"
+	"github.com/h0dy/http-server/internal/database"
+	"github.com/h0dy/http-server/internal/store"
+)
+
+type ChirpDraft struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Body      string     `json:"body"`
+	UserID    uuid.UUID  `json:"user_id"`
+	PublishAt *time.Time `json:"publish_at"` // nil means the draft isn't scheduled
+}
+
+// draftFromDB func converts a database draft into its json response
+func draftFromDB(draft database.ChirpDraft) ChirpDraft {
+	res := ChirpDraft{
+		ID:        draft.ID,
+		CreatedAt: draft.CreatedAt,
+		UpdatedAt: draft.UpdatedAt,
+		Body:      draft.Body,
+		UserID:    draft.UserID,
+	}
+	if draft.PublishAt.Valid {
+		res.PublishAt = &draft.PublishAt.Time
+	}
+	return res
+}
+
+// toNullTime func converts an optional time into sql.NullTime
+func toNullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+func (cfg *apiConfig) handlerCreateDraft(w http.ResponseWriter, r *http.Request) {
+	type reqBody struct {
+		Body      string     `json:"body"`
+		PublishAt *time.Time `json:"publish_at"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	defer r.Body.Close()
+
+	userId, _, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	data := reqBody{}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Couldn't decode the json data", err)
+		return
+	}
+	// reject a draft early if it couldn't be published as a chirp
+	if _, err := validateChirp(data.Body); err != nil {
+		respondWithErr(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	draft, err := cfg.store.CreateChirpDraft(r.Context(), database.CreateChirpDraftParams{
+		Body:      data.Body,
+		UserID:    userId,
+		PublishAt: toNullTime(data.PublishAt),
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't create draft", err)
+		return
+	}
+	respondWithJson(w, http.StatusCreated, draftFromDB(draft))
+}
+
+func (cfg *apiConfig) handlerGetDrafts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _, err := cfg.authenticate(r, auth.ScopeChirpsRead)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	drafts, err := cfg.store.GetChirpDrafts(r.Context(), userId)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve drafts", err)
+		return
+	}
+
+	draftsJson := []ChirpDraft{}
+	for _, draft := range drafts {
+		draftsJson = append(draftsJson, draftFromDB(draft))
+	}
+	respondWithJson(w, http.StatusOK, draftsJson)
+}
+
+func (cfg *apiConfig) handlerUpdateDraft(w http.ResponseWriter, r *http.Request) {
+	type reqBody struct {
+		Body      string     `json:"body"`
+		PublishAt *time.Time `json:"publish_at"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	defer r.Body.Close()
+
+	draftId, err := uuid.Parse(r.PathValue("draftID"))
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Invalid draft id", err)
+		return
+	}
+
+	userId, _, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	data := reqBody{}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Couldn't decode the json data", err)
+		return
+	}
+	if _, err := validateChirp(data.Body); err != nil {
+		respondWithErr(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	draft, err := cfg.store.UpdateChirpDraft(r.Context(), database.UpdateChirpDraftParams{
+		Body:      data.Body,
+		PublishAt: toNullTime(data.PublishAt),
+		ID:        draftId,
+		UserID:    userId,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithErr(w, http.StatusNotFound, "Couldn't find the draft", err)
+			return
+		}
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't update draft", err)
+		return
+	}
+	respondWithJson(w, http.StatusOK, draftFromDB(draft))
+}
+
+func (cfg *apiConfig) handlerDeleteDraft(w http.ResponseWriter, r *http.Request) {
+	draftId, err := uuid.Parse(r.PathValue("draftID"))
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Invalid draft id", err)
+		return
+	}
+
+	userId, _, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	deleted, err := cfg.store.DeleteChirpDraft(r.Context(), database.DeleteChirpDraftParams{
+		ID:     draftId,
+		UserID: userId,
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't delete draft", err)
+		return
+	}
+	if deleted == 0 {
+		respondWithErr(w, http.StatusNotFound, "Couldn't find the draft", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// publishDueDrafts func publishes the scheduled drafts that are due.
+// due drafts are locked with SKIP LOCKED, so several server instances never publish the same draft
+func (cfg *apiConfig) publishDueDrafts(ctx context.Context) {
+	published, rejected, err := cfg.publishDueDraftsBatch(ctx, 100)
+	if err != nil {
+		log.Printf("error in publishing scheduled drafts: %v", err)
+		return
+	}
+	for _, draft := range rejected {
+		log.Printf("draft %v of user %v can't be published, it was unscheduled: %v", draft.ID, draft.UserID, draft.Err)
+	}
+	if published > 0 {
+		log.Printf("published %d scheduled drafts", published)
+	}
+}
+
+// publishDueDraftsBatch func publishes up to limit due drafts in a single transaction
+func (cfg *apiConfig) publishDueDraftsBatch(ctx context.Context, limit int32) (int, []rejectedDraft, error) {
+	var (
+		published int
+		rejected  []rejectedDraft
+	)
+	err := cfg.store.InTx(ctx, func(tx store.Store) error {
+		var err error
+		published, rejected, err = publishDrafts(ctx, tx, limit, time.Now().UTC())
+		return err
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return published, rejected, nil
+}
+
+// draftPublisher are the queries publishing drafts needs, the ones of the store in the transaction of the batch
+type draftPublisher interface {
+	GetDueChirpDrafts(ctx context.Context, arg database.GetDueChirpDraftsParams) ([]database.ChirpDraft, error)
+	UnscheduleChirpDraft(ctx context.Context, id uuid.UUID) error
+	CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error)
+	DeletePublishedChirpDraft(ctx context.Context, id uuid.UUID) error
+	mentionWebhooks
+}
+
+// rejectedDraft is a due draft that failed the validation of chirps, it's unscheduled instead of published
+type rejectedDraft struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+	Err    error
+}
+
+// publishDrafts func publishes up to limit drafts due at now as chirps, the drafts that fail validation are
+// unscheduled and returned so they can be reported
+func publishDrafts(ctx context.Context, q draftPublisher, limit int32, now time.Time) (int, []rejectedDraft, error) {
+	drafts, err := q.GetDueChirpDrafts(ctx, database.GetDueChirpDraftsParams{
+		Now:       now,
+		MaxDrafts: limit,
+	})
+	if err != nil {
+		return 0, nil, fmt.Errorf("couldn't retrieve due drafts: %v", err)
+	}
+
+	published := 0
+	var rejected []rejectedDraft
+	for _, draft := range drafts {
+		// same validation as handlerCreateChirp
+		cleanedBody, err := validateChirp(draft.Body)
+		if err != nil {
+			if err := q.UnscheduleChirpDraft(ctx, draft.ID); err != nil {
+				return 0, nil, fmt.Errorf("couldn't unschedule draft %v: %v", draft.ID, err)
+			}
+			rejected = append(rejected, rejectedDraft{ID: draft.ID, UserID: draft.UserID, Err: err})
+			continue
+		}
+		chirp, err := q.CreateChirp(ctx, database.CreateChirpParams{
+			Body:   cleanedBody,
+			UserID: draft.UserID,
+		})
+		if err != nil {
+			return 0, nil, fmt.Errorf("couldn't publish draft %v: %v", draft.ID, err)
+		}
+		if err := enqueueWebhook(ctx, q, draft.UserID, webhookChirpCreated, webhookChirpFromDB(chirp)); err != nil {
+			return 0, nil, err
+		}
+		if err := enqueueMentionWebhooks(ctx, q, chirp); err != nil {
+			return 0, nil, err
+		}
+		if err := q.DeletePublishedChirpDraft(ctx, draft.ID); err != nil {
+			return 0, nil, fmt.Errorf("couldn't delete published draft %v: %v", draft.ID, err)
+		}
+		published++
+	}
+	return published, rejected, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/database"
+)
+
+// fakeDraftPublisher keeps the drafts, chirps and queued webhooks like the postgres queries would
+type fakeDraftPublisher struct {
+	drafts   []database.ChirpDraft
+	chirps   []database.Chirp
+	handles  map[string]uuid.UUID // lowercased handles of the users
+	webhooks []string
+}
+
+func (f *fakeDraftPublisher) GetDueChirpDrafts(ctx context.Context, arg database.GetDueChirpDraftsParams) ([]database.ChirpDraft, error) {
+	var due []database.ChirpDraft
+	for _, draft := range f.drafts {
+		if draft.PublishAt.Valid && !draft.PublishAt.Time.After(arg.Now) && len(due) < int(arg.MaxDrafts) {
+			due = append(due, draft)
+		}
+	}
+	return due, nil
+}
+
+func (f *fakeDraftPublisher) UnscheduleChirpDraft(ctx context.Context, id uuid.UUID) error {
+	for i := range f.drafts {
+		if f.drafts[i].ID == id {
+			f.drafts[i].PublishAt = sql.NullTime{}
+		}
+	}
+	return nil
+}
+
+func (f *fakeDraftPublisher) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	chirp := database.Chirp{ID: uuid.New(), Body: arg.Body, UserID: arg.UserID}
+	f.chirps = append(f.chirps, chirp)
+	return chirp, nil
+}
+
+func (f *fakeDraftPublisher) DeletePublishedChirpDraft(ctx context.Context, id uuid.UUID) error {
+	f.drafts = slices.DeleteFunc(f.drafts, func(draft database.ChirpDraft) bool { return draft.ID == id })
+	return nil
+}
+
+func (f *fakeDraftPublisher) GetProfileByHandle(ctx context.Context, handle string) (database.GetProfileByHandleRow, error) {
+	id, ok := f.handles[strings.ToLower(handle)]
+	if !ok {
+		return database.GetProfileByHandleRow{}, sql.ErrNoRows
+	}
+	return database.GetProfileByHandleRow{ID: id, Handle: sql.NullString{String: handle, Valid: true}}, nil
+}
+
+func (f *fakeDraftPublisher) CreateWebhookDeliveries(ctx context.Context, arg database.CreateWebhookDeliveriesParams) (int64, error) {
+	f.webhooks = append(f.webhooks, arg.Event)
+	return 1, nil
+}
+
+func TestPublishDrafts(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	userID := uuid.New()
+	draft := func(body string, publishAt time.Time) database.ChirpDraft {
+		return database.ChirpDraft{
+			ID:        uuid.New(),
+			Body:      body,
+			UserID:    userID,
+			PublishAt: sql.NullTime{Time: publishAt, Valid: true},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		draft         database.ChirpDraft
+		wantChirp     string // body of the published chirp, empty when nothing is published
+		wantWebhooks  []string
+		wantRejected  bool
+		wantScheduled bool // the draft is still there and scheduled
+	}{
+		{
+			name:         "Due draft",
+			draft:        draft("see you tomorrow", now.Add(-time.Minute)),
+			wantChirp:    "see you tomorrow",
+			wantWebhooks: []string{webhookChirpCreated},
+		},
+		{
+			name:         "Due draft mentioning a user",
+			draft:        draft("see you tomorrow @Chirper and @nobody", now.Add(-time.Minute)),
+			wantChirp:    "see you tomorrow @Chirper and @nobody",
+			wantWebhooks: []string{webhookChirpCreated, webhookChirpMentioned},
+		},
+		{
+			name:         "Due draft with a profane word",
+			draft:        draft("what a kerfuffle", now),
+			wantChirp:    "what a ****",
+			wantWebhooks: []string{webhookChirpCreated},
+		},
+		{
+			name:         "Too long",
+			draft:        draft(strings.Repeat("a", 141), now.Add(-time.Minute)),
+			wantRejected: true,
+		},
+		{
+			name:          "Scheduled later",
+			draft:         draft("not yet", now.Add(time.Minute)),
+			wantScheduled: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &fakeDraftPublisher{drafts: []database.ChirpDraft{tt.draft}, handles: map[string]uuid.UUID{"chirper": uuid.New()}}
+			published, rejected, err := publishDrafts(context.Background(), q, 100, now)
+			if err != nil {
+				t.Fatalf("publishDrafts() error = %v", err)
+			}
+
+			if tt.wantChirp != "" {
+				if published != 1 || len(q.chirps) != 1 || q.chirps[0].Body != tt.wantChirp || q.chirps[0].UserID != userID {
+					t.Errorf("publishDrafts() published %d chirps %+v, want %q", published, q.chirps, tt.wantChirp)
+				}
+				if !slices.Equal(q.webhooks, tt.wantWebhooks) {
+					t.Errorf("queued webhooks = %v, want %v", q.webhooks, tt.wantWebhooks)
+				}
+				if len(q.drafts) != 0 {
+					t.Errorf("the published draft wasn't deleted: %+v", q.drafts)
+				}
+				return
+			}
+
+			if published != 0 || len(q.chirps) != 0 || len(q.webhooks) != 0 {
+				t.Errorf("publishDrafts() published %d chirps %+v with webhooks %v, want none", published, q.chirps, q.webhooks)
+			}
+			if gotRejected := len(rejected) == 1 && rejected[0].ID == tt.draft.ID && rejected[0].Err != nil; gotRejected != tt.wantRejected {
+				t.Errorf("publishDrafts() rejected = %+v, want rejected %v", rejected, tt.wantRejected)
+			}
+			if len(q.drafts) != 1 || q.drafts[0].PublishAt.Valid != tt.wantScheduled {
+				t.Errorf("drafts = %+v, want the draft kept with scheduled %v", q.drafts, tt.wantScheduled)
+			}
+		})
+	}
+}
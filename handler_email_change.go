@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/auth"
+	"github.com/h0dy/http-server/internal/database"
+	"github.com/h0dy/http-server/internal/mail"
+	"github.com/h0dy/http-server/internal/store"
+)
+
+const (
+	emailConfirmExpiry = 24 * time.Hour     // the new address has a day to confirm the change
+	emailUndoExpiry    = 7 * 24 * time.Hour // the old address can undo the change for a week
+)
+
+// requestEmailChange func records a change of the user's email and sends a confirmation link to the new address,
+// and a notice with a link to undo the change to the old one
+func (cfg *apiConfig) requestEmailChange(ctx context.Context, user database.User, newEmail string) error {
+	confirmToken := auth.MarkRefreshToken()
+	undoToken := auth.MarkRefreshToken()
+
+	err := cfg.store.InTx(ctx, func(tx store.Store) error {
+		if err := tx.CancelEmailChanges(ctx, user.ID); err != nil {
+			return fmt.Errorf("couldn't cancel the pending email changes: %v", err)
+		}
+		now := time.Now().UTC()
+		if _, err := tx.CreateEmailChange(ctx, database.CreateEmailChangeParams{
+			UserID:           user.ID,
+			OldEmail:         user.Email,
+			NewEmail:         newEmail,
+			ConfirmTokenHash: auth.HashToken(confirmToken),
+			UndoTokenHash:    auth.HashToken(undoToken),
+			ExpiresAt:        now.Add(emailConfirmExpiry),
+			UndoExpiresAt:    now.Add(emailUndoExpiry),
+		}); err != nil {
+			return fmt.Errorf("couldn't create the email change: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := cfg.mailer.Send(ctx, mail.Message{
+		To:      newEmail,
+		Subject: "Confirm your new Chirpy email",
+		Body: fmt.Sprintf(
+			"Someone asked to use this address for the Chirpy account %v.\n\n"+
+				"Confirm the change within %v by opening:\n%v\n\n"+
+				"If it wasn't you, ignore this email.",
+			user.Email, emailConfirmExpiry, cfg.emailChangeLink("confirm", confirmToken),
+		),
+	}); err != nil {
+		return fmt.Errorf("couldn't send the confirmation to the new email: %v", err)
+	}
+	if err := cfg.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy email is being changed",
+		Body: fmt.Sprintf(
+			"Someone asked to change the email of your Chirpy account to %v.\n\n"+
+				"If it wasn't you, undo the change, choose a new password and log out every device by opening:\n%v\n\n"+
+				"The link works for %v, even after the new email is confirmed.",
+			newEmail, cfg.emailChangeLink("undo", undoToken), emailUndoExpiry,
+		),
+	}); err != nil {
+		return fmt.Errorf("couldn't send the notice to the old email: %v", err)
+	}
+	return nil
+}
+
+// emailChangeLink func returns the link of the page confirming or undoing an email change
+func (cfg *apiConfig) emailChangeLink(action, token string) string {
+	query := url.Values{"action": {action}, "token": {token}}
+	return cfg.baseURL + "/app/account/email.html?" + query.Encode()
+}
+
+// handlerConfirmEmailChange func replaces the email of the user with the new one, the token of the confirmation link
+// proves the user owns the new address
+func (cfg *apiConfig) handlerConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	defer r.Body.Close()
+
+	data := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Couldn't decode the json data", err)
+		return
+	}
+
+	var user database.User
+	err := cfg.store.InTx(r.Context(), func(tx store.Store) error {
+		change, err := tx.ConfirmEmailChange(r.Context(), auth.HashToken(data.Token))
+		if err != nil {
+			return err
+		}
+		user, err = tx.UpdateUserEmail(r.Context(), database.UpdateUserEmailParams{
+			ID:    change.UserID,
+			Email: change.NewEmail,
+		})
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithErr(w, http.StatusNotFound, "The link is invalid or expired", err)
+		return
+	}
+	if isUniqueViolation(err) {
+		respondWithErr(w, http.StatusConflict, "Email is already in use", err)
+		return
+	}
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't confirm the email change", err)
+		return
+	}
+	respondWithJson(w, http.StatusOK, userFromDB(user))
+}
+
+// handlerUndoEmailChange func cancels an email change from the link sent to the old address, the old email is
+// restored if the change was already confirmed. the account may have been taken over, so its password is replaced
+// with a new one, every device is logged out and the api tokens and refresh tokens of the apps are revoked
+func (cfg *apiConfig) handlerUndoEmailChange(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"` // the new password, whoever made the change may know the current one
+	}
+
+	type response struct {
+		User
+		RevokedSessions int64 `json:"revoked_sessions"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	defer r.Body.Close()
+
+	data := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Couldn't decode the json data", err)
+		return
+	}
+	if data.Password == "" {
+		respondWithErr(w, http.StatusBadRequest, "Make sure to provide a new password", nil)
+		return
+	}
+
+	var (
+		change      database.EmailChange
+		user        database.User
+		sessionIDs  []uuid.UUID
+		passwordErr error // the new password is checked against the old email, which the change holds
+	)
+	err := cfg.store.InTx(r.Context(), func(tx store.Store) error {
+		var err error
+		change, err = tx.UndoEmailChange(r.Context(), auth.HashToken(data.Token))
+		if err != nil {
+			return err
+		}
+		if passwordErr = auth.ValidatePassword(data.Password, change.OldEmail); passwordErr != nil {
+			return passwordErr
+		}
+		hashedPassword, err := auth.HashPasswordWithParams(data.Password, cfg.passwordParams)
+		if err != nil {
+			return fmt.Errorf("couldn't hash the password: %v", err)
+		}
+		// changes requested after this one (maybe by the same person) are cancelled too
+		if err := tx.CancelEmailChanges(r.Context(), change.UserID); err != nil {
+			return fmt.Errorf("couldn't cancel the email changes: %v", err)
+		}
+		user, err = tx.ChangeUserPassword(r.Context(), database.ChangeUserPasswordParams{
+			ID:             change.UserID,
+			HashedPassword: hashedPassword,
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't change the password: %w", err)
+		}
+		sessionIDs, err = tx.RevokeOtherSessions(r.Context(), database.RevokeOtherSessionsParams{UserID: change.UserID, CurrentID: uuid.Nil})
+		if err != nil {
+			return fmt.Errorf("couldn't revoke the sessions: %v", err)
+		}
+		if err := tx.RevokeUserRefreshTokens(r.Context(), change.UserID); err != nil { // the ones given to oauth clients
+			return fmt.Errorf("couldn't revoke the refresh tokens: %v", err)
+		}
+		if err := tx.RevokeUserAPITokens(r.Context(), change.UserID); err != nil {
+			return fmt.Errorf("couldn't revoke the api tokens: %v", err)
+		}
+		if change.ConfirmedAt.Valid {
+			user, err = tx.UpdateUserEmail(r.Context(), database.UpdateUserEmailParams{
+				ID:    change.UserID,
+				Email: change.OldEmail,
+			})
+			if err != nil {
+				return fmt.Errorf("couldn't restore the email: %w", err)
+			}
+		}
+		return nil
+	})
+	if passwordErr != nil {
+		respondWithErr(w, http.StatusBadRequest, passwordErr.Error(), passwordErr)
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithErr(w, http.StatusNotFound, "The link is invalid or expired", err)
+		return
+	}
+	if isUniqueViolation(err) {
+		respondWithErr(w, http.StatusConflict, "The old email is now used by another account", err)
+		return
+	}
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't undo the email change", err)
+		return
+	}
+
+	// every access token issued so far, of the sessions and of the apps
+	if err := cfg.revokeUserTokens(r.Context(), change.UserID); err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't revoke the access tokens", err)
+		return
+	}
+	respondWithJson(w, http.StatusOK, response{User: userFromDB(user), RevokedSessions: int64(len(sessionIDs))})
+}
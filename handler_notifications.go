@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/auth"
+	"github.com/h0dy/http-server/internal/database"
+)
+
+const notificationsPageSize = 50
+
+type Notification struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	Kind      string     `json:"kind"` // e.g. poll_closed
+	ChirpID   *uuid.UUID `json:"chirp_id,omitempty"`
+	Read      bool       `json:"read"`
+}
+
+func notificationFromDB(notification database.Notification) Notification {
+	res := Notification{
+		ID:        notification.ID,
+		CreatedAt: notification.CreatedAt,
+		Kind:      notification.Kind,
+		Read:      notification.ReadAt.Valid,
+	}
+	if notification.ChirpID.Valid {
+		res.ChirpID = &notification.ChirpID.UUID
+	}
+	return res
+}
+
+// handlerGetNotifications func lists the latest notifications of the user
+func (cfg *apiConfig) handlerGetNotifications(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _, err := cfg.authenticate(r, auth.ScopeChirpsRead)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	notifications, err := cfg.store.GetNotifications(r.Context(), database.GetNotificationsParams{
+		UserID: userId,
+		Limit:  notificationsPageSize,
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve notifications", err)
+		return
+	}
+
+	notificationsJson := []Notification{}
+	for _, notification := range notifications {
+		notificationsJson = append(notificationsJson, notificationFromDB(notification))
+	}
+	respondWithJson(w, http.StatusOK, notificationsJson)
+}
+
+// handlerReadNotifications func marks all the notifications of the user as read
+func (cfg *apiConfig) handlerReadNotifications(w http.ResponseWriter, r *http.Request) {
+	userId, _, err := cfg.authenticate(r, auth.ScopeChirpsRead)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	if err := cfg.store.MarkNotificationsRead(r.Context(), userId); err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't update notifications", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/auth"
+	"github.com/h0dy/http-server/internal/database"
+	"github.com/h0dy/http-server/internal/store"
+)
+
+const (
+	oauthCodeExpiry         = 10 * time.Minute
+	oauthAccessTokenExpiry  = accessTokenExpiry
+	oauthRefreshTokenExpiry = 60 * 24 * time.Hour
+	oauthConsentPage        = "/app/oauth/consent.html"
+)
+
+// oauthError is the error shape of the oauth endpoints, https://datatracker.ietf.org/doc/html/rfc6749#section-5.2
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *oauthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// respondWithOAuthServerErr func responds with a server_error, the error itself (driver or database details) is only logged
+func respondWithOAuthServerErr(w http.ResponseWriter, err error) {
+	log.Printf("oauth server error: %v", err)
+	respondWithOAuthErr(w, http.StatusInternalServerError, &oauthError{"server_error", "the server couldn't complete the request"})
+}
+
+func respondWithOAuthErr(w http.ResponseWriter, code int, err *oauthError) {
+	log.Println(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJson(w, code, err)
+}
+
+// authorizationParams are the parameters of an authorization request, https://datatracker.ietf.org/doc/html/rfc6749#section-4.1.1
+type authorizationParams struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"` // space separated
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+}
+
+// validateAuthorization func checks an authorization request and returns the client and the requested scopes.
+// a nil client means the redirect uri can't be trusted, so the error must not be sent to it
+func (cfg *apiConfig) validateAuthorization(ctx context.Context, params authorizationParams) (*database.OauthClient, []string, *oauthError) {
+	client, err := cfg.store.GetOAuthClient(ctx, params.ClientID)
+	if err != nil {
+		return nil, nil, &oauthError{"invalid_client", "unknown client_id"}
+	}
+	if !slices.Contains(client.RedirectUris, params.RedirectURI) {
+		return nil, nil, &oauthError{"invalid_request", "redirect_uri isn't registered for this client"}
+	}
+
+	if params.ResponseType != "code" {
+		return &client, nil, &oauthError{"unsupported_response_type", "only the code response type is supported"}
+	}
+	if params.CodeChallenge == "" || params.CodeChallengeMethod != auth.PKCEMethodS256 {
+		return &client, nil, &oauthError{"invalid_request", "a S256 code_challenge is required (PKCE)"}
+	}
+	scopes := strings.Fields(params.Scope)
+	if !auth.ValidAPITokenScopes(scopes) {
+		return &client, nil, &oauthError{"invalid_scope", "scope must be some of: " + strings.Join(auth.APITokenScopes, " ")}
+	}
+	return &client, scopes, nil
+}
+
+// oauthRedirect func builds the redirect uri of the client with the query parameters
+func oauthRedirect(redirectURI string, query url.Values) string {
+	parsed, _ := url.Parse(redirectURI) // registered redirect uris are already validated
+	values := parsed.Query()
+	for key := range query {
+		values.Set(key, query.Get(key))
+	}
+	parsed.RawQuery = values.Encode()
+	return parsed.String()
+}
+
+// handlerOAuthAuthorize func is where third-party apps send the user, a valid request is forwarded to the consent page
+func (cfg *apiConfig) handlerOAuthAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	params := authorizationParams{
+		ResponseType:        query.Get("response_type"),
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	}
+
+	client, _, oauthErr := cfg.validateAuthorization(r.Context(), params)
+	if oauthErr != nil {
+		if client == nil {
+			respondWithOAuthErr(w, http.StatusBadRequest, oauthErr)
+			return
+		}
+		http.Redirect(w, r, oauthRedirect(params.RedirectURI, url.Values{
+			"error":             {oauthErr.Code},
+			"error_description": {oauthErr.Description},
+			"state":             {params.State},
+		}), http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, oauthConsentPage+"?"+query.Encode(), http.StatusFound)
+}
+
+// handlerOAuthConsent func records the decision of the logged in user on the consent page,
+// it returns where the browser has to go next (the redirect uri with a code or an error)
+func (cfg *apiConfig) handlerOAuthConsent(w http.ResponseWriter, r *http.Request) {
+	type reqBody struct {
+		authorizationParams
+		Approved bool `json:"approved"`
+	}
+	type response struct {
+		RedirectTo string `json:"redirect_to"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	defer r.Body.Close()
+
+	userId, _, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	data := reqBody{}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Couldn't decode the json data", err)
+		return
+	}
+
+	client, scopes, oauthErr := cfg.validateAuthorization(r.Context(), data.authorizationParams)
+	if oauthErr != nil {
+		respondWithOAuthErr(w, http.StatusBadRequest, oauthErr)
+		return
+	}
+	if !data.Approved {
+		respondWithJson(w, http.StatusOK, response{
+			RedirectTo: oauthRedirect(data.RedirectURI, url.Values{
+				"error": {"access_denied"},
+				"state": {data.State},
+			}),
+		})
+		return
+	}
+
+	code := auth.MarkRefreshToken()
+	if err := cfg.store.CreateOAuthCode(r.Context(), database.CreateOAuthCodeParams{
+		CodeHash:      auth.HashToken(code),
+		ClientID:      client.ID,
+		UserID:        userId,
+		RedirectUri:   data.RedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: data.CodeChallenge,
+		ExpiresAt:     time.Now().UTC().Add(oauthCodeExpiry),
+	}); err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't create the authorization code", err)
+		return
+	}
+	respondWithJson(w, http.StatusOK, response{
+		RedirectTo: oauthRedirect(data.RedirectURI, url.Values{
+			"code":  {code},
+			"state": {data.State},
+		}),
+	})
+}
+
+// authenticateClient func identifies the client calling the token endpoints, from http basic auth or the form.
+// confidential clients must send their secret, public clients only their id
+func (cfg *apiConfig) authenticateClient(r *http.Request) (database.OauthClient, *oauthError) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+	client, err := cfg.store.GetOAuthClient(r.Context(), clientID)
+	if err != nil {
+		return database.OauthClient{}, &oauthError{"invalid_client", "unknown client"}
+	}
+	if client.SecretHash.Valid {
+		if subtle.ConstantTimeCompare([]byte(auth.HashToken(clientSecret)), []byte(client.SecretHash.String)) != 1 {
+			return database.OauthClient{}, &oauthError{"invalid_client", "invalid client secret"}
+		}
+	}
+	return client, nil
+}
+
+// handlerOAuthToken func exchanges an authorization code or a refresh token for an access token,
+// https://datatracker.ietf.org/doc/html/rfc6749#section-5.1
+func (cfg *apiConfig) handlerOAuthToken(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token,omitempty"`
+		Scope        string `json:"scope"`
+	}
+
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthErr(w, http.StatusBadRequest, &oauthError{"invalid_request", "couldn't parse the form"})
+		return
+	}
+	client, oauthErr := cfg.authenticateClient(r)
+	if oauthErr != nil {
+		respondWithOAuthErr(w, http.StatusUnauthorized, oauthErr)
+		return
+	}
+
+	var userId, grantID uuid.UUID
+	var scopes []string
+	refreshToken := ""
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		code, err := cfg.store.UseOAuthCode(r.Context(), auth.HashToken(r.PostForm.Get("code")))
+		if err != nil {
+			respondWithOAuthErr(w, http.StatusBadRequest, &oauthError{"invalid_grant", "invalid, expired or already used code"})
+			return
+		}
+		if code.ClientID != client.ID || code.RedirectUri != r.PostForm.Get("redirect_uri") {
+			respondWithOAuthErr(w, http.StatusBadRequest, &oauthError{"invalid_grant", "code was issued to another client or redirect_uri"})
+			return
+		}
+		if !auth.VerifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+			respondWithOAuthErr(w, http.StatusBadRequest, &oauthError{"invalid_grant", "invalid code_verifier"})
+			return
+		}
+		userId, scopes, grantID = code.UserID, code.Scopes, uuid.New()
+
+		refreshToken = auth.MarkRefreshToken()
+		if _, err := cfg.store.CreateOAuthRefreshToken(r.Context(), database.CreateOAuthRefreshTokenParams{
+			Token:     refreshToken,
+			UserID:    userId,
+			ExpiresAt: time.Now().UTC().Add(oauthRefreshTokenExpiry),
+			ClientID:  sql.NullString{String: client.ID, Valid: true},
+			Scopes:    scopes,
+			GrantID:   uuid.NullUUID{UUID: grantID, Valid: true},
+		}); err != nil {
+			respondWithOAuthServerErr(w, err)
+			return
+		}
+
+	case "refresh_token":
+		token, newToken, err := rotateOAuthRefreshToken(r.Context(), cfg.store, r.PostForm.Get("refresh_token"), client.ID)
+		if errors.Is(err, errRefreshTokenReused) {
+			if err := cfg.revokeOAuthGrant(r.Context(), token.GrantID.UUID); err != nil {
+				log.Printf("error in revoking the grant of a reused refresh token: %v", err)
+			}
+		}
+		if errors.Is(err, sql.ErrNoRows) || errors.Is(err, errRefreshTokenReused) {
+			respondWithOAuthErr(w, http.StatusBadRequest, &oauthError{"invalid_grant", "invalid, expired or already used refresh token"})
+			return
+		}
+		if err != nil {
+			respondWithOAuthServerErr(w, err)
+			return
+		}
+		userId, scopes, grantID, refreshToken = newToken.UserID, newToken.Scopes, newToken.GrantID.UUID, newToken.Token
+
+	default:
+		respondWithOAuthErr(w, http.StatusBadRequest, &oauthError{"unsupported_grant_type", "grant_type must be authorization_code or refresh_token"})
+		return
+	}
+
+	accessToken, err := auth.MakeClientJWT(userId, grantID, client.ID, cfg.jwtSecret, oauthAccessTokenExpiry, scopes)
+	if err != nil {
+		respondWithOAuthServerErr(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJson(w, http.StatusOK, response{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(oauthAccessTokenExpiry.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(scopes, " "),
+	})
+}
+
+// errRefreshTokenReused is returned for an oauth refresh token that was already exchanged, it may have leaked
+var errRefreshTokenReused = errors.New("refresh token already used")
+
+// rotateOAuthRefreshToken func exchanges a refresh token of the client for a new one of the same grant, each refresh
+// token can only be used once (https://datatracker.ietf.org/doc/html/rfc9700#section-4.14.2). it returns the used
+// token and the new one, sql.ErrNoRows when the token is unknown or expired, and errRefreshTokenReused along with
+// the used token when it was already exchanged or revoked
+func rotateOAuthRefreshToken(ctx context.Context, s store.Store, token, clientID string) (used, rotated database.RefreshToken, err error) {
+	err = s.InTx(ctx, func(tx store.Store) error {
+		used, err = tx.UseOAuthRefreshToken(ctx, database.UseOAuthRefreshTokenParams{Token: token, ClientID: clientID})
+		if errors.Is(err, sql.ErrNoRows) {
+			presented, getErr := tx.GetRefreshToken(ctx, token)
+			if getErr == nil && presented.ClientID.String == clientID && presented.RevokedAt.Valid && presented.GrantID.Valid {
+				used = presented
+				return errRefreshTokenReused
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		grantID := used.GrantID
+		if !grantID.Valid { // issued before the refresh tokens were tied to a grant
+			grantID = uuid.NullUUID{UUID: uuid.New(), Valid: true}
+		}
+		rotated, err = tx.CreateOAuthRefreshToken(ctx, database.CreateOAuthRefreshTokenParams{
+			Token:     auth.MarkRefreshToken(),
+			UserID:    used.UserID,
+			ExpiresAt: time.Now().UTC().Add(oauthRefreshTokenExpiry),
+			ClientID:  used.ClientID,
+			Scopes:    used.Scopes,
+			GrantID:   grantID,
+		})
+		return err
+	})
+	return used, rotated, err
+}
+
+// revokeOAuthGrant func revokes the refresh tokens of the grant and the access tokens issued with them
+func (cfg *apiConfig) revokeOAuthGrant(ctx context.Context, grantID uuid.UUID) error {
+	if err := cfg.store.RevokeOAuthGrant(ctx, grantID); err != nil {
+		return fmt.Errorf("couldn't revoke the refresh tokens of grant %v: %v", grantID, err)
+	}
+	return cfg.revokeToken(ctx, grantID.String())
+}
+
+// handlerOAuthIntrospect func tells a confidential client whether a token it was issued is still active,
+// https://datatracker.ietf.org/doc/html/rfc7662
+func (cfg *apiConfig) handlerOAuthIntrospect(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Active    bool   `json:"active"`
+		Scope     string `json:"scope,omitempty"`
+		ClientID  string `json:"client_id,omitempty"`
+		Subject   string `json:"sub,omitempty"`
+		ExpiresAt int64  `json:"exp,omitempty"`
+		TokenType string `json:"token_type,omitempty"`
+	}
+
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthErr(w, http.StatusBadRequest, &oauthError{"invalid_request", "couldn't parse the form"})
+		return
+	}
+	client, oauthErr := cfg.authenticateClient(r)
+	if oauthErr != nil || !client.SecretHash.Valid {
+		respondWithOAuthErr(w, http.StatusUnauthorized, &oauthError{"invalid_client", "introspection needs a confidential client"})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	token := r.PostForm.Get("token")
+
+	// clients can only introspect their own tokens, anything else is reported as inactive
+	if claims, err := auth.ParseJWT(token, cfg.jwtSecret); err == nil {
+		if claims.ClientID != client.ID || cfg.denylist.IsRevoked(claims) {
+			respondWithJson(w, http.StatusOK, response{Active: false})
+			return
+		}
+		respondWithJson(w, http.StatusOK, response{
+			Active:    true,
+			Scope:     strings.Join(claims.Scopes, " "),
+			ClientID:  claims.ClientID,
+			Subject:   claims.Subject,
+			ExpiresAt: claims.ExpiresAt.Unix(),
+			TokenType: "access_token",
+		})
+		return
+	}
+	refreshToken, err := cfg.store.GetRefreshToken(r.Context(), token)
+	if err != nil || refreshToken.ClientID.String != client.ID || refreshToken.RevokedAt.Valid || refreshToken.ExpiresAt.Before(time.Now().UTC()) {
+		respondWithJson(w, http.StatusOK, response{Active: false})
+		return
+	}
+	respondWithJson(w, http.StatusOK, response{
+		Active:    true,
+		Scope:     strings.Join(refreshToken.Scopes, " "),
+		ClientID:  client.ID,
+		Subject:   refreshToken.UserID.String(),
+		ExpiresAt: refreshToken.ExpiresAt.Unix(),
+		TokenType: "refresh_token",
+	})
+}
+
+// handlerOAuthRevoke func revokes an access or refresh token of the client, https://datatracker.ietf.org/doc/html/rfc7009.
+// unknown tokens are not an error
+func (cfg *apiConfig) handlerOAuthRevoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthErr(w, http.StatusBadRequest, &oauthError{"invalid_request", "couldn't parse the form"})
+		return
+	}
+	client, oauthErr := cfg.authenticateClient(r)
+	if oauthErr != nil {
+		respondWithOAuthErr(w, http.StatusUnauthorized, oauthErr)
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if claims, err := auth.ParseJWT(token, cfg.jwtSecret); err == nil {
+		if claims.ClientID == client.ID {
+			if err := cfg.revokeToken(r.Context(), claims.ID); err != nil {
+				respondWithOAuthServerErr(w, err)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	// revoking a refresh token revokes its whole grant, the access tokens included
+	refreshToken, err := cfg.store.GetRefreshToken(r.Context(), token)
+	if err == nil && refreshToken.ClientID.Valid && refreshToken.ClientID.String == client.ID && refreshToken.GrantID.Valid {
+		if err := cfg.revokeOAuthGrant(r.Context(), refreshToken.GrantID.UUID); err != nil {
+			respondWithOAuthServerErr(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if _, err := cfg.store.RevokeOAuthRefreshToken(r.Context(), database.RevokeOAuthRefreshTokenParams{
+		Token:    token,
+		ClientID: client.ID,
+	}); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondWithOAuthServerErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
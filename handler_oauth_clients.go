@@ -0,0 +1,206 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/auth"
+	"github.com/h0dy/http-server/internal/database"
+	"github.com/h0dy/http-server/internal/store"
+)
+
+const maxRedirectURIs = 5
+
+type OAuthClient struct {
+	ClientID     string    `json:"client_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Confidential bool      `json:"confidential"` // confidential clients authenticate with a client secret
+}
+
+func oauthClientFromDB(client database.OauthClient) OAuthClient {
+	return OAuthClient{
+		ClientID:     client.ID,
+		CreatedAt:    client.CreatedAt,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectUris,
+		Confidential: client.SecretHash.Valid,
+	}
+}
+
+// validateRedirectURI func makes sure a redirect uri is absolute, without fragment and uses https (http is only allowed for localhost)
+func validateRedirectURI(redirectURI string) error {
+	parsed, err := url.Parse(redirectURI)
+	if err != nil || !parsed.IsAbs() || parsed.Host == "" {
+		return errors.New("redirect uris must be absolute urls")
+	}
+	if parsed.Fragment != "" {
+		return errors.New("redirect uris can't have a fragment")
+	}
+	isLocalhost := parsed.Hostname() == "localhost" || parsed.Hostname() == "127.0.0.1"
+	if parsed.Scheme != "https" && !(parsed.Scheme == "http" && isLocalhost) {
+		return errors.New("redirect uris must use https")
+	}
+	return nil
+}
+
+// handlerCreateOAuthClient func registers a third-party app owned by the user,
+// the client secret of confidential clients is only returned once
+func (cfg *apiConfig) handlerCreateOAuthClient(w http.ResponseWriter, r *http.Request) {
+	type reqBody struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Confidential bool     `json:"confidential"`
+	}
+	type response struct {
+		OAuthClient
+		ClientSecret string `json:"client_secret,omitempty"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	defer r.Body.Close()
+
+	userId, _, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	data := reqBody{}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Couldn't decode the json data", err)
+		return
+	}
+	data.Name = strings.TrimSpace(data.Name)
+	if data.Name == "" || len(data.Name) > maxAPITokenNameLength {
+		respondWithErr(w, http.StatusBadRequest, "Make sure to provide an app name of at most 50 characters", nil)
+		return
+	}
+	if len(data.RedirectURIs) == 0 || len(data.RedirectURIs) > maxRedirectURIs {
+		respondWithErr(w, http.StatusBadRequest, "Make sure to provide between 1 and 5 redirect uris", nil)
+		return
+	}
+	for _, redirectURI := range data.RedirectURIs {
+		if err := validateRedirectURI(redirectURI); err != nil {
+			respondWithErr(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+	}
+
+	clientSecret := ""
+	secretHash := sql.NullString{}
+	if data.Confidential {
+		clientSecret = auth.MarkRefreshToken()
+		secretHash = sql.NullString{String: auth.HashToken(clientSecret), Valid: true}
+	}
+
+	client, err := cfg.store.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		ID:           "chirpy_" + auth.MarkRefreshToken()[:32],
+		UserID:       userId,
+		Name:         data.Name,
+		RedirectUris: data.RedirectURIs,
+		SecretHash:   secretHash,
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't register the app", err)
+		return
+	}
+	respondWithJson(w, http.StatusCreated, response{
+		OAuthClient:  oauthClientFromDB(client),
+		ClientSecret: clientSecret,
+	})
+}
+
+func (cfg *apiConfig) handlerGetOAuthClients(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	clients, err := cfg.store.GetOAuthClientsByUser(r.Context(), userId)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve apps", err)
+		return
+	}
+	clientsJson := []OAuthClient{}
+	for _, client := range clients {
+		clientsJson = append(clientsJson, oauthClientFromDB(client))
+	}
+	respondWithJson(w, http.StatusOK, clientsJson)
+}
+
+// handlerDeleteOAuthClient func deletes an app of the user, its codes and refresh tokens are deleted with it and the
+// access tokens it was issued are revoked
+func (cfg *apiConfig) handlerDeleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	userId, _, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	// the grants go with the refresh tokens, they're read first to revoke their access tokens after
+	var grantIDs []uuid.UUID
+	var deleted int64
+	err = cfg.store.InTx(r.Context(), func(tx store.Store) error {
+		grantIDs, err = tx.GetOAuthClientGrants(r.Context(), sql.NullString{String: r.PathValue("clientID"), Valid: true})
+		if err != nil {
+			return err
+		}
+		deleted, err = tx.DeleteOAuthClient(r.Context(), database.DeleteOAuthClientParams{
+			ID:     r.PathValue("clientID"),
+			UserID: userId,
+		})
+		return err
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't delete the app", err)
+		return
+	}
+	if deleted == 0 {
+		respondWithErr(w, http.StatusNotFound, "Couldn't find the app", nil)
+		return
+	}
+
+	for _, grantID := range grantIDs {
+		if err := cfg.revokeToken(r.Context(), grantID.String()); err != nil {
+			respondWithErr(w, http.StatusInternalServerError, "Couldn't revoke the access tokens of the app", err)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerGetOAuthClientInfo func returns the public info of an app, it's shown on the consent page
+func (cfg *apiConfig) handlerGetOAuthClientInfo(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		ClientID string `json:"client_id"`
+		Name     string `json:"name"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	client, err := cfg.store.GetOAuthClient(r.Context(), r.PathValue("clientID"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithErr(w, http.StatusNotFound, "Couldn't find the app", err)
+			return
+		}
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve the app", err)
+		return
+	}
+	respondWithJson(w, http.StatusOK, response{
+		ClientID: client.ID,
+		Name:     client.Name,
+	})
+}
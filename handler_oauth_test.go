@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/database"
+	"github.com/h0dy/http-server/internal/store"
+)
+
+func TestRotateOAuthRefreshToken(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	user, err := s.CreateUser(ctx, database.CreateUserParams{Email: "user@example.com", HashedPassword: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateOAuthClient(ctx, database.CreateOAuthClientParams{ID: "client", UserID: user.ID, Name: "app", RedirectUris: []string{}}); err != nil {
+		t.Fatal(err)
+	}
+	createToken := func(t *testing.T, grantID uuid.NullUUID) database.RefreshToken {
+		t.Helper()
+		token, err := s.CreateOAuthRefreshToken(ctx, database.CreateOAuthRefreshTokenParams{
+			Token:     uuid.NewString(),
+			UserID:    user.ID,
+			ExpiresAt: time.Now().UTC().Add(time.Hour),
+			ClientID:  sql.NullString{String: "client", Valid: true},
+			Scopes:    []string{"chirps:read"},
+			GrantID:   grantID,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	t.Run("Rotated on every use", func(t *testing.T) {
+		grantID := uuid.NullUUID{UUID: uuid.New(), Valid: true}
+		first := createToken(t, grantID)
+		_, second, err := rotateOAuthRefreshToken(ctx, s, first.Token, "client")
+		if err != nil || second.Token == first.Token || second.GrantID != grantID || second.UserID != user.ID {
+			t.Fatalf("rotateOAuthRefreshToken() = %+v, %v, want a new token of the grant", second, err)
+		}
+		if _, third, err := rotateOAuthRefreshToken(ctx, s, second.Token, "client"); err != nil || third.GrantID != grantID {
+			t.Errorf("rotateOAuthRefreshToken() of the new token = %+v, %v, want a new token of the grant", third, err)
+		}
+
+		used, _, err := rotateOAuthRefreshToken(ctx, s, first.Token, "client")
+		if !errors.Is(err, errRefreshTokenReused) || used.GrantID != grantID {
+			t.Errorf("rotateOAuthRefreshToken() of a used token = %+v, %v, want it reported as reused with its grant", used, err)
+		}
+	})
+
+	t.Run("Token issued before the grants", func(t *testing.T) {
+		legacy := createToken(t, uuid.NullUUID{})
+		if _, rotated, err := rotateOAuthRefreshToken(ctx, s, legacy.Token, "client"); err != nil || !rotated.GrantID.Valid {
+			t.Errorf("rotateOAuthRefreshToken() = %+v, %v, want a new token with a grant", rotated, err)
+		}
+	})
+
+	t.Run("Invalid token", func(t *testing.T) {
+		token := createToken(t, uuid.NullUUID{UUID: uuid.New(), Valid: true})
+		if _, _, err := rotateOAuthRefreshToken(ctx, s, token.Token, "another-client"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("rotateOAuthRefreshToken() by another client error = %v, want sql.ErrNoRows", err)
+		}
+		if _, _, err := rotateOAuthRefreshToken(ctx, s, "missing", "client"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("rotateOAuthRefreshToken() of a missing token error = %v, want sql.ErrNoRows", err)
+		}
+	})
+}
+
+func TestRespondWithOAuthServerErr(t *testing.T) {
+	w := httptest.NewRecorder()
+	respondWithOAuthServerErr(w, errors.New(`pq: relation "oauth_codes" does not exist`))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	if body := w.Body.String(); strings.Contains(body, "oauth_codes") || !strings.Contains(body, `"server_error"`) {
+		t.Errorf("body = %s, want a server_error without the error", body)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/h0dy/http-server/internal/auth"
+	"github.com/h0dy/http-server/internal/database"
+	"github.com/h0dy/http-server/internal/store"
+)
+
+// how long the user has to log in at the provider
+const oidcLoginExpiry = 10 * time.Minute
+
+// the cookie that binds a login to the browser that started it, it holds the hash of the state
+const oidcStateCookie = "oidc_state"
+
+// how long after logging in with the provider a user without a password can change or delete their account
+const oidcReauthWindow = 10 * time.Minute
+
+var errOIDCEmailNotVerified = errors.New("the provider hasn't verified the email of the account")
+
+var errReauthRequired = errors.New("the account has no password and the session didn't start with a recent provider login")
+
+// handlerOIDCLogin func sends the user to the identity provider to log in, with ?restore=true the login also
+// restores the account when it's scheduled for deletion
+func (cfg *apiConfig) handlerOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if cfg.oidc == nil {
+		respondWithErr(w, http.StatusNotFound, "OIDC login isn't configured", nil)
+		return
+	}
+
+	// the state ties the callback to this login, the nonce ties the id token to it
+	state := auth.MarkRefreshToken()
+	nonce := auth.MarkRefreshToken()
+	codeVerifier := auth.MarkRefreshToken()
+	if err := cfg.store.CreateOIDCLogin(r.Context(), database.CreateOIDCLoginParams{
+		StateHash:    auth.HashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    time.Now().UTC().Add(oidcLoginExpiry),
+		Restore:      r.URL.Query().Get("restore") == "true",
+	}); err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't start the login", err)
+		return
+	}
+	// Lax, the provider sends the user back with a top-level navigation from its own site
+	cfg.setOIDCStateCookie(w, auth.HashToken(state), int(oidcLoginExpiry.Seconds()))
+	http.Redirect(w, r, cfg.oidc.AuthCodeURL(state, nonce, auth.MakeCodeChallenge(codeVerifier)), http.StatusFound)
+}
+
+// setOIDCStateCookie func sets the state cookie of a login, a negative maxAge deletes it
+func (cfg *apiConfig) setOIDCStateCookie(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		HttpOnly: true,
+		Secure:   cfg.platform != "dev", // use HTTPS in production
+		SameSite: http.SameSiteLaxMode,
+		Path:     "/api/login/oidc",
+		MaxAge:   maxAge,
+	})
+}
+
+// handlerOIDCCallback func is where the provider sends the user back, it logs the user in like handlerUserLogin
+func (cfg *apiConfig) handlerOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if cfg.oidc == nil {
+		respondWithErr(w, http.StatusNotFound, "OIDC login isn't configured", nil)
+		return
+	}
+
+	// the login can only be finished once, by the browser that started it
+	stateCookie, cookieErr := r.Cookie(oidcStateCookie)
+	cfg.setOIDCStateCookie(w, "", -1)
+
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		respondWithErr(w, http.StatusUnauthorized, "The provider refused the login: "+providerErr, nil)
+		return
+	}
+	stateHash := auth.HashToken(query.Get("state"))
+	if cookieErr != nil || subtle.ConstantTimeCompare([]byte(stateCookie.Value), []byte(stateHash)) != 1 {
+		respondWithErr(w, http.StatusBadRequest, "The login wasn't started in this browser, try again", cookieErr)
+		return
+	}
+	login, err := cfg.store.UseOIDCLogin(r.Context(), stateHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithErr(w, http.StatusBadRequest, "Invalid or expired login, try again", err)
+		return
+	}
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve the login", err)
+		return
+	}
+
+	rawIDToken, err := cfg.oidc.Exchange(r.Context(), query.Get("code"), login.CodeVerifier)
+	if err != nil {
+		respondWithErr(w, http.StatusUnauthorized, "Couldn't log in with the provider", err)
+		return
+	}
+	claims, err := cfg.oidc.VerifyIDToken(r.Context(), rawIDToken, login.Nonce)
+	if err != nil {
+		respondWithErr(w, http.StatusUnauthorized, "Invalid id token", err)
+		return
+	}
+
+	user, err := cfg.oidcUser(r.Context(), claims)
+	if err != nil {
+		if errors.Is(err, errOIDCEmailNotVerified) {
+			respondWithErr(w, http.StatusForbidden, err.Error(), err)
+			return
+		}
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't log in with the provider", err)
+		return
+	}
+	// the users without a password can only restore their account this way
+	if login.Restore && user.DeleteAfter.Valid {
+		user, err = cfg.store.RestoreUser(r.Context(), user.ID)
+		if err != nil {
+			respondWithErr(w, http.StatusInternalServerError, "Couldn't restore the account", err)
+			return
+		}
+	}
+	cfg.respondWithLogin(w, r, user)
+}
+
+// oidcUser func returns the user linked to the provider account. an account that isn't linked yet is linked
+// to the user with the same email, or to a new user, but only when the provider verified the email
+func (cfg *apiConfig) oidcUser(ctx context.Context, claims *auth.IDTokenClaims) (database.User, error) {
+	user, err := cfg.store.GetUserByIdentity(ctx, database.GetUserByIdentityParams{
+		Provider: cfg.oidc.Issuer,
+		Subject:  claims.Subject,
+	})
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, err
+	}
+	if claims.Email == "" || !claims.EmailVerified {
+		return database.User{}, errOIDCEmailNotVerified
+	}
+
+	err = cfg.store.InTx(ctx, func(tx store.Store) error {
+		var err error
+		user, err = tx.GetUserByEmail(ctx, claims.Email)
+		if errors.Is(err, sql.ErrNoRows) {
+			// users created through the provider have no password, they log in with it until they set one
+			user, err = tx.CreateUser(ctx, database.CreateUserParams{
+				Email:          claims.Email,
+				HashedPassword: "",
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't retrieve the user: %v", err)
+		}
+		if err := tx.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+			Provider: cfg.oidc.Issuer,
+			Subject:  claims.Subject,
+			UserID:   user.ID,
+			Email:    claims.Email,
+		}); err != nil {
+			return fmt.Errorf("couldn't link the account: %v", err)
+		}
+		return nil
+	})
+	return user, err
+}
+
+// checkReauthentication func checks that the user just confirmed it's them before a change to their account: with
+// their password, or for the users without a password (they only log in with the provider), with a provider login
+// that started the current session a moment ago. errReauthRequired means such a user has to log in again
+func (cfg *apiConfig) checkReauthentication(ctx context.Context, user database.User, password string, claims *auth.Claims) error {
+	if user.HashedPassword != "" {
+		return auth.CheckPasswordHash(password, user.HashedPassword)
+	}
+	sessions, err := cfg.store.GetSessions(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("%w: couldn't retrieve the sessions: %v", errReauthRequired, err)
+	}
+	sessionID := currentSessionID(claims)
+	for _, session := range sessions {
+		if session.ID == sessionID && time.Since(session.CreatedAt) < oidcReauthWindow {
+			return nil
+		}
+	}
+	return errReauthRequired
+}
+
+// respondWithReauthErr func responds to a failed checkReauthentication, msg is the message for a wrong password
+func respondWithReauthErr(w http.ResponseWriter, err error, msg string) {
+	if errors.Is(err, errReauthRequired) {
+		msg = "Log in with the provider again to confirm it's you"
+	}
+	respondWithErr(w, http.StatusUnauthorized, msg, err)
+}
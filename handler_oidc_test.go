@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/auth"
+)
+
+// mockIdP is a local OpenID Connect provider, it issues an ID token with the claims of the test for any code
+type mockIdP struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	claims   auth.IDTokenClaims
+	provider *auth.OIDCProvider
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kid": "key-1",
+				"kty": "RSA",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, idp.claims)
+		token.Header["kid"] = "key-1"
+		signed, err := token.SignedString(idp.key)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	idp.provider, err = auth.DiscoverOIDC(context.Background(), idp.server.URL, "chirpy", "secret", "http://localhost:8080/api/login/oidc/callback")
+	if err != nil {
+		t.Fatalf("DiscoverOIDC() error = %v", err)
+	}
+	return idp
+}
+
+// oidcLogin func logs in at the provider as subject, from the redirect to the provider to the callback, path is the
+// route that starts the login. it returns the status code of the callback
+func (s *testServer) oidcLogin(t *testing.T, idp *mockIdP, path, subject, email string, out any) int {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	res, err := client.Get(s.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	expect(t, "start the login", res.StatusCode, http.StatusFound)
+	location, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the user logs in at the provider, which sends them back with a code for the id token
+	idp.claims = auth.IDTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    idp.server.URL,
+			Subject:   subject,
+			Audience:  jwt.ClaimStrings{"chirpy"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+		Nonce:         location.Query().Get("nonce"),
+		Email:         email,
+		EmailVerified: true,
+	}
+	req, err := http.NewRequest("GET", s.URL+"/api/login/oidc/callback?code=code&state="+url.QueryEscape(location.Query().Get("state")), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cookie := range res.Cookies() {
+		req.AddCookie(cookie)
+	}
+	return s.do(t, req, out)
+}
+
+func TestOIDCCallbackStateCookie(t *testing.T) {
+	const state = "state-of-the-login"
+	tests := []struct {
+		name       string
+		cookie     *http.Cookie
+		wantStatus int
+	}{
+		{name: "Missing cookie", wantStatus: http.StatusBadRequest},
+		{name: "Cookie of another login", cookie: &http.Cookie{Name: oidcStateCookie, Value: auth.HashToken("another-state")}, wantStatus: http.StatusBadRequest},
+		{name: "Cookie holding the state itself", cookie: &http.Cookie{Name: oidcStateCookie, Value: state}, wantStatus: http.StatusBadRequest},
+		// the login is then looked up, but it was never started
+		{name: "Cookie of the login", cookie: &http.Cookie{Name: oidcStateCookie, Value: auth.HashToken(state)}, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			s.cfg.oidc = newMockIdP(t).provider
+
+			req, err := http.NewRequest("GET", s.URL+"/api/login/oidc/callback?code=code&state="+state, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+			res, err := s.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			if res.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", res.StatusCode, tt.wantStatus)
+			}
+
+			cleared := false
+			for _, cookie := range res.Cookies() {
+				cleared = cleared || cookie.Name == oidcStateCookie && cookie.MaxAge < 0
+			}
+			if !cleared {
+				t.Errorf("cookies = %v, want the state cookie cleared", res.Cookies())
+			}
+		})
+	}
+}
+
+// the users created through the provider have no password, a recent provider login confirms it's them instead
+func TestOIDCAccountWithoutPassword(t *testing.T) {
+	s := newTestServer(t)
+	idp := newMockIdP(t)
+	s.cfg.oidc = idp.provider
+	const email = "provider-user@example.com"
+
+	user := testUser{}
+	expect(t, "first login", s.oidcLogin(t, idp, "/api/login/oidc", "subject-1", email, &user), http.StatusOK)
+	again := testUser{}
+	expect(t, "login again", s.oidcLogin(t, idp, "/api/login/oidc", "subject-1", email, &again), http.StatusOK)
+	if again.ID != user.ID {
+		t.Fatalf("login again returned user %v, want %v", again.ID, user.ID)
+	}
+	expect(t, "password login", s.request(t, "POST", "/api/login", "", map[string]string{"email": email, "password": ""}, nil), http.StatusUnauthorized)
+
+	// a token that isn't from a recent provider login can't change the account
+	stale, err := s.cfg.makeAccessToken(context.Background(), user.ID, uuid.Nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "delete without a recent login", s.request(t, "DELETE", "/api/users", stale, map[string]string{}, nil), http.StatusUnauthorized)
+	expect(t, "set a password without a recent login", s.request(t, "PATCH", "/api/users", stale, map[string]string{"password": testPassword}, nil), http.StatusUnauthorized)
+
+	expect(t, "delete", s.request(t, "DELETE", "/api/users", user.Token, map[string]string{}, nil), http.StatusOK)
+	expect(t, "login", s.oidcLogin(t, idp, "/api/login/oidc", "subject-1", email, nil), http.StatusForbidden)
+	restored := testUser{}
+	expect(t, "restore", s.oidcLogin(t, idp, "/api/login/oidc?restore=true", "subject-1", email, &restored), http.StatusOK)
+
+	// the user sets a password, then logs in with it like any other user
+	expect(t, "set a password", s.request(t, "PATCH", "/api/users", restored.Token, map[string]string{"password": testPassword}, nil), http.StatusOK)
+	loggedIn := s.login(t, email)
+	expect(t, "delete without the password", s.request(t, "DELETE", "/api/users", loggedIn.Token, map[string]string{}, nil), http.StatusUnauthorized)
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/auth"
+	"github.com/h0dy/http-server/internal/database"
+	"github.com/h0dy/http-server/internal/store"
+)
+
+const (
+	minPollOptions      = 2
+	maxPollOptions      = 4
+	maxPollOptionLength = 50
+	maxPollDuration     = 7 * 24 * time.Hour
+)
+
+type Poll struct {
+	ID            uuid.UUID    `json:"id"`
+	ClosesAt      time.Time    `json:"closes_at"`
+	Closed        bool         `json:"closed"`
+	Options       []PollOption `json:"options"`
+	TotalVotes    *int64       `json:"total_votes,omitempty"` // hidden until the user voted or the poll is closed
+	VotedOptionID *uuid.UUID   `json:"voted_option_id,omitempty"`
+}
+
+type PollOption struct {
+	ID    uuid.UUID `json:"id"`
+	Text  string    `json:"text"`
+	Votes *int64    `json:"votes,omitempty"` // hidden until the user voted or the poll is closed
+}
+
+// pollParams is the optional poll sent along with a new chirp
+type pollParams struct {
+	Options  []string  `json:"options"`
+	ClosesAt time.Time `json:"closes_at"`
+}
+
+// validatePoll func checks the options and closing time of a new poll and returns the trimmed options
+func validatePoll(poll pollParams, now time.Time) ([]string, error) {
+	if len(poll.Options) < minPollOptions || len(poll.Options) > maxPollOptions {
+		return nil, fmt.Errorf("a poll needs between %d and %d options", minPollOptions, maxPollOptions)
+	}
+	options := make([]string, 0, len(poll.Options))
+	for _, option := range poll.Options {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			return nil, errors.New("poll options can't be empty")
+		}
+		if len(option) > maxPollOptionLength {
+			return nil, fmt.Errorf("poll options can't be longer than %d characters", maxPollOptionLength)
+		}
+		options = append(options, replaceProfaneWords(option))
+	}
+	if !poll.ClosesAt.After(now) {
+		return nil, errors.New("poll closing time must be in the future")
+	}
+	if poll.ClosesAt.Sub(now) > maxPollDuration {
+		return nil, errors.New("poll can't stay open longer than 7 days")
+	}
+	return options, nil
+}
+
+// createPoll func attaches a poll to a chirp, options must be validated with validatePoll first
+func createPoll(ctx context.Context, q store.Chirps, chirpID uuid.UUID, options []string, closesAt time.Time) error {
+	poll, err := q.CreatePoll(ctx, database.CreatePollParams{
+		ChirpID:  chirpID,
+		ClosesAt: closesAt.UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't create poll: %v", err)
+	}
+	for idx, option := range options {
+		if _, err := q.CreatePollOption(ctx, database.CreatePollOptionParams{
+			PollID:   poll.ID,
+			Position: int32(idx),
+			Text:     option,
+		}); err != nil {
+			return fmt.Errorf("couldn't create poll option: %v", err)
+		}
+	}
+	return nil
+}
+
+// getChirpPolls func returns the polls of the given chirps keyed by chirp id.
+// vote counts are only included for the polls the viewer voted on or that are closed
+func (cfg *apiConfig) getChirpPolls(ctx context.Context, chirpIDs []uuid.UUID, viewerID uuid.UUID) (map[uuid.UUID]*Poll, error) {
+	polls := map[uuid.UUID]*Poll{}
+	if len(chirpIDs) == 0 {
+		return polls, nil
+	}
+
+	dbPolls, err := cfg.store.GetPollsByChirpIDs(ctx, chirpIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(dbPolls) == 0 {
+		return polls, nil
+	}
+	pollIDs := make([]uuid.UUID, 0, len(dbPolls))
+	for _, poll := range dbPolls {
+		pollIDs = append(pollIDs, poll.ID)
+	}
+
+	results, err := cfg.store.GetPollResults(ctx, pollIDs)
+	if err != nil {
+		return nil, err
+	}
+	votedOptions := map[uuid.UUID]uuid.UUID{} // poll id -> option id
+	if viewerID != uuid.Nil {
+		votes, err := cfg.store.GetUserPollVotes(ctx, database.GetUserPollVotesParams{
+			UserID:  viewerID,
+			PollIds: pollIDs,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, vote := range votes {
+			votedOptions[vote.PollID] = vote.OptionID
+		}
+	}
+
+	now := time.Now().UTC()
+	byID := map[uuid.UUID]*Poll{}
+	for _, dbPoll := range dbPolls {
+		poll := &Poll{
+			ID:       dbPoll.ID,
+			ClosesAt: dbPoll.ClosesAt,
+			Closed:   !dbPoll.ClosesAt.After(now),
+			Options:  []PollOption{},
+		}
+		if optionID, ok := votedOptions[dbPoll.ID]; ok {
+			poll.VotedOptionID = &optionID
+		}
+		if poll.Closed || poll.VotedOptionID != nil {
+			poll.TotalVotes = new(int64)
+		}
+		byID[dbPoll.ID] = poll
+		polls[dbPoll.ChirpID] = poll
+	}
+	for _, result := range results { // results are ordered by option position
+		poll := byID[result.PollID]
+		option := PollOption{ID: result.ID, Text: result.Text}
+		if poll.TotalVotes != nil {
+			votes := result.Votes
+			option.Votes = &votes
+			*poll.TotalVotes += votes
+		}
+		poll.Options = append(poll.Options, option)
+	}
+	return polls, nil
+}
+
+// viewerID func returns the id of the user making the request, or uuid.Nil for anonymous requests
+func (cfg *apiConfig) viewerID(r *http.Request) uuid.UUID {
+	userId, _, err := cfg.authenticate(r, auth.ScopeChirpsRead)
+	if err != nil {
+		return uuid.Nil
+	}
+	return userId
+}
+
+// handlerVotePoll func records the vote of the user on the poll of a chirp
+func (cfg *apiConfig) handlerVotePoll(w http.ResponseWriter, r *http.Request) {
+	type reqBody struct {
+		OptionID uuid.UUID `json:"option_id"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	defer r.Body.Close()
+
+	chirpId, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Invalid chirp id", err)
+		return
+	}
+
+	userId, _, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	data := reqBody{}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Couldn't decode the json data", err)
+		return
+	}
+
+	poll, err := cfg.store.GetPollByChirpID(r.Context(), chirpId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithErr(w, http.StatusNotFound, "Couldn't find a poll on this chirp", err)
+			return
+		}
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve the poll", err)
+		return
+	}
+	if !poll.ClosesAt.After(time.Now().UTC()) {
+		respondWithErr(w, http.StatusBadRequest, "Poll is closed", nil)
+		return
+	}
+
+	if _, err := cfg.store.GetPollOption(r.Context(), database.GetPollOptionParams{
+		ID:     data.OptionID,
+		PollID: poll.ID,
+	}); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithErr(w, http.StatusBadRequest, "Option doesn't belong to this poll", err)
+			return
+		}
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve the poll option", err)
+		return
+	}
+
+	voted, err := cfg.store.CreatePollVote(r.Context(), database.CreatePollVoteParams{
+		PollID:   poll.ID,
+		UserID:   userId,
+		OptionID: data.OptionID,
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't record the vote", err)
+		return
+	}
+	if voted == 0 {
+		respondWithErr(w, http.StatusConflict, "You already voted on this poll", nil)
+		return
+	}
+
+	polls, err := cfg.getChirpPolls(r.Context(), []uuid.UUID{chirpId}, userId)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve the poll", err)
+		return
+	}
+	respondWithJson(w, http.StatusOK, polls[chirpId])
+}
+
+// notifyClosedPolls func notifies the voters of the polls that closed since the last run, except the polls of the
+// chirps in the trash. closed polls are locked with SKIP LOCKED, so voters are notified only once with several
+// server instances
+func (cfg *apiConfig) notifyClosedPolls(ctx context.Context) {
+	err := cfg.store.InTx(ctx, func(tx store.Store) error {
+		polls, err := tx.GetClosedPollsToNotify(ctx, database.GetClosedPollsToNotifyParams{
+			Now:      time.Now().UTC(),
+			MaxPolls: 100,
+		})
+		if err != nil {
+			return err
+		}
+		for _, poll := range polls {
+			if _, err := tx.NotifyPollVoters(ctx, poll.ID); err != nil {
+				return fmt.Errorf("couldn't notify the voters of poll %v: %w", poll.ID, err)
+			}
+			if err := tx.MarkPollNotified(ctx, poll.ID); err != nil {
+				return fmt.Errorf("couldn't notify the voters of poll %v: %w", poll.ID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("error in notifying closed polls: %v", err)
+	}
+}
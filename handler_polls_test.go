@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidatePoll(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name      string
+		poll      pollParams
+		expected  []string
+		expectErr bool
+	}{
+		{
+			name:     "Valid poll",
+			poll:     pollParams{Options: []string{" yes ", "no"}, ClosesAt: now.Add(time.Hour)},
+			expected: []string{"yes", "no"},
+		},
+		{
+			name:     "Profane option",
+			poll:     pollParams{Options: []string{"kerfuffle", "no", "maybe", "later"}, ClosesAt: now.Add(time.Hour)},
+			expected: []string{"****", "no", "maybe", "later"},
+		},
+		{
+			name:      "Too few options",
+			poll:      pollParams{Options: []string{"yes"}, ClosesAt: now.Add(time.Hour)},
+			expectErr: true,
+		},
+		{
+			name:      "Too many options",
+			poll:      pollParams{Options: []string{"a", "b", "c", "d", "e"}, ClosesAt: now.Add(time.Hour)},
+			expectErr: true,
+		},
+		{
+			name:      "Empty option",
+			poll:      pollParams{Options: []string{"yes", "  "}, ClosesAt: now.Add(time.Hour)},
+			expectErr: true,
+		},
+		{
+			name:      "Closes in the past",
+			poll:      pollParams{Options: []string{"yes", "no"}, ClosesAt: now.Add(-time.Minute)},
+			expectErr: true,
+		},
+		{
+			name:      "Open for too long",
+			poll:      pollParams{Options: []string{"yes", "no"}, ClosesAt: now.Add(8 * 24 * time.Hour)},
+			expectErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			options, err := validatePoll(c.poll, now)
+			if err != nil {
+				if !c.expectErr {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if c.expectErr {
+				t.Errorf("expected error but got none")
+				return
+			}
+			if len(options) != len(c.expected) {
+				t.Fatalf("expected %v options, got %v", len(c.expected), len(options))
+			}
+			for idx := range options {
+				if options[idx] != c.expected[idx] {
+					t.Errorf("option %d: expected %q, got %q", idx, c.expected[idx], options[idx])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/auth"
+	"github.com/h0dy/http-server/internal/database"
+	"github.com/h0dy/http-server/internal/store"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+)
+
+// handles are 3 to 20 letters, digits or underscores, they are unique regardless of their case
+var handleRegex = regexp.MustCompile(`^[a-zA-Z0-9_]{3,20}$`)
+
+// reservedHandles are the literal path segments of the routes under /api/users/, the profile of a user with one of
+// these handles couldn't be reached (GET /api/users/exports lists the data exports)
+var reservedHandles = []string{"email", "exports", "restore"}
+
+// Author is the public identity shown next to a chirp, it must never hold private data like the email
+type Author struct {
+	ID          uuid.UUID `json:"id"`
+	Handle      string    `json:"handle"`
+	DisplayName string    `json:"display_name"`
+	AvatarURL   string    `json:"avatar_url"`
+}
+
+type Profile struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	Handle         string    `json:"handle"`
+	DisplayName    string    `json:"display_name"`
+	Bio            string    `json:"bio"`
+	AvatarURL      string    `json:"avatar_url"`
+	FollowersCount int64     `json:"followers_count"`
+	FollowingCount int64     `json:"following_count"`
+	ChirpsCount    int64     `json:"chirps_count"`
+}
+
+// profileParams holds the public profile fields the user can edit
+type profileParams struct {
+	Handle      string `json:"handle"`
+	DisplayName string `json:"display_name"`
+	Bio         string `json:"bio"`
+	AvatarURL   string `json:"avatar_url"`
+}
+
+// validateProfile func trims the profile fields and makes sure they are valid
+func validateProfile(profile profileParams) (profileParams, error) {
+	profile.Handle = strings.TrimPrefix(strings.TrimSpace(profile.Handle), "@")
+	profile.DisplayName = strings.TrimSpace(profile.DisplayName)
+	profile.Bio = strings.TrimSpace(profile.Bio)
+	profile.AvatarURL = strings.TrimSpace(profile.AvatarURL)
+
+	if !handleRegex.MatchString(profile.Handle) {
+		return profile, errors.New("handle must be 3 to 20 letters, digits or underscores")
+	}
+	if slices.Contains(reservedHandles, strings.ToLower(profile.Handle)) {
+		return profile, fmt.Errorf("the handle %q is reserved", profile.Handle)
+	}
+	if len(profile.DisplayName) > maxDisplayNameLength {
+		return profile, errors.New("display name is too long")
+	}
+	if len(profile.Bio) > maxBioLength {
+		return profile, errors.New("bio is too long")
+	}
+	if profile.AvatarURL != "" {
+		avatarURL, err := url.Parse(profile.AvatarURL)
+		if err != nil || (avatarURL.Scheme != "http" && avatarURL.Scheme != "https") || avatarURL.Host == "" {
+			return profile, errors.New("avatar url must be a valid http(s) url")
+		}
+	}
+	profile.DisplayName = replaceProfaneWords(profile.DisplayName)
+	profile.Bio = replaceProfaneWords(profile.Bio)
+	return profile, nil
+}
+
+// getAuthors func returns the public identity of the given users keyed by user id
+func (cfg *apiConfig) getAuthors(ctx context.Context, userIDs []uuid.UUID) (map[uuid.UUID]*Author, error) {
+	authors := map[uuid.UUID]*Author{}
+	if len(userIDs) == 0 {
+		return authors, nil
+	}
+	rows, err := cfg.store.GetAuthors(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		authors[row.ID] = &Author{
+			ID:          row.ID,
+			Handle:      row.Handle.String,
+			DisplayName: row.DisplayName,
+			AvatarURL:   row.AvatarUrl,
+		}
+	}
+	return authors, nil
+}
+
+// handlerGetProfile func returns the public profile of a user by their handle
+func (cfg *apiConfig) handlerGetProfile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	profile, err := cfg.store.GetProfileByHandle(r.Context(), strings.TrimPrefix(r.PathValue("handle"), "@"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithErr(w, http.StatusNotFound, "Couldn't find the user", err)
+			return
+		}
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve the user", err)
+		return
+	}
+	respondWithJson(w, http.StatusOK, Profile{
+		ID:             profile.ID,
+		CreatedAt:      profile.CreatedAt,
+		Handle:         profile.Handle.String,
+		DisplayName:    profile.DisplayName,
+		Bio:            profile.Bio,
+		AvatarURL:      profile.AvatarUrl,
+		FollowersCount: profile.FollowersCount,
+		FollowingCount: profile.FollowingCount,
+		ChirpsCount:    profile.ChirpsCount,
+	})
+}
+
+// handlerUpdateProfile func sets the public profile of the user
+func (cfg *apiConfig) handlerUpdateProfile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	defer r.Body.Close()
+
+	userId, _, err := cfg.authenticate(r, auth.ScopeProfileWrite)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	data := profileParams{}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Couldn't decode the json data", err)
+		return
+	}
+	profile, err := validateProfile(data)
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	user, err := cfg.store.UpdateUserProfile(r.Context(), database.UpdateUserProfileParams{
+		Handle:      sql.NullString{String: profile.Handle, Valid: true},
+		DisplayName: profile.DisplayName,
+		Bio:         profile.Bio,
+		AvatarUrl:   profile.AvatarURL,
+		ID:          userId,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithErr(w, http.StatusNotFound, "Couldn't find the user", err)
+			return
+		}
+		if isUniqueViolation(err) {
+			respondWithErr(w, http.StatusConflict, "This handle is already taken", err)
+			return
+		}
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't update the profile", err)
+		return
+	}
+	respondWithJson(w, http.StatusOK, userFromDB(user))
+}
+
+func (cfg *apiConfig) handlerFollowUser(w http.ResponseWriter, r *http.Request) {
+	userId, _, err := cfg.authenticate(r, auth.ScopeProfileWrite)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	followee, err := cfg.store.GetProfileByHandle(r.Context(), strings.TrimPrefix(r.PathValue("handle"), "@"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithErr(w, http.StatusNotFound, "Couldn't find the user", err)
+			return
+		}
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve the user", err)
+		return
+	}
+	if followee.ID == userId {
+		respondWithErr(w, http.StatusBadRequest, "You can't follow yourself", nil)
+		return
+	}
+
+	authors, err := cfg.getAuthors(r.Context(), []uuid.UUID{userId})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't follow the user", err)
+		return
+	}
+	err = cfg.store.InTx(r.Context(), func(tx store.Store) error {
+		followed, err := tx.FollowUser(r.Context(), database.FollowUserParams{
+			FollowerID: userId,
+			FolloweeID: followee.ID,
+		})
+		// following a user again doesn't tell them twice
+		if err != nil || followed == 0 {
+			return err
+		}
+		return enqueueWebhook(r.Context(), tx, followee.ID, webhookFollowerCreated, webhookFollowerData{Follower: authors[userId]})
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't follow the user", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerUnfollowUser(w http.ResponseWriter, r *http.Request) {
+	userId, _, err := cfg.authenticate(r, auth.ScopeProfileWrite)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	followee, err := cfg.store.GetProfileByHandle(r.Context(), strings.TrimPrefix(r.PathValue("handle"), "@"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithErr(w, http.StatusNotFound, "Couldn't find the user", err)
+			return
+		}
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve the user", err)
+		return
+	}
+
+	unfollowed, err := cfg.store.UnfollowUser(r.Context(), database.UnfollowUserParams{
+		FollowerID: userId,
+		FolloweeID: followee.ID,
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't unfollow the user", err)
+		return
+	}
+	if unfollowed == 0 {
+		respondWithErr(w, http.StatusNotFound, "You don't follow this user", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
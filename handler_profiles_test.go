@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+func TestValidateProfile(t *testing.T) {
+	cases := []struct {
+		name      string
+		input     profileParams
+		expected  profileParams
+		expectErr bool
+	}{
+		{
+			name:     "Valid profile",
+			input:    profileParams{Handle: " @Chirpy_Fan ", DisplayName: " Chirpy Fan ", AvatarURL: "https://example.com/a.png"},
+			expected: profileParams{Handle: "Chirpy_Fan", DisplayName: "Chirpy Fan", AvatarURL: "https://example.com/a.png"},
+		},
+		{
+			name:     "Profane bio",
+			input:    profileParams{Handle: "fan", Bio: "what a kerfuffle"},
+			expected: profileParams{Handle: "fan", Bio: "what a ****"},
+		},
+		{
+			name:      "Handle too short",
+			input:     profileParams{Handle: "ab"},
+			expectErr: true,
+		},
+		{
+			name:      "Handle with invalid characters",
+			input:     profileParams{Handle: "chirpy-fan"},
+			expectErr: true,
+		},
+		{
+			name:      "Reserved handle",
+			input:     profileParams{Handle: "@Exports"},
+			expectErr: true,
+		},
+		{
+			name:      "Avatar not an http url",
+			input:     profileParams{Handle: "fan", AvatarURL: "javascript:alert(1)"},
+			expectErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			output, err := validateProfile(c.input)
+			if err != nil {
+				if !c.expectErr {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if c.expectErr {
+				t.Errorf("expected error but got none")
+				return
+			}
+			if output != c.expected {
+				t.Errorf("\nexpected: %+v\ngot: %+v", c.expected, output)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/auth"
+	"github.com/h0dy/http-server/internal/database"
+)
+
+// Session is a device the user is logged in from (a first-party refresh token)
+type Session struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"` // nil until the refresh token is used
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	Current    bool       `json:"current"` // the session of the request
+}
+
+func sessionFromDB(session database.RefreshToken, currentID uuid.UUID) Session {
+	res := Session{
+		ID:        session.ID,
+		CreatedAt: session.CreatedAt,
+		ExpiresAt: session.ExpiresAt,
+		UserAgent: session.UserAgent,
+		IP:        session.Ip,
+		Current:   session.ID == currentID,
+	}
+	if session.LastUsedAt.Valid {
+		res.LastUsedAt = &session.LastUsedAt.Time
+	}
+	return res
+}
+
+// clientIP func returns the ip address of the client making the request
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// currentSessionID func returns the session the access token was issued for, uuid.Nil if it wasn't issued for one
+func currentSessionID(claims *auth.Claims) uuid.UUID {
+	if claims == nil {
+		return uuid.Nil
+	}
+	sessionID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return uuid.Nil
+	}
+	return sessionID
+}
+
+func (cfg *apiConfig) handlerGetSessions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, claims, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	sessions, err := cfg.store.GetSessions(r.Context(), userId)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve sessions", err)
+		return
+	}
+	currentID := currentSessionID(claims)
+	sessionsJson := []Session{}
+	for _, session := range sessions {
+		sessionsJson = append(sessionsJson, sessionFromDB(session, currentID))
+	}
+	respondWithJson(w, http.StatusOK, sessionsJson)
+}
+
+// handlerRevokeSession func logs a device out, its refresh token and the access tokens issued with it can't be used anymore
+func (cfg *apiConfig) handlerRevokeSession(w http.ResponseWriter, r *http.Request) {
+	sessionId, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Invalid session id", err)
+		return
+	}
+
+	userId, _, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	revoked, err := cfg.store.RevokeSession(r.Context(), database.RevokeSessionParams{
+		ID:     sessionId,
+		UserID: userId,
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't revoke the session", err)
+		return
+	}
+	if revoked == 0 {
+		respondWithErr(w, http.StatusNotFound, "Couldn't find the session", sql.ErrNoRows)
+		return
+	}
+	if err := cfg.revokeToken(r.Context(), sessionId.String()); err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't revoke the access tokens of the session", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerRevokeOtherSessions func logs out everywhere else, every session but the one of the request
+func (cfg *apiConfig) handlerRevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		RevokedSessions int64 `json:"revoked_sessions"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, claims, err := cfg.authenticate(r, auth.ScopeAccount)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	revoked, err := cfg.revokeOtherSessions(r.Context(), userId, currentSessionID(claims))
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't revoke the sessions", err)
+		return
+	}
+	respondWithJson(w, http.StatusOK, response{RevokedSessions: revoked})
+}
+
+// revokeOtherSessions func revokes every session of the user but the current one, with their access tokens,
+// and returns how many were revoked
+func (cfg *apiConfig) revokeOtherSessions(ctx context.Context, userID, currentID uuid.UUID) (int64, error) {
+	sessionIDs, err := cfg.store.RevokeOtherSessions(ctx, database.RevokeOtherSessionsParams{
+		UserID:    userID,
+		CurrentID: currentID,
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, sessionID := range sessionIDs {
+		if err := cfg.revokeToken(ctx, sessionID.String()); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(sessionIDs)), nil
+}
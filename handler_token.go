@@ -1,12 +1,36 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
 	"net/http"
+	"slices"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/h0dy/http-server/internal/auth"
+	"github.com/h0dy/http-server/internal/database"
 )
 
+// how long access tokens (JWT) are valid, revocations are kept as long
+const accessTokenExpiry = time.Hour
+
+// makeAccessToken func creates an access token (JWT) for the session of the user with every user scope plus the permissions of their roles
+func (cfg *apiConfig) makeAccessToken(ctx context.Context, userID, sessionID uuid.UUID) (string, error) {
+	roles, err := cfg.store.GetUserRoles(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("couldn't retrieve user roles: %v", err)
+	}
+	permissions, err := cfg.store.GetUserPermissions(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("couldn't retrieve user permissions: %v", err)
+	}
+	scopes := append(slices.Clone(auth.UserScopes), permissions...)
+	return auth.MakeSessionJWT(userID, sessionID, cfg.jwtSecret, accessTokenExpiry, roles, scopes)
+}
+
 // handlerRefreshToken func creates a new access token(JWT) with the refresh token in the header
 func (cfg *apiConfig) handlerRefreshToken(w http.ResponseWriter, r *http.Request) {
 	refreshToken, err := auth.GetBearerToken(r.Header)
@@ -20,16 +44,20 @@ func (cfg *apiConfig) handlerRefreshToken(w http.ResponseWriter, r *http.Request
 	}
 	w.Header().Set("Content-Type", "application/json")
 
-	user, err := cfg.db.GetUserFromRefreshToken(r.Context(), refreshToken)
+	session, err := cfg.store.UseRefreshToken(r.Context(), database.UseRefreshTokenParams{
+		Token: refreshToken,
+		Ip:    clientIP(r),
+	})
 	if err != nil {
 		respondWithErr(w, http.StatusUnauthorized, "Invalid or expired refresh token", err)
 		return
 	}
 
 	// create a new access token(JWT)
-	accessToken, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Hour)
+	accessToken, err := cfg.makeAccessToken(r.Context(), session.UserID, session.ID)
 	if err != nil {
-		respondWithErr(w, http.StatusBadRequest, "Couldn't generate token", err)
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't generate token", err)
+		return
 	}
 
 	respondWithJson(w, http.StatusOK, response{
@@ -37,19 +65,83 @@ func (cfg *apiConfig) handlerRefreshToken(w http.ResponseWriter, r *http.Request
 	})
 }
 
+// handlerRevokeToken func logs out, it revokes the refresh token and the access tokens issued with it
 func (cfg *apiConfig) handlerRevokeToken(w http.ResponseWriter, r *http.Request) {
 	refreshToken, err := auth.GetBearerToken(r.Header)
 	if err != nil {
 		respondWithErr(w, http.StatusUnauthorized, err.Error(), err)
 		return
 	}
-	if err := cfg.db.SetRevokedAtToken(r.Context(), refreshToken); err != nil {
+	session, err := cfg.store.GetRefreshToken(r.Context(), refreshToken)
+	if err != nil || session.ClientID.Valid {
 		respondWithErr(w, http.StatusUnauthorized, "Couldn't revoke token", err)
 		return
 	}
+	if err := cfg.store.SetRevokedAtToken(r.Context(), refreshToken); err != nil {
+		respondWithErr(w, http.StatusUnauthorized, "Couldn't revoke token", err)
+		return
+	}
+	if err := cfg.revokeToken(r.Context(), session.ID.String()); err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't revoke the access tokens", err)
+		return
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// revokeToken func revokes an access token by its id (jti), or every access token of a session by its id (sid).
+// it takes effect right away on this server, and on the others when they sync their denylist
+func (cfg *apiConfig) revokeToken(ctx context.Context, id string) error {
+	expiresAt := time.Now().UTC().Add(accessTokenExpiry)
+	if err := cfg.store.RevokeToken(ctx, database.RevokeTokenParams{
+		ID:        id,
+		ExpiresAt: expiresAt,
+	}); err != nil {
+		return fmt.Errorf("couldn't revoke token %v: %v", id, err)
+	}
+	cfg.denylist.RevokeToken(id, expiresAt)
+	return nil
+}
+
+// revokeUserTokens func revokes every access token of the user issued so far (e.g. after a password change).
+// tokens are issued with a precision of a second, so the time is truncated to match
+func (cfg *apiConfig) revokeUserTokens(ctx context.Context, userID uuid.UUID) error {
+	validAfter := time.Now().UTC().Truncate(time.Second)
+	if err := cfg.store.SetTokensValidAfter(ctx, database.SetTokensValidAfterParams{
+		ID:               userID,
+		TokensValidAfter: sql.NullTime{Time: validAfter, Valid: true},
+	}); err != nil {
+		return fmt.Errorf("couldn't revoke the tokens of user %v: %v", userID, err)
+	}
+	cfg.denylist.RevokeUserTokens(userID.String(), validAfter)
+	return nil
+}
+
+// syncDenylist func loads the revocations made by every server into the denylist and drops the outdated ones
+func (cfg *apiConfig) syncDenylist(ctx context.Context) {
+	revokedTokens, err := cfg.store.GetRevokedTokens(ctx)
+	if err != nil {
+		log.Printf("error in syncing the denylist: %v", err)
+		return
+	}
+	for _, revokedToken := range revokedTokens {
+		cfg.denylist.RevokeToken(revokedToken.ID, revokedToken.ExpiresAt)
+	}
+
+	users, err := cfg.store.GetTokensValidAfter(ctx, time.Now().UTC().Add(-accessTokenExpiry))
+	if err != nil {
+		log.Printf("error in syncing the denylist: %v", err)
+		return
+	}
+	for _, user := range users {
+		cfg.denylist.RevokeUserTokens(user.ID.String(), user.TokensValidAfter.Time)
+	}
+
+	if err := cfg.store.PurgeRevokedTokens(ctx); err != nil {
+		log.Printf("error in purging revoked tokens: %v", err)
+	}
+	cfg.denylist.Prune(time.Now().UTC(), accessTokenExpiry)
+}
+
 // with cookies
 // func (cfg *apiConfig) handlerRefreshToken(w http.ResponseWriter, r *http.Request) {
 
@@ -3,21 +3,48 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/h0dy/http-server/internal/auth"
 	"github.com/h0dy/http-server/internal/database"
+	"github.com/h0dy/http-server/internal/mail"
 
 	"github.com/google/uuid"
 )
 
 type User struct { // User strut to hold json response
-	ID          uuid.UUID `json:"id"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Email       string    `json:"email"`
-	IsChirpyRed bool      `json:"is_chirpy_red"`
+	ID          uuid.UUID  `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	Email       string     `json:"email"`
+	IsChirpyRed bool       `json:"is_chirpy_red"`
+	Handle      string     `json:"handle"`
+	DisplayName string     `json:"display_name"`
+	Bio         string     `json:"bio"`
+	AvatarURL   string     `json:"avatar_url"`
+	DeleteAfter *time.Time `json:"delete_after,omitempty"` // set while the account is scheduled for deletion
+}
+
+// userFromDB func converts a database user into the json response of the user themselves (it includes the email)
+func userFromDB(user database.User) User {
+	res := User{
+		ID:          user.ID,
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+		Email:       user.Email,
+		IsChirpyRed: user.ChirpyRedUntil.Valid && time.Now().Before(user.ChirpyRedUntil.Time), // derived from the subscription
+		Handle:      user.Handle.String,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarURL:   user.AvatarUrl,
+	}
+	if user.DeleteAfter.Valid {
+		res.DeleteAfter = &user.DeleteAfter.Time
+	}
+	return res
 }
 
 // handlerCreateUser func is a handler to create user
@@ -48,13 +75,18 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 		respondWithErr(w, http.StatusBadRequest, "Make sure to provide the password", nil)
 		return
 	}
+	if err := auth.ValidatePassword(data.Password, data.Email); err != nil {
+		respondWithErr(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
 
-	hashedPassword, err := auth.HashPassword(data.Password)
+	hashedPassword, err := auth.HashPasswordWithParams(data.Password, cfg.passwordParams)
 	if err != nil {
 		respondWithErr(w, http.StatusInternalServerError, "Couldn't hash the password", err)
+		return
 	}
 
-	user, err := cfg.db.CreateUser(context.Background(), database.CreateUserParams{
+	user, err := cfg.store.CreateUser(context.Background(), database.CreateUserParams{
 		Email:          data.Email,
 		HashedPassword: hashedPassword,
 	})
@@ -62,63 +94,43 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 		respondWithErr(w, http.StatusInternalServerError, "Something went wrong, maybe try login in instead", err)
 		return
 	}
-	respondWithJson(w, http.StatusCreated, User{
-		ID:          user.ID,
-		CreatedAt:   user.CreatedAt,
-		UpdatedAt:   user.UpdatedAt,
-		Email:       user.Email,
-		IsChirpyRed: user.IsChirpyRed,
-	})
+	respondWithJson(w, http.StatusCreated, userFromDB(user))
 }
 
-func (cfg *apiConfig) handlerUserLogin(w http.ResponseWriter, r *http.Request) {
-	type reqBody struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
+// respondWithLogin func issues an access token and a refresh token to the user who just logged in,
+// unless the account is scheduled for deletion
+func (cfg *apiConfig) respondWithLogin(w http.ResponseWriter, r *http.Request, user database.User) {
 	type response struct {
 		User
 		Token        string `json:"token"`
 		RefreshToken string `json:"refresh_token"`
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	defer r.Body.Close()
-
-	data := reqBody{}
-	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&data); err != nil {
-		respondWithErr(w, http.StatusInternalServerError, "Couldn't decode the json data", err)
-		return
-	}
-	user, err := cfg.db.GetUserByEmail(context.Background(), data.Email)
-	if err != nil {
-		respondWithErr(w, http.StatusBadRequest, "Incorrect credential; incorrect email or password", err)
-		return
-	}
-
-	if err := auth.CheckPasswordHash(data.Password, user.HashedPassword); err != nil {
-		respondWithErr(w, http.StatusUnauthorized, "Incorrect credential; incorrect email or password", err)
-		return
-	}
-
-	accessToken, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Hour)
-	if err != nil {
-		respondWithErr(w, http.StatusInternalServerError, "error in generating token", err)
+	if user.DeleteAfter.Valid {
+		respondWithErr(w, http.StatusForbidden, "The account is scheduled for deletion; restore it with POST /api/users/restore", nil)
 		return
 	}
 
+	// every login starts a new session, the refresh token
 	refreshToken := auth.MarkRefreshToken()
-	_, err = cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+	session, err := cfg.store.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
 		Token:     refreshToken,
 		UserID:    user.ID,
 		ExpiresAt: time.Now().UTC().Add(time.Hour * 24 * 60),
+		UserAgent: r.UserAgent(),
+		Ip:        clientIP(r),
 	})
 	if err != nil {
 		respondWithErr(w, http.StatusInternalServerError, "Couldn't create access JWT", err)
 		return
 	}
 
+	accessToken, err := cfg.makeAccessToken(r.Context(), user.ID, session.ID)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "error in generating token", err)
+		return
+	}
+
 	// 🍪 set HttpOnly cookie
 	http.SetCookie(w, &http.Cookie{
 		Name:     "refresh_token",
@@ -130,75 +142,187 @@ func (cfg *apiConfig) handlerUserLogin(w http.ResponseWriter, r *http.Request) {
 		MaxAge:   int((24 * time.Hour * 60).Seconds()),
 	})
 
+	w.Header().Set("Content-Type", "application/json")
 	respondWithJson(w, http.StatusOK, response{
-		User: User{
-			ID:          user.ID,
-			CreatedAt:   user.CreatedAt,
-			UpdatedAt:   user.UpdatedAt,
-			Email:       user.Email,
-			IsChirpyRed: user.IsChirpyRed,
-		},
+		User:         userFromDB(user),
 		Token:        accessToken,
 		RefreshToken: refreshToken,
 	})
 }
 
-func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request) {
+func (cfg *apiConfig) handlerUserLogin(w http.ResponseWriter, r *http.Request) {
 	type reqBody struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
 	}
 
-	type response struct {
-		User
-		Token string `json:"token"`
-	}
-
 	w.Header().Set("Content-Type", "application/json")
 	defer r.Body.Close()
 
 	data := reqBody{}
 	decoder := json.NewDecoder(r.Body)
 	if err := decoder.Decode(&data); err != nil {
-		respondWithErr(w, http.StatusInternalServerError, "something went wrong", err)
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't decode the json data", err)
 		return
 	}
-
-	accessToken, err := auth.GetBearerToken(r.Header)
+	user, err := cfg.store.GetUserByEmail(context.Background(), data.Email)
 	if err != nil {
-		respondWithErr(w, http.StatusUnauthorized, "Unauthorized", err)
+		respondWithErr(w, http.StatusBadRequest, "Incorrect credential; incorrect email or password", err)
+		return
+	}
+
+	if err := auth.CheckPasswordHash(data.Password, user.HashedPassword); err != nil {
+		respondWithErr(w, http.StatusUnauthorized, "Incorrect credential; incorrect email or password", err)
 		return
 	}
 
-	userID, err := auth.ValidateJWT(accessToken, cfg.jwtSecret)
+	// bcrypt hashes and argon2id hashes with outdated parameters are replaced, the password is known only now
+	if auth.NeedsRehash(user.HashedPassword, cfg.passwordParams) {
+		cfg.rehashPassword(r.Context(), user.ID, data.Password)
+	}
+
+	cfg.respondWithLogin(w, r, user)
+}
+
+// rehashPassword func replaces the hash of the user's password with one made with the current parameters,
+// failing only means the old hash stays, so errors are logged
+func (cfg *apiConfig) rehashPassword(ctx context.Context, userID uuid.UUID, password string) {
+	hashedPassword, err := auth.HashPasswordWithParams(password, cfg.passwordParams)
 	if err != nil {
-		respondWithErr(w, http.StatusUnauthorized, "Unauthorized", err)
+		log.Printf("couldn't rehash the password of user %v: %v", userID, err)
+		return
+	}
+	if err := cfg.store.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{
+		ID:             userID,
+		HashedPassword: hashedPassword,
+	}); err != nil {
+		log.Printf("couldn't rehash the password of user %v: %v", userID, err)
+	}
+}
+
+// handlerUpdateUser func changes the email and/or the password of the user, only the fields given change and the
+// current password is required. a new email only replaces the old one once it's confirmed from the new address.
+// the users without a password (created through a provider login) set one here, after a recent provider login
+func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		CurrentPassword     string  `json:"current_password"`
+		Email               *string `json:"email"`
+		Password            *string `json:"password"`
+		RevokeOtherSessions bool    `json:"revoke_other_sessions"` // log out everywhere else
+	}
+
+	type response struct {
+		User
+		Token           string `json:"token,omitempty"`         // a new access token, when the password changed
+		PendingEmail    string `json:"pending_email,omitempty"` // the new email waiting for its confirmation
+		RevokedSessions int64  `json:"revoked_sessions,omitempty"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	defer r.Body.Close()
+
+	data := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Couldn't decode the json data", err)
+		return
+	}
+	if data.Email == nil && data.Password == nil && !data.RevokeOtherSessions {
+		respondWithErr(w, http.StatusBadRequest, "Make sure to provide the email or the password to change", nil)
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(data.Password)
+	// changing the credentials needs an access token (JWT), personal access tokens can't do it
+	userID, claims, err := cfg.authenticate(r, auth.ScopeAccount)
 	if err != nil {
-		respondWithErr(w, http.StatusInternalServerError, "Couldn't hash the password", err)
+		respondWithAuthErr(w, err)
+		return
 	}
 
-	user, err := cfg.db.UpdateUserPassEmail(r.Context(), database.UpdateUserPassEmailParams{
-		Email:          data.Email,
-		HashedPassword: hashedPassword,
-		ID:             userID,
-	})
+	user, err := cfg.store.GetUserByID(r.Context(), userID)
 	if err != nil {
 		respondWithErr(w, http.StatusNotFound, "Couldn't find the user", err)
 		return
 	}
+	if err := cfg.checkReauthentication(r.Context(), user, data.CurrentPassword, claims); err != nil {
+		respondWithReauthErr(w, err, "Incorrect current password")
+		return
+	}
 
-	respondWithJson(w, http.StatusOK, response{
-		User: User{
-			ID:          user.ID,
-			CreatedAt:   user.CreatedAt,
-			UpdatedAt:   user.UpdatedAt,
-			Email:       user.Email,
-			IsChirpyRed: user.IsChirpyRed,
-		},
-		Token: accessToken,
-	})
+	// every field is validated before anything changes
+	newEmail := ""
+	if data.Email != nil {
+		newEmail = strings.TrimSpace(*data.Email)
+		if !mail.ValidAddress(newEmail) {
+			respondWithErr(w, http.StatusBadRequest, "Invalid email", nil)
+			return
+		}
+		if strings.EqualFold(newEmail, user.Email) {
+			respondWithErr(w, http.StatusBadRequest, "The new email is the current email", nil)
+			return
+		}
+		if _, err := cfg.store.GetUserByEmail(r.Context(), newEmail); err == nil {
+			respondWithErr(w, http.StatusConflict, "Email is already in use", nil)
+			return
+		}
+	}
+	if data.Password != nil {
+		// the password must not look like the current email, nor the new one the account is about to use
+		for _, email := range []string{user.Email, newEmail} {
+			if email == "" {
+				continue
+			}
+			if err := auth.ValidatePassword(*data.Password, email); err != nil {
+				respondWithErr(w, http.StatusBadRequest, err.Error(), err)
+				return
+			}
+		}
+	}
+
+	res := response{}
+	if newEmail != "" {
+		if err := cfg.requestEmailChange(r.Context(), user, newEmail); err != nil {
+			respondWithErr(w, http.StatusInternalServerError, "Couldn't send the email confirmation", err)
+			return
+		}
+		res.PendingEmail = newEmail
+	}
+
+	if data.Password != nil {
+		hashedPassword, err := auth.HashPasswordWithParams(*data.Password, cfg.passwordParams)
+		if err != nil {
+			respondWithErr(w, http.StatusInternalServerError, "Couldn't hash the password", err)
+			return
+		}
+		user, err = cfg.store.ChangeUserPassword(r.Context(), database.ChangeUserPasswordParams{
+			ID:             userID,
+			HashedPassword: hashedPassword,
+		})
+		if err != nil {
+			respondWithErr(w, http.StatusInternalServerError, "Couldn't change the password", err)
+			return
+		}
+
+		// access tokens issued with the old password are revoked, the current session gets a new one
+		if err := cfg.revokeUserTokens(r.Context(), userID); err != nil {
+			respondWithErr(w, http.StatusInternalServerError, "Couldn't revoke the access tokens", err)
+			return
+		}
+		res.Token, err = cfg.makeAccessToken(r.Context(), userID, currentSessionID(claims))
+		if err != nil {
+			respondWithErr(w, http.StatusInternalServerError, "error in generating token", err)
+			return
+		}
+	}
+
+	if data.RevokeOtherSessions {
+		res.RevokedSessions, err = cfg.revokeOtherSessions(r.Context(), userID, currentSessionID(claims))
+		if err != nil {
+			respondWithErr(w, http.StatusInternalServerError, "Couldn't revoke the other sessions", err)
+			return
+		}
+	}
+
+	res.User = userFromDB(user)
+	respondWithJson(w, http.StatusOK, res)
 }
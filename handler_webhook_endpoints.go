@@ -0,0 +1,441 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/auth"
+	"github.com/h0dy/http-server/internal/database"
+)
+
+const (
+	maxWebhookEndpoints = 10
+	maxWebhookURLLength = 2048
+	webhookSecretPrefix = "whsec_"
+)
+
+type WebhookEndpoint struct {
+	ID           uuid.UUID  `json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	ClientID     *string    `json:"client_id"` // the app that registered it, null when the user did
+	URL          string     `json:"url"`
+	Events       []string   `json:"events"`
+	Enabled      bool       `json:"enabled"`
+	FailureCount int32      `json:"failure_count"` // failed attempts in a row
+	DisabledAt   *time.Time `json:"disabled_at"`
+}
+
+func webhookEndpointFromDB(endpoint database.WebhookEndpoint) WebhookEndpoint {
+	res := WebhookEndpoint{
+		ID:           endpoint.ID,
+		CreatedAt:    endpoint.CreatedAt,
+		UpdatedAt:    endpoint.UpdatedAt,
+		URL:          endpoint.Url,
+		Events:       endpoint.Events,
+		Enabled:      !endpoint.DisabledAt.Valid,
+		FailureCount: endpoint.FailureCount,
+	}
+	if endpoint.ClientID.Valid {
+		res.ClientID = &endpoint.ClientID.String
+	}
+	if endpoint.DisabledAt.Valid {
+		res.DisabledAt = &endpoint.DisabledAt.Time
+	}
+	return res
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	Event          string          `json:"event"`
+	Status         string          `json:"status"` // pending, delivered or failed
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at"` // only set while the delivery is pending
+	LastAttemptAt  *time.Time      `json:"last_attempt_at"`
+	ResponseStatus *int32          `json:"response_status"` // http status of the last attempt, null if the endpoint couldn't be reached
+	LastError      string          `json:"last_error"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+	Payload        json.RawMessage `json:"payload"`
+}
+
+func webhookDeliveryFromDB(delivery database.WebhookDelivery) WebhookDelivery {
+	res := WebhookDelivery{
+		ID:        delivery.ID,
+		CreatedAt: delivery.CreatedAt,
+		Event:     delivery.Event,
+		Status:    delivery.Status,
+		Attempts:  delivery.Attempts,
+		LastError: delivery.LastError,
+		Payload:   json.RawMessage(delivery.Payload),
+	}
+	if delivery.Status == webhookDeliveryPending {
+		res.NextAttemptAt = &delivery.NextAttemptAt
+	}
+	if delivery.LastAttemptAt.Valid {
+		res.LastAttemptAt = &delivery.LastAttemptAt.Time
+	}
+	if delivery.ResponseStatus.Valid {
+		res.ResponseStatus = &delivery.ResponseStatus.Int32
+	}
+	if delivery.DeliveredAt.Valid {
+		res.DeliveredAt = &delivery.DeliveredAt.Time
+	}
+	return res
+}
+
+// webhookClientID func returns the app the request was made by, an app only manages the endpoints it registered
+func webhookClientID(claims *auth.Claims) sql.NullString {
+	return sql.NullString{String: claims.ClientID, Valid: claims.ClientID != ""}
+}
+
+// validateWebhookURL func makes sure a webhook url is an absolute https url. the server is the one calling it,
+// so hosts of the local network are rejected (only ip addresses, names aren't resolved until the delivery)
+func validateWebhookURL(rawURL string) error {
+	if len(rawURL) > maxWebhookURLLength {
+		return errors.New("the url is too long")
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || !parsed.IsAbs() || parsed.Host == "" {
+		return errors.New("the url must be an absolute url")
+	}
+	if parsed.Scheme != "https" {
+		return errors.New("the url must use https")
+	}
+	if parsed.User != nil {
+		return errors.New("the url can't hold credentials")
+	}
+	host := parsed.Hostname()
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errors.New("the url can't point to the local network")
+	}
+	if ip := net.ParseIP(host); ip != nil && isLocalNetworkIP(ip) {
+		return errors.New("the url can't point to the local network")
+	}
+	return nil
+}
+
+// localNetworks are the ranges the webhooks can't be sent to: the server, its networks (the metadata services of the
+// clouds included) and the ranges that aren't routed on the internet, from the IANA special-purpose registries.
+// the ipv6 ranges that embed an ipv4 address (NAT64, 6to4, Teredo, ...) are all refused, the gateway translating them
+// could be the one reaching the local network
+var localNetworks = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // this network
+	netip.MustParsePrefix("10.0.0.0/8"),      // private
+	netip.MustParsePrefix("100.64.0.0/10"),   // shared address space (CGNAT), metadata services like 100.100.100.200
+	netip.MustParsePrefix("127.0.0.0/8"),     // loopback
+	netip.MustParsePrefix("169.254.0.0/16"),  // link-local, metadata services like 169.254.169.254
+	netip.MustParsePrefix("172.16.0.0/12"),   // private
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("192.88.99.0/24"),  // 6to4 relay anycast
+	netip.MustParsePrefix("192.168.0.0/16"),  // private
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("224.0.0.0/4"),     // multicast
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, and the broadcast address
+
+	netip.MustParsePrefix("::/96"),          // unspecified, loopback and the deprecated ipv4-compatible addresses
+	netip.MustParsePrefix("::ffff:0:0/96"),  // ipv4-mapped, only reached when unmapping is skipped
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64
+	netip.MustParsePrefix("64:ff9b:1::/48"), // local-use NAT64
+	netip.MustParsePrefix("100::/64"),       // discard-only
+	netip.MustParsePrefix("2001::/32"),      // Teredo
+	netip.MustParsePrefix("2001:db8::/32"),  // documentation
+	netip.MustParsePrefix("2002::/16"),      // 6to4
+	netip.MustParsePrefix("fc00::/7"),       // unique local
+	netip.MustParsePrefix("fe80::/10"),      // link-local
+	netip.MustParsePrefix("fec0::/10"),      // site-local, deprecated
+	netip.MustParsePrefix("ff00::/8"),       // multicast
+}
+
+// isLocalNetworkIP func reports whether the webhooks can't be sent to the ip, it belongs to localNetworks. an ipv4
+// address mapped to ipv6 (::ffff:10.0.0.1) is checked as the ipv4 address it is
+func isLocalNetworkIP(ip net.IP) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return true
+	}
+	addr = addr.Unmap()
+	for _, network := range localNetworks {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateWebhookEvents func makes sure the events are known and returns them without duplicates
+func validateWebhookEvents(events []string) ([]string, error) {
+	if len(events) == 0 {
+		return nil, errors.New("make sure to provide the events to send")
+	}
+	res := []string{}
+	for _, event := range events {
+		if !slices.Contains(webhookEventTypes, event) {
+			return nil, fmt.Errorf("unknown event %q, events must be some of: %v", event, strings.Join(webhookEventTypes, ", "))
+		}
+		if !slices.Contains(res, event) {
+			res = append(res, event)
+		}
+	}
+	return res, nil
+}
+
+// handlerCreateWebhookEndpoint func registers a url to send the events of the user to, an app registers it
+// on behalf of the user. the signing secret is only returned once
+func (cfg *apiConfig) handlerCreateWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+	type reqBody struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+	}
+	type response struct {
+		WebhookEndpoint
+		Secret string `json:"secret"` // the deliveries are signed with it
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	defer r.Body.Close()
+
+	userId, claims, err := cfg.authenticate(r, auth.ScopeWebhooks)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	data := reqBody{}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Couldn't decode the json data", err)
+		return
+	}
+	if err := validateWebhookURL(data.URL); err != nil {
+		respondWithErr(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	events, err := validateWebhookEvents(data.Events)
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	endpoints, err := cfg.store.GetWebhookEndpoints(r.Context(), database.GetWebhookEndpointsParams{UserID: userId})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve webhooks", err)
+		return
+	}
+	if len(endpoints) >= maxWebhookEndpoints {
+		respondWithErr(w, http.StatusConflict, fmt.Sprintf("You can't register more than %d webhooks", maxWebhookEndpoints), nil)
+		return
+	}
+
+	secret := webhookSecretPrefix + auth.MarkRefreshToken()
+	endpoint, err := cfg.store.CreateWebhookEndpoint(r.Context(), database.CreateWebhookEndpointParams{
+		UserID:   userId,
+		ClientID: webhookClientID(claims),
+		Url:      data.URL,
+		Secret:   secret,
+		Events:   events,
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't register the webhook", err)
+		return
+	}
+	respondWithJson(w, http.StatusCreated, response{
+		WebhookEndpoint: webhookEndpointFromDB(endpoint),
+		Secret:          secret,
+	})
+}
+
+func (cfg *apiConfig) handlerGetWebhookEndpoints(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, claims, err := cfg.authenticate(r, auth.ScopeWebhooks)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+
+	endpoints, err := cfg.store.GetWebhookEndpoints(r.Context(), database.GetWebhookEndpointsParams{
+		UserID:   userId,
+		ClientID: webhookClientID(claims),
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve webhooks", err)
+		return
+	}
+	endpointsJson := []WebhookEndpoint{}
+	for _, endpoint := range endpoints {
+		endpointsJson = append(endpointsJson, webhookEndpointFromDB(endpoint))
+	}
+	respondWithJson(w, http.StatusOK, endpointsJson)
+}
+
+// handlerUpdateWebhookEndpoint func changes the url, the events or whether a webhook is enabled, the fields are optional.
+// enabling a webhook resets its failures, its pending deliveries are sent again
+func (cfg *apiConfig) handlerUpdateWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+	type reqBody struct {
+		URL     *string  `json:"url"`
+		Events  []string `json:"events"`
+		Enabled *bool    `json:"enabled"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	defer r.Body.Close()
+
+	userId, claims, err := cfg.authenticate(r, auth.ScopeWebhooks)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+	endpointId, err := uuid.Parse(r.PathValue("webhookID"))
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Invalid webhook id", err)
+		return
+	}
+
+	data := reqBody{}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Couldn't decode the json data", err)
+		return
+	}
+
+	endpoint, err := cfg.store.GetWebhookEndpoint(r.Context(), database.GetWebhookEndpointParams{
+		ID:       endpointId,
+		UserID:   userId,
+		ClientID: webhookClientID(claims),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithErr(w, http.StatusNotFound, "Couldn't find the webhook", err)
+			return
+		}
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve the webhook", err)
+		return
+	}
+
+	params := database.UpdateWebhookEndpointParams{
+		ID:           endpoint.ID,
+		Url:          endpoint.Url,
+		Events:       endpoint.Events,
+		FailureCount: endpoint.FailureCount,
+		DisabledAt:   endpoint.DisabledAt,
+	}
+	if data.URL != nil {
+		if err := validateWebhookURL(*data.URL); err != nil {
+			respondWithErr(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+		params.Url = *data.URL
+	}
+	if data.Events != nil {
+		params.Events, err = validateWebhookEvents(data.Events)
+		if err != nil {
+			respondWithErr(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+	}
+	if data.Enabled != nil && *data.Enabled {
+		params.FailureCount = 0
+		params.DisabledAt = sql.NullTime{}
+	} else if data.Enabled != nil && !endpoint.DisabledAt.Valid {
+		params.DisabledAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+	}
+
+	endpoint, err = cfg.store.UpdateWebhookEndpoint(r.Context(), params)
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't update the webhook", err)
+		return
+	}
+	respondWithJson(w, http.StatusOK, webhookEndpointFromDB(endpoint))
+}
+
+// handlerDeleteWebhookEndpoint func deletes a webhook with its deliveries
+func (cfg *apiConfig) handlerDeleteWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+	userId, claims, err := cfg.authenticate(r, auth.ScopeWebhooks)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+	endpointId, err := uuid.Parse(r.PathValue("webhookID"))
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Invalid webhook id", err)
+		return
+	}
+
+	deleted, err := cfg.store.DeleteWebhookEndpoint(r.Context(), database.DeleteWebhookEndpointParams{
+		ID:       endpointId,
+		UserID:   userId,
+		ClientID: webhookClientID(claims),
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't delete the webhook", err)
+		return
+	}
+	if deleted == 0 {
+		respondWithErr(w, http.StatusNotFound, "Couldn't find the webhook", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerGetWebhookDeliveries func lists a page of the deliveries of a webhook, the latest first
+func (cfg *apiConfig) handlerGetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, claims, err := cfg.authenticate(r, auth.ScopeWebhooks)
+	if err != nil {
+		respondWithAuthErr(w, err)
+		return
+	}
+	endpointId, err := uuid.Parse(r.PathValue("webhookID"))
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Invalid webhook id", err)
+		return
+	}
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	if _, err := cfg.store.GetWebhookEndpoint(r.Context(), database.GetWebhookEndpointParams{
+		ID:       endpointId,
+		UserID:   userId,
+		ClientID: webhookClientID(claims),
+	}); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithErr(w, http.StatusNotFound, "Couldn't find the webhook", err)
+			return
+		}
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve the webhook", err)
+		return
+	}
+
+	deliveries, err := cfg.store.GetWebhookDeliveries(r.Context(), database.GetWebhookDeliveriesParams{
+		EndpointID: endpointId,
+		Limit:      limit,
+		Offset:     offset,
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve the deliveries", err)
+		return
+	}
+	deliveriesJson := []WebhookDelivery{}
+	for _, delivery := range deliveries {
+		deliveriesJson = append(deliveriesJson, webhookDeliveryFromDB(delivery))
+	}
+	respondWithJson(w, http.StatusOK, deliveriesJson)
+}
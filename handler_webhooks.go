@@ -1,51 +1,319 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
-	"github.com/h0dy/http-server/internal/auth"
+	"github.com/h0dy/http-server/internal/database"
+	"github.com/h0dy/http-server/internal/store"
+	"github.com/h0dy/http-server/internal/webhook"
 )
 
-// handlerChirpyUpgrade func is a handler to handle polka (payment provider) webhooks signals
-func (cfg *apiConfig) handlerChirpyUpgrade(w http.ResponseWriter, r *http.Request) {
-	type reqBody struct {
-		Event string `json:"event"`
-		Data  struct {
-			UserId uuid.UUID `json:"user_id"`
-		} `json:"data"`
+const (
+	polkaTimestampHeader = "X-Polka-Timestamp" // unix time the webhook was sent at
+	polkaSignatureHeader = "X-Polka-Signature" // v1=<hex HMAC-SHA256 of "<timestamp>.<body>">
+
+	polkaSignatureTolerance = 5 * time.Minute
+	// processed events are kept well past the tolerance, older events are rejected by their timestamp anyway
+	webhookEventRetention = 24 * time.Hour
+	maxWebhookBodySize    = 1 << 20
+
+	webhookEventMaxAttempts = 8 // the event is failed after this many attempts, about an hour after it's received
+	webhookEventRetryBase   = 30 * time.Second
+	webhookEventRetryMax    = time.Hour
+	webhookEventBatchSize   = 50 // events processed by a run of the worker
+)
+
+const (
+	webhookEventPending   = "pending"
+	webhookEventProcessed = "processed"
+	webhookEventFailed    = "failed" // the dead letter state, the event is only processed again if an admin replays it
+)
+
+type WebhookEvent struct {
+	ID            string          `json:"id"`
+	CreatedAt     time.Time       `json:"created_at"`
+	Event         string          `json:"event"`
+	UserID        *uuid.UUID      `json:"user_id"`
+	SentAt        time.Time       `json:"sent_at"` // when the event happened, see polkaEventTime
+	Status        string          `json:"status"`  // pending, processed or failed
+	Attempts      int32           `json:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	LastError     string          `json:"last_error"`
+	ProcessedAt   *time.Time      `json:"processed_at"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+func webhookEventFromDB(event database.WebhookEvent) WebhookEvent {
+	res := WebhookEvent{
+		ID:            event.ID,
+		CreatedAt:     event.CreatedAt,
+		Event:         event.Event,
+		SentAt:        event.SentAt,
+		Status:        event.Status,
+		Attempts:      event.Attempts,
+		NextAttemptAt: event.NextAttemptAt,
+		LastError:     event.LastError,
+		Payload:       json.RawMessage(event.Payload),
+	}
+	if event.UserID.Valid {
+		res.UserID = &event.UserID.UUID
+	}
+	if event.ProcessedAt.Valid {
+		res.ProcessedAt = &event.ProcessedAt.Time
 	}
+	return res
+}
 
-	polkaApiKey, err := auth.GetAPIKey(r.Header)
+// handlerChirpyUpgrade func is a handler to handle polka (payment provider) webhooks signals,
+// the request must be signed with the polka key. the event is only stored so polka gets its answer right away,
+// processWebhookEvents processes it in the background
+func (cfg *apiConfig) handlerChirpyUpgrade(w http.ResponseWriter, r *http.Request) {
+	// the signature covers the raw body, so it's read before decoding
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodySize))
 	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Couldn't read the body", err)
+		return
+	}
+	timestamp := r.Header.Get(polkaTimestampHeader)
+	if err := cfg.polkaVerifier.Verify(body, timestamp, r.Header.Get(polkaSignatureHeader), time.Now()); err != nil {
 		respondWithErr(w, http.StatusUnauthorized, err.Error(), err)
 		return
 	}
-	if polkaApiKey != cfg.polkaKey {
-		respondWithErr(w, http.StatusUnauthorized, "API Key is invalid", nil)
+	signedAt, err := webhook.ParseTimestamp(timestamp)
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, err.Error(), err)
 		return
 	}
 
-	data := reqBody{}
-	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&data); err != nil {
-		respondWithErr(w, http.StatusInternalServerError, "something went wrong", err)
+	data := polkaEvent{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		respondWithErr(w, http.StatusBadRequest, "Couldn't decode the json data", err)
 		return
 	}
-	if data.Event != "user.upgraded" {
-		w.WriteHeader(http.StatusNoContent)
+	if data.ID == "" {
+		respondWithErr(w, http.StatusBadRequest, "Make sure to provide the event id", nil)
 		return
 	}
+	sentAt := polkaEventTime(data, signedAt)
+
+	created, err := cfg.store.CreateWebhookEvent(r.Context(), database.CreateWebhookEventParams{
+		ID:      data.ID,
+		Event:   data.Event,
+		UserID:  uuid.NullUUID{UUID: data.Data.UserID, Valid: data.Data.UserID != uuid.Nil},
+		Payload: string(body),
+		SentAt:  sentAt,
+	})
+	if err != nil {
+		// polka retries the event since it isn't acknowledged
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't store the event", err)
+		return
+	}
+	if created == 0 {
+		// a replay (or a retry of a delivered event) isn't stored again, it's acknowledged so polka stops retrying
+		log.Printf("ignoring polka event %v, it was already received", data.ID)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	if err := cfg.db.UpgradeToChirpyRed(r.Context(), data.Data.UserId); err != nil {
+// processWebhookEvents func processes the polka events that are due, each one in its own transaction
+func (cfg *apiConfig) processWebhookEvents(ctx context.Context) {
+	for range webhookEventBatchSize {
+		found, err := cfg.processNextWebhookEvent(ctx)
+		if err != nil {
+			log.Printf("error in processing webhook events: %v", err)
+			return
+		}
+		if !found {
+			return
+		}
+	}
+}
+
+// processNextWebhookEvent func processes the next due event and saves its outcome, it returns false when no event is due.
+// the event stays locked until then, so other servers skip it
+func (cfg *apiConfig) processNextWebhookEvent(ctx context.Context) (bool, error) {
+	found := false
+	err := cfg.store.InTx(ctx, func(tx store.Store) error {
+		event, err := tx.ClaimWebhookEvent(ctx)
 		if errors.Is(err, sql.ErrNoRows) {
-			respondWithErr(w, http.StatusNotFound, "Couldn't find the user", err)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't claim an event: %w", err)
+		}
+		found = true
+
+		// the changes of an event that fails are rolled back by its nested transaction, and its failure is saved instead
+		processErr := tx.InTx(ctx, func(tx store.Store) error {
+			return handleWebhookEvent(ctx, tx, event)
+		})
+		if processErr == nil {
+			if err := tx.CompleteWebhookEvent(ctx, event.ID); err != nil {
+				return fmt.Errorf("couldn't complete event %v: %w", event.ID, err)
+			}
+			return nil
+		}
+		status, nextAttemptAt := webhookEventRetry(event.Attempts+1, time.Now().UTC())
+		log.Printf("polka event %v failed (attempt %d, %v): %v", event.ID, event.Attempts+1, status, processErr)
+		if err := tx.FailWebhookEvent(ctx, database.FailWebhookEventParams{
+			ID:            event.ID,
+			Status:        status,
+			NextAttemptAt: nextAttemptAt,
+			LastError:     processErr.Error(),
+		}); err != nil {
+			return fmt.Errorf("couldn't save the failure of event %v: %w", event.ID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return found, nil
+}
+
+// handleWebhookEvent func applies a stored event, at the time polka sent it so a late or retried event
+// has the same effect as one processed right away
+func handleWebhookEvent(ctx context.Context, tx store.Store, event database.WebhookEvent) error {
+	data := polkaEvent{}
+	if err := json.Unmarshal([]byte(event.Payload), &data); err != nil {
+		return fmt.Errorf("couldn't decode the event: %w", err)
+	}
+
+	err := processPolkaEvent(ctx, tx, data, event.SentAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("couldn't find user %v", data.Data.UserID)
+	}
+	// errNoSubscription is retried: polka may send the upgrade after the events that follow it, and an event that
+	// still has no subscription after its last attempt ends up failed, where an admin can replay it
+	if errors.Is(err, errStaleEvent) {
+		// a later event was applied first, this one would undo it
+		log.Printf("ignoring polka event %v: %v", event.ID, err)
+		return nil
+	}
+	return err
+}
+
+// webhookEventRetry func returns the status of an event after its failed attempt, and when it's attempted next
+func webhookEventRetry(attempts int32, now time.Time) (status string, nextAttemptAt time.Time) {
+	if attempts >= webhookEventMaxAttempts {
+		return webhookEventFailed, now
+	}
+	return webhookEventPending, now.Add(webhook.Backoff(int(attempts), webhookEventRetryBase, webhookEventRetryMax))
+}
+
+// processPolkaEvent func updates the subscription of the user from the event, and whether the user is chirpy red
+func processPolkaEvent(ctx context.Context, tx store.Store, event polkaEvent, now time.Time) error {
+	var current *database.Subscription
+	sub, err := tx.GetSubscription(ctx, event.Data.UserID)
+	if err == nil {
+		current = &sub
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("couldn't retrieve the subscription: %w", err)
+	}
+
+	next, changed, err := applyPolkaEvent(current, event, now)
+	if err != nil || !changed {
+		return err
+	}
+	if _, err := tx.GetUserByID(ctx, event.Data.UserID); err != nil {
+		return err
+	}
+
+	sub, err = tx.UpsertSubscription(ctx, database.UpsertSubscriptionParams{
+		UserID:           next.UserID,
+		Plan:             next.Plan,
+		Status:           next.Status,
+		CurrentPeriodEnd: next.CurrentPeriodEnd,
+		CancelAt:         next.CancelAt,
+		LastEventAt:      next.LastEventAt,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't save the subscription: %v", err)
+	}
+	until := chirpyRedUntil(sub)
+	if err := tx.SetChirpyRedUntil(ctx, database.SetChirpyRedUntilParams{
+		ID:             sub.UserID,
+		ChirpyRedUntil: sql.NullTime{Time: until, Valid: !until.IsZero()},
+	}); err != nil {
+		return fmt.Errorf("couldn't update the user: %v", err)
+	}
+	return nil
+}
+
+// handlerAdminGetWebhookEvents func lists a page of the polka events with a status (failed by default),
+// it requires the webhooks:manage permission
+func (cfg *apiConfig) handlerAdminGetWebhookEvents(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = webhookEventFailed
+	}
+	if status != webhookEventPending && status != webhookEventProcessed && status != webhookEventFailed {
+		respondWithErr(w, http.StatusBadRequest, "status must be pending, processed or failed", nil)
+		return
+	}
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithErr(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	events, err := cfg.store.GetWebhookEventsByStatus(r.Context(), database.GetWebhookEventsByStatusParams{
+		Status: status,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve the events", err)
+		return
+	}
+	eventsJson := []WebhookEvent{}
+	for _, event := range events {
+		eventsJson = append(eventsJson, webhookEventFromDB(event))
+	}
+	respondWithJson(w, http.StatusOK, eventsJson)
+}
+
+// handlerAdminReplayWebhookEvent func puts a failed event back in the queue with all its attempts,
+// it requires the webhooks:manage permission. the event still waits for the earlier pending events of its user,
+// but the events processed since it failed aren't applied again after it
+func (cfg *apiConfig) handlerAdminReplayWebhookEvent(w http.ResponseWriter, r *http.Request) {
+	eventID := r.PathValue("eventID")
+
+	event, err := cfg.store.ReplayWebhookEvent(r.Context(), eventID)
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := cfg.store.GetWebhookEvent(r.Context(), eventID); errors.Is(err, sql.ErrNoRows) {
+			respondWithErr(w, http.StatusNotFound, "Couldn't find the event", err)
+			return
+		} else if err != nil {
+			respondWithErr(w, http.StatusInternalServerError, "Couldn't retrieve the event", err)
 			return
 		}
-		respondWithErr(w, http.StatusInternalServerError, "Couldn't update user", err)
+		respondWithErr(w, http.StatusConflict, "Only failed events can be replayed", nil)
+		return
+	}
+	if err != nil {
+		respondWithErr(w, http.StatusInternalServerError, "Couldn't replay the event", err)
+		return
+	}
+	respondWithJson(w, http.StatusOK, webhookEventFromDB(event))
+}
+
+func (cfg *apiConfig) purgeWebhookEvents(ctx context.Context) {
+	purged, err := cfg.store.PurgeWebhookEvents(ctx, time.Now().UTC().Add(-webhookEventRetention))
+	if err != nil {
+		log.Printf("error in purging webhook events: %v", err)
+		return
+	}
+	if purged > 0 {
+		log.Printf("purged %d webhook events", purged)
 	}
-	w.WriteHeader(http.StatusNoContent)
 }
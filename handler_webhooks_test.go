@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWebhookEventRetry(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		attempts   int32
+		wantStatus string
+		wantNext   time.Time
+	}{
+		{
+			name:       "First failure",
+			attempts:   1,
+			wantStatus: webhookEventPending,
+			wantNext:   now.Add(webhookEventRetryBase),
+		},
+		{
+			name:       "Backoff doubles",
+			attempts:   3,
+			wantStatus: webhookEventPending,
+			wantNext:   now.Add(4 * webhookEventRetryBase),
+		},
+		{
+			name:       "Last retry",
+			attempts:   webhookEventMaxAttempts - 1,
+			wantStatus: webhookEventPending,
+			wantNext:   now.Add(64 * webhookEventRetryBase),
+		},
+		{
+			name:       "Out of attempts",
+			attempts:   webhookEventMaxAttempts,
+			wantStatus: webhookEventFailed,
+			wantNext:   now,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, next := webhookEventRetry(tt.attempts, now)
+			if status != tt.wantStatus {
+				t.Errorf("webhookEventRetry() status = %v, want %v", status, tt.wantStatus)
+			}
+			if !next.Equal(tt.wantNext) {
+				t.Errorf("webhookEventRetry() next attempt = %v, want %v", next, tt.wantNext)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strings"
+)
+
+// scopes of the user's own data, access tokens (JWT) hold all of them
+// while personal access tokens only hold the ones picked by the user
+const (
+	ScopeAccount      = "account" // manage credentials and tokens, never granted to personal access tokens
+	ScopeChirpsRead   = "chirps:read"
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeProfileWrite = "profile:write"
+	ScopeWebhooks     = "webhooks" // manage the webhook endpoints of the account
+)
+
+// UserScopes are the scopes every logged in user holds in their access token
+var UserScopes = []string{ScopeAccount, ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite, ScopeWebhooks}
+
+// APITokenScopes are the scopes a personal access token can be granted
+var APITokenScopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite, ScopeWebhooks}
+
+// APITokenPrefix makes personal access tokens recognizable, e.g. by secret scanners
+const APITokenPrefix = "chirpy_pat_"
+
+// MakeAPIToken func returns a new random personal access token and the hash to store
+func MakeAPIToken() (token, hash string) {
+	key := make([]byte, 32)
+	rand.Read(key)
+	token = APITokenPrefix + hex.EncodeToString(key)
+	return token, HashToken(token)
+}
+
+// HashToken func returns the sha256 hash of a random token (personal access token, oauth code or secret),
+// tokens are random so a fast hash is enough
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAPIToken func reports whether a bearer token is a personal access token rather than a JWT
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, APITokenPrefix)
+}
+
+// ValidAPITokenScopes func reports whether every scope can be granted to a personal access token
+func ValidAPITokenScopes(scopes []string) bool {
+	if len(scopes) == 0 {
+		return false
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(APITokenScopes, scope) {
+			return false
+		}
+	}
+	return true
+}
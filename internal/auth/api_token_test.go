@@ -0,0 +1,43 @@
+package auth
+
+import "testing"
+
+func TestAPIToken(t *testing.T) {
+	token1, hash1 := MakeAPIToken()
+	token2, hash2 := MakeAPIToken()
+
+	if !IsAPIToken(token1) || !IsAPIToken(token2) {
+		t.Errorf("expected tokens to have the %v prefix: %v, %v", APITokenPrefix, token1, token2)
+	}
+	if token1 == token2 || hash1 == hash2 {
+		t.Errorf("expected different tokens")
+	}
+	if HashToken(token1) != hash1 {
+		t.Errorf("hash mismatch: got %v, expected %v", HashToken(token1), hash1)
+	}
+	if jwt, _ := MakeJWT([16]byte{}, "secret", 0, nil, nil); IsAPIToken(jwt) {
+		t.Errorf("expected a JWT not to be a personal access token")
+	}
+}
+
+func TestValidAPITokenScopes(t *testing.T) {
+	cases := []struct {
+		name     string
+		scopes   []string
+		expected bool
+	}{
+		{"Single scope", []string{ScopeChirpsRead}, true},
+		{"All scopes", []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite}, true},
+		{"No scopes", nil, false},
+		{"Account scope", []string{ScopeChirpsRead, ScopeAccount}, false},
+		{"Permission", []string{PermissionManageUsers}, false},
+		{"Unknown scope", []string{"chirps:everything"}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := ValidAPITokenScopes(c.scopes); got != c.expected {
+				t.Errorf("got %v, expected %v", got, c.expected)
+			}
+		})
+	}
+}
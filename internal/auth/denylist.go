@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// Denylist is an in-memory cache of the revoked access tokens, so checking a token doesn't need a database round trip.
+// a token is revoked by its id (jti), by its session (sid), or by its user when it was issued before the user's
+// tokens_valid_after. entries are only kept until the tokens they revoke would have expired anyway
+type Denylist struct {
+	mu     sync.RWMutex
+	tokens map[string]time.Time // revoked token and session ids, with when their tokens expire
+	users  map[string]time.Time // tokens of the user (subject) issued before the time are revoked
+}
+
+func NewDenylist() *Denylist {
+	return &Denylist{
+		tokens: map[string]time.Time{},
+		users:  map[string]time.Time{},
+	}
+}
+
+// RevokeToken func revokes the access token, or every access token of the session, with the id
+func (d *Denylist) RevokeToken(id string, expiresAt time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if expiresAt.After(d.tokens[id]) {
+		d.tokens[id] = expiresAt
+	}
+}
+
+// RevokeUserTokens func revokes the access tokens of the user issued before validAfter
+func (d *Denylist) RevokeUserTokens(userID string, validAfter time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if validAfter.After(d.users[userID]) {
+		d.users[userID] = validAfter
+	}
+}
+
+// IsRevoked func reports whether the access token has been revoked, a nil denylist revokes nothing
+func (d *Denylist) IsRevoked(claims *Claims) bool {
+	if d == nil {
+		return false
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if _, ok := d.tokens[claims.ID]; ok && claims.ID != "" {
+		return true
+	}
+	if _, ok := d.tokens[claims.SessionID]; ok && claims.SessionID != "" {
+		return true
+	}
+	if validAfter, ok := d.users[claims.Subject]; ok {
+		return claims.IssuedAt == nil || claims.IssuedAt.Before(validAfter)
+	}
+	return false
+}
+
+// Prune func drops the entries that can't revoke an unexpired token anymore,
+// maxTokenAge is the longest lifetime of an access token
+func (d *Denylist) Prune(now time.Time, maxTokenAge time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, expiresAt := range d.tokens {
+		if !expiresAt.After(now) {
+			delete(d.tokens, id)
+		}
+	}
+	for userID, validAfter := range d.users {
+		if !validAfter.Add(maxTokenAge).After(now) {
+			delete(d.users, userID)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestDenylist(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	userID := uuid.NewString()
+	makeClaims := func(id, sessionID string, issuedAt time.Time) *Claims {
+		return &Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				ID:       id,
+				Subject:  userID,
+				IssuedAt: jwt.NewNumericDate(issuedAt),
+			},
+			SessionID: sessionID,
+		}
+	}
+
+	denylist := NewDenylist()
+	denylist.RevokeToken("revoked-token", now.Add(time.Hour))
+	denylist.RevokeToken("revoked-session", now.Add(time.Hour))
+	denylist.RevokeUserTokens(userID, now)
+
+	cases := []struct {
+		name     string
+		claims   *Claims
+		expected bool
+	}{
+		{"Valid token", makeClaims("token", "session", now), false},
+		{"Revoked token", makeClaims("revoked-token", "session", now), true},
+		{"Token of a revoked session", makeClaims("token", "revoked-session", now), true},
+		{"Token issued before the user's tokens were revoked", makeClaims("token", "session", now.Add(-time.Second)), true},
+		{"Token issued after the user's tokens were revoked", makeClaims("token", "session", now.Add(time.Second)), false},
+		{"Token without id", makeClaims("", "", now), false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := denylist.IsRevoked(c.claims); got != c.expected {
+				t.Errorf("revoked mismatch: got %v, expected %v", got, c.expected)
+			}
+		})
+	}
+
+	t.Run("Prune", func(t *testing.T) {
+		denylist.Prune(now.Add(2*time.Hour), time.Hour)
+		if denylist.IsRevoked(makeClaims("revoked-token", "revoked-session", now.Add(-time.Second))) {
+			t.Error("expected expired entries to be pruned")
+		}
+	})
+
+	t.Run("Nil denylist", func(t *testing.T) {
+		var nilDenylist *Denylist
+		if nilDenylist.IsRevoked(makeClaims("revoked-token", "", now)) {
+			t.Error("a nil denylist shouldn't revoke anything")
+		}
+	})
+}
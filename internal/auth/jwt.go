@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -17,12 +18,59 @@ const (
 	TokenTypeAccess TokenType = "chirpy-access"
 )
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	claims := jwt.RegisteredClaims{ // https://datatracker.ietf.org/doc/html/rfc7519#section-4.1
+// Claims are the claims of an access token, roles and scopes (permissions) are embedded
+// so authorization doesn't need a database round trip
+type Claims struct {
+	jwt.RegisteredClaims
+	Roles     []string `json:"roles,omitempty"`
+	Scopes    []string `json:"scopes,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"` // set when the token was issued to a third-party app (oauth)
+	SessionID string   `json:"sid,omitempty"`       // set when the token was issued for a session (refresh token) or an oauth grant
+}
+
+// UserID func returns the id of the user the token was issued to
+func (c *Claims) UserID() (uuid.UUID, error) {
+	userId, err := uuid.Parse(c.Subject)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid id; couldn't parse use id: %v", err.Error())
+	}
+	return userId, nil
+}
+
+// HasRole func reports whether the token holds the role
+func (c *Claims) HasRole(role string) bool {
+	return slices.Contains(c.Roles, role)
+}
+
+// HasScope func reports whether the token holds the scope (permission)
+func (c *Claims) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
+}
+
+// MakeJWT func creates an access token for the user with their roles and scopes (permissions)
+func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration, roles, scopes []string) (string, error) {
+	return signJWT(Claims{Roles: roles, Scopes: scopes}, userID, tokenSecret, expiresIn)
+}
+
+// MakeSessionJWT func creates an access token like MakeJWT, tied to the session (refresh token) it was issued for
+func MakeSessionJWT(userID, sessionID uuid.UUID, tokenSecret string, expiresIn time.Duration, roles, scopes []string) (string, error) {
+	return signJWT(Claims{Roles: roles, Scopes: scopes, SessionID: sessionID.String()}, userID, tokenSecret, expiresIn)
+}
+
+// MakeClientJWT func creates an access token issued to a third-party app on behalf of the user, it only holds the granted scopes.
+// it is tied to the grant (authorization) it was issued for, so revoking the grant revokes it
+func MakeClientJWT(userID, grantID uuid.UUID, clientID, tokenSecret string, expiresIn time.Duration, scopes []string) (string, error) {
+	return signJWT(Claims{Scopes: scopes, ClientID: clientID, SessionID: grantID.String()}, userID, tokenSecret, expiresIn)
+}
+
+// signJWT func fills the registered claims of an access token and signs it
+func signJWT(claims Claims, userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	claims.RegisteredClaims = jwt.RegisteredClaims{ // https://datatracker.ietf.org/doc/html/rfc7519#section-4.1
 		Issuer:    string(TokenTypeAccess),
 		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
 		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
 		Subject:   userID.String(),
+		ID:        uuid.NewString(), // jti, lets the token be revoked on its own
 	}
 	// create a token with specified signing method and claims
 	// SigningMethodHS256 is a signing method and its key is token of type []byte
@@ -30,31 +78,40 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 	return jwtToken.SignedString([]byte(tokenSecret)) // returns complete JWT string
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+// ParseJWT func validates an access token and returns its claims
+func ParseJWT(tokenString, tokenSecret string) (*Claims, error) {
 	// validate the signature of JWT and extract the claims into a (token *jwt.Token) struct
 	token, err := jwt.ParseWithClaims(
 		tokenString,
-		&jwt.RegisteredClaims{},
+		&Claims{},
 		func(token *jwt.Token) (any, error) { return []byte(tokenSecret), nil },
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
 	)
 	if err != nil {
-		return uuid.Nil, err
+		return nil, err
 	}
 
-	claims, ok := token.Claims.(*jwt.RegisteredClaims) // to get access to Claims
+	claims, ok := token.Claims.(*Claims) // to get access to Claims
 	if !ok || !token.Valid {
-		return uuid.Nil, errors.New("invalid token claims")
+		return nil, errors.New("invalid token claims")
 	}
 
 	if claims.Issuer != string(TokenTypeAccess) {
-		return uuid.Nil, errors.New("invalid issuer")
+		return nil, errors.New("invalid issuer")
 	}
+	if _, err := claims.UserID(); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
 
-	userId, err := uuid.Parse(claims.Subject)
+// ValidateJWT func validates an access token and returns the id of its user
+func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+	claims, err := ParseJWT(tokenString, tokenSecret)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("invalid id; couldn't parse use id: %v", err.Error())
+		return uuid.Nil, err
 	}
-	return userId, nil
+	return claims.UserID()
 }
 
 // MarkRefreshToken func returns a random 256-bit string
@@ -11,10 +11,10 @@ func TestJWT(t *testing.T) {
 	tokenSecretTest := "chirpy-test"
 
 	userID1 := uuid.New()
-	token1, _ := MakeJWT(userID1, tokenSecretTest, time.Hour)
+	token1, _ := MakeJWT(userID1, tokenSecretTest, time.Hour, nil, nil)
 
 	userID2 := uuid.New()
-	token2, _ := MakeJWT(userID2, tokenSecretTest, time.Hour)
+	token2, _ := MakeJWT(userID2, tokenSecretTest, time.Hour, nil, nil)
 
 	cases := []struct {
 		name        string
@@ -75,3 +75,44 @@ func TestJWT(t *testing.T) {
 	}
 
 }
+
+func TestSessionJWT(t *testing.T) {
+	userID, sessionID := uuid.New(), uuid.New()
+	token, err := MakeSessionJWT(userID, sessionID, "chirpy-test", time.Hour, nil, []string{ScopeAccount})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := ParseJWT(token, "chirpy-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims.SessionID != sessionID.String() {
+		t.Errorf("session id mismatch: got %v, expected %v", claims.SessionID, sessionID)
+	}
+	if !claims.HasScope(ScopeAccount) {
+		t.Errorf("expected the %v scope", ScopeAccount)
+	}
+}
+
+func TestClientJWT(t *testing.T) {
+	userID, grantID := uuid.New(), uuid.New()
+	token, err := MakeClientJWT(userID, grantID, "client", "chirpy-test", time.Hour, []string{ScopeChirpsRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := ParseJWT(token, "chirpy-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims.ClientID != "client" || claims.SessionID != grantID.String() {
+		t.Errorf("got client %v and grant %v, expected client and %v", claims.ClientID, claims.SessionID, grantID)
+	}
+
+	denylist := NewDenylist()
+	denylist.RevokeToken(grantID.String(), time.Now().Add(time.Hour))
+	if !denylist.IsRevoked(claims) {
+		t.Error("expected the token to be revoked with its grant")
+	}
+}
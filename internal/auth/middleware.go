@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// roles and permissions seeded by the migrations
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+
+	PermissionDeleteAnyChirp = "chirps:delete_any"
+	PermissionManageUsers    = "users:manage"
+	PermissionManageWebhooks = "webhooks:manage"
+)
+
+type contextKey string
+
+const claimsContextKey contextKey = "chirpy-claims"
+
+// ClaimsFromContext func returns the access token claims stored by RequirePermission
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(*Claims)
+	return claims, ok
+}
+
+// RequirePermission func returns a middleware that only lets through requests with a valid, unrevoked access token
+// holding the permission, the claims of the token are stored in the request context
+func RequirePermission(tokenSecret string, denylist *Denylist, permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			accessToken, err := GetBearerToken(r.Header)
+			if err != nil {
+				writeError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+			claims, err := ParseJWT(accessToken, tokenSecret)
+			if err != nil || denylist.IsRevoked(claims) {
+				writeError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+			if !claims.HasScope(permission) {
+				writeError(w, http.StatusForbidden, "Forbidden; missing permission "+permission)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsContextKey, claims)))
+		})
+	}
+}
+
+// writeError func responds with the same json error shape as the handlers
+func writeError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRequirePermission(t *testing.T) {
+	tokenSecret := "chirpy-test"
+	userID := uuid.New()
+
+	// the permissions each role gets, same as the roles migration
+	rolePermissions := map[string][]string{
+		"":            nil,
+		RoleModerator: {PermissionDeleteAnyChirp},
+		RoleAdmin:     {PermissionDeleteAnyChirp, PermissionManageUsers},
+	}
+	makeToken := func(role string, expiresIn time.Duration) string {
+		roles := []string{}
+		if role != "" {
+			roles = append(roles, role)
+		}
+		token, err := MakeJWT(userID, tokenSecret, expiresIn, roles, rolePermissions[role])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	// a revoked admin token, and a moderator whose tokens were all revoked
+	denylist := NewDenylist()
+	revokedToken := makeToken(RoleAdmin, time.Hour)
+	revokedClaims, err := ParseJWT(revokedToken, tokenSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	denylist.RevokeToken(revokedClaims.ID, revokedClaims.ExpiresAt.Time)
+	revokedUserID := uuid.New()
+	moderatorToken, err := MakeJWT(revokedUserID, tokenSecret, time.Hour, []string{RoleModerator}, rolePermissions[RoleModerator])
+	if err != nil {
+		t.Fatal(err)
+	}
+	denylist.RevokeUserTokens(revokedUserID.String(), time.Now().Add(time.Second))
+
+	cases := []struct {
+		name       string
+		authHeader string
+		permission string
+		expected   int
+	}{
+		{"No token", "", PermissionDeleteAnyChirp, http.StatusUnauthorized},
+		{"Invalid token", "Bearer not-a-jwt", PermissionDeleteAnyChirp, http.StatusUnauthorized},
+		{"Expired token", "Bearer " + makeToken(RoleAdmin, -time.Minute), PermissionManageUsers, http.StatusUnauthorized},
+		{"Wrong secret", "Bearer " + func() string {
+			token, _ := MakeJWT(userID, "other-secret", time.Hour, []string{RoleAdmin}, rolePermissions[RoleAdmin])
+			return token
+		}(), PermissionManageUsers, http.StatusUnauthorized},
+
+		{"User deletes any chirp", "Bearer " + makeToken("", time.Hour), PermissionDeleteAnyChirp, http.StatusForbidden},
+		{"User manages users", "Bearer " + makeToken("", time.Hour), PermissionManageUsers, http.StatusForbidden},
+		{"Moderator deletes any chirp", "Bearer " + makeToken(RoleModerator, time.Hour), PermissionDeleteAnyChirp, http.StatusOK},
+		{"Moderator manages users", "Bearer " + makeToken(RoleModerator, time.Hour), PermissionManageUsers, http.StatusForbidden},
+		{"Admin deletes any chirp", "Bearer " + makeToken(RoleAdmin, time.Hour), PermissionDeleteAnyChirp, http.StatusOK},
+		{"Admin manages users", "Bearer " + makeToken(RoleAdmin, time.Hour), PermissionManageUsers, http.StatusOK},
+
+		{"Revoked token", "Bearer " + revokedToken, PermissionManageUsers, http.StatusUnauthorized},
+		{"Token issued before the user's tokens were revoked", "Bearer " + moderatorToken, PermissionDeleteAnyChirp, http.StatusUnauthorized},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var gotClaims *Claims
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotClaims, _ = ClaimsFromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			})
+			handler := RequirePermission(tokenSecret, denylist, c.permission)(next)
+
+			req := httptest.NewRequest(http.MethodGet, "/admin/users", nil)
+			if c.authHeader != "" {
+				req.Header.Set("Authorization", c.authHeader)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != c.expected {
+				t.Fatalf("status mismatch: got %v, expected %v", rec.Code, c.expected)
+			}
+			if c.expected != http.StatusOK {
+				return
+			}
+			if gotClaims == nil {
+				t.Fatal("expected claims in the request context")
+			}
+			if gotUserID, _ := gotClaims.UserID(); gotUserID != userID {
+				t.Errorf("userID mismatch: got %v, expected %v", gotUserID, userID)
+			}
+		})
+	}
+}
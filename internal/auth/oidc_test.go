@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIdP is a local OpenID Connect provider, it issues an ID token with the claims of the test for any code
+type mockIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+	claims IDTokenClaims
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{key: key, kid: "key-1"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kid": idp.kid,
+				"kty": "RSA",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if clientID, _, ok := r.BasicAuth(); !ok || clientID != "chirpy" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idp.sign(t, idp.claims, idp.key, idp.kid)})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *mockIdP) sign(t *testing.T, claims IDTokenClaims, key *rsa.PrivateKey, kid string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestOIDCProvider(t *testing.T) {
+	idp := newMockIdP(t)
+	ctx := context.Background()
+
+	provider, err := DiscoverOIDC(ctx, idp.server.URL, "chirpy", "secret", "http://localhost:8080/api/login/oidc/callback")
+	if err != nil {
+		t.Fatalf("discovery failed: %v", err)
+	}
+	if provider.TokenEndpoint != idp.server.URL+"/token" {
+		t.Errorf("unexpected token endpoint %v", provider.TokenEndpoint)
+	}
+
+	authURL, err := url.Parse(provider.AuthCodeURL("state", "nonce", "challenge"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query := authURL.Query(); query.Get("client_id") != "chirpy" || query.Get("code_challenge_method") != PKCEMethodS256 {
+		t.Errorf("unexpected authorization url %v", authURL)
+	}
+
+	valid := IDTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    idp.server.URL,
+			Subject:   "user-123",
+			Audience:  jwt.ClaimStrings{"chirpy"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+		Nonce:         "nonce",
+		Email:         "user@example.com",
+		EmailVerified: true,
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name      string
+		claims    func(IDTokenClaims) IDTokenClaims
+		key       *rsa.PrivateKey
+		kid       string
+		nonce     string
+		expectErr bool
+	}{
+		{
+			name:   "valid id token",
+			claims: func(c IDTokenClaims) IDTokenClaims { return c },
+			nonce:  "nonce",
+		},
+		{
+			name:      "wrong nonce",
+			claims:    func(c IDTokenClaims) IDTokenClaims { return c },
+			nonce:     "another-nonce",
+			expectErr: true,
+		},
+		{
+			name: "wrong audience",
+			claims: func(c IDTokenClaims) IDTokenClaims {
+				c.Audience = jwt.ClaimStrings{"another-app"}
+				return c
+			},
+			nonce:     "nonce",
+			expectErr: true,
+		},
+		{
+			name: "wrong issuer",
+			claims: func(c IDTokenClaims) IDTokenClaims {
+				c.Issuer = "https://evil.example.com"
+				return c
+			},
+			nonce:     "nonce",
+			expectErr: true,
+		},
+		{
+			name: "expired",
+			claims: func(c IDTokenClaims) IDTokenClaims {
+				c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+				return c
+			},
+			nonce:     "nonce",
+			expectErr: true,
+		},
+		{
+			name:      "signed by an unknown key",
+			claims:    func(c IDTokenClaims) IDTokenClaims { return c },
+			key:       otherKey,
+			nonce:     "nonce",
+			expectErr: true,
+		},
+		{
+			name:      "unknown key id",
+			claims:    func(c IDTokenClaims) IDTokenClaims { return c },
+			kid:       "key-2",
+			nonce:     "nonce",
+			expectErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			key, kid := idp.key, idp.kid
+			if c.key != nil {
+				key = c.key
+			}
+			if c.kid != "" {
+				kid = c.kid
+			}
+			rawIDToken := idp.sign(t, c.claims(valid), key, kid)
+
+			claims, err := provider.VerifyIDToken(ctx, rawIDToken, c.nonce)
+			if (err != nil) != c.expectErr {
+				t.Fatalf("expected error: %v, got: %v", c.expectErr, err)
+			}
+			if !c.expectErr && (claims.Subject != "user-123" || claims.Email != "user@example.com" || !claims.EmailVerified) {
+				t.Errorf("unexpected claims %+v", claims)
+			}
+		})
+	}
+
+	t.Run("code exchange", func(t *testing.T) {
+		idp.claims = valid
+		rawIDToken, err := provider.Exchange(ctx, "code", "verifier")
+		if err != nil {
+			t.Fatalf("exchange failed: %v", err)
+		}
+		if _, err := provider.VerifyIDToken(ctx, rawIDToken, "nonce"); err != nil {
+			t.Errorf("exchanged id token is invalid: %v", err)
+		}
+	})
+
+	t.Run("key rotation", func(t *testing.T) {
+		idp.key, idp.kid = otherKey, "key-3"
+		rawIDToken := idp.sign(t, valid, idp.key, idp.kid)
+		if _, err := provider.VerifyIDToken(ctx, rawIDToken, "nonce"); err != nil {
+			t.Errorf("token signed by the rotated key is invalid: %v", err)
+		}
+	})
+}
@@ -1,22 +1,141 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"strings"
 
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// HashPassword func hashes plain password using bcrypt with 12 cost
+var (
+	ErrPasswordMismatch   = errors.New("password doesn't match the hash")
+	ErrUnknownHashFormat  = errors.New("unknown password hash format")
+	errInvalidArgon2Hash  = errors.New("invalid argon2id hash")
+	errUnsupportedVersion = errors.New("unsupported argon2 version")
+)
+
+// Argon2Params are the parameters of argon2id, https://datatracker.ietf.org/doc/html/rfc9106#section-4
+type Argon2Params struct {
+	Memory      uint32 // in KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params are above the OWASP recommendation (19 MiB, 2 iterations, 1 thread)
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// HashPassword func hashes plain password using argon2id with the default parameters
 func HashPassword(password string) (string, error) {
-	hashedPass, err := bcrypt.GenerateFromPassword([]byte(password), 12)
-	if err != nil {
+	return HashPasswordWithParams(password, DefaultArgon2Params)
+}
+
+// HashPasswordWithParams func hashes plain password using argon2id, the hash is in the PHC string format
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key> so it carries everything needed to check it
+func HashPasswordWithParams(password string, params Argon2Params) (string, error) {
+	salt := make([]byte, params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
 		return "", fmt.Errorf("error in hashing password: %v", err)
 	}
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
 
-	return string(hashedPass), nil
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		params.Memory,
+		params.Iterations,
+		params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
 }
 
+// CheckPasswordHash func checks a password against its hash, argon2id or bcrypt (hashes made before argon2id)
 func CheckPasswordHash(password, hash string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		params, salt, key, err := parseArgon2Hash(hash)
+		if err != nil {
+			return err
+		}
+		otherKey := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+		if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+			return ErrPasswordMismatch
+		}
+		return nil
+	case isBcryptHash(hash):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	default:
+		return ErrUnknownHashFormat
+	}
+}
+
+// NeedsRehash func reports whether the hash should be replaced by a hash with the parameters,
+// because it's a bcrypt hash or an argon2id hash with other parameters
+func NeedsRehash(hash string, params Argon2Params) bool {
+	hashParams, salt, key, err := parseArgon2Hash(hash)
+	if err != nil {
+		return true
+	}
+	return hashParams.Memory != params.Memory ||
+		hashParams.Iterations != params.Iterations ||
+		hashParams.Parallelism != params.Parallelism ||
+		uint32(len(salt)) != params.SaltLength ||
+		uint32(len(key)) != params.KeyLength
+}
+
+// parseArgon2Hash func parses an argon2id hash in the PHC string format
+func parseArgon2Hash(hash string) (Argon2Params, []byte, []byte, error) {
+	parts := strings.Split(hash, "$") // "", "argon2id", "v=19", "m=65536,t=3,p=2", salt, key
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Argon2Params{}, nil, nil, errInvalidArgon2Hash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return Argon2Params{}, nil, nil, errInvalidArgon2Hash
+	}
+	if version != argon2.Version {
+		return Argon2Params{}, nil, nil, errUnsupportedVersion
+	}
+
+	params := Argon2Params{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return Argon2Params{}, nil, nil, errInvalidArgon2Hash
+	}
+	if params.Memory == 0 || params.Iterations == 0 || params.Parallelism == 0 {
+		return Argon2Params{}, nil, nil, errInvalidArgon2Hash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2Params{}, nil, nil, errInvalidArgon2Hash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Argon2Params{}, nil, nil, errInvalidArgon2Hash
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
+
+func isBcryptHash(hash string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(hash, prefix) {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+//go:embed data/breached_passwords.txt
+var breachedPasswordsFile string
+
+// BreachCorpus is a set of breached passwords queried with k-anonymity, like the haveibeenpwned range api:
+// only the first 5 characters of the SHA-1 hash of the password are given, and the corpus answers with the
+// suffixes of the breached hashes starting with them, so the password never leaves the server
+type BreachCorpus interface {
+	Range(prefix string) ([]string, error)
+}
+
+// offlineBreachCorpus is a breach corpus held in memory, sorted SHA-1 hashes in uppercase hex
+type offlineBreachCorpus []string
+
+// NewOfflineBreachCorpus func reads a breach corpus of SHA-1 hashes, one per line, lines starting with # are ignored
+func NewOfflineBreachCorpus(r io.Reader) (BreachCorpus, error) {
+	corpus := offlineBreachCorpus{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := hex.DecodeString(line); err != nil || len(line) != 2*sha1.Size {
+			return nil, fmt.Errorf("invalid SHA-1 hash in breach corpus: %q", line)
+		}
+		corpus = append(corpus, strings.ToUpper(line))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	slices.Sort(corpus)
+	return corpus, nil
+}
+
+func (c offlineBreachCorpus) Range(prefix string) ([]string, error) {
+	prefix = strings.ToUpper(prefix)
+	suffixes := []string{}
+	start, _ := slices.BinarySearch(c, prefix)
+	for _, hash := range c[start:] {
+		if !strings.HasPrefix(hash, prefix) {
+			break
+		}
+		suffixes = append(suffixes, hash[len(prefix):])
+	}
+	return suffixes, nil
+}
+
+// IsBreachedPassword func reports whether the password is in the breach corpus
+func IsBreachedPassword(corpus BreachCorpus, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	suffixes, err := corpus.Range(hash[:5])
+	if err != nil {
+		return false, fmt.Errorf("couldn't query the breach corpus: %v", err)
+	}
+	return slices.Contains(suffixes, hash[5:]), nil
+}
+
+// PasswordPolicy are the rules new passwords have to follow
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int // bounds the work of hashing
+	MinScore  int // minimum zxcvbn-style score, from 0 to 4
+	Breaches  BreachCorpus
+}
+
+// DefaultPasswordPolicy is the policy of chirpy accounts, with the bundled offline breach corpus
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength: 8,
+	MaxLength: 256,
+	MinScore:  3,
+	Breaches:  mustLoadBreachCorpus(breachedPasswordsFile),
+}
+
+func mustLoadBreachCorpus(file string) BreachCorpus {
+	corpus, err := NewOfflineBreachCorpus(strings.NewReader(file))
+	if err != nil {
+		panic(err)
+	}
+	return corpus
+}
+
+// ValidatePassword func checks a new password against the default policy
+func ValidatePassword(password, email string) error {
+	return DefaultPasswordPolicy.Validate(password, email)
+}
+
+// Validate func checks a new password of the user with the email, the error explains why it was rejected
+func (p PasswordPolicy) Validate(password, email string) error {
+	length := len([]rune(password))
+	if length < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters long", p.MinLength)
+	}
+	if len(password) > p.MaxLength {
+		return fmt.Errorf("password must be at most %d bytes long", p.MaxLength)
+	}
+
+	emailWords := emailWords(email)
+	if similarToEmail(password, emailWords) {
+		return fmt.Errorf("password is too similar to your email")
+	}
+
+	if p.Breaches != nil {
+		breached, err := IsBreachedPassword(p.Breaches, password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			return fmt.Errorf("password has appeared in a data breach, choose another one")
+		}
+	}
+
+	strength := EstimatePasswordStrength(password, emailWords...)
+	if strength.Score < p.MinScore {
+		reason := "it would be easy to guess"
+		if strength.Warning != "" {
+			reason = strings.TrimPrefix(strength.Warning, "the password ")
+		}
+		return fmt.Errorf("password is too weak (strength %d of 4, needs %d): %v; add more words or characters", strength.Score, p.MinScore, reason)
+	}
+	return nil
+}
+
+// emailWords func splits an email into the words an attacker would try, e.g. john.doe@example.com
+// into john.doe, john, doe and example
+func emailWords(email string) []string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	local, domain, _ := strings.Cut(email, "@")
+	words := []string{local}
+	isSeparator := func(c rune) bool { return !unicode.IsLetter(c) && !unicode.IsDigit(c) }
+	words = append(words, strings.FieldsFunc(local, isSeparator)...)
+	if name, _, ok := strings.Cut(domain, "."); ok {
+		words = append(words, name)
+	}
+	return words
+}
+
+// similarToEmail func reports whether the password is mostly the email, e.g. the local part with a few characters added
+func similarToEmail(password string, emailWords []string) bool {
+	password = strings.ToLower(password)
+	if len(emailWords) == 0 || len(emailWords[0]) < 3 {
+		return false
+	}
+	local := emailWords[0]
+	if strings.Contains(password, local) || strings.Contains(local, password) {
+		return true
+	}
+	// the same, ignoring punctuation (john.doe and johndoe)
+	normalize := func(s string) string {
+		return strings.Map(func(c rune) rune {
+			if unicode.IsLetter(c) || unicode.IsDigit(c) {
+				return c
+			}
+			return -1
+		}, s)
+	}
+	normalizedLocal := normalize(local)
+	return len(normalizedLocal) >= 3 && strings.Contains(normalize(password), normalizedLocal)
+}
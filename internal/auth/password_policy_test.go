@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidatePassword(t *testing.T) {
+	email := "john.doe@example.com"
+
+	cases := []struct {
+		name      string
+		password  string
+		expectErr string // part of the error message, empty when the password is accepted
+	}{
+		{"Strong password", "violet-Mango-7-trombone", ""},
+		{"Random letters", "kdjfhwuezq", ""},
+		{"Leet passphrase", "Tr0ub4dour&3", ""},
+		{"Too short", "x7#kQ", "at least 8 characters"},
+		{"Too long", strings.Repeat("x7#kQ", 60), "at most 256 bytes"},
+		{"Longer than bcrypt allows", strings.Repeat("x7#kQ", 20), ""},
+		{"Common password", "Pa$$word", "common password"},
+		{"Common password with variations", "MonKey!!", "common password"},
+		{"Reversed common password", "drowssap", "common password"},
+		{"Sequence", "abcdefgh123", "sequence"},
+		{"Keyboard pattern", "asdfghjkl;", "keyboard pattern"},
+		{"Repeated characters", "zzzzzzzzzzzz", "repeated characters"},
+		{"Email local part", "john.doe1!", "similar to your email"},
+		{"Email without punctuation", "JohnDoe2024", "similar to your email"},
+		{"Email domain", "example1987", "too weak"},
+		{"Breached password", "password", "data breach"},
+		{"Breached password with variations", "Whatever2025", "data breach"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ValidatePassword(c.password, email)
+			if c.expectErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.expectErr) {
+				t.Errorf("expected an error containing %q, got: %v", c.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestEstimatePasswordStrength(t *testing.T) {
+	cases := []struct {
+		password string
+		minScore int
+		maxScore int
+	}{
+		{"123456", 0, 0},
+		{"qwerty", 0, 0},
+		{"Password1!", 0, 1},
+		{"summer1987", 1, 1},
+		{"83749274", 3, 3},
+		{"correcthorsebattery", 4, 4},
+	}
+	for _, c := range cases {
+		t.Run(c.password, func(t *testing.T) {
+			strength := EstimatePasswordStrength(c.password)
+			if strength.Score < c.minScore || strength.Score > c.maxScore {
+				t.Errorf("score mismatch: got %v, expected between %v and %v", strength.Score, c.minScore, c.maxScore)
+			}
+		})
+	}
+}
+
+func TestBreachCorpus(t *testing.T) {
+	// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	corpus, err := NewOfflineBreachCorpus(strings.NewReader("# comment\n5baa61e4c9b93f3f0682250b6cf8331b7ee68fd8\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	suffixes, _ := corpus.Range("5BAA6")
+	if len(suffixes) != 1 || suffixes[0] != "1E4C9B93F3F0682250B6CF8331B7EE68FD8" {
+		t.Errorf("unexpected range: %v", suffixes)
+	}
+	if breached, _ := IsBreachedPassword(corpus, "password"); !breached {
+		t.Error("expected password to be breached")
+	}
+	if breached, _ := IsBreachedPassword(corpus, "violet-Mango-7-trombone"); breached {
+		t.Error("expected a strong password not to be breached")
+	}
+	if _, err := NewOfflineBreachCorpus(strings.NewReader("not-a-hash\n")); err == nil {
+		t.Error("expected an error for an invalid hash")
+	}
+}
@@ -0,0 +1,335 @@
+package auth
+
+import (
+	_ "embed"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// the strength estimation follows zxcvbn (https://github.com/dropbox/zxcvbn): the password is split into the
+// patterns an attacker would try first (common passwords, sequences, repeats, keyboard walks, years), the rest is
+// brute forced, and the score comes from the number of guesses of the cheapest split
+
+//go:embed data/common_passwords.txt
+var commonPasswordsFile string
+
+// rank of the common passwords, 1 is the most common
+var commonPasswords = loadRankedList(commonPasswordsFile)
+
+var keyboardRows = []string{"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./"}
+
+var leetSubstitutions = map[rune]rune{'4': 'a', '@': 'a', '8': 'b', '3': 'e', '6': 'g', '1': 'i', '!': 'i', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z'}
+
+// PasswordStrength is the estimated strength of a password
+type PasswordStrength struct {
+	Score   int     // from 0 (too guessable) to 4 (very unguessable), like zxcvbn
+	Guesses float64 // log10 of the estimated number of guesses to find the password
+	Warning string  // the weakest pattern found in the password, empty if there is none
+}
+
+// a pattern found in the password, from start to end (excluded)
+type passwordMatch struct {
+	start, end int
+	guesses    float64 // log10
+	warning    string
+}
+
+func loadRankedList(file string) map[string]int {
+	ranks := map[string]int{}
+	for _, line := range strings.Split(file, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, ok := ranks[line]; !ok {
+			ranks[line] = len(ranks) + 1
+		}
+	}
+	return ranks
+}
+
+// EstimatePasswordStrength func estimates how many guesses it takes to find the password,
+// userInputs are words an attacker knows about the user (e.g. the email) and tries first
+func EstimatePasswordStrength(password string, userInputs ...string) PasswordStrength {
+	chars := []rune(password)
+	if len(chars) == 0 {
+		return PasswordStrength{Warning: "the password is empty"}
+	}
+	inputs := map[string]bool{}
+	for _, input := range userInputs {
+		if input = strings.ToLower(input); len(input) >= 3 {
+			inputs[input] = true
+		}
+	}
+
+	matches := findPasswordMatches(chars, inputs)
+	bruteForce := math.Log10(float64(passwordCardinality(chars)))
+
+	// best[i] is the fewest guesses (log10) to find chars[:i], through the match ending at i (or brute force)
+	best := make([]float64, len(chars)+1)
+	through := make([]*passwordMatch, len(chars)+1)
+	for i := 1; i <= len(chars); i++ {
+		best[i] = best[i-1] + bruteForce
+		for j := range matches {
+			match := &matches[j]
+			// every pattern costs at least 10 guesses, so patterns can't be chained for free
+			guesses := math.Max(match.guesses, 1)
+			if match.end == i && best[match.start]+guesses < best[i] {
+				best[i] = best[match.start] + guesses
+				through[i] = match
+			}
+		}
+	}
+
+	// the warning of the longest pattern used
+	warning, longest := "", 0
+	for i := len(chars); i > 0; {
+		match := through[i]
+		if match == nil {
+			i--
+			continue
+		}
+		if match.end-match.start > longest {
+			warning, longest = match.warning, match.end-match.start
+		}
+		i = match.start
+	}
+
+	guesses := best[len(chars)]
+	return PasswordStrength{
+		Score:   passwordScore(guesses),
+		Guesses: guesses,
+		Warning: warning,
+	}
+}
+
+// passwordScore func turns a number of guesses (log10) into the zxcvbn score
+func passwordScore(guesses float64) int {
+	switch {
+	case guesses < 3:
+		return 0
+	case guesses < 6:
+		return 1
+	case guesses < 8:
+		return 2
+	case guesses < 10:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// passwordCardinality func returns the size of the character set to brute force the password
+func passwordCardinality(chars []rune) int {
+	var lower, upper, digit, symbol, other bool
+	for _, c := range chars {
+		switch {
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= '0' && c <= '9':
+			digit = true
+		case c < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	cardinality := 0
+	for _, set := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if set.used {
+			cardinality += set.size
+		}
+	}
+	return cardinality
+}
+
+// findPasswordMatches func finds every pattern of the password
+func findPasswordMatches(chars []rune, userInputs map[string]bool) []passwordMatch {
+	matches := []passwordMatch{}
+	lower := []rune(strings.ToLower(string(chars)))
+
+	for start := 0; start < len(chars); start++ {
+		for end := start + 1; end <= len(chars); end++ {
+			if match, ok := dictionaryMatch(chars[start:end], lower[start:end], userInputs); ok {
+				match.start, match.end = start, end
+				matches = append(matches, match)
+			}
+			if end-start < 3 {
+				continue
+			}
+			if match, ok := repeatMatch(lower[start:end]); ok {
+				match.start, match.end = start, end
+				matches = append(matches, match)
+			}
+			if match, ok := sequenceMatch(lower[start:end]); ok {
+				match.start, match.end = start, end
+				matches = append(matches, match)
+			}
+			if match, ok := keyboardMatch(lower[start:end]); ok {
+				match.start, match.end = start, end
+				matches = append(matches, match)
+			}
+			if match, ok := yearMatch(lower[start:end]); ok {
+				match.start, match.end = start, end
+				matches = append(matches, match)
+			}
+		}
+	}
+	return matches
+}
+
+// dictionaryMatch func matches common passwords and user inputs, also reversed or with l33t substitutions
+func dictionaryMatch(chars, lower []rune, userInputs map[string]bool) (passwordMatch, bool) {
+	word := string(lower)
+	variations := 0.0 // log10 of the guesses added by the variations of the word
+
+	lookup := func(word string) (int, string, bool) {
+		if userInputs[word] {
+			return 1, "the password contains your personal information", true
+		}
+		if rank, ok := commonPasswords[word]; ok {
+			return rank, "the password contains a common password", true
+		}
+		return 0, "", false
+	}
+
+	rank, warning, ok := lookup(word)
+	if !ok {
+		if rank, warning, ok = lookup(reverseString(word)); ok {
+			variations += math.Log10(2)
+		}
+	}
+	if !ok {
+		unleeted, substitutions := unleet(lower)
+		if substitutions > 0 {
+			if rank, warning, ok = lookup(unleeted); ok {
+				variations += math.Log10(float64(2 * substitutions))
+			}
+		}
+	}
+	if !ok {
+		return passwordMatch{}, false
+	}
+	// only the first letter in uppercase is tried early, any other mix costs more
+	if uppercase := countUpper(chars); uppercase > 0 {
+		if uppercase == 1 && unicode.IsUpper(chars[0]) || uppercase == len(chars) {
+			variations += math.Log10(2)
+		} else {
+			variations += float64(uppercase) * math.Log10(2)
+		}
+	}
+	return passwordMatch{guesses: math.Log10(float64(rank)) + variations, warning: warning}, true
+}
+
+// repeatMatch func matches a character repeated, like aaaa
+func repeatMatch(lower []rune) (passwordMatch, bool) {
+	for _, c := range lower[1:] {
+		if c != lower[0] {
+			return passwordMatch{}, false
+		}
+	}
+	return passwordMatch{
+		guesses: math.Log10(float64(passwordCardinality(lower[:1]) * len(lower))),
+		warning: "the password contains repeated characters like aaa",
+	}, true
+}
+
+// sequenceMatch func matches characters following each other, like abcd or 9876
+func sequenceMatch(lower []rune) (passwordMatch, bool) {
+	delta := lower[1] - lower[0]
+	if delta != 1 && delta != -1 {
+		return passwordMatch{}, false
+	}
+	for i := 2; i < len(lower); i++ {
+		if lower[i]-lower[i-1] != delta {
+			return passwordMatch{}, false
+		}
+	}
+	base := 26.0
+	if unicode.IsDigit(lower[0]) {
+		base = 10
+	}
+	return passwordMatch{
+		guesses: math.Log10(base * 2 * float64(len(lower))),
+		warning: "the password contains a sequence like abc or 123",
+	}, true
+}
+
+// keyboardMatch func matches keys next to each other on a keyboard row, like qwerty or lkjh
+func keyboardMatch(lower []rune) (passwordMatch, bool) {
+	for _, row := range keyboardRows {
+		position := strings.IndexRune(row, lower[0])
+		if position < 0 {
+			continue
+		}
+		delta := strings.IndexRune(row, lower[1]) - position
+		if delta != 1 && delta != -1 {
+			continue
+		}
+		walk := true
+		for i := 1; i < len(lower); i++ {
+			if strings.IndexRune(row, lower[i])-strings.IndexRune(row, lower[i-1]) != delta {
+				walk = false
+				break
+			}
+		}
+		if walk {
+			return passwordMatch{
+				guesses: math.Log10(47 * 2 * float64(len(lower))),
+				warning: "the password contains a keyboard pattern like qwerty",
+			}, true
+		}
+	}
+	return passwordMatch{}, false
+}
+
+// yearMatch func matches a recent year, like 1987 or 2024
+func yearMatch(lower []rune) (passwordMatch, bool) {
+	year := string(lower)
+	if len(year) != 4 || year < "1900" || year > "2099" || strings.TrimFunc(year, unicode.IsDigit) != "" {
+		return passwordMatch{}, false
+	}
+	return passwordMatch{
+		guesses: math.Log10(200),
+		warning: "the password contains a year",
+	}, true
+}
+
+// unleet func undoes l33t substitutions, like p4ssw0rd to password
+func unleet(lower []rune) (string, int) {
+	substitutions := 0
+	unleeted := make([]rune, len(lower))
+	for i, c := range lower {
+		if sub, ok := leetSubstitutions[c]; ok {
+			unleeted[i] = sub
+			substitutions++
+			continue
+		}
+		unleeted[i] = c
+	}
+	return string(unleeted), substitutions
+}
+
+func reverseString(s string) string {
+	chars := []rune(s)
+	for i, j := 0, len(chars)-1; i < j; i, j = i+1, j-1 {
+		chars[i], chars[j] = chars[j], chars[i]
+	}
+	return string(chars)
+}
+
+func countUpper(chars []rune) int {
+	count := 0
+	for _, c := range chars {
+		if unicode.IsUpper(c) {
+			count++
+		}
+	}
+	return count
+}
@@ -1,7 +1,10 @@
 package auth
 
 import (
+	"strings"
 	"testing"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestPassword(t *testing.T) {
@@ -45,3 +48,59 @@ func TestPassword(t *testing.T) {
 		}
 	}
 }
+
+func TestPasswordHashFormats(t *testing.T) {
+	password := "violet-Mango-7-trombone"
+	cheapParams := Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+	argon2Hash, err := HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cheapHash, err := HashPasswordWithParams(password, cheapParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name        string
+		password    string
+		hash        string
+		expectErr   bool
+		needsRehash bool
+	}{
+		{"Argon2id", password, argon2Hash, false, false},
+		{"Argon2id wrong password", "violet-Mango-7-trombonE", argon2Hash, true, false},
+		{"Argon2id with outdated parameters", password, cheapHash, false, true},
+		{"Bcrypt", password, string(bcryptHash), false, true},
+		{"Bcrypt wrong password", "not-the-password", string(bcryptHash), true, true},
+		{"Unknown format", password, "plain:" + password, true, true},
+		{"No password", password, "", true, true},
+		{"Invalid argon2id parameters", password, "$argon2id$v=19$m=0,t=0,p=0$c2FsdA$a2V5", true, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := CheckPasswordHash(c.password, c.hash)
+			if (err != nil) != c.expectErr {
+				t.Errorf("expected error: %v, got: %v", c.expectErr, err)
+			}
+			if got := NeedsRehash(c.hash, DefaultArgon2Params); got != c.needsRehash {
+				t.Errorf("needs rehash mismatch: got %v, expected %v", got, c.needsRehash)
+			}
+		})
+	}
+
+	// bcrypt ignores everything after 72 bytes, argon2id doesn't
+	long := strings.Repeat("a", 72)
+	longHash, err := HashPasswordWithParams(long+"first", cheapParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckPasswordHash(long+"second", longHash); err == nil {
+		t.Error("expected passwords longer than 72 bytes to be fully compared")
+	}
+}
@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"regexp"
+)
+
+// PKCEMethodS256 is the only supported code challenge method, "plain" doesn't protect the code
+const PKCEMethodS256 = "S256"
+
+// code verifiers are 43 to 128 unreserved characters, https://datatracker.ietf.org/doc/html/rfc7636#section-4.1
+var codeVerifierRegex = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// MakeCodeChallenge func derives the S256 code challenge of a code verifier
+func MakeCodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyPKCE func checks a code verifier against the code challenge sent with the authorization request
+func VerifyPKCE(verifier, challenge string) bool {
+	if !codeVerifierRegex.MatchString(verifier) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(MakeCodeChallenge(verifier)), []byte(challenge)) == 1
+}
@@ -0,0 +1,29 @@
+package auth
+
+import "testing"
+
+func TestVerifyPKCE(t *testing.T) {
+	// example from https://datatracker.ietf.org/doc/html/rfc7636#appendix-B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	cases := []struct {
+		name      string
+		verifier  string
+		challenge string
+		expected  bool
+	}{
+		{"Valid verifier", verifier, challenge, true},
+		{"Wrong verifier", "xBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk", challenge, false},
+		{"Verifier as challenge (plain)", verifier, verifier, false},
+		{"Verifier too short", "abc", MakeCodeChallenge("abc"), false},
+		{"Empty verifier", "", challenge, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := VerifyPKCE(c.verifier, c.challenge); got != c.expected {
+				t.Errorf("got %v, expected %v", got, c.expected)
+			}
+		})
+	}
+}
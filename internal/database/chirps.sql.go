@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -14,7 +15,7 @@ import (
 const createChirp = `-- name: CreateChirp :one
 INSERT INTO chirps(id, created_at, updated_at, body, user_id)
 VALUES(gen_random_uuid(), NOW(), NOW(), $1, $2)
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, deleted_at, deleted_by
 `
 
 type CreateChirpParams struct {
@@ -31,22 +32,16 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.DeletedAt,
+		&i.DeletedBy,
 	)
 	return i, err
 }
 
-const deleteChirpById = `-- name: DeleteChirpById :exec
-DELETE FROM chirps WHERE id = $1
-`
-
-func (q *Queries) DeleteChirpById(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, deleteChirpById, id)
-	return err
-}
-
 const getAllChirps = `-- name: GetAllChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, deleted_at, deleted_by FROM chirps
 WHERE (user_id = $1 OR $1 IS NULL)
+AND deleted_at IS NULL
 ORDER BY created_at ASC
 `
 
@@ -65,6 +60,8 @@ func (q *Queries) GetAllChirps(ctx context.Context, userID uuid.NullUUID) ([]Chi
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.DeletedAt,
+			&i.DeletedBy,
 		); err != nil {
 			return nil, err
 		}
@@ -80,7 +77,7 @@ func (q *Queries) GetAllChirps(ctx context.Context, userID uuid.NullUUID) ([]Chi
 }
 
 const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE id = $1
+SELECT id, created_at, updated_at, body, user_id, deleted_at, deleted_by FROM chirps WHERE id = $1 AND deleted_at IS NULL
 `
 
 func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -92,6 +89,115 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.DeletedAt,
+		&i.DeletedBy,
+	)
+	return i, err
+}
+
+const getTrashedChirps = `-- name: GetTrashedChirps :many
+SELECT id, created_at, updated_at, body, user_id, deleted_at, deleted_by FROM chirps
+WHERE user_id = $1
+AND deleted_by = user_id
+AND deleted_at > $2::timestamp
+ORDER BY deleted_at DESC
+`
+
+type GetTrashedChirpsParams struct {
+	UserID uuid.UUID
+	Cutoff time.Time
+}
+
+// the chirps removed by a moderator aren't in the trash of their author
+func (q *Queries) GetTrashedChirps(ctx context.Context, arg GetTrashedChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getTrashedChirps, arg.UserID, arg.Cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.DeletedAt,
+			&i.DeletedBy,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeTrashedChirps = `-- name: PurgeTrashedChirps :execrows
+DELETE FROM chirps WHERE deleted_at <= $1::timestamp
+`
+
+func (q *Queries) PurgeTrashedChirps(ctx context.Context, cutoff time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeTrashedChirps, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const restoreChirp = `-- name: RestoreChirp :one
+UPDATE chirps
+SET deleted_at = NULL, deleted_by = NULL, updated_at = NOW()
+WHERE id = $1
+AND user_id = $2
+AND deleted_by = user_id
+AND deleted_at > $3::timestamp
+RETURNING id, created_at, updated_at, body, user_id, deleted_at, deleted_by
+`
+
+type RestoreChirpParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+	Cutoff time.Time
+}
+
+func (q *Queries) RestoreChirp(ctx context.Context, arg RestoreChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, restoreChirp, arg.ID, arg.UserID, arg.Cutoff)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.DeletedAt,
+		&i.DeletedBy,
 	)
 	return i, err
 }
+
+const softDeleteChirp = `-- name: SoftDeleteChirp :execrows
+UPDATE chirps
+SET deleted_at = NOW(), updated_at = NOW(), deleted_by = $1::uuid
+WHERE id = $2 AND deleted_at IS NULL
+`
+
+type SoftDeleteChirpParams struct {
+	DeletedBy uuid.UUID
+	ID        uuid.UUID
+}
+
+func (q *Queries) SoftDeleteChirp(ctx context.Context, arg SoftDeleteChirpParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, softDeleteChirp, arg.DeletedBy, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
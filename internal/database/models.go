@@ -11,28 +11,258 @@ import (
 	"github.com/google/uuid"
 )
 
+type ApiToken struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UserID     uuid.UUID
+	Name       string
+	TokenHash  string
+	Scopes     []string
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+type Bookmark struct {
+	CollectionID uuid.UUID
+	ChirpID      uuid.UUID
+	CreatedAt    time.Time
+}
+
 type Chirp struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Body      string
 	UserID    uuid.UUID
+	DeletedAt sql.NullTime
+	DeletedBy uuid.NullUUID
 }
 
-type RefreshToken struct {
-	Token     string
+type ChirpDraft struct {
+	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+	PublishAt sql.NullTime
+}
+
+type Collection struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	Name      string
+}
+
+type DataExport struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UserID      uuid.UUID
+	Status      string
+	Archive     []byte
+	CompletedAt sql.NullTime
+	ExpiresAt   sql.NullTime
+	LeaseUntil  sql.NullTime
+}
+
+type EmailChange struct {
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	UserID           uuid.UUID
+	OldEmail         string
+	NewEmail         string
+	ConfirmTokenHash string
+	UndoTokenHash    string
+	ExpiresAt        time.Time
+	UndoExpiresAt    time.Time
+	ConfirmedAt      sql.NullTime
+	UndoneAt         sql.NullTime
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type Notification struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	Kind      string
+	ChirpID   uuid.NullUUID
+	ReadAt    sql.NullTime
+}
+
+type OauthClient struct {
+	ID           string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	UserID       uuid.UUID
+	Name         string
+	RedirectUris []string
+	SecretHash   sql.NullString
+}
+
+type OauthCode struct {
+	CodeHash      string
+	CreatedAt     time.Time
+	ClientID      string
+	UserID        uuid.UUID
+	RedirectUri   string
+	Scopes        []string
+	CodeChallenge string
+	ExpiresAt     time.Time
+	UsedAt        sql.NullTime
+}
+
+type OidcLogin struct {
+	StateHash    string
+	CreatedAt    time.Time
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+	Restore      bool
+}
+
+type Permission struct {
+	Name string
+}
+
+type Poll struct {
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	ChirpID          uuid.UUID
+	ClosesAt         time.Time
+	ClosedNotifiedAt sql.NullTime
+}
+
+type PollOption struct {
+	ID       uuid.UUID
+	PollID   uuid.UUID
+	Position int32
+	Text     string
+}
+
+type PollVote struct {
+	PollID    uuid.UUID
 	UserID    uuid.UUID
+	OptionID  uuid.UUID
+	CreatedAt time.Time
+}
+
+type RefreshToken struct {
+	Token      string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+	ClientID   sql.NullString
+	Scopes     []string
+	ID         uuid.UUID
+	UserAgent  string
+	Ip         string
+	LastUsedAt sql.NullTime
+	GrantID    uuid.NullUUID
+}
+
+type RevokedToken struct {
+	ID        string
+	CreatedAt time.Time
 	ExpiresAt time.Time
-	RevokedAt sql.NullTime
+}
+
+type Role struct {
+	Name string
+}
+
+type RolePermission struct {
+	Role       string
+	Permission string
+}
+
+type Subscription struct {
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	UserID           uuid.UUID
+	Plan             string
+	Status           string
+	CurrentPeriodEnd time.Time
+	CancelAt         sql.NullTime
+	LastEventAt      time.Time
 }
 
 type User struct {
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	Email            string
+	HashedPassword   string
+	Handle           sql.NullString
+	DisplayName      string
+	Bio              string
+	AvatarUrl        string
+	TokensValidAfter sql.NullTime
+	DeleteAfter      sql.NullTime
+	ChirpyRedUntil   sql.NullTime
+}
+
+type UserIdentity struct {
+	Provider  string
+	Subject   string
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	Email     string
+}
+
+type UserRole struct {
+	UserID    uuid.UUID
+	Role      string
+	CreatedAt time.Time
+}
+
+type WebhookDelivery struct {
 	ID             uuid.UUID
 	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	EndpointID     uuid.UUID
+	Event          string
+	Payload        string
+	Status         string
+	Attempts       int32
+	NextAttemptAt  time.Time
+	LastAttemptAt  sql.NullTime
+	ResponseStatus sql.NullInt32
+	LastError      string
+	DeliveredAt    sql.NullTime
+}
+
+type WebhookEndpoint struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	UserID       uuid.UUID
+	ClientID     sql.NullString
+	Url          string
+	Secret       string
+	Events       []string
+	FailureCount int32
+	DisabledAt   sql.NullTime
+}
+
+type WebhookEvent struct {
+	ID            string
+	CreatedAt     time.Time
+	Event         string
+	UserID        uuid.NullUUID
+	Payload       string
+	SentAt        time.Time
+	Status        string
+	Attempts      int32
+	NextAttemptAt time.Time
+	LastError     string
+	ProcessedAt   sql.NullTime
 }
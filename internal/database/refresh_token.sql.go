@@ -7,30 +7,85 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const createOAuthRefreshToken = `-- name: CreateOAuthRefreshToken :one
+INSERT INTO refresh_tokens(token, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scopes, grant_id)
+VALUES ($1, NOW(), NOW(), $2, $3, NULL, $4, $5, $6)
+RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scopes, id, user_agent, ip, last_used_at, grant_id
+`
+
+type CreateOAuthRefreshTokenParams struct {
+	Token     string
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	ClientID  sql.NullString
+	Scopes    []string
+	GrantID   uuid.NullUUID
+}
+
+func (q *Queries) CreateOAuthRefreshToken(ctx context.Context, arg CreateOAuthRefreshTokenParams) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, createOAuthRefreshToken,
+		arg.Token,
+		arg.UserID,
+		arg.ExpiresAt,
+		arg.ClientID,
+		pq.Array(arg.Scopes),
+		arg.GrantID,
+	)
+	var i RefreshToken
+	err := row.Scan(
+		&i.Token,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+		&i.ID,
+		&i.UserAgent,
+		&i.Ip,
+		&i.LastUsedAt,
+		&i.GrantID,
+	)
+	return i, err
+}
+
 const createRefreshToken = `-- name: CreateRefreshToken :one
 INSERT INTO refresh_tokens(token,
     created_at,
     updated_at, 
     user_id, 
     expires_at, 
-    revoked_at)
-VALUES ($1, NOW(), NOW(), $2,  $3, NULL)
-RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+    revoked_at,
+    user_agent,
+    ip)
+VALUES ($1, NOW(), NOW(), $2,  $3, NULL, $4, $5)
+RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scopes, id, user_agent, ip, last_used_at, grant_id
 `
 
 type CreateRefreshTokenParams struct {
 	Token     string
 	UserID    uuid.UUID
 	ExpiresAt time.Time
+	UserAgent string
+	Ip        string
 }
 
 func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, createRefreshToken, arg.Token, arg.UserID, arg.ExpiresAt)
+	row := q.db.QueryRowContext(ctx, createRefreshToken,
+		arg.Token,
+		arg.UserID,
+		arg.ExpiresAt,
+		arg.UserAgent,
+		arg.Ip,
+	)
 	var i RefreshToken
 	err := row.Scan(
 		&i.Token,
@@ -39,32 +94,185 @@ func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshToken
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+		&i.ID,
+		&i.UserAgent,
+		&i.Ip,
+		&i.LastUsedAt,
+		&i.GrantID,
 	)
 	return i, err
 }
 
-const getUserFromRefreshToken = `-- name: GetUserFromRefreshToken :one
-SELECT users.id, users.created_at, users.updated_at, users.email, users.hashed_password, users.is_chirpy_red FROM users
-JOIN refresh_tokens ON users.id = refresh_tokens.user_id
-WHERE refresh_tokens.token = $1
-AND revoked_at IS NULL
-AND expires_at > NOW()
+const getRefreshToken = `-- name: GetRefreshToken :one
+SELECT token, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scopes, id, user_agent, ip, last_used_at, grant_id FROM refresh_tokens WHERE token = $1
 `
 
-func (q *Queries) GetUserFromRefreshToken(ctx context.Context, token string) (User, error) {
-	row := q.db.QueryRowContext(ctx, getUserFromRefreshToken, token)
-	var i User
+func (q *Queries) GetRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getRefreshToken, token)
+	var i RefreshToken
 	err := row.Scan(
-		&i.ID,
+		&i.Token,
 		&i.CreatedAt,
 		&i.UpdatedAt,
-		&i.Email,
-		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+		&i.ID,
+		&i.UserAgent,
+		&i.Ip,
+		&i.LastUsedAt,
+		&i.GrantID,
 	)
 	return i, err
 }
 
+const getSessions = `-- name: GetSessions :many
+SELECT token, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scopes, id, user_agent, ip, last_used_at, grant_id FROM refresh_tokens
+WHERE user_id = $1
+AND client_id IS NULL
+AND revoked_at IS NULL
+AND expires_at > NOW()
+ORDER BY COALESCE(last_used_at, created_at) DESC
+`
+
+func (q *Queries) GetSessions(ctx context.Context, userID uuid.UUID) ([]RefreshToken, error) {
+	rows, err := q.db.QueryContext(ctx, getSessions, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RefreshToken
+	for rows.Next() {
+		var i RefreshToken
+		if err := rows.Scan(
+			&i.Token,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ExpiresAt,
+			&i.RevokedAt,
+			&i.ClientID,
+			pq.Array(&i.Scopes),
+			&i.ID,
+			&i.UserAgent,
+			&i.Ip,
+			&i.LastUsedAt,
+			&i.GrantID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeOAuthGrant = `-- name: RevokeOAuthGrant :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE grant_id = $1::uuid AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeOAuthGrant(ctx context.Context, grantID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeOAuthGrant, grantID)
+	return err
+}
+
+const revokeOAuthRefreshToken = `-- name: RevokeOAuthRefreshToken :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE token = $1 AND client_id = $2::text AND revoked_at IS NULL
+`
+
+type RevokeOAuthRefreshTokenParams struct {
+	Token    string
+	ClientID string
+}
+
+func (q *Queries) RevokeOAuthRefreshToken(ctx context.Context, arg RevokeOAuthRefreshTokenParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeOAuthRefreshToken, arg.Token, arg.ClientID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeOtherSessions = `-- name: RevokeOtherSessions :many
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND id <> $2 AND client_id IS NULL AND revoked_at IS NULL
+RETURNING id
+`
+
+type RevokeOtherSessionsParams struct {
+	UserID    uuid.UUID
+	CurrentID uuid.UUID
+}
+
+// log out everywhere else, every session of the user but the current one
+func (q *Queries) RevokeOtherSessions(ctx context.Context, arg RevokeOtherSessionsParams) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, revokeOtherSessions, arg.UserID, arg.CurrentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeSession = `-- name: RevokeSession :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND user_id = $2 AND client_id IS NULL AND revoked_at IS NULL
+`
+
+type RevokeSessionParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) RevokeSession(ctx context.Context, arg RevokeSessionParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeSession, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeUserRefreshTokens = `-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL
+`
+
+// every session of the user and every refresh token given to oauth clients
+func (q *Queries) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeUserRefreshTokens, userID)
+	return err
+}
+
 const setRevokedAtToken = `-- name: SetRevokedAtToken :exec
 UPDATE refresh_tokens 
 SET revoked_at = NOW(),
@@ -76,3 +284,77 @@ func (q *Queries) SetRevokedAtToken(ctx context.Context, token string) error {
 	_, err := q.db.ExecContext(ctx, setRevokedAtToken, token)
 	return err
 }
+
+const useOAuthRefreshToken = `-- name: UseOAuthRefreshToken :one
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE token = $1
+AND client_id = $2::text
+AND revoked_at IS NULL
+AND expires_at > NOW()
+RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scopes, id, user_agent, ip, last_used_at, grant_id
+`
+
+type UseOAuthRefreshTokenParams struct {
+	Token    string
+	ClientID string
+}
+
+// oauth refresh tokens can only be used once, the client is given a new one of the same grant
+func (q *Queries) UseOAuthRefreshToken(ctx context.Context, arg UseOAuthRefreshTokenParams) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, useOAuthRefreshToken, arg.Token, arg.ClientID)
+	var i RefreshToken
+	err := row.Scan(
+		&i.Token,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+		&i.ID,
+		&i.UserAgent,
+		&i.Ip,
+		&i.LastUsedAt,
+		&i.GrantID,
+	)
+	return i, err
+}
+
+const useRefreshToken = `-- name: UseRefreshToken :one
+UPDATE refresh_tokens
+SET last_used_at = NOW(), ip = $2
+WHERE token = $1
+AND client_id IS NULL
+AND revoked_at IS NULL
+AND expires_at > NOW()
+RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scopes, id, user_agent, ip, last_used_at, grant_id
+`
+
+type UseRefreshTokenParams struct {
+	Token string
+	Ip    string
+}
+
+// only first-party refresh tokens (sessions), third-party apps refresh through the oauth token endpoint
+func (q *Queries) UseRefreshToken(ctx context.Context, arg UseRefreshTokenParams) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, useRefreshToken, arg.Token, arg.Ip)
+	var i RefreshToken
+	err := row.Scan(
+		&i.Token,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+		&i.ID,
+		&i.UserAgent,
+		&i.Ip,
+		&i.LastUsedAt,
+		&i.GrantID,
+	)
+	return i, err
+}
@@ -7,14 +7,47 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const changeUserPassword = `-- name: ChangeUserPassword :one
+UPDATE users SET hashed_password = $2, updated_at = NOW() WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, handle, display_name, bio, avatar_url, tokens_valid_after, delete_after, chirpy_red_until
+`
+
+type ChangeUserPasswordParams struct {
+	ID             uuid.UUID
+	HashedPassword string
+}
+
+func (q *Queries) ChangeUserPassword(ctx context.Context, arg ChangeUserPasswordParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, changeUserPassword, arg.ID, arg.HashedPassword)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.TokensValidAfter,
+		&i.DeleteAfter,
+		&i.ChirpyRedUntil,
+	)
+	return i, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users(id, created_at, updated_at, email, hashed_password)
 VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, handle, display_name, bio, avatar_url, tokens_valid_after, delete_after, chirpy_red_until
 `
 
 type CreateUserParams struct {
@@ -31,11 +64,29 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.TokensValidAfter,
+		&i.DeleteAfter,
+		&i.ChirpyRedUntil,
 	)
 	return i, err
 }
 
+const deleteUser = `-- name: DeleteUser :execrows
+DELETE FROM users WHERE id = $1
+`
+
+func (q *Queries) DeleteUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const deleteUsers = `-- name: DeleteUsers :exec
 DELETE FROM users
 `
@@ -45,8 +96,86 @@ func (q *Queries) DeleteUsers(ctx context.Context) error {
 	return err
 }
 
+const getAuthors = `-- name: GetAuthors :many
+SELECT id, handle, display_name, avatar_url FROM users
+WHERE id = ANY($1::uuid[])
+`
+
+type GetAuthorsRow struct {
+	ID          uuid.UUID
+	Handle      sql.NullString
+	DisplayName string
+	AvatarUrl   string
+}
+
+func (q *Queries) GetAuthors(ctx context.Context, ids []uuid.UUID) ([]GetAuthorsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getAuthors, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetAuthorsRow
+	for rows.Next() {
+		var i GetAuthorsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Handle,
+			&i.DisplayName,
+			&i.AvatarUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getProfileByHandle = `-- name: GetProfileByHandle :one
+SELECT id, created_at, handle, display_name, bio, avatar_url,
+    (SELECT COUNT(*) FROM follows WHERE follows.followee_id = users.id) AS followers_count,
+    (SELECT COUNT(*) FROM follows WHERE follows.follower_id = users.id) AS following_count,
+    (SELECT COUNT(*) FROM chirps WHERE chirps.user_id = users.id AND chirps.deleted_at IS NULL) AS chirps_count
+FROM users
+WHERE LOWER(handle) = LOWER($1) AND delete_after IS NULL
+`
+
+type GetProfileByHandleRow struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	Handle         sql.NullString
+	DisplayName    string
+	Bio            string
+	AvatarUrl      string
+	FollowersCount int64
+	FollowingCount int64
+	ChirpsCount    int64
+}
+
+func (q *Queries) GetProfileByHandle(ctx context.Context, handle string) (GetProfileByHandleRow, error) {
+	row := q.db.QueryRowContext(ctx, getProfileByHandle, handle)
+	var i GetProfileByHandleRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.FollowersCount,
+		&i.FollowingCount,
+		&i.ChirpsCount,
+	)
+	return i, err
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users WHERE email = $1
+SELECT id, created_at, updated_at, email, hashed_password, handle, display_name, bio, avatar_url, tokens_valid_after, delete_after, chirpy_red_until FROM users WHERE email = $1
 `
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
@@ -58,26 +187,110 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.TokensValidAfter,
+		&i.DeleteAfter,
+		&i.ChirpyRedUntil,
 	)
 	return i, err
 }
 
-const updateUserPassEmail = `-- name: UpdateUserPassEmail :one
-UPDATE users
-SET email = $1, hashed_password = $2, updated_at = NOW()
-WHERE id = $3
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, handle, display_name, bio, avatar_url, tokens_valid_after, delete_after, chirpy_red_until FROM users WHERE id = $1
 `
 
-type UpdateUserPassEmailParams struct {
-	Email          string
-	HashedPassword string
-	ID             uuid.UUID
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.TokensValidAfter,
+		&i.DeleteAfter,
+		&i.ChirpyRedUntil,
+	)
+	return i, err
+}
+
+const getUsers = `-- name: GetUsers :many
+SELECT id, created_at, updated_at, email, hashed_password, handle, display_name, bio, avatar_url, tokens_valid_after, delete_after, chirpy_red_until FROM users
+ORDER BY created_at ASC
+LIMIT $1 OFFSET $2
+`
+
+type GetUsersParams struct {
+	Limit  int32
+	Offset int32
+}
+
+func (q *Queries) GetUsers(ctx context.Context, arg GetUsersParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, getUsers, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Email,
+			&i.HashedPassword,
+			&i.Handle,
+			&i.DisplayName,
+			&i.Bio,
+			&i.AvatarUrl,
+			&i.TokensValidAfter,
+			&i.DeleteAfter,
+			&i.ChirpyRedUntil,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-func (q *Queries) UpdateUserPassEmail(ctx context.Context, arg UpdateUserPassEmailParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, updateUserPassEmail, arg.Email, arg.HashedPassword, arg.ID)
+const purgeDeletedUsers = `-- name: PurgeDeletedUsers :execrows
+DELETE FROM users WHERE delete_after <= NOW()
+`
+
+// everything of the users goes with them through the ON DELETE CASCADE foreign keys
+func (q *Queries) PurgeDeletedUsers(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedUsers)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const restoreUser = `-- name: RestoreUser :one
+UPDATE users SET delete_after = NULL, updated_at = NOW()
+WHERE id = $1 AND delete_after > NOW()
+RETURNING id, created_at, updated_at, email, hashed_password, handle, display_name, bio, avatar_url, tokens_valid_after, delete_after, chirpy_red_until
+`
+
+// an account can be restored until it's purged
+func (q *Queries) RestoreUser(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, restoreUser, id)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -85,18 +298,130 @@ func (q *Queries) UpdateUserPassEmail(ctx context.Context, arg UpdateUserPassEma
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.TokensValidAfter,
+		&i.DeleteAfter,
+		&i.ChirpyRedUntil,
 	)
 	return i, err
 }
 
-const upgradeToChirpyRed = `-- name: UpgradeToChirpyRed :exec
-UPDATE users
-SET is_chirpy_red = TRUE
-WHERE id = $1
+const scheduleUserDeletion = `-- name: ScheduleUserDeletion :one
+UPDATE users SET delete_after = $2, updated_at = NOW()
+WHERE id = $1 AND delete_after IS NULL
+RETURNING id, created_at, updated_at, email, hashed_password, handle, display_name, bio, avatar_url, tokens_valid_after, delete_after, chirpy_red_until
+`
+
+type ScheduleUserDeletionParams struct {
+	ID          uuid.UUID
+	DeleteAfter sql.NullTime
+}
+
+func (q *Queries) ScheduleUserDeletion(ctx context.Context, arg ScheduleUserDeletionParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, scheduleUserDeletion, arg.ID, arg.DeleteAfter)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.TokensValidAfter,
+		&i.DeleteAfter,
+		&i.ChirpyRedUntil,
+	)
+	return i, err
+}
+
+const updateUserEmail = `-- name: UpdateUserEmail :one
+UPDATE users SET email = $2, updated_at = NOW() WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, handle, display_name, bio, avatar_url, tokens_valid_after, delete_after, chirpy_red_until
+`
+
+type UpdateUserEmailParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) UpdateUserEmail(ctx context.Context, arg UpdateUserEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserEmail, arg.ID, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.TokensValidAfter,
+		&i.DeleteAfter,
+		&i.ChirpyRedUntil,
+	)
+	return i, err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users SET hashed_password = $2 WHERE id = $1
 `
 
-func (q *Queries) UpgradeToChirpyRed(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, upgradeToChirpyRed, id)
+type UpdateUserPasswordParams struct {
+	ID             uuid.UUID
+	HashedPassword string
+}
+
+// replaces an outdated hash of the same password, so updated_at doesn't change
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.ID, arg.HashedPassword)
 	return err
 }
+
+const updateUserProfile = `-- name: UpdateUserProfile :one
+UPDATE users
+SET handle = $1, display_name = $2, bio = $3, avatar_url = $4, updated_at = NOW()
+WHERE id = $5
+RETURNING id, created_at, updated_at, email, hashed_password, handle, display_name, bio, avatar_url, tokens_valid_after, delete_after, chirpy_red_until
+`
+
+type UpdateUserProfileParams struct {
+	Handle      sql.NullString
+	DisplayName string
+	Bio         string
+	AvatarUrl   string
+	ID          uuid.UUID
+}
+
+func (q *Queries) UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserProfile,
+		arg.Handle,
+		arg.DisplayName,
+		arg.Bio,
+		arg.AvatarUrl,
+		arg.ID,
+	)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.TokensValidAfter,
+		&i.DeleteAfter,
+		&i.ChirpyRedUntil,
+	)
+	return i, err
+}
@@ -0,0 +1,84 @@
+package mail
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatMessage(t *testing.T) {
+	date := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		msg      Message
+		contains []string
+		wantErr  error
+	}{
+		{
+			name: "Plain message",
+			msg:  Message{To: "user@example.com", Subject: "Hello", Body: "line one\nline two"},
+			contains: []string{
+				"From: chirpy@example.com\r\n",
+				"To: user@example.com\r\n",
+				"Subject: Hello\r\n",
+				"Date: Thu, 02 Jan 2025 03:04:05 +0000\r\n",
+				"\r\n\r\nline one\r\nline two",
+			},
+		},
+		{
+			name:     "Non-ASCII subject is encoded",
+			msg:      Message{To: "user@example.com", Subject: "Café", Body: "body"},
+			contains: []string{"Subject: =?utf-8?q?Caf=C3=A9?=\r\n"},
+		},
+		{
+			name:    "Line break in the recipient",
+			msg:     Message{To: "user@example.com\r\nBcc: victim@example.com", Subject: "Hello"},
+			wantErr: errHeaderInjection,
+		},
+		{
+			name:    "Line break in the subject",
+			msg:     Message{To: "user@example.com", Subject: "Hello\nBcc: victim@example.com"},
+			wantErr: errHeaderInjection,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := FormatMessage("chirpy@example.com", tt.msg, date)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("FormatMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("FormatMessage() = %q, want it to contain %q", data, want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		want    bool
+	}{
+		{"user@example.com", true},
+		{"first.last+tag@sub.example.com", true},
+		{"", false},
+		{"user", false},
+		{"user@", false},
+		{"User <user@example.com>", false},
+		{" user@example.com", false},
+		{"user@example.com\r\nBcc: victim@example.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			if got := ValidAddress(tt.address); got != tt.want {
+				t.Errorf("ValidAddress(%q) = %v, want %v", tt.address, got, tt.want)
+			}
+		})
+	}
+}
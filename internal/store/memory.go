@@ -0,0 +1,2225 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/auth"
+	"github.com/h0dy/http-server/internal/database"
+)
+
+// rolePermissions are the permissions of the roles, as seeded by the migrations
+var rolePermissions = map[string][]string{
+	auth.RoleAdmin:     {auth.PermissionDeleteAnyChirp, auth.PermissionManageUsers, auth.PermissionManageWebhooks},
+	auth.RoleModerator: {auth.PermissionDeleteAnyChirp},
+}
+
+// Memory is a store that keeps everything in memory, for the tests and for trying the api out, it's safe for
+// concurrent use
+type Memory struct {
+	mu   *sync.Mutex
+	data *memoryData
+	inTx bool // the lock is held by InTx
+}
+
+type memoryData struct {
+	users         map[uuid.UUID]database.User
+	userRoles     map[uuid.UUID][]string // sorted
+	chirps        map[uuid.UUID]database.Chirp
+	polls         map[uuid.UUID]database.Poll
+	pollOptions   map[uuid.UUID]database.PollOption
+	pollVotes     map[[2]uuid.UUID]database.PollVote // keyed by poll id and user id
+	refreshTokens map[string]database.RefreshToken
+	revokedTokens map[string]database.RevokedToken
+	emailChanges  map[uuid.UUID]database.EmailChange
+	identities    map[[2]string]database.UserIdentity // keyed by provider and subject
+	oidcLogins    map[string]database.OidcLogin
+	follows       map[[2]uuid.UUID]database.Follow // keyed by follower id and followee id
+	notifications map[uuid.UUID]database.Notification
+	apiTokens     map[uuid.UUID]database.ApiToken
+	drafts        map[uuid.UUID]database.ChirpDraft
+	collections   map[uuid.UUID]database.Collection
+	bookmarks     map[[2]uuid.UUID]database.Bookmark // keyed by collection id and chirp id
+	oauthClients  map[string]database.OauthClient
+	oauthCodes    map[string]database.OauthCode
+	endpoints     map[uuid.UUID]database.WebhookEndpoint
+	deliveries    map[uuid.UUID]database.WebhookDelivery
+	webhookEvents map[string]database.WebhookEvent
+	subscriptions map[uuid.UUID]database.Subscription // keyed by user id
+	dataExports   map[uuid.UUID]database.DataExport
+}
+
+var _ Store = (*Memory)(nil)
+
+func NewMemory() *Memory {
+	return &Memory{
+		mu: &sync.Mutex{},
+		data: &memoryData{
+			users:         map[uuid.UUID]database.User{},
+			userRoles:     map[uuid.UUID][]string{},
+			chirps:        map[uuid.UUID]database.Chirp{},
+			polls:         map[uuid.UUID]database.Poll{},
+			pollOptions:   map[uuid.UUID]database.PollOption{},
+			pollVotes:     map[[2]uuid.UUID]database.PollVote{},
+			refreshTokens: map[string]database.RefreshToken{},
+			revokedTokens: map[string]database.RevokedToken{},
+			emailChanges:  map[uuid.UUID]database.EmailChange{},
+			identities:    map[[2]string]database.UserIdentity{},
+			oidcLogins:    map[string]database.OidcLogin{},
+			follows:       map[[2]uuid.UUID]database.Follow{},
+			notifications: map[uuid.UUID]database.Notification{},
+			apiTokens:     map[uuid.UUID]database.ApiToken{},
+			drafts:        map[uuid.UUID]database.ChirpDraft{},
+			collections:   map[uuid.UUID]database.Collection{},
+			bookmarks:     map[[2]uuid.UUID]database.Bookmark{},
+			oauthClients:  map[string]database.OauthClient{},
+			oauthCodes:    map[string]database.OauthCode{},
+			endpoints:     map[uuid.UUID]database.WebhookEndpoint{},
+			deliveries:    map[uuid.UUID]database.WebhookDelivery{},
+			webhookEvents: map[string]database.WebhookEvent{},
+			subscriptions: map[uuid.UUID]database.Subscription{},
+			dataExports:   map[uuid.UUID]database.DataExport{},
+		},
+	}
+}
+
+// lock func locks the store for one method, unless InTx already holds the lock
+func (m *Memory) lock() (unlock func()) {
+	if m.inTx {
+		return func() {}
+	}
+	m.mu.Lock()
+	return m.mu.Unlock
+}
+
+// InTx func runs fn with the store locked, the data is restored to its snapshot if fn fails
+func (m *Memory) InTx(ctx context.Context, fn func(tx Store) error) error {
+	if !m.inTx {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+	}
+
+	snapshot := m.data.clone()
+	if err := fn(&Memory{mu: m.mu, data: m.data, inTx: true}); err != nil {
+		*m.data = snapshot
+		return err
+	}
+	return nil
+}
+
+func (d *memoryData) clone() memoryData {
+	userRoles := make(map[uuid.UUID][]string, len(d.userRoles))
+	for userID, roles := range d.userRoles {
+		userRoles[userID] = slices.Clone(roles)
+	}
+	return memoryData{
+		users:         maps.Clone(d.users),
+		userRoles:     userRoles,
+		chirps:        maps.Clone(d.chirps),
+		polls:         maps.Clone(d.polls),
+		pollOptions:   maps.Clone(d.pollOptions),
+		pollVotes:     maps.Clone(d.pollVotes),
+		refreshTokens: maps.Clone(d.refreshTokens),
+		revokedTokens: maps.Clone(d.revokedTokens),
+		emailChanges:  maps.Clone(d.emailChanges),
+		identities:    maps.Clone(d.identities),
+		oidcLogins:    maps.Clone(d.oidcLogins),
+		follows:       maps.Clone(d.follows),
+		notifications: maps.Clone(d.notifications),
+		apiTokens:     maps.Clone(d.apiTokens),
+		drafts:        maps.Clone(d.drafts),
+		collections:   maps.Clone(d.collections),
+		bookmarks:     maps.Clone(d.bookmarks),
+		oauthClients:  maps.Clone(d.oauthClients),
+		oauthCodes:    maps.Clone(d.oauthCodes),
+		endpoints:     maps.Clone(d.endpoints),
+		deliveries:    maps.Clone(d.deliveries),
+		webhookEvents: maps.Clone(d.webhookEvents),
+		subscriptions: maps.Clone(d.subscriptions),
+		dataExports:   maps.Clone(d.dataExports),
+	}
+}
+
+// lastNow is the last time returned by now, in unix microseconds
+var lastNow atomic.Int64
+
+// now func returns the current time with the precision of postgres timestamps. it's always after the time it
+// returned before, so the rows created one after the other sort in that order like they would in postgres
+func now() time.Time {
+	for {
+		last := lastNow.Load()
+		next := max(time.Now().UnixMicro(), last+1)
+		if lastNow.CompareAndSwap(last, next) {
+			return time.UnixMicro(next).UTC()
+		}
+	}
+}
+
+// sortedValues func returns the values of the map sorted with cmp, ties are broken by key so the order is stable
+func sortedValues[K comparable, V any](values map[K]V, keep func(V) bool, cmp func(a, b V) int, key func(V) string) []V {
+	res := []V{}
+	for _, value := range values {
+		if keep(value) {
+			res = append(res, value)
+		}
+	}
+	slices.SortFunc(res, func(a, b V) int {
+		if c := cmp(a, b); c != 0 {
+			return c
+		}
+		return strings.Compare(key(a), key(b))
+	})
+	return res
+}
+
+// users
+
+func (m *Memory) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	defer m.lock()()
+	for _, user := range m.data.users {
+		if user.Email == arg.Email {
+			return database.User{}, fmt.Errorf("email %v: %w", arg.Email, ErrConflict)
+		}
+	}
+	createdAt := now()
+	user := database.User{
+		ID:             uuid.New(),
+		CreatedAt:      createdAt,
+		UpdatedAt:      createdAt,
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+	}
+	m.data.users[user.ID] = user
+	return user, nil
+}
+
+func (m *Memory) DeleteUsers(ctx context.Context) error {
+	defer m.lock()()
+	for id := range m.data.users {
+		m.data.deleteUser(id)
+	}
+	return nil
+}
+
+// deleteUser func deletes the user with everything that references them, like the ON DELETE CASCADE foreign keys
+func (d *memoryData) deleteUser(id uuid.UUID) {
+	delete(d.users, id)
+	delete(d.userRoles, id)
+	delete(d.subscriptions, id)
+	for exportID, export := range d.dataExports {
+		if export.UserID == id {
+			delete(d.dataExports, exportID)
+		}
+	}
+	for _, chirp := range d.chirps {
+		if chirp.UserID == id {
+			d.deleteChirp(chirp.ID)
+		}
+	}
+	for key, vote := range d.pollVotes {
+		if vote.UserID == id {
+			delete(d.pollVotes, key)
+		}
+	}
+	for token, refreshToken := range d.refreshTokens {
+		if refreshToken.UserID == id {
+			delete(d.refreshTokens, token)
+		}
+	}
+	for changeID, change := range d.emailChanges {
+		if change.UserID == id {
+			delete(d.emailChanges, changeID)
+		}
+	}
+	for key, identity := range d.identities {
+		if identity.UserID == id {
+			delete(d.identities, key)
+		}
+	}
+	for key := range d.follows {
+		if key[0] == id || key[1] == id {
+			delete(d.follows, key)
+		}
+	}
+	for notificationID, notification := range d.notifications {
+		if notification.UserID == id {
+			delete(d.notifications, notificationID)
+		}
+	}
+	for tokenID, apiToken := range d.apiTokens {
+		if apiToken.UserID == id {
+			delete(d.apiTokens, tokenID)
+		}
+	}
+	for draftID, draft := range d.drafts {
+		if draft.UserID == id {
+			delete(d.drafts, draftID)
+		}
+	}
+	for collectionID, collection := range d.collections {
+		if collection.UserID == id {
+			d.deleteCollection(collectionID)
+		}
+	}
+	for clientID, client := range d.oauthClients {
+		if client.UserID == id {
+			d.deleteOAuthClient(clientID)
+		}
+	}
+	for codeHash, code := range d.oauthCodes {
+		if code.UserID == id {
+			delete(d.oauthCodes, codeHash)
+		}
+	}
+	for endpointID, endpoint := range d.endpoints {
+		if endpoint.UserID == id {
+			d.deleteWebhookEndpoint(endpointID)
+		}
+	}
+}
+
+func (m *Memory) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	defer m.lock()()
+	for _, user := range m.data.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (m *Memory) GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error) {
+	defer m.lock()()
+	user, ok := m.data.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (m *Memory) UpdateUserEmail(ctx context.Context, arg database.UpdateUserEmailParams) (database.User, error) {
+	defer m.lock()()
+	user, ok := m.data.users[arg.ID]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	for _, other := range m.data.users {
+		if other.ID != user.ID && other.Email == arg.Email {
+			return database.User{}, fmt.Errorf("email %v: %w", arg.Email, ErrConflict)
+		}
+	}
+	user.Email = arg.Email
+	user.UpdatedAt = now()
+	m.data.users[user.ID] = user
+	return user, nil
+}
+
+func (m *Memory) ChangeUserPassword(ctx context.Context, arg database.ChangeUserPasswordParams) (database.User, error) {
+	defer m.lock()()
+	user, ok := m.data.users[arg.ID]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	user.HashedPassword = arg.HashedPassword
+	user.UpdatedAt = now()
+	m.data.users[user.ID] = user
+	return user, nil
+}
+
+func (m *Memory) UpdateUserPassword(ctx context.Context, arg database.UpdateUserPasswordParams) error {
+	defer m.lock()()
+	if user, ok := m.data.users[arg.ID]; ok {
+		user.HashedPassword = arg.HashedPassword
+		m.data.users[user.ID] = user
+	}
+	return nil
+}
+
+func (m *Memory) UpdateUserProfile(ctx context.Context, arg database.UpdateUserProfileParams) (database.User, error) {
+	defer m.lock()()
+	user, ok := m.data.users[arg.ID]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	if arg.Handle.Valid {
+		for _, other := range m.data.users {
+			if other.ID != user.ID && other.Handle.Valid && strings.EqualFold(other.Handle.String, arg.Handle.String) {
+				return database.User{}, fmt.Errorf("handle %v: %w", arg.Handle.String, ErrConflict)
+			}
+		}
+	}
+	user.Handle = arg.Handle
+	user.DisplayName = arg.DisplayName
+	user.Bio = arg.Bio
+	user.AvatarUrl = arg.AvatarUrl
+	user.UpdatedAt = now()
+	m.data.users[user.ID] = user
+	return user, nil
+}
+
+func (m *Memory) GetProfileByHandle(ctx context.Context, handle string) (database.GetProfileByHandleRow, error) {
+	defer m.lock()()
+	for _, user := range m.data.users {
+		if !user.Handle.Valid || !strings.EqualFold(user.Handle.String, handle) || user.DeleteAfter.Valid {
+			continue
+		}
+		profile := database.GetProfileByHandleRow{
+			ID:          user.ID,
+			CreatedAt:   user.CreatedAt,
+			Handle:      user.Handle,
+			DisplayName: user.DisplayName,
+			Bio:         user.Bio,
+			AvatarUrl:   user.AvatarUrl,
+		}
+		for key := range m.data.follows {
+			if key[1] == user.ID {
+				profile.FollowersCount++
+			}
+			if key[0] == user.ID {
+				profile.FollowingCount++
+			}
+		}
+		for _, chirp := range m.data.chirps {
+			if chirp.UserID == user.ID && !chirp.DeletedAt.Valid {
+				profile.ChirpsCount++
+			}
+		}
+		return profile, nil
+	}
+	return database.GetProfileByHandleRow{}, sql.ErrNoRows
+}
+
+func (m *Memory) GetAuthors(ctx context.Context, ids []uuid.UUID) ([]database.GetAuthorsRow, error) {
+	defer m.lock()()
+	authors := []database.GetAuthorsRow{}
+	seen := map[uuid.UUID]bool{}
+	for _, id := range ids {
+		user, ok := m.data.users[id]
+		if !ok || seen[id] {
+			continue
+		}
+		seen[id] = true
+		authors = append(authors, database.GetAuthorsRow{
+			ID:          user.ID,
+			Handle:      user.Handle,
+			DisplayName: user.DisplayName,
+			AvatarUrl:   user.AvatarUrl,
+		})
+	}
+	return authors, nil
+}
+
+func (m *Memory) GetUsers(ctx context.Context, arg database.GetUsersParams) ([]database.User, error) {
+	defer m.lock()()
+	users := sortedValues(m.data.users,
+		func(database.User) bool { return true },
+		func(a, b database.User) int { return a.CreatedAt.Compare(b.CreatedAt) },
+		func(user database.User) string { return user.ID.String() },
+	)
+	return page(users, arg.Limit, arg.Offset), nil
+}
+
+// page func returns the rows of LIMIT limit OFFSET offset
+func page[V any](rows []V, limit, offset int32) []V {
+	start := min(int(offset), len(rows))
+	end := min(start+int(limit), len(rows))
+	return rows[start:end]
+}
+
+func (m *Memory) DeleteUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	defer m.lock()()
+	if _, ok := m.data.users[id]; !ok {
+		return 0, nil
+	}
+	m.data.deleteUser(id)
+	return 1, nil
+}
+
+func (m *Memory) ScheduleUserDeletion(ctx context.Context, arg database.ScheduleUserDeletionParams) (database.User, error) {
+	defer m.lock()()
+	user, ok := m.data.users[arg.ID]
+	if !ok || user.DeleteAfter.Valid {
+		return database.User{}, sql.ErrNoRows
+	}
+	user.DeleteAfter = arg.DeleteAfter
+	user.UpdatedAt = now()
+	m.data.users[user.ID] = user
+	return user, nil
+}
+
+func (m *Memory) RestoreUser(ctx context.Context, id uuid.UUID) (database.User, error) {
+	defer m.lock()()
+	user, ok := m.data.users[id]
+	if !ok || !user.DeleteAfter.Valid || !user.DeleteAfter.Time.After(now()) {
+		return database.User{}, sql.ErrNoRows
+	}
+	user.DeleteAfter = sql.NullTime{}
+	user.UpdatedAt = now()
+	m.data.users[user.ID] = user
+	return user, nil
+}
+
+func (m *Memory) PurgeDeletedUsers(ctx context.Context) (int64, error) {
+	defer m.lock()()
+	purged := int64(0)
+	for _, user := range m.data.users {
+		if user.DeleteAfter.Valid && !user.DeleteAfter.Time.After(now()) {
+			m.data.deleteUser(user.ID)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (m *Memory) SetTokensValidAfter(ctx context.Context, arg database.SetTokensValidAfterParams) error {
+	defer m.lock()()
+	if user, ok := m.data.users[arg.ID]; ok {
+		user.TokensValidAfter = arg.TokensValidAfter
+		m.data.users[user.ID] = user
+	}
+	return nil
+}
+
+func (m *Memory) SetChirpyRedUntil(ctx context.Context, arg database.SetChirpyRedUntilParams) error {
+	defer m.lock()()
+	if user, ok := m.data.users[arg.ID]; ok {
+		user.ChirpyRedUntil = arg.ChirpyRedUntil
+		m.data.users[user.ID] = user
+	}
+	return nil
+}
+
+func (m *Memory) GetTokensValidAfter(ctx context.Context, since time.Time) ([]database.GetTokensValidAfterRow, error) {
+	defer m.lock()()
+	rows := []database.GetTokensValidAfterRow{}
+	for _, user := range m.data.users {
+		if user.TokensValidAfter.Valid && user.TokensValidAfter.Time.After(since) {
+			rows = append(rows, database.GetTokensValidAfterRow{ID: user.ID, TokensValidAfter: user.TokensValidAfter})
+		}
+	}
+	return rows, nil
+}
+
+func (m *Memory) GetUserRoles(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	defer m.lock()()
+	return slices.Clone(m.data.userRoles[userID]), nil
+}
+
+func (m *Memory) GetUserPermissions(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	defer m.lock()()
+	permissions := []string{}
+	for _, role := range m.data.userRoles[userID] {
+		permissions = append(permissions, rolePermissions[role]...)
+	}
+	slices.Sort(permissions)
+	return slices.Compact(permissions), nil
+}
+
+func (m *Memory) AssignUserRole(ctx context.Context, arg database.AssignUserRoleParams) error {
+	defer m.lock()()
+	if _, ok := m.data.users[arg.UserID]; !ok {
+		return fmt.Errorf("user %v doesn't exist", arg.UserID)
+	}
+	if _, ok := rolePermissions[arg.Role]; !ok {
+		return fmt.Errorf("role %v doesn't exist", arg.Role)
+	}
+	roles := m.data.userRoles[arg.UserID]
+	if idx, found := slices.BinarySearch(roles, arg.Role); !found {
+		m.data.userRoles[arg.UserID] = slices.Insert(roles, idx, arg.Role)
+	}
+	return nil
+}
+
+func (m *Memory) RemoveUserRole(ctx context.Context, arg database.RemoveUserRoleParams) (int64, error) {
+	defer m.lock()()
+	roles := m.data.userRoles[arg.UserID]
+	idx, found := slices.BinarySearch(roles, arg.Role)
+	if !found {
+		return 0, nil
+	}
+	m.data.userRoles[arg.UserID] = slices.Delete(roles, idx, idx+1)
+	return 1, nil
+}
+
+// email changes
+
+func (m *Memory) CreateEmailChange(ctx context.Context, arg database.CreateEmailChangeParams) (database.EmailChange, error) {
+	defer m.lock()()
+	if _, ok := m.data.users[arg.UserID]; !ok {
+		return database.EmailChange{}, fmt.Errorf("user %v doesn't exist", arg.UserID)
+	}
+	for _, change := range m.data.emailChanges {
+		if change.ConfirmTokenHash == arg.ConfirmTokenHash || change.UndoTokenHash == arg.UndoTokenHash {
+			return database.EmailChange{}, fmt.Errorf("email change token: %w", ErrConflict)
+		}
+	}
+	change := database.EmailChange{
+		ID:               uuid.New(),
+		CreatedAt:        now(),
+		UserID:           arg.UserID,
+		OldEmail:         arg.OldEmail,
+		NewEmail:         arg.NewEmail,
+		ConfirmTokenHash: arg.ConfirmTokenHash,
+		UndoTokenHash:    arg.UndoTokenHash,
+		ExpiresAt:        arg.ExpiresAt,
+		UndoExpiresAt:    arg.UndoExpiresAt,
+	}
+	m.data.emailChanges[change.ID] = change
+	return change, nil
+}
+
+func (m *Memory) CancelEmailChanges(ctx context.Context, userID uuid.UUID) error {
+	defer m.lock()()
+	for _, change := range m.data.emailChanges {
+		if change.UserID == userID && !change.ConfirmedAt.Valid && !change.UndoneAt.Valid {
+			change.UndoneAt = sql.NullTime{Time: now(), Valid: true}
+			m.data.emailChanges[change.ID] = change
+		}
+	}
+	return nil
+}
+
+func (m *Memory) ConfirmEmailChange(ctx context.Context, confirmTokenHash string) (database.EmailChange, error) {
+	defer m.lock()()
+	for _, change := range m.data.emailChanges {
+		if change.ConfirmTokenHash == confirmTokenHash && !change.ConfirmedAt.Valid && !change.UndoneAt.Valid && change.ExpiresAt.After(now()) {
+			change.ConfirmedAt = sql.NullTime{Time: now(), Valid: true}
+			m.data.emailChanges[change.ID] = change
+			return change, nil
+		}
+	}
+	return database.EmailChange{}, sql.ErrNoRows
+}
+
+func (m *Memory) UndoEmailChange(ctx context.Context, undoTokenHash string) (database.EmailChange, error) {
+	defer m.lock()()
+	for _, change := range m.data.emailChanges {
+		if change.UndoTokenHash == undoTokenHash && !change.UndoneAt.Valid && change.UndoExpiresAt.After(now()) {
+			change.UndoneAt = sql.NullTime{Time: now(), Valid: true}
+			m.data.emailChanges[change.ID] = change
+			return change, nil
+		}
+	}
+	return database.EmailChange{}, sql.ErrNoRows
+}
+
+// identities
+
+func (m *Memory) CreateUserIdentity(ctx context.Context, arg database.CreateUserIdentityParams) error {
+	defer m.lock()()
+	if _, ok := m.data.users[arg.UserID]; !ok {
+		return fmt.Errorf("user %v doesn't exist", arg.UserID)
+	}
+	key := [2]string{arg.Provider, arg.Subject}
+	if _, ok := m.data.identities[key]; ok {
+		return fmt.Errorf("identity %v at %v: %w", arg.Subject, arg.Provider, ErrConflict)
+	}
+	m.data.identities[key] = database.UserIdentity{
+		Provider:  arg.Provider,
+		Subject:   arg.Subject,
+		CreatedAt: now(),
+		UserID:    arg.UserID,
+		Email:     arg.Email,
+	}
+	return nil
+}
+
+func (m *Memory) GetUserByIdentity(ctx context.Context, arg database.GetUserByIdentityParams) (database.User, error) {
+	defer m.lock()()
+	identity, ok := m.data.identities[[2]string{arg.Provider, arg.Subject}]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	user, ok := m.data.users[identity.UserID]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (m *Memory) CreateOIDCLogin(ctx context.Context, arg database.CreateOIDCLoginParams) error {
+	defer m.lock()()
+	if _, ok := m.data.oidcLogins[arg.StateHash]; ok {
+		return fmt.Errorf("oidc login: %w", ErrConflict)
+	}
+	m.data.oidcLogins[arg.StateHash] = database.OidcLogin{
+		StateHash:    arg.StateHash,
+		CreatedAt:    now(),
+		Nonce:        arg.Nonce,
+		CodeVerifier: arg.CodeVerifier,
+		ExpiresAt:    arg.ExpiresAt,
+		Restore:      arg.Restore,
+	}
+	return nil
+}
+
+// UseOIDCLogin func deletes the login and returns it, a login can only be completed once
+func (m *Memory) UseOIDCLogin(ctx context.Context, stateHash string) (database.OidcLogin, error) {
+	defer m.lock()()
+	login, ok := m.data.oidcLogins[stateHash]
+	if !ok || !login.ExpiresAt.After(now()) {
+		return database.OidcLogin{}, sql.ErrNoRows
+	}
+	delete(m.data.oidcLogins, stateHash)
+	return login, nil
+}
+
+// follows
+
+// FollowUser func returns 0 when the user already follows them
+func (m *Memory) FollowUser(ctx context.Context, arg database.FollowUserParams) (int64, error) {
+	defer m.lock()()
+	for _, id := range []uuid.UUID{arg.FollowerID, arg.FolloweeID} {
+		if _, ok := m.data.users[id]; !ok {
+			return 0, fmt.Errorf("user %v doesn't exist", id)
+		}
+	}
+	if arg.FollowerID == arg.FolloweeID {
+		return 0, fmt.Errorf("user %v can't follow themselves", arg.FollowerID)
+	}
+	key := [2]uuid.UUID{arg.FollowerID, arg.FolloweeID}
+	if _, ok := m.data.follows[key]; ok {
+		return 0, nil
+	}
+	m.data.follows[key] = database.Follow{FollowerID: arg.FollowerID, FolloweeID: arg.FolloweeID, CreatedAt: now()}
+	return 1, nil
+}
+
+func (m *Memory) UnfollowUser(ctx context.Context, arg database.UnfollowUserParams) (int64, error) {
+	defer m.lock()()
+	key := [2]uuid.UUID{arg.FollowerID, arg.FolloweeID}
+	if _, ok := m.data.follows[key]; !ok {
+		return 0, nil
+	}
+	delete(m.data.follows, key)
+	return 1, nil
+}
+
+// chirps
+
+func (m *Memory) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	defer m.lock()()
+	if _, ok := m.data.users[arg.UserID]; !ok {
+		return database.Chirp{}, fmt.Errorf("user %v doesn't exist", arg.UserID)
+	}
+	createdAt := now()
+	chirp := database.Chirp{
+		ID:        uuid.New(),
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+		Body:      arg.Body,
+		UserID:    arg.UserID,
+	}
+	m.data.chirps[chirp.ID] = chirp
+	return chirp, nil
+}
+
+// deleteChirp func deletes the chirp with its poll and its notifications
+func (d *memoryData) deleteChirp(id uuid.UUID) {
+	delete(d.chirps, id)
+	for notificationID, notification := range d.notifications {
+		if notification.ChirpID.Valid && notification.ChirpID.UUID == id {
+			delete(d.notifications, notificationID)
+		}
+	}
+	for _, poll := range d.polls {
+		if poll.ChirpID != id {
+			continue
+		}
+		delete(d.polls, poll.ID)
+		for _, option := range d.pollOptions {
+			if option.PollID == poll.ID {
+				delete(d.pollOptions, option.ID)
+			}
+		}
+		for key, vote := range d.pollVotes {
+			if vote.PollID == poll.ID {
+				delete(d.pollVotes, key)
+			}
+		}
+	}
+}
+
+func chirpKey(chirp database.Chirp) string { return chirp.ID.String() }
+
+func (m *Memory) GetAllChirps(ctx context.Context, userID uuid.NullUUID) ([]database.Chirp, error) {
+	defer m.lock()()
+	return sortedValues(m.data.chirps,
+		func(chirp database.Chirp) bool {
+			return !chirp.DeletedAt.Valid && (!userID.Valid || chirp.UserID == userID.UUID)
+		},
+		func(a, b database.Chirp) int { return a.CreatedAt.Compare(b.CreatedAt) },
+		chirpKey,
+	), nil
+}
+
+func (m *Memory) GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	defer m.lock()()
+	chirp, ok := m.data.chirps[id]
+	if !ok || chirp.DeletedAt.Valid {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return chirp, nil
+}
+
+func (m *Memory) SoftDeleteChirp(ctx context.Context, arg database.SoftDeleteChirpParams) (int64, error) {
+	defer m.lock()()
+	chirp, ok := m.data.chirps[arg.ID]
+	if !ok || chirp.DeletedAt.Valid {
+		return 0, nil
+	}
+	deletedAt := now()
+	chirp.DeletedAt = sql.NullTime{Time: deletedAt, Valid: true}
+	chirp.DeletedBy = uuid.NullUUID{UUID: arg.DeletedBy, Valid: true}
+	chirp.UpdatedAt = deletedAt
+	m.data.chirps[arg.ID] = chirp
+	return 1, nil
+}
+
+// isTrashedByAuthor func reports whether the chirp is in the trash of its author, the chirps removed by a moderator
+// aren't
+func isTrashedByAuthor(chirp database.Chirp) bool {
+	return chirp.DeletedAt.Valid && chirp.DeletedBy.Valid && chirp.DeletedBy.UUID == chirp.UserID
+}
+
+func (m *Memory) GetTrashedChirps(ctx context.Context, arg database.GetTrashedChirpsParams) ([]database.Chirp, error) {
+	defer m.lock()()
+	return sortedValues(m.data.chirps,
+		func(chirp database.Chirp) bool {
+			return chirp.UserID == arg.UserID && isTrashedByAuthor(chirp) && chirp.DeletedAt.Time.After(arg.Cutoff)
+		},
+		func(a, b database.Chirp) int { return b.DeletedAt.Time.Compare(a.DeletedAt.Time) },
+		chirpKey,
+	), nil
+}
+
+func (m *Memory) RestoreChirp(ctx context.Context, arg database.RestoreChirpParams) (database.Chirp, error) {
+	defer m.lock()()
+	chirp, ok := m.data.chirps[arg.ID]
+	if !ok || chirp.UserID != arg.UserID || !isTrashedByAuthor(chirp) || !chirp.DeletedAt.Time.After(arg.Cutoff) {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	chirp.DeletedAt = sql.NullTime{}
+	chirp.DeletedBy = uuid.NullUUID{}
+	chirp.UpdatedAt = now()
+	m.data.chirps[chirp.ID] = chirp
+	return chirp, nil
+}
+
+func (m *Memory) PurgeTrashedChirps(ctx context.Context, cutoff time.Time) (int64, error) {
+	defer m.lock()()
+	purged := int64(0)
+	for _, chirp := range m.data.chirps {
+		if chirp.DeletedAt.Valid && !chirp.DeletedAt.Time.After(cutoff) {
+			m.data.deleteChirp(chirp.ID)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (m *Memory) CreatePoll(ctx context.Context, arg database.CreatePollParams) (database.Poll, error) {
+	defer m.lock()()
+	if _, ok := m.data.chirps[arg.ChirpID]; !ok {
+		return database.Poll{}, fmt.Errorf("chirp %v doesn't exist", arg.ChirpID)
+	}
+	for _, poll := range m.data.polls {
+		if poll.ChirpID == arg.ChirpID {
+			return database.Poll{}, fmt.Errorf("poll of chirp %v: %w", arg.ChirpID, ErrConflict)
+		}
+	}
+	poll := database.Poll{
+		ID:        uuid.New(),
+		CreatedAt: now(),
+		ChirpID:   arg.ChirpID,
+		ClosesAt:  arg.ClosesAt,
+	}
+	m.data.polls[poll.ID] = poll
+	return poll, nil
+}
+
+func (m *Memory) CreatePollOption(ctx context.Context, arg database.CreatePollOptionParams) (database.PollOption, error) {
+	defer m.lock()()
+	if _, ok := m.data.polls[arg.PollID]; !ok {
+		return database.PollOption{}, fmt.Errorf("poll %v doesn't exist", arg.PollID)
+	}
+	for _, option := range m.data.pollOptions {
+		if option.PollID == arg.PollID && option.Position == arg.Position {
+			return database.PollOption{}, fmt.Errorf("option %d of poll %v: %w", arg.Position, arg.PollID, ErrConflict)
+		}
+	}
+	option := database.PollOption{
+		ID:       uuid.New(),
+		PollID:   arg.PollID,
+		Position: arg.Position,
+		Text:     arg.Text,
+	}
+	m.data.pollOptions[option.ID] = option
+	return option, nil
+}
+
+func (m *Memory) GetPollByChirpID(ctx context.Context, chirpID uuid.UUID) (database.Poll, error) {
+	defer m.lock()()
+	if chirp, ok := m.data.chirps[chirpID]; !ok || chirp.DeletedAt.Valid {
+		return database.Poll{}, sql.ErrNoRows
+	}
+	for _, poll := range m.data.polls {
+		if poll.ChirpID == chirpID {
+			return poll, nil
+		}
+	}
+	return database.Poll{}, sql.ErrNoRows
+}
+
+func (m *Memory) GetPollsByChirpIDs(ctx context.Context, chirpIds []uuid.UUID) ([]database.Poll, error) {
+	defer m.lock()()
+	polls := []database.Poll{}
+	for _, poll := range m.data.polls {
+		if slices.Contains(chirpIds, poll.ChirpID) {
+			polls = append(polls, poll)
+		}
+	}
+	return polls, nil
+}
+
+func (m *Memory) GetPollOption(ctx context.Context, arg database.GetPollOptionParams) (database.PollOption, error) {
+	defer m.lock()()
+	option, ok := m.data.pollOptions[arg.ID]
+	if !ok || option.PollID != arg.PollID {
+		return database.PollOption{}, sql.ErrNoRows
+	}
+	return option, nil
+}
+
+func (m *Memory) GetPollResults(ctx context.Context, pollIds []uuid.UUID) ([]database.GetPollResultsRow, error) {
+	defer m.lock()()
+	options := sortedValues(m.data.pollOptions,
+		func(option database.PollOption) bool { return slices.Contains(pollIds, option.PollID) },
+		func(a, b database.PollOption) int {
+			if c := bytes.Compare(a.PollID[:], b.PollID[:]); c != 0 {
+				return c
+			}
+			return int(a.Position - b.Position)
+		},
+		func(option database.PollOption) string { return option.ID.String() },
+	)
+	results := make([]database.GetPollResultsRow, 0, len(options))
+	for _, option := range options {
+		result := database.GetPollResultsRow{
+			ID:       option.ID,
+			PollID:   option.PollID,
+			Position: option.Position,
+			Text:     option.Text,
+		}
+		for _, vote := range m.data.pollVotes {
+			if vote.OptionID == option.ID {
+				result.Votes++
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (m *Memory) GetUserPollVotes(ctx context.Context, arg database.GetUserPollVotesParams) ([]database.PollVote, error) {
+	defer m.lock()()
+	votes := []database.PollVote{}
+	for _, pollID := range arg.PollIds {
+		if vote, ok := m.data.pollVotes[[2]uuid.UUID{pollID, arg.UserID}]; ok {
+			votes = append(votes, vote)
+		}
+	}
+	return votes, nil
+}
+
+func (m *Memory) CreatePollVote(ctx context.Context, arg database.CreatePollVoteParams) (int64, error) {
+	defer m.lock()()
+	if _, ok := m.data.users[arg.UserID]; !ok {
+		return 0, fmt.Errorf("user %v doesn't exist", arg.UserID)
+	}
+	if option, ok := m.data.pollOptions[arg.OptionID]; !ok || option.PollID != arg.PollID {
+		return 0, fmt.Errorf("option %v of poll %v doesn't exist", arg.OptionID, arg.PollID)
+	}
+	key := [2]uuid.UUID{arg.PollID, arg.UserID}
+	if _, ok := m.data.pollVotes[key]; ok {
+		return 0, nil
+	}
+	m.data.pollVotes[key] = database.PollVote{
+		PollID:    arg.PollID,
+		UserID:    arg.UserID,
+		OptionID:  arg.OptionID,
+		CreatedAt: now(),
+	}
+	return 1, nil
+}
+
+// GetClosedPollsToNotify func returns the polls closed at now whose voters weren't notified yet, the poll of a chirp
+// in the trash waits until the chirp is restored, or purged with it
+func (m *Memory) GetClosedPollsToNotify(ctx context.Context, arg database.GetClosedPollsToNotifyParams) ([]database.Poll, error) {
+	defer m.lock()()
+	polls := sortedValues(m.data.polls,
+		func(poll database.Poll) bool {
+			chirp, ok := m.data.chirps[poll.ChirpID]
+			return !poll.ClosesAt.After(arg.Now) && !poll.ClosedNotifiedAt.Valid && ok && !chirp.DeletedAt.Valid
+		},
+		func(a, b database.Poll) int { return a.ClosesAt.Compare(b.ClosesAt) },
+		func(poll database.Poll) string { return poll.ID.String() },
+	)
+	return page(polls, arg.MaxPolls, 0), nil
+}
+
+func (m *Memory) MarkPollNotified(ctx context.Context, id uuid.UUID) error {
+	defer m.lock()()
+	if poll, ok := m.data.polls[id]; ok {
+		poll.ClosedNotifiedAt = sql.NullTime{Time: now(), Valid: true}
+		m.data.polls[id] = poll
+	}
+	return nil
+}
+
+// drafts
+
+func (m *Memory) CreateChirpDraft(ctx context.Context, arg database.CreateChirpDraftParams) (database.ChirpDraft, error) {
+	defer m.lock()()
+	if _, ok := m.data.users[arg.UserID]; !ok {
+		return database.ChirpDraft{}, fmt.Errorf("user %v doesn't exist", arg.UserID)
+	}
+	createdAt := now()
+	draft := database.ChirpDraft{
+		ID:        uuid.New(),
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+		Body:      arg.Body,
+		UserID:    arg.UserID,
+		PublishAt: arg.PublishAt,
+	}
+	m.data.drafts[draft.ID] = draft
+	return draft, nil
+}
+
+func draftKey(draft database.ChirpDraft) string { return draft.ID.String() }
+
+func (m *Memory) GetChirpDrafts(ctx context.Context, userID uuid.UUID) ([]database.ChirpDraft, error) {
+	defer m.lock()()
+	return sortedValues(m.data.drafts,
+		func(draft database.ChirpDraft) bool { return draft.UserID == userID },
+		func(a, b database.ChirpDraft) int { return a.CreatedAt.Compare(b.CreatedAt) },
+		draftKey,
+	), nil
+}
+
+func (m *Memory) UpdateChirpDraft(ctx context.Context, arg database.UpdateChirpDraftParams) (database.ChirpDraft, error) {
+	defer m.lock()()
+	draft, ok := m.data.drafts[arg.ID]
+	if !ok || draft.UserID != arg.UserID {
+		return database.ChirpDraft{}, sql.ErrNoRows
+	}
+	draft.Body = arg.Body
+	draft.PublishAt = arg.PublishAt
+	draft.UpdatedAt = now()
+	m.data.drafts[draft.ID] = draft
+	return draft, nil
+}
+
+func (m *Memory) DeleteChirpDraft(ctx context.Context, arg database.DeleteChirpDraftParams) (int64, error) {
+	defer m.lock()()
+	draft, ok := m.data.drafts[arg.ID]
+	if !ok || draft.UserID != arg.UserID {
+		return 0, nil
+	}
+	delete(m.data.drafts, draft.ID)
+	return 1, nil
+}
+
+func (m *Memory) GetDueChirpDrafts(ctx context.Context, arg database.GetDueChirpDraftsParams) ([]database.ChirpDraft, error) {
+	defer m.lock()()
+	drafts := sortedValues(m.data.drafts,
+		func(draft database.ChirpDraft) bool {
+			return draft.PublishAt.Valid && !draft.PublishAt.Time.After(arg.Now)
+		},
+		func(a, b database.ChirpDraft) int { return a.PublishAt.Time.Compare(b.PublishAt.Time) },
+		draftKey,
+	)
+	return drafts[:min(len(drafts), int(arg.MaxDrafts))], nil
+}
+
+func (m *Memory) DeletePublishedChirpDraft(ctx context.Context, id uuid.UUID) error {
+	defer m.lock()()
+	delete(m.data.drafts, id)
+	return nil
+}
+
+func (m *Memory) UnscheduleChirpDraft(ctx context.Context, id uuid.UUID) error {
+	defer m.lock()()
+	if draft, ok := m.data.drafts[id]; ok {
+		draft.PublishAt = sql.NullTime{}
+		draft.UpdatedAt = now()
+		m.data.drafts[id] = draft
+	}
+	return nil
+}
+
+// collections
+
+// collectionNameTaken func reports whether the user has another collection with the name
+func (d *memoryData) collectionNameTaken(userID, id uuid.UUID, name string) bool {
+	for _, collection := range d.collections {
+		if collection.UserID == userID && collection.ID != id && collection.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteCollection func deletes the collection with its bookmarks
+func (d *memoryData) deleteCollection(id uuid.UUID) {
+	delete(d.collections, id)
+	for key := range d.bookmarks {
+		if key[0] == id {
+			delete(d.bookmarks, key)
+		}
+	}
+}
+
+func (m *Memory) CreateCollection(ctx context.Context, arg database.CreateCollectionParams) (database.Collection, error) {
+	defer m.lock()()
+	if _, ok := m.data.users[arg.UserID]; !ok {
+		return database.Collection{}, fmt.Errorf("user %v doesn't exist", arg.UserID)
+	}
+	if m.data.collectionNameTaken(arg.UserID, uuid.Nil, arg.Name) {
+		return database.Collection{}, fmt.Errorf("collection %v: %w", arg.Name, ErrConflict)
+	}
+	createdAt := now()
+	collection := database.Collection{
+		ID:        uuid.New(),
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+		UserID:    arg.UserID,
+		Name:      arg.Name,
+	}
+	m.data.collections[collection.ID] = collection
+	return collection, nil
+}
+
+func (m *Memory) GetCollections(ctx context.Context, userID uuid.UUID) ([]database.Collection, error) {
+	defer m.lock()()
+	return sortedValues(m.data.collections,
+		func(collection database.Collection) bool { return collection.UserID == userID },
+		func(a, b database.Collection) int { return strings.Compare(a.Name, b.Name) },
+		func(collection database.Collection) string { return collection.ID.String() },
+	), nil
+}
+
+func (m *Memory) GetCollection(ctx context.Context, arg database.GetCollectionParams) (database.Collection, error) {
+	defer m.lock()()
+	collection, ok := m.data.collections[arg.ID]
+	if !ok || collection.UserID != arg.UserID {
+		return database.Collection{}, sql.ErrNoRows
+	}
+	return collection, nil
+}
+
+func (m *Memory) RenameCollection(ctx context.Context, arg database.RenameCollectionParams) (database.Collection, error) {
+	defer m.lock()()
+	collection, ok := m.data.collections[arg.ID]
+	if !ok || collection.UserID != arg.UserID {
+		return database.Collection{}, sql.ErrNoRows
+	}
+	if m.data.collectionNameTaken(arg.UserID, arg.ID, arg.Name) {
+		return database.Collection{}, fmt.Errorf("collection %v: %w", arg.Name, ErrConflict)
+	}
+	collection.Name = arg.Name
+	collection.UpdatedAt = now()
+	m.data.collections[collection.ID] = collection
+	return collection, nil
+}
+
+func (m *Memory) DeleteCollection(ctx context.Context, arg database.DeleteCollectionParams) (int64, error) {
+	defer m.lock()()
+	collection, ok := m.data.collections[arg.ID]
+	if !ok || collection.UserID != arg.UserID {
+		return 0, nil
+	}
+	m.data.deleteCollection(collection.ID)
+	return 1, nil
+}
+
+func (m *Memory) AddBookmark(ctx context.Context, arg database.AddBookmarkParams) error {
+	defer m.lock()()
+	if _, ok := m.data.collections[arg.CollectionID]; !ok {
+		return fmt.Errorf("collection %v doesn't exist", arg.CollectionID)
+	}
+	key := [2]uuid.UUID{arg.CollectionID, arg.ChirpID}
+	if _, ok := m.data.bookmarks[key]; !ok {
+		m.data.bookmarks[key] = database.Bookmark{CollectionID: arg.CollectionID, ChirpID: arg.ChirpID, CreatedAt: now()}
+	}
+	return nil
+}
+
+func (m *Memory) RemoveBookmark(ctx context.Context, arg database.RemoveBookmarkParams) (int64, error) {
+	defer m.lock()()
+	key := [2]uuid.UUID{arg.CollectionID, arg.ChirpID}
+	if _, ok := m.data.bookmarks[key]; !ok {
+		return 0, nil
+	}
+	delete(m.data.bookmarks, key)
+	return 1, nil
+}
+
+// GetBookmarks func returns the bookmarks of deleted chirps too, they're unavailable
+func (m *Memory) GetBookmarks(ctx context.Context, arg database.GetBookmarksParams) ([]database.GetBookmarksRow, error) {
+	defer m.lock()()
+	bookmarks := sortedValues(m.data.bookmarks,
+		func(bookmark database.Bookmark) bool { return bookmark.CollectionID == arg.CollectionID },
+		func(a, b database.Bookmark) int { return b.CreatedAt.Compare(a.CreatedAt) },
+		func(bookmark database.Bookmark) string { return bookmark.ChirpID.String() },
+	)
+	bookmarks = bookmarks[min(len(bookmarks), int(arg.Offset)):]
+	bookmarks = bookmarks[:min(len(bookmarks), int(arg.Limit))]
+
+	rows := make([]database.GetBookmarksRow, 0, len(bookmarks))
+	for _, bookmark := range bookmarks {
+		row := database.GetBookmarksRow{ChirpID: bookmark.ChirpID, BookmarkedAt: bookmark.CreatedAt}
+		if chirp, ok := m.data.chirps[bookmark.ChirpID]; ok {
+			row.Available = !chirp.DeletedAt.Valid
+			row.ChirpCreatedAt = sql.NullTime{Time: chirp.CreatedAt, Valid: true}
+			row.ChirpUpdatedAt = sql.NullTime{Time: chirp.UpdatedAt, Valid: true}
+			row.Body = sql.NullString{String: chirp.Body, Valid: true}
+			row.UserID = uuid.NullUUID{UUID: chirp.UserID, Valid: true}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// notifications
+
+func (m *Memory) NotifyPollVoters(ctx context.Context, pollID uuid.UUID) (int64, error) {
+	defer m.lock()()
+	poll, ok := m.data.polls[pollID]
+	if !ok {
+		return 0, nil
+	}
+	createdAt := now()
+	notified := int64(0)
+	for _, vote := range m.data.pollVotes {
+		if vote.PollID != pollID {
+			continue
+		}
+		notification := database.Notification{
+			ID:        uuid.New(),
+			CreatedAt: createdAt,
+			UserID:    vote.UserID,
+			Kind:      "poll_closed",
+			ChirpID:   uuid.NullUUID{UUID: poll.ChirpID, Valid: true},
+		}
+		m.data.notifications[notification.ID] = notification
+		notified++
+	}
+	return notified, nil
+}
+
+func (m *Memory) GetNotifications(ctx context.Context, arg database.GetNotificationsParams) ([]database.Notification, error) {
+	defer m.lock()()
+	notifications := sortedValues(m.data.notifications,
+		func(notification database.Notification) bool { return notification.UserID == arg.UserID },
+		func(a, b database.Notification) int { return b.CreatedAt.Compare(a.CreatedAt) },
+		func(notification database.Notification) string { return notification.ID.String() },
+	)
+	return notifications[:min(len(notifications), int(arg.Limit))], nil
+}
+
+func (m *Memory) MarkNotificationsRead(ctx context.Context, userID uuid.UUID) error {
+	defer m.lock()()
+	for id, notification := range m.data.notifications {
+		if notification.UserID == userID && !notification.ReadAt.Valid {
+			notification.ReadAt = sql.NullTime{Time: now(), Valid: true}
+			m.data.notifications[id] = notification
+		}
+	}
+	return nil
+}
+
+// oauth clients
+
+// deleteOAuthClient func deletes the client with its codes and refresh tokens, like the ON DELETE CASCADE foreign keys
+func (d *memoryData) deleteOAuthClient(id string) {
+	delete(d.oauthClients, id)
+	for codeHash, code := range d.oauthCodes {
+		if code.ClientID == id {
+			delete(d.oauthCodes, codeHash)
+		}
+	}
+	for token, refreshToken := range d.refreshTokens {
+		if refreshToken.ClientID.Valid && refreshToken.ClientID.String == id {
+			delete(d.refreshTokens, token)
+		}
+	}
+	for endpointID, endpoint := range d.endpoints {
+		if endpoint.ClientID.Valid && endpoint.ClientID.String == id {
+			d.deleteWebhookEndpoint(endpointID)
+		}
+	}
+}
+
+func (m *Memory) CreateOAuthClient(ctx context.Context, arg database.CreateOAuthClientParams) (database.OauthClient, error) {
+	defer m.lock()()
+	if _, ok := m.data.users[arg.UserID]; !ok {
+		return database.OauthClient{}, fmt.Errorf("user %v doesn't exist", arg.UserID)
+	}
+	if _, ok := m.data.oauthClients[arg.ID]; ok {
+		return database.OauthClient{}, fmt.Errorf("oauth client %v: %w", arg.ID, ErrConflict)
+	}
+	createdAt := now()
+	client := database.OauthClient{
+		ID:           arg.ID,
+		CreatedAt:    createdAt,
+		UpdatedAt:    createdAt,
+		UserID:       arg.UserID,
+		Name:         arg.Name,
+		RedirectUris: slices.Clone(arg.RedirectUris),
+		SecretHash:   arg.SecretHash,
+	}
+	m.data.oauthClients[client.ID] = client
+	return client, nil
+}
+
+func (m *Memory) GetOAuthClient(ctx context.Context, id string) (database.OauthClient, error) {
+	defer m.lock()()
+	client, ok := m.data.oauthClients[id]
+	if !ok {
+		return database.OauthClient{}, sql.ErrNoRows
+	}
+	return client, nil
+}
+
+func (m *Memory) GetOAuthClientsByUser(ctx context.Context, userID uuid.UUID) ([]database.OauthClient, error) {
+	defer m.lock()()
+	return sortedValues(m.data.oauthClients,
+		func(client database.OauthClient) bool { return client.UserID == userID },
+		func(a, b database.OauthClient) int { return a.CreatedAt.Compare(b.CreatedAt) },
+		func(client database.OauthClient) string { return client.ID },
+	), nil
+}
+
+func (m *Memory) GetOAuthClientGrants(ctx context.Context, clientID sql.NullString) ([]uuid.UUID, error) {
+	defer m.lock()()
+	grantIDs := []uuid.UUID{}
+	for _, token := range m.data.refreshTokens {
+		if clientID.Valid && token.ClientID == clientID && token.GrantID.Valid && !slices.Contains(grantIDs, token.GrantID.UUID) {
+			grantIDs = append(grantIDs, token.GrantID.UUID)
+		}
+	}
+	return grantIDs, nil
+}
+
+func (m *Memory) DeleteOAuthClient(ctx context.Context, arg database.DeleteOAuthClientParams) (int64, error) {
+	defer m.lock()()
+	client, ok := m.data.oauthClients[arg.ID]
+	if !ok || client.UserID != arg.UserID {
+		return 0, nil
+	}
+	m.data.deleteOAuthClient(client.ID)
+	return 1, nil
+}
+
+func (m *Memory) CreateOAuthCode(ctx context.Context, arg database.CreateOAuthCodeParams) error {
+	defer m.lock()()
+	if _, ok := m.data.oauthClients[arg.ClientID]; !ok {
+		return fmt.Errorf("oauth client %v doesn't exist", arg.ClientID)
+	}
+	if _, ok := m.data.users[arg.UserID]; !ok {
+		return fmt.Errorf("user %v doesn't exist", arg.UserID)
+	}
+	if _, ok := m.data.oauthCodes[arg.CodeHash]; ok {
+		return fmt.Errorf("oauth code: %w", ErrConflict)
+	}
+	m.data.oauthCodes[arg.CodeHash] = database.OauthCode{
+		CodeHash:      arg.CodeHash,
+		CreatedAt:     now(),
+		ClientID:      arg.ClientID,
+		UserID:        arg.UserID,
+		RedirectUri:   arg.RedirectUri,
+		Scopes:        slices.Clone(arg.Scopes),
+		CodeChallenge: arg.CodeChallenge,
+		ExpiresAt:     arg.ExpiresAt,
+	}
+	return nil
+}
+
+// UseOAuthCode func marks the code as used, a code can only be exchanged once
+func (m *Memory) UseOAuthCode(ctx context.Context, codeHash string) (database.OauthCode, error) {
+	defer m.lock()()
+	code, ok := m.data.oauthCodes[codeHash]
+	usedAt := now()
+	if !ok || code.UsedAt.Valid || !code.ExpiresAt.After(usedAt) {
+		return database.OauthCode{}, sql.ErrNoRows
+	}
+	code.UsedAt = sql.NullTime{Time: usedAt, Valid: true}
+	m.data.oauthCodes[codeHash] = code
+	return code, nil
+}
+
+// refresh tokens
+
+func (m *Memory) createRefreshToken(token database.RefreshToken) (database.RefreshToken, error) {
+	if _, ok := m.data.users[token.UserID]; !ok {
+		return database.RefreshToken{}, fmt.Errorf("user %v doesn't exist", token.UserID)
+	}
+	if _, ok := m.data.oauthClients[token.ClientID.String]; token.ClientID.Valid && !ok {
+		return database.RefreshToken{}, fmt.Errorf("oauth client %v doesn't exist", token.ClientID.String)
+	}
+	if _, ok := m.data.refreshTokens[token.Token]; ok {
+		return database.RefreshToken{}, fmt.Errorf("refresh token: %w", ErrConflict)
+	}
+	createdAt := now()
+	token.ID = uuid.New()
+	token.CreatedAt = createdAt
+	token.UpdatedAt = createdAt
+	m.data.refreshTokens[token.Token] = token
+	return token, nil
+}
+
+func (m *Memory) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error) {
+	defer m.lock()()
+	return m.createRefreshToken(database.RefreshToken{
+		Token:     arg.Token,
+		UserID:    arg.UserID,
+		ExpiresAt: arg.ExpiresAt,
+		UserAgent: arg.UserAgent,
+		Ip:        arg.Ip,
+	})
+}
+
+func (m *Memory) CreateOAuthRefreshToken(ctx context.Context, arg database.CreateOAuthRefreshTokenParams) (database.RefreshToken, error) {
+	defer m.lock()()
+	return m.createRefreshToken(database.RefreshToken{
+		Token:     arg.Token,
+		UserID:    arg.UserID,
+		ExpiresAt: arg.ExpiresAt,
+		ClientID:  arg.ClientID,
+		Scopes:    slices.Clone(arg.Scopes),
+		GrantID:   arg.GrantID,
+	})
+}
+
+func (m *Memory) GetRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	defer m.lock()()
+	refreshToken, ok := m.data.refreshTokens[token]
+	if !ok {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	return refreshToken, nil
+}
+
+// isSession func reports whether the refresh token is a first-party session that can still be used
+func isSession(token database.RefreshToken) bool {
+	return !token.ClientID.Valid && !token.RevokedAt.Valid && token.ExpiresAt.After(now())
+}
+
+func (m *Memory) UseRefreshToken(ctx context.Context, arg database.UseRefreshTokenParams) (database.RefreshToken, error) {
+	defer m.lock()()
+	token, ok := m.data.refreshTokens[arg.Token]
+	if !ok || !isSession(token) {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	token.LastUsedAt = sql.NullTime{Time: now(), Valid: true}
+	token.Ip = arg.Ip
+	m.data.refreshTokens[token.Token] = token
+	return token, nil
+}
+
+// revoke func revokes the refresh token, it must exist
+func (d *memoryData) revoke(token string) {
+	refreshToken := d.refreshTokens[token]
+	revokedAt := now()
+	refreshToken.RevokedAt = sql.NullTime{Time: revokedAt, Valid: true}
+	refreshToken.UpdatedAt = revokedAt
+	d.refreshTokens[token] = refreshToken
+}
+
+func (m *Memory) SetRevokedAtToken(ctx context.Context, token string) error {
+	defer m.lock()()
+	if _, ok := m.data.refreshTokens[token]; ok {
+		m.data.revoke(token)
+	}
+	return nil
+}
+
+func (m *Memory) RevokeOAuthRefreshToken(ctx context.Context, arg database.RevokeOAuthRefreshTokenParams) (int64, error) {
+	defer m.lock()()
+	token, ok := m.data.refreshTokens[arg.Token]
+	if !ok || token.ClientID.String != arg.ClientID || !token.ClientID.Valid || token.RevokedAt.Valid {
+		return 0, nil
+	}
+	m.data.revoke(token.Token)
+	return 1, nil
+}
+
+// UseOAuthRefreshToken func revokes the refresh token of the client, it can only be used once
+func (m *Memory) UseOAuthRefreshToken(ctx context.Context, arg database.UseOAuthRefreshTokenParams) (database.RefreshToken, error) {
+	defer m.lock()()
+	token, ok := m.data.refreshTokens[arg.Token]
+	if !ok || !token.ClientID.Valid || token.ClientID.String != arg.ClientID || token.RevokedAt.Valid || !token.ExpiresAt.After(now()) {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	m.data.revoke(token.Token)
+	return m.data.refreshTokens[token.Token], nil
+}
+
+func (m *Memory) RevokeOAuthGrant(ctx context.Context, grantID uuid.UUID) error {
+	defer m.lock()()
+	for _, token := range m.data.refreshTokens {
+		if token.GrantID.Valid && token.GrantID.UUID == grantID && !token.RevokedAt.Valid {
+			m.data.revoke(token.Token)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) GetSessions(ctx context.Context, userID uuid.UUID) ([]database.RefreshToken, error) {
+	defer m.lock()()
+	lastUsed := func(token database.RefreshToken) time.Time {
+		if token.LastUsedAt.Valid {
+			return token.LastUsedAt.Time
+		}
+		return token.CreatedAt
+	}
+	return sortedValues(m.data.refreshTokens,
+		func(token database.RefreshToken) bool { return token.UserID == userID && isSession(token) },
+		func(a, b database.RefreshToken) int { return lastUsed(b).Compare(lastUsed(a)) },
+		func(token database.RefreshToken) string { return token.ID.String() },
+	), nil
+}
+
+func (m *Memory) RevokeSession(ctx context.Context, arg database.RevokeSessionParams) (int64, error) {
+	defer m.lock()()
+	for _, token := range m.data.refreshTokens {
+		if token.ID == arg.ID && token.UserID == arg.UserID && !token.ClientID.Valid && !token.RevokedAt.Valid {
+			m.data.revoke(token.Token)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (m *Memory) RevokeOtherSessions(ctx context.Context, arg database.RevokeOtherSessionsParams) ([]uuid.UUID, error) {
+	defer m.lock()()
+	revoked := []uuid.UUID{}
+	for _, token := range m.data.refreshTokens {
+		if token.UserID == arg.UserID && token.ID != arg.CurrentID && !token.ClientID.Valid && !token.RevokedAt.Valid {
+			m.data.revoke(token.Token)
+			revoked = append(revoked, token.ID)
+		}
+	}
+	return revoked, nil
+}
+
+func (m *Memory) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) error {
+	defer m.lock()()
+	for _, token := range m.data.refreshTokens {
+		if token.UserID == userID && !token.RevokedAt.Valid {
+			m.data.revoke(token.Token)
+		}
+	}
+	return nil
+}
+
+// personal access tokens
+
+func (m *Memory) CreateAPIToken(ctx context.Context, arg database.CreateAPITokenParams) (database.ApiToken, error) {
+	defer m.lock()()
+	if _, ok := m.data.users[arg.UserID]; !ok {
+		return database.ApiToken{}, fmt.Errorf("user %v doesn't exist", arg.UserID)
+	}
+	for _, apiToken := range m.data.apiTokens {
+		if apiToken.TokenHash == arg.TokenHash {
+			return database.ApiToken{}, fmt.Errorf("api token: %w", ErrConflict)
+		}
+	}
+	apiToken := database.ApiToken{
+		ID:        uuid.New(),
+		CreatedAt: now(),
+		UserID:    arg.UserID,
+		Name:      arg.Name,
+		TokenHash: arg.TokenHash,
+		Scopes:    slices.Clone(arg.Scopes),
+		ExpiresAt: arg.ExpiresAt,
+	}
+	m.data.apiTokens[apiToken.ID] = apiToken
+	return apiToken, nil
+}
+
+func (m *Memory) GetAPITokens(ctx context.Context, userID uuid.UUID) ([]database.ApiToken, error) {
+	defer m.lock()()
+	return sortedValues(m.data.apiTokens,
+		func(apiToken database.ApiToken) bool { return apiToken.UserID == userID && !apiToken.RevokedAt.Valid },
+		func(a, b database.ApiToken) int { return a.CreatedAt.Compare(b.CreatedAt) },
+		func(apiToken database.ApiToken) string { return apiToken.ID.String() },
+	), nil
+}
+
+func (m *Memory) GetValidAPIToken(ctx context.Context, tokenHash string) (database.ApiToken, error) {
+	defer m.lock()()
+	for _, apiToken := range m.data.apiTokens {
+		if apiToken.TokenHash == tokenHash && !apiToken.RevokedAt.Valid &&
+			(!apiToken.ExpiresAt.Valid || apiToken.ExpiresAt.Time.After(now())) {
+			return apiToken, nil
+		}
+	}
+	return database.ApiToken{}, sql.ErrNoRows
+}
+
+// TouchAPIToken func only writes last_used_at once a minute at most, like the postgres query
+func (m *Memory) TouchAPIToken(ctx context.Context, id uuid.UUID) error {
+	defer m.lock()()
+	apiToken, ok := m.data.apiTokens[id]
+	if !ok {
+		return nil
+	}
+	usedAt := now()
+	if !apiToken.LastUsedAt.Valid || apiToken.LastUsedAt.Time.Before(usedAt.Add(-time.Minute)) {
+		apiToken.LastUsedAt = sql.NullTime{Time: usedAt, Valid: true}
+		m.data.apiTokens[id] = apiToken
+	}
+	return nil
+}
+
+func (m *Memory) RevokeAPIToken(ctx context.Context, arg database.RevokeAPITokenParams) (int64, error) {
+	defer m.lock()()
+	apiToken, ok := m.data.apiTokens[arg.ID]
+	if !ok || apiToken.UserID != arg.UserID || apiToken.RevokedAt.Valid {
+		return 0, nil
+	}
+	apiToken.RevokedAt = sql.NullTime{Time: now(), Valid: true}
+	m.data.apiTokens[apiToken.ID] = apiToken
+	return 1, nil
+}
+
+func (m *Memory) RevokeUserAPITokens(ctx context.Context, userID uuid.UUID) error {
+	defer m.lock()()
+	for id, apiToken := range m.data.apiTokens {
+		if apiToken.UserID == userID && !apiToken.RevokedAt.Valid {
+			apiToken.RevokedAt = sql.NullTime{Time: now(), Valid: true}
+			m.data.apiTokens[id] = apiToken
+		}
+	}
+	return nil
+}
+
+// revoked access tokens
+
+func (m *Memory) RevokeToken(ctx context.Context, arg database.RevokeTokenParams) error {
+	defer m.lock()()
+	if _, ok := m.data.revokedTokens[arg.ID]; !ok {
+		m.data.revokedTokens[arg.ID] = database.RevokedToken{ID: arg.ID, CreatedAt: now(), ExpiresAt: arg.ExpiresAt}
+	}
+	return nil
+}
+
+func (m *Memory) GetRevokedTokens(ctx context.Context) ([]database.RevokedToken, error) {
+	defer m.lock()()
+	revokedTokens := []database.RevokedToken{}
+	for _, revokedToken := range m.data.revokedTokens {
+		if revokedToken.ExpiresAt.After(now()) {
+			revokedTokens = append(revokedTokens, revokedToken)
+		}
+	}
+	return revokedTokens, nil
+}
+
+func (m *Memory) PurgeRevokedTokens(ctx context.Context) error {
+	defer m.lock()()
+	for id, revokedToken := range m.data.revokedTokens {
+		if !revokedToken.ExpiresAt.After(now()) {
+			delete(m.data.revokedTokens, id)
+		}
+	}
+	return nil
+}
+
+// webhooks
+
+// deleteWebhookEndpoint func deletes the endpoint with its deliveries, like the ON DELETE CASCADE foreign key
+func (d *memoryData) deleteWebhookEndpoint(id uuid.UUID) {
+	delete(d.endpoints, id)
+	for deliveryID, delivery := range d.deliveries {
+		if delivery.EndpointID == id {
+			delete(d.deliveries, deliveryID)
+		}
+	}
+}
+
+// CreateWebhookDeliveries func queues the event for every enabled endpoint of the user that subscribed to it
+func (m *Memory) CreateWebhookDeliveries(ctx context.Context, arg database.CreateWebhookDeliveriesParams) (int64, error) {
+	defer m.lock()()
+	queued := int64(0)
+	for _, endpoint := range m.data.endpoints {
+		if endpoint.UserID != arg.UserID || endpoint.DisabledAt.Valid || !slices.Contains(endpoint.Events, arg.Event) {
+			continue
+		}
+		createdAt := now()
+		delivery := database.WebhookDelivery{
+			ID:            uuid.New(),
+			CreatedAt:     createdAt,
+			EndpointID:    endpoint.ID,
+			Event:         arg.Event,
+			Payload:       arg.Payload,
+			Status:        "pending",
+			NextAttemptAt: createdAt,
+		}
+		m.data.deliveries[delivery.ID] = delivery
+		queued++
+	}
+	return queued, nil
+}
+
+// webhookEndpointMatches func reports whether the endpoint is the user's, and the app's when clientID is set: an app
+// only sees the endpoints it registered
+func webhookEndpointMatches(endpoint database.WebhookEndpoint, userID uuid.UUID, clientID sql.NullString) bool {
+	return endpoint.UserID == userID && (!clientID.Valid || endpoint.ClientID == clientID)
+}
+
+func (m *Memory) CreateWebhookEndpoint(ctx context.Context, arg database.CreateWebhookEndpointParams) (database.WebhookEndpoint, error) {
+	defer m.lock()()
+	if _, ok := m.data.users[arg.UserID]; !ok {
+		return database.WebhookEndpoint{}, fmt.Errorf("user %v doesn't exist", arg.UserID)
+	}
+	if _, ok := m.data.oauthClients[arg.ClientID.String]; arg.ClientID.Valid && !ok {
+		return database.WebhookEndpoint{}, fmt.Errorf("oauth client %v doesn't exist", arg.ClientID.String)
+	}
+	createdAt := now()
+	endpoint := database.WebhookEndpoint{
+		ID:        uuid.New(),
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+		UserID:    arg.UserID,
+		ClientID:  arg.ClientID,
+		Url:       arg.Url,
+		Secret:    arg.Secret,
+		Events:    slices.Clone(arg.Events),
+	}
+	m.data.endpoints[endpoint.ID] = endpoint
+	return endpoint, nil
+}
+
+func webhookEndpointKey(endpoint database.WebhookEndpoint) string { return endpoint.ID.String() }
+
+func (m *Memory) GetWebhookEndpoints(ctx context.Context, arg database.GetWebhookEndpointsParams) ([]database.WebhookEndpoint, error) {
+	defer m.lock()()
+	return sortedValues(m.data.endpoints,
+		func(endpoint database.WebhookEndpoint) bool {
+			return webhookEndpointMatches(endpoint, arg.UserID, arg.ClientID)
+		},
+		func(a, b database.WebhookEndpoint) int { return a.CreatedAt.Compare(b.CreatedAt) },
+		webhookEndpointKey,
+	), nil
+}
+
+func (m *Memory) GetWebhookEndpoint(ctx context.Context, arg database.GetWebhookEndpointParams) (database.WebhookEndpoint, error) {
+	defer m.lock()()
+	endpoint, ok := m.data.endpoints[arg.ID]
+	if !ok || !webhookEndpointMatches(endpoint, arg.UserID, arg.ClientID) {
+		return database.WebhookEndpoint{}, sql.ErrNoRows
+	}
+	return endpoint, nil
+}
+
+func (m *Memory) UpdateWebhookEndpoint(ctx context.Context, arg database.UpdateWebhookEndpointParams) (database.WebhookEndpoint, error) {
+	defer m.lock()()
+	endpoint, ok := m.data.endpoints[arg.ID]
+	if !ok {
+		return database.WebhookEndpoint{}, sql.ErrNoRows
+	}
+	endpoint.Url = arg.Url
+	endpoint.Events = slices.Clone(arg.Events)
+	endpoint.FailureCount = arg.FailureCount
+	endpoint.DisabledAt = arg.DisabledAt
+	endpoint.UpdatedAt = now()
+	m.data.endpoints[endpoint.ID] = endpoint
+	return endpoint, nil
+}
+
+func (m *Memory) DeleteWebhookEndpoint(ctx context.Context, arg database.DeleteWebhookEndpointParams) (int64, error) {
+	defer m.lock()()
+	endpoint, ok := m.data.endpoints[arg.ID]
+	if !ok || !webhookEndpointMatches(endpoint, arg.UserID, arg.ClientID) {
+		return 0, nil
+	}
+	m.data.deleteWebhookEndpoint(endpoint.ID)
+	return 1, nil
+}
+
+func (m *Memory) RecordWebhookEndpointSuccess(ctx context.Context, id uuid.UUID) error {
+	defer m.lock()()
+	if endpoint, ok := m.data.endpoints[id]; ok {
+		endpoint.FailureCount = 0
+		m.data.endpoints[id] = endpoint
+	}
+	return nil
+}
+
+// RecordWebhookEndpointFailure func disables the endpoint when it reaches max_failures, the pending deliveries wait
+// until it's enabled again
+func (m *Memory) RecordWebhookEndpointFailure(ctx context.Context, arg database.RecordWebhookEndpointFailureParams) (database.WebhookEndpoint, error) {
+	defer m.lock()()
+	endpoint, ok := m.data.endpoints[arg.ID]
+	if !ok {
+		return database.WebhookEndpoint{}, sql.ErrNoRows
+	}
+	endpoint.FailureCount++
+	if endpoint.FailureCount >= arg.MaxFailures && !endpoint.DisabledAt.Valid {
+		endpoint.DisabledAt = sql.NullTime{Time: now(), Valid: true}
+	}
+	m.data.endpoints[endpoint.ID] = endpoint
+	return endpoint, nil
+}
+
+// ClaimWebhookDeliveries func leases the due deliveries until lease_until, so they aren't sent twice while they're
+// in flight
+func (m *Memory) ClaimWebhookDeliveries(ctx context.Context, arg database.ClaimWebhookDeliveriesParams) ([]database.ClaimWebhookDeliveriesRow, error) {
+	defer m.lock()()
+	due := sortedValues(m.data.deliveries,
+		func(delivery database.WebhookDelivery) bool {
+			endpoint := m.data.endpoints[delivery.EndpointID]
+			return delivery.Status == "pending" && !delivery.NextAttemptAt.After(now()) && !endpoint.DisabledAt.Valid
+		},
+		func(a, b database.WebhookDelivery) int { return a.NextAttemptAt.Compare(b.NextAttemptAt) },
+		func(delivery database.WebhookDelivery) string { return delivery.ID.String() },
+	)
+	rows := []database.ClaimWebhookDeliveriesRow{}
+	for _, delivery := range page(due, arg.Limit, 0) {
+		delivery.NextAttemptAt = arg.LeaseUntil
+		m.data.deliveries[delivery.ID] = delivery
+		endpoint := m.data.endpoints[delivery.EndpointID]
+		rows = append(rows, database.ClaimWebhookDeliveriesRow{
+			ID:         delivery.ID,
+			EndpointID: delivery.EndpointID,
+			Event:      delivery.Event,
+			Payload:    delivery.Payload,
+			Attempts:   delivery.Attempts,
+			Url:        endpoint.Url,
+			Secret:     endpoint.Secret,
+		})
+	}
+	return rows, nil
+}
+
+func (m *Memory) CompleteWebhookDelivery(ctx context.Context, arg database.CompleteWebhookDeliveryParams) error {
+	defer m.lock()()
+	delivery, ok := m.data.deliveries[arg.ID]
+	if !ok {
+		return nil
+	}
+	deliveredAt := now()
+	delivery.Status = "delivered"
+	delivery.Attempts++
+	delivery.LastAttemptAt = sql.NullTime{Time: deliveredAt, Valid: true}
+	delivery.ResponseStatus = arg.ResponseStatus
+	delivery.LastError = ""
+	delivery.DeliveredAt = sql.NullTime{Time: deliveredAt, Valid: true}
+	m.data.deliveries[delivery.ID] = delivery
+	return nil
+}
+
+func (m *Memory) FailWebhookDelivery(ctx context.Context, arg database.FailWebhookDeliveryParams) error {
+	defer m.lock()()
+	delivery, ok := m.data.deliveries[arg.ID]
+	if !ok {
+		return nil
+	}
+	delivery.Status = arg.Status
+	delivery.Attempts++
+	delivery.NextAttemptAt = arg.NextAttemptAt
+	delivery.LastAttemptAt = sql.NullTime{Time: now(), Valid: true}
+	delivery.ResponseStatus = arg.ResponseStatus
+	delivery.LastError = arg.LastError
+	m.data.deliveries[delivery.ID] = delivery
+	return nil
+}
+
+func (m *Memory) GetWebhookDeliveries(ctx context.Context, arg database.GetWebhookDeliveriesParams) ([]database.WebhookDelivery, error) {
+	defer m.lock()()
+	deliveries := sortedValues(m.data.deliveries,
+		func(delivery database.WebhookDelivery) bool { return delivery.EndpointID == arg.EndpointID },
+		func(a, b database.WebhookDelivery) int { return b.CreatedAt.Compare(a.CreatedAt) },
+		func(delivery database.WebhookDelivery) string { return delivery.ID.String() },
+	)
+	return page(deliveries, arg.Limit, arg.Offset), nil
+}
+
+func (m *Memory) PurgeWebhookDeliveries(ctx context.Context, createdAt time.Time) (int64, error) {
+	defer m.lock()()
+	purged := int64(0)
+	for id, delivery := range m.data.deliveries {
+		if delivery.Status != "pending" && delivery.CreatedAt.Before(createdAt) {
+			delete(m.data.deliveries, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// polka events
+
+func (m *Memory) CreateWebhookEvent(ctx context.Context, arg database.CreateWebhookEventParams) (int64, error) {
+	defer m.lock()()
+	if _, ok := m.data.webhookEvents[arg.ID]; ok {
+		return 0, nil
+	}
+	createdAt := now()
+	m.data.webhookEvents[arg.ID] = database.WebhookEvent{
+		ID:            arg.ID,
+		CreatedAt:     createdAt,
+		Event:         arg.Event,
+		UserID:        arg.UserID,
+		Payload:       arg.Payload,
+		SentAt:        arg.SentAt,
+		Status:        "pending",
+		NextAttemptAt: createdAt,
+	}
+	return 1, nil
+}
+
+// webhookEventBefore func reports whether a happened before b, by sent_at then created_at
+func webhookEventBefore(a, b database.WebhookEvent) bool {
+	if c := a.SentAt.Compare(b.SentAt); c != 0 {
+		return c < 0
+	}
+	return a.CreatedAt.Before(b.CreatedAt)
+}
+
+// ClaimWebhookEvent func returns the oldest due event whose user has no earlier pending event (even one waiting for
+// a retry), so the events of a user are processed in the order they happened. the store is locked by InTx until
+// the event is completed or failed
+func (m *Memory) ClaimWebhookEvent(ctx context.Context) (database.WebhookEvent, error) {
+	defer m.lock()()
+	claimedAt := now()
+	var claimed *database.WebhookEvent
+	for _, event := range m.data.webhookEvents {
+		if event.Status != "pending" || event.NextAttemptAt.After(claimedAt) {
+			continue
+		}
+		if claimed != nil && !webhookEventBefore(event, *claimed) {
+			continue
+		}
+		blocked := false
+		for _, earlier := range m.data.webhookEvents {
+			if event.UserID.Valid && earlier.UserID == event.UserID && earlier.Status == "pending" && webhookEventBefore(earlier, event) {
+				blocked = true
+				break
+			}
+		}
+		if !blocked {
+			claimed = &event
+		}
+	}
+	if claimed == nil {
+		return database.WebhookEvent{}, sql.ErrNoRows
+	}
+	return *claimed, nil
+}
+
+func (m *Memory) CompleteWebhookEvent(ctx context.Context, id string) error {
+	defer m.lock()()
+	event, ok := m.data.webhookEvents[id]
+	if !ok {
+		return nil
+	}
+	event.Status = "processed"
+	event.Attempts++
+	event.LastError = ""
+	event.ProcessedAt = sql.NullTime{Time: now(), Valid: true}
+	m.data.webhookEvents[id] = event
+	return nil
+}
+
+func (m *Memory) FailWebhookEvent(ctx context.Context, arg database.FailWebhookEventParams) error {
+	defer m.lock()()
+	event, ok := m.data.webhookEvents[arg.ID]
+	if !ok {
+		return nil
+	}
+	event.Status = arg.Status
+	event.Attempts++
+	event.NextAttemptAt = arg.NextAttemptAt
+	event.LastError = arg.LastError
+	m.data.webhookEvents[arg.ID] = event
+	return nil
+}
+
+func (m *Memory) GetWebhookEvent(ctx context.Context, id string) (database.WebhookEvent, error) {
+	defer m.lock()()
+	event, ok := m.data.webhookEvents[id]
+	if !ok {
+		return database.WebhookEvent{}, sql.ErrNoRows
+	}
+	return event, nil
+}
+
+func (m *Memory) GetWebhookEventsByStatus(ctx context.Context, arg database.GetWebhookEventsByStatusParams) ([]database.WebhookEvent, error) {
+	defer m.lock()()
+	events := sortedValues(m.data.webhookEvents,
+		func(event database.WebhookEvent) bool { return event.Status == arg.Status },
+		func(a, b database.WebhookEvent) int { return b.CreatedAt.Compare(a.CreatedAt) },
+		func(event database.WebhookEvent) string { return event.ID },
+	)
+	return page(events, arg.Limit, arg.Offset), nil
+}
+
+// ReplayWebhookEvent func gives a failed event all its attempts back
+func (m *Memory) ReplayWebhookEvent(ctx context.Context, id string) (database.WebhookEvent, error) {
+	defer m.lock()()
+	event, ok := m.data.webhookEvents[id]
+	if !ok || event.Status != "failed" {
+		return database.WebhookEvent{}, sql.ErrNoRows
+	}
+	event.Status = "pending"
+	event.Attempts = 0
+	event.NextAttemptAt = now()
+	event.LastError = ""
+	m.data.webhookEvents[id] = event
+	return event, nil
+}
+
+// PurgeWebhookEvents func deletes the processed events created before createdAt, failed and pending events are kept
+// until they're processed
+func (m *Memory) PurgeWebhookEvents(ctx context.Context, createdAt time.Time) (int64, error) {
+	defer m.lock()()
+	purged := int64(0)
+	for id, event := range m.data.webhookEvents {
+		if event.Status == "processed" && event.CreatedAt.Before(createdAt) {
+			delete(m.data.webhookEvents, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (m *Memory) GetSubscription(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+	defer m.lock()()
+	sub, ok := m.data.subscriptions[userID]
+	if !ok {
+		return database.Subscription{}, sql.ErrNoRows
+	}
+	return sub, nil
+}
+
+func (m *Memory) UpsertSubscription(ctx context.Context, arg database.UpsertSubscriptionParams) (database.Subscription, error) {
+	defer m.lock()()
+	if _, ok := m.data.users[arg.UserID]; !ok {
+		return database.Subscription{}, fmt.Errorf("user %v doesn't exist", arg.UserID)
+	}
+	updatedAt := now()
+	sub, ok := m.data.subscriptions[arg.UserID]
+	if !ok {
+		sub = database.Subscription{ID: uuid.New(), CreatedAt: updatedAt, UserID: arg.UserID}
+	}
+	sub.UpdatedAt = updatedAt
+	sub.Plan = arg.Plan
+	sub.Status = arg.Status
+	sub.CurrentPeriodEnd = arg.CurrentPeriodEnd
+	sub.CancelAt = arg.CancelAt
+	sub.LastEventAt = arg.LastEventAt
+	m.data.subscriptions[arg.UserID] = sub
+	return sub, nil
+}
+
+// data exports
+
+func (m *Memory) CreateDataExport(ctx context.Context, userID uuid.UUID) (database.CreateDataExportRow, error) {
+	defer m.lock()()
+	if _, ok := m.data.users[userID]; !ok {
+		return database.CreateDataExportRow{}, fmt.Errorf("user %v doesn't exist", userID)
+	}
+	for _, export := range m.data.dataExports {
+		if export.UserID == userID && export.Status == "pending" {
+			return database.CreateDataExportRow{}, fmt.Errorf("pending export of user %v: %w", userID, ErrConflict)
+		}
+	}
+	export := database.DataExport{ID: uuid.New(), CreatedAt: now(), UserID: userID, Status: "pending"}
+	m.data.dataExports[export.ID] = export
+	return database.CreateDataExportRow{ID: export.ID, CreatedAt: export.CreatedAt, Status: export.Status}, nil
+}
+
+func (m *Memory) GetDataExports(ctx context.Context, userID uuid.UUID) ([]database.GetDataExportsRow, error) {
+	defer m.lock()()
+	exports := sortedValues(m.data.dataExports,
+		func(export database.DataExport) bool { return export.UserID == userID },
+		func(a, b database.DataExport) int { return b.CreatedAt.Compare(a.CreatedAt) },
+		func(export database.DataExport) string { return export.ID.String() },
+	)
+	rows := []database.GetDataExportsRow{}
+	for _, export := range exports {
+		rows = append(rows, database.GetDataExportsRow{
+			ID:          export.ID,
+			CreatedAt:   export.CreatedAt,
+			Status:      export.Status,
+			CompletedAt: export.CompletedAt,
+			ExpiresAt:   export.ExpiresAt,
+		})
+	}
+	return rows, nil
+}
+
+func (m *Memory) GetDataExportArchive(ctx context.Context, arg database.GetDataExportArchiveParams) (database.GetDataExportArchiveRow, error) {
+	defer m.lock()()
+	export, ok := m.data.dataExports[arg.ID]
+	if !ok || export.UserID != arg.UserID {
+		return database.GetDataExportArchiveRow{}, sql.ErrNoRows
+	}
+	return database.GetDataExportArchiveRow{Status: export.Status, Archive: export.Archive, ExpiresAt: export.ExpiresAt}, nil
+}
+
+// ClaimDataExports func leases the oldest pending exports until lease_until, so they aren't generated twice
+func (m *Memory) ClaimDataExports(ctx context.Context, arg database.ClaimDataExportsParams) ([]database.ClaimDataExportsRow, error) {
+	defer m.lock()()
+	exports := sortedValues(m.data.dataExports,
+		func(export database.DataExport) bool {
+			return export.Status == "pending" && (!export.LeaseUntil.Valid || !export.LeaseUntil.Time.After(arg.Now))
+		},
+		func(a, b database.DataExport) int { return a.CreatedAt.Compare(b.CreatedAt) },
+		func(export database.DataExport) string { return export.ID.String() },
+	)
+	rows := []database.ClaimDataExportsRow{}
+	for _, export := range page(exports, arg.Limit, 0) {
+		export.LeaseUntil = sql.NullTime{Time: arg.LeaseUntil, Valid: true}
+		m.data.dataExports[export.ID] = export
+		rows = append(rows, database.ClaimDataExportsRow{ID: export.ID, UserID: export.UserID})
+	}
+	return rows, nil
+}
+
+func (m *Memory) CompleteDataExport(ctx context.Context, arg database.CompleteDataExportParams) error {
+	defer m.lock()()
+	export, ok := m.data.dataExports[arg.ID]
+	if !ok {
+		return nil
+	}
+	export.Status = arg.Status
+	export.Archive = arg.Archive
+	export.CompletedAt = sql.NullTime{Time: now(), Valid: true}
+	export.ExpiresAt = arg.ExpiresAt
+	m.data.dataExports[arg.ID] = export
+	return nil
+}
+
+func (m *Memory) PurgeExpiredDataExports(ctx context.Context) (int64, error) {
+	defer m.lock()()
+	purgedAt := now()
+	purged := int64(0)
+	for id, export := range m.data.dataExports {
+		if export.ExpiresAt.Valid && !export.ExpiresAt.Time.After(purgedAt) {
+			delete(m.data.dataExports, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// ExportChirps func returns every chirp of the user, including the ones in the trash
+func (m *Memory) ExportChirps(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error) {
+	defer m.lock()()
+	return sortedValues(m.data.chirps,
+		func(chirp database.Chirp) bool { return chirp.UserID == userID },
+		func(a, b database.Chirp) int { return a.CreatedAt.Compare(b.CreatedAt) },
+		func(chirp database.Chirp) string { return chirp.ID.String() },
+	), nil
+}
+
+// exportFollows func returns the follows of the user, as the follower or as the followee, oldest first
+func (d *memoryData) exportFollows(keep func(database.Follow) bool) []database.Follow {
+	return sortedValues(d.follows, keep,
+		func(a, b database.Follow) int { return a.CreatedAt.Compare(b.CreatedAt) },
+		func(follow database.Follow) string { return follow.FollowerID.String() + follow.FolloweeID.String() },
+	)
+}
+
+func (m *Memory) ExportFollowing(ctx context.Context, followerID uuid.UUID) ([]database.ExportFollowingRow, error) {
+	defer m.lock()()
+	rows := []database.ExportFollowingRow{}
+	for _, follow := range m.data.exportFollows(func(follow database.Follow) bool { return follow.FollowerID == followerID }) {
+		if followee, ok := m.data.users[follow.FolloweeID]; ok {
+			rows = append(rows, database.ExportFollowingRow{ID: followee.ID, Handle: followee.Handle, CreatedAt: follow.CreatedAt})
+		}
+	}
+	return rows, nil
+}
+
+func (m *Memory) ExportFollowers(ctx context.Context, followeeID uuid.UUID) ([]database.ExportFollowersRow, error) {
+	defer m.lock()()
+	rows := []database.ExportFollowersRow{}
+	for _, follow := range m.data.exportFollows(func(follow database.Follow) bool { return follow.FolloweeID == followeeID }) {
+		if follower, ok := m.data.users[follow.FollowerID]; ok {
+			rows = append(rows, database.ExportFollowersRow{ID: follower.ID, Handle: follower.Handle, CreatedAt: follow.CreatedAt})
+		}
+	}
+	return rows, nil
+}
+
+func (m *Memory) ExportBookmarks(ctx context.Context, userID uuid.UUID) ([]database.ExportBookmarksRow, error) {
+	defer m.lock()()
+	bookmarks := sortedValues(m.data.bookmarks,
+		func(bookmark database.Bookmark) bool {
+			return m.data.collections[bookmark.CollectionID].UserID == userID
+		},
+		func(a, b database.Bookmark) int { return a.CreatedAt.Compare(b.CreatedAt) },
+		func(bookmark database.Bookmark) string {
+			return bookmark.CollectionID.String() + bookmark.ChirpID.String()
+		},
+	)
+	rows := []database.ExportBookmarksRow{}
+	for _, bookmark := range bookmarks {
+		rows = append(rows, database.ExportBookmarksRow{
+			Collection: m.data.collections[bookmark.CollectionID].Name,
+			ChirpID:    bookmark.ChirpID,
+			CreatedAt:  bookmark.CreatedAt,
+		})
+	}
+	return rows, nil
+}
+
+func (m *Memory) ExportPollVotes(ctx context.Context, userID uuid.UUID) ([]database.ExportPollVotesRow, error) {
+	defer m.lock()()
+	votes := sortedValues(m.data.pollVotes,
+		func(vote database.PollVote) bool { return vote.UserID == userID },
+		func(a, b database.PollVote) int { return a.CreatedAt.Compare(b.CreatedAt) },
+		func(vote database.PollVote) string { return vote.PollID.String() },
+	)
+	rows := []database.ExportPollVotesRow{}
+	for _, vote := range votes {
+		rows = append(rows, database.ExportPollVotesRow{
+			ChirpID:   m.data.polls[vote.PollID].ChirpID,
+			Option:    m.data.pollOptions[vote.OptionID].Text,
+			CreatedAt: vote.CreatedAt,
+		})
+	}
+	return rows, nil
+}
+
+func (m *Memory) ExportNotifications(ctx context.Context, userID uuid.UUID) ([]database.Notification, error) {
+	defer m.lock()()
+	return sortedValues(m.data.notifications,
+		func(notification database.Notification) bool { return notification.UserID == userID },
+		func(a, b database.Notification) int { return a.CreatedAt.Compare(b.CreatedAt) },
+		func(notification database.Notification) string { return notification.ID.String() },
+	), nil
+}
+
+func (m *Memory) ExportUserIdentities(ctx context.Context, userID uuid.UUID) ([]database.UserIdentity, error) {
+	defer m.lock()()
+	return sortedValues(m.data.identities,
+		func(identity database.UserIdentity) bool { return identity.UserID == userID },
+		func(a, b database.UserIdentity) int { return a.CreatedAt.Compare(b.CreatedAt) },
+		func(identity database.UserIdentity) string { return identity.Provider + "/" + identity.Subject },
+	), nil
+}
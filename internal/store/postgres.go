@@ -0,0 +1,37 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/h0dy/http-server/internal/database"
+)
+
+// Postgres is the store of a postgres database, over the queries generated by sqlc
+type Postgres struct {
+	*database.Queries
+	db *sql.DB // nil when the store is bound to a transaction
+	tx *sql.Tx // the transaction the store is bound to
+}
+
+var _ Store = (*Postgres)(nil)
+
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{Queries: database.New(db), db: db}
+}
+
+func (p *Postgres) InTx(ctx context.Context, fn func(tx Store) error) error {
+	if p.db == nil { // already in a transaction
+		return inSavepoint(ctx, p.tx, func() error { return fn(p) })
+	}
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&Postgres{Queries: p.WithTx(tx), tx: tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,1756 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/database"
+	"github.com/pressly/goose/v3"
+	_ "modernc.org/sqlite"
+)
+
+//go:embed sqlite_migrations/*.sql
+var sqliteMigrations embed.FS
+
+// sqliteTimeLayout is how timestamps are saved: UTC with the microseconds of postgres timestamps, and a fixed width
+// so the queries can compare them as text
+const sqliteTimeLayout = "2006-01-02 15:04:05.000000"
+
+// SQLite is the store of a sqlite database, for local development and small deployments. it has its own schema
+// (sqlite_migrations) that is migrated when the store is opened. the ids and timestamps made by gen_random_uuid()
+// and NOW() in the postgres queries are made by the store, in go
+type SQLite struct {
+	q  database.DBTX
+	db *sql.DB // nil when the store is bound to a transaction
+}
+
+var _ Store = (*SQLite)(nil)
+
+// OpenSQLite func opens the sqlite database at path (":memory:" for one that isn't saved) and applies its migrations
+func OpenSQLite(ctx context.Context, path string) (*SQLite, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	// sqlite has one writer at a time, a single connection queues the queries instead of failing them as busy
+	// (and it keeps the data of an in-memory database)
+	db.SetMaxOpenConns(1)
+
+	migrations, err := fs.Sub(sqliteMigrations, "sqlite_migrations")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	provider, err := goose.NewProvider(goose.DialectSQLite3, db, migrations)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err := provider.Up(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("couldn't migrate the sqlite database: %w", err)
+	}
+	return &SQLite{q: db, db: db}, nil
+}
+
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLite) InTx(ctx context.Context, fn func(tx Store) error) error {
+	if s.db == nil { // already in a transaction
+		return inSavepoint(ctx, s.q, func() error { return fn(s) })
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&SQLite{q: tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// sqliteTime func formats t the way timestamps are saved
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+func sqliteNullTime(t sql.NullTime) any {
+	if !t.Valid {
+		return nil
+	}
+	return sqliteTime(t.Time)
+}
+
+// sqliteNow func returns the current time as it's saved, it stands for NOW()
+func sqliteNow() string {
+	return sqliteTime(time.Now())
+}
+
+// sqliteJSON func encodes a list of ids as a json array, sqlite has no arrays so the queries read them with json_each
+// where postgres uses ANY
+func sqliteJSON(values any) string {
+	data, _ := json.Marshal(values) // lists of strings and uuids always encode
+	return string(data)
+}
+
+// sqliteStrings is a list saved as a json array, NULL for a nil list
+type sqliteStrings []string
+
+func (s sqliteStrings) Value() (driver.Value, error) {
+	if s == nil {
+		return nil, nil
+	}
+	return sqliteJSON([]string(s)), nil
+}
+
+func (s *sqliteStrings) Scan(src any) error {
+	switch src := src.(type) {
+	case nil:
+		*s = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(src), (*[]string)(s))
+	case []byte:
+		return json.Unmarshal(src, (*[]string)(s))
+	}
+	return fmt.Errorf("can't scan %T into a list of strings", src)
+}
+
+// scanner is a row of QueryRowContext or of QueryContext
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// sqliteQuery func runs a query that returns many rows, it returns nil without rows like the sqlc code
+func sqliteQuery[T any](ctx context.Context, q database.DBTX, scan func(scanner) (T, error), query string, args ...any) ([]T, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []T
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// sqliteExecRows func runs a statement and returns how many rows it changed
+func sqliteExecRows(ctx context.Context, q database.DBTX, query string, args ...any) (int64, error) {
+	result, err := q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func scanString(row scanner) (string, error) {
+	var s string
+	err := row.Scan(&s)
+	return s, err
+}
+
+func scanUUID(row scanner) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
+// users
+
+const sqliteUserColumns = `id, created_at, updated_at, email, hashed_password, handle, display_name, bio, avatar_url,
+	tokens_valid_after, delete_after, chirpy_red_until`
+
+func scanUser(row scanner) (database.User, error) {
+	var i database.User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.TokensValidAfter,
+		&i.DeleteAfter,
+		&i.ChirpyRedUntil,
+	)
+	return i, err
+}
+
+func (s *SQLite) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	return scanUser(s.q.QueryRowContext(ctx, `
+		INSERT INTO users(id, created_at, updated_at, email, hashed_password)
+		VALUES (?1, ?2, ?2, ?3, ?4)
+		RETURNING `+sqliteUserColumns,
+		uuid.New(), sqliteNow(), arg.Email, arg.HashedPassword,
+	))
+}
+
+func (s *SQLite) DeleteUsers(ctx context.Context) error {
+	_, err := s.q.ExecContext(ctx, `DELETE FROM users`)
+	return err
+}
+
+func (s *SQLite) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	return scanUser(s.q.QueryRowContext(ctx, `SELECT `+sqliteUserColumns+` FROM users WHERE email = ?1`, email))
+}
+
+func (s *SQLite) GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error) {
+	return scanUser(s.q.QueryRowContext(ctx, `SELECT `+sqliteUserColumns+` FROM users WHERE id = ?1`, id))
+}
+
+func (s *SQLite) UpdateUserEmail(ctx context.Context, arg database.UpdateUserEmailParams) (database.User, error) {
+	return scanUser(s.q.QueryRowContext(ctx, `
+		UPDATE users SET email = ?2, updated_at = ?3 WHERE id = ?1
+		RETURNING `+sqliteUserColumns,
+		arg.ID, arg.Email, sqliteNow(),
+	))
+}
+
+func (s *SQLite) ChangeUserPassword(ctx context.Context, arg database.ChangeUserPasswordParams) (database.User, error) {
+	return scanUser(s.q.QueryRowContext(ctx, `
+		UPDATE users SET hashed_password = ?2, updated_at = ?3 WHERE id = ?1
+		RETURNING `+sqliteUserColumns,
+		arg.ID, arg.HashedPassword, sqliteNow(),
+	))
+}
+
+func (s *SQLite) UpdateUserPassword(ctx context.Context, arg database.UpdateUserPasswordParams) error {
+	_, err := s.q.ExecContext(ctx, `UPDATE users SET hashed_password = ?2 WHERE id = ?1`, arg.ID, arg.HashedPassword)
+	return err
+}
+
+func (s *SQLite) UpdateUserProfile(ctx context.Context, arg database.UpdateUserProfileParams) (database.User, error) {
+	return scanUser(s.q.QueryRowContext(ctx, `
+		UPDATE users
+		SET handle = ?1, display_name = ?2, bio = ?3, avatar_url = ?4, updated_at = ?6
+		WHERE id = ?5
+		RETURNING `+sqliteUserColumns,
+		arg.Handle, arg.DisplayName, arg.Bio, arg.AvatarUrl, arg.ID, sqliteNow(),
+	))
+}
+
+func (s *SQLite) GetProfileByHandle(ctx context.Context, handle string) (database.GetProfileByHandleRow, error) {
+	var i database.GetProfileByHandleRow
+	err := s.q.QueryRowContext(ctx, `
+		SELECT id, created_at, handle, display_name, bio, avatar_url,
+			(SELECT COUNT(*) FROM follows WHERE follows.followee_id = users.id),
+			(SELECT COUNT(*) FROM follows WHERE follows.follower_id = users.id),
+			(SELECT COUNT(*) FROM chirps WHERE chirps.user_id = users.id AND chirps.deleted_at IS NULL)
+		FROM users
+		WHERE LOWER(handle) = LOWER(?1) AND delete_after IS NULL`,
+		handle,
+	).Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.FollowersCount,
+		&i.FollowingCount,
+		&i.ChirpsCount,
+	)
+	return i, err
+}
+
+func (s *SQLite) GetAuthors(ctx context.Context, ids []uuid.UUID) ([]database.GetAuthorsRow, error) {
+	return sqliteQuery(ctx, s.q, func(row scanner) (database.GetAuthorsRow, error) {
+		var i database.GetAuthorsRow
+		err := row.Scan(&i.ID, &i.Handle, &i.DisplayName, &i.AvatarUrl)
+		return i, err
+	}, `
+		SELECT id, handle, display_name, avatar_url FROM users
+		WHERE id IN (SELECT value FROM json_each(?1))`,
+		sqliteJSON(ids),
+	)
+}
+
+func (s *SQLite) GetUsers(ctx context.Context, arg database.GetUsersParams) ([]database.User, error) {
+	return sqliteQuery(ctx, s.q, scanUser, `
+		SELECT `+sqliteUserColumns+` FROM users
+		ORDER BY created_at ASC
+		LIMIT ?1 OFFSET ?2`,
+		arg.Limit, arg.Offset,
+	)
+}
+
+func (s *SQLite) DeleteUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	return sqliteExecRows(ctx, s.q, `DELETE FROM users WHERE id = ?1`, id)
+}
+
+func (s *SQLite) ScheduleUserDeletion(ctx context.Context, arg database.ScheduleUserDeletionParams) (database.User, error) {
+	return scanUser(s.q.QueryRowContext(ctx, `
+		UPDATE users SET delete_after = ?2, updated_at = ?3
+		WHERE id = ?1 AND delete_after IS NULL
+		RETURNING `+sqliteUserColumns,
+		arg.ID, sqliteNullTime(arg.DeleteAfter), sqliteNow(),
+	))
+}
+
+// RestoreUser func restores an account until it's purged
+func (s *SQLite) RestoreUser(ctx context.Context, id uuid.UUID) (database.User, error) {
+	return scanUser(s.q.QueryRowContext(ctx, `
+		UPDATE users SET delete_after = NULL, updated_at = ?2
+		WHERE id = ?1 AND delete_after > ?2
+		RETURNING `+sqliteUserColumns,
+		id, sqliteNow(),
+	))
+}
+
+// PurgeDeletedUsers func deletes everything of the users through the ON DELETE CASCADE foreign keys
+func (s *SQLite) PurgeDeletedUsers(ctx context.Context) (int64, error) {
+	return sqliteExecRows(ctx, s.q, `DELETE FROM users WHERE delete_after <= ?1`, sqliteNow())
+}
+
+func (s *SQLite) SetTokensValidAfter(ctx context.Context, arg database.SetTokensValidAfterParams) error {
+	_, err := s.q.ExecContext(ctx, `UPDATE users SET tokens_valid_after = ?2 WHERE id = ?1`,
+		arg.ID, sqliteNullTime(arg.TokensValidAfter),
+	)
+	return err
+}
+
+func (s *SQLite) SetChirpyRedUntil(ctx context.Context, arg database.SetChirpyRedUntilParams) error {
+	_, err := s.q.ExecContext(ctx, `UPDATE users SET chirpy_red_until = ?2 WHERE id = ?1`,
+		arg.ID, sqliteNullTime(arg.ChirpyRedUntil),
+	)
+	return err
+}
+
+func (s *SQLite) GetTokensValidAfter(ctx context.Context, since time.Time) ([]database.GetTokensValidAfterRow, error) {
+	return sqliteQuery(ctx, s.q, func(row scanner) (database.GetTokensValidAfterRow, error) {
+		var i database.GetTokensValidAfterRow
+		err := row.Scan(&i.ID, &i.TokensValidAfter)
+		return i, err
+	}, `SELECT id, tokens_valid_after FROM users WHERE tokens_valid_after > ?1`, sqliteTime(since))
+}
+
+func (s *SQLite) GetUserRoles(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	return sqliteQuery(ctx, s.q, scanString, `SELECT role FROM user_roles WHERE user_id = ?1 ORDER BY role`, userID)
+}
+
+func (s *SQLite) GetUserPermissions(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	return sqliteQuery(ctx, s.q, scanString, `
+		SELECT DISTINCT role_permissions.permission FROM role_permissions
+		JOIN user_roles ON user_roles.role = role_permissions.role
+		WHERE user_roles.user_id = ?1
+		ORDER BY role_permissions.permission`,
+		userID,
+	)
+}
+
+func (s *SQLite) AssignUserRole(ctx context.Context, arg database.AssignUserRoleParams) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO user_roles(user_id, role, created_at)
+		VALUES(?1, ?2, ?3)
+		ON CONFLICT (user_id, role) DO NOTHING`,
+		arg.UserID, arg.Role, sqliteNow(),
+	)
+	return err
+}
+
+func (s *SQLite) RemoveUserRole(ctx context.Context, arg database.RemoveUserRoleParams) (int64, error) {
+	return sqliteExecRows(ctx, s.q, `DELETE FROM user_roles WHERE user_id = ?1 AND role = ?2`, arg.UserID, arg.Role)
+}
+
+// email changes
+
+const sqliteEmailChangeColumns = `id, created_at, user_id, old_email, new_email, confirm_token_hash, undo_token_hash,
+	expires_at, undo_expires_at, confirmed_at, undone_at`
+
+func scanEmailChange(row scanner) (database.EmailChange, error) {
+	var i database.EmailChange
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.OldEmail,
+		&i.NewEmail,
+		&i.ConfirmTokenHash,
+		&i.UndoTokenHash,
+		&i.ExpiresAt,
+		&i.UndoExpiresAt,
+		&i.ConfirmedAt,
+		&i.UndoneAt,
+	)
+	return i, err
+}
+
+func (s *SQLite) CreateEmailChange(ctx context.Context, arg database.CreateEmailChangeParams) (database.EmailChange, error) {
+	return scanEmailChange(s.q.QueryRowContext(ctx, `
+		INSERT INTO email_changes(id, created_at, user_id, old_email, new_email, confirm_token_hash, undo_token_hash, expires_at, undo_expires_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9)
+		RETURNING `+sqliteEmailChangeColumns,
+		uuid.New(), sqliteNow(), arg.UserID, arg.OldEmail, arg.NewEmail, arg.ConfirmTokenHash, arg.UndoTokenHash,
+		sqliteTime(arg.ExpiresAt), sqliteTime(arg.UndoExpiresAt),
+	))
+}
+
+// CancelEmailChanges func cancels the pending email changes, a new one replaces them
+func (s *SQLite) CancelEmailChanges(ctx context.Context, userID uuid.UUID) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE email_changes SET undone_at = ?2
+		WHERE user_id = ?1 AND confirmed_at IS NULL AND undone_at IS NULL`,
+		userID, sqliteNow(),
+	)
+	return err
+}
+
+// ConfirmEmailChange func confirms a change once, before it expires and unless it was undone
+func (s *SQLite) ConfirmEmailChange(ctx context.Context, confirmTokenHash string) (database.EmailChange, error) {
+	return scanEmailChange(s.q.QueryRowContext(ctx, `
+		UPDATE email_changes SET confirmed_at = ?2
+		WHERE confirm_token_hash = ?1 AND confirmed_at IS NULL AND undone_at IS NULL AND expires_at > ?2
+		RETURNING `+sqliteEmailChangeColumns,
+		confirmTokenHash, sqliteNow(),
+	))
+}
+
+func (s *SQLite) UndoEmailChange(ctx context.Context, undoTokenHash string) (database.EmailChange, error) {
+	return scanEmailChange(s.q.QueryRowContext(ctx, `
+		UPDATE email_changes SET undone_at = ?2
+		WHERE undo_token_hash = ?1 AND undone_at IS NULL AND undo_expires_at > ?2
+		RETURNING `+sqliteEmailChangeColumns,
+		undoTokenHash, sqliteNow(),
+	))
+}
+
+// identities
+
+func (s *SQLite) CreateUserIdentity(ctx context.Context, arg database.CreateUserIdentityParams) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO user_identities(provider, subject, created_at, user_id, email)
+		VALUES (?1, ?2, ?3, ?4, ?5)`,
+		arg.Provider, arg.Subject, sqliteNow(), arg.UserID, arg.Email,
+	)
+	return err
+}
+
+func (s *SQLite) GetUserByIdentity(ctx context.Context, arg database.GetUserByIdentityParams) (database.User, error) {
+	return scanUser(s.q.QueryRowContext(ctx, `
+		SELECT `+sqliteUserColumns+` FROM users
+		WHERE id = (SELECT user_id FROM user_identities WHERE provider = ?1 AND subject = ?2)`,
+		arg.Provider, arg.Subject,
+	))
+}
+
+func (s *SQLite) CreateOIDCLogin(ctx context.Context, arg database.CreateOIDCLoginParams) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO oidc_logins(state_hash, created_at, nonce, code_verifier, expires_at, restore)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6)`,
+		arg.StateHash, sqliteNow(), arg.Nonce, arg.CodeVerifier, sqliteTime(arg.ExpiresAt), arg.Restore,
+	)
+	return err
+}
+
+// UseOIDCLogin func deletes the login and returns it, a login can only be completed once
+func (s *SQLite) UseOIDCLogin(ctx context.Context, stateHash string) (database.OidcLogin, error) {
+	var i database.OidcLogin
+	err := s.q.QueryRowContext(ctx, `
+		DELETE FROM oidc_logins
+		WHERE state_hash = ?1 AND expires_at > ?2
+		RETURNING state_hash, created_at, nonce, code_verifier, expires_at, restore`,
+		stateHash, sqliteNow(),
+	).Scan(&i.StateHash, &i.CreatedAt, &i.Nonce, &i.CodeVerifier, &i.ExpiresAt, &i.Restore)
+	return i, err
+}
+
+// follows
+
+// FollowUser func returns 0 when the user already follows them
+func (s *SQLite) FollowUser(ctx context.Context, arg database.FollowUserParams) (int64, error) {
+	return sqliteExecRows(ctx, s.q, `
+		INSERT INTO follows(follower_id, followee_id, created_at)
+		VALUES(?1, ?2, ?3)
+		ON CONFLICT (follower_id, followee_id) DO NOTHING`,
+		arg.FollowerID, arg.FolloweeID, sqliteNow(),
+	)
+}
+
+func (s *SQLite) UnfollowUser(ctx context.Context, arg database.UnfollowUserParams) (int64, error) {
+	return sqliteExecRows(ctx, s.q, `DELETE FROM follows WHERE follower_id = ?1 AND followee_id = ?2`,
+		arg.FollowerID, arg.FolloweeID,
+	)
+}
+
+// chirps
+
+const sqliteChirpColumns = `id, created_at, updated_at, body, user_id, deleted_at, deleted_by`
+
+func scanChirp(row scanner) (database.Chirp, error) {
+	var i database.Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.DeletedAt,
+		&i.DeletedBy,
+	)
+	return i, err
+}
+
+func (s *SQLite) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	return scanChirp(s.q.QueryRowContext(ctx, `
+		INSERT INTO chirps(id, created_at, updated_at, body, user_id)
+		VALUES(?1, ?2, ?2, ?3, ?4)
+		RETURNING `+sqliteChirpColumns,
+		uuid.New(), sqliteNow(), arg.Body, arg.UserID,
+	))
+}
+
+func (s *SQLite) GetAllChirps(ctx context.Context, userID uuid.NullUUID) ([]database.Chirp, error) {
+	return sqliteQuery(ctx, s.q, scanChirp, `
+		SELECT `+sqliteChirpColumns+` FROM chirps
+		WHERE (user_id = ?1 OR ?1 IS NULL)
+		AND deleted_at IS NULL
+		ORDER BY created_at ASC`,
+		userID,
+	)
+}
+
+func (s *SQLite) GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	return scanChirp(s.q.QueryRowContext(ctx, `SELECT `+sqliteChirpColumns+` FROM chirps WHERE id = ?1 AND deleted_at IS NULL`, id))
+}
+
+func (s *SQLite) SoftDeleteChirp(ctx context.Context, arg database.SoftDeleteChirpParams) (int64, error) {
+	return sqliteExecRows(ctx, s.q, `
+		UPDATE chirps
+		SET deleted_at = ?2, updated_at = ?2, deleted_by = ?3
+		WHERE id = ?1 AND deleted_at IS NULL`,
+		arg.ID, sqliteNow(), arg.DeletedBy,
+	)
+}
+
+func (s *SQLite) GetTrashedChirps(ctx context.Context, arg database.GetTrashedChirpsParams) ([]database.Chirp, error) {
+	return sqliteQuery(ctx, s.q, scanChirp, `
+		SELECT `+sqliteChirpColumns+` FROM chirps
+		WHERE user_id = ?1
+		AND deleted_by = user_id
+		AND deleted_at > ?2
+		ORDER BY deleted_at DESC`,
+		arg.UserID, sqliteTime(arg.Cutoff),
+	)
+}
+
+func (s *SQLite) RestoreChirp(ctx context.Context, arg database.RestoreChirpParams) (database.Chirp, error) {
+	return scanChirp(s.q.QueryRowContext(ctx, `
+		UPDATE chirps
+		SET deleted_at = NULL, deleted_by = NULL, updated_at = ?4
+		WHERE id = ?1
+		AND user_id = ?2
+		AND deleted_by = user_id
+		AND deleted_at > ?3
+		RETURNING `+sqliteChirpColumns,
+		arg.ID, arg.UserID, sqliteTime(arg.Cutoff), sqliteNow(),
+	))
+}
+
+func (s *SQLite) PurgeTrashedChirps(ctx context.Context, cutoff time.Time) (int64, error) {
+	return sqliteExecRows(ctx, s.q, `DELETE FROM chirps WHERE deleted_at <= ?1`, sqliteTime(cutoff))
+}
+
+// polls
+
+const sqlitePollColumns = `polls.id, polls.created_at, polls.chirp_id, polls.closes_at, polls.closed_notified_at`
+
+func scanPoll(row scanner) (database.Poll, error) {
+	var i database.Poll
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.ChirpID,
+		&i.ClosesAt,
+		&i.ClosedNotifiedAt,
+	)
+	return i, err
+}
+
+func scanPollOption(row scanner) (database.PollOption, error) {
+	var i database.PollOption
+	err := row.Scan(
+		&i.ID,
+		&i.PollID,
+		&i.Position,
+		&i.Text,
+	)
+	return i, err
+}
+
+func (s *SQLite) CreatePoll(ctx context.Context, arg database.CreatePollParams) (database.Poll, error) {
+	return scanPoll(s.q.QueryRowContext(ctx, `
+		INSERT INTO polls(id, created_at, chirp_id, closes_at)
+		VALUES(?1, ?2, ?3, ?4)
+		RETURNING `+sqlitePollColumns,
+		uuid.New(), sqliteNow(), arg.ChirpID, sqliteTime(arg.ClosesAt),
+	))
+}
+
+func (s *SQLite) CreatePollOption(ctx context.Context, arg database.CreatePollOptionParams) (database.PollOption, error) {
+	return scanPollOption(s.q.QueryRowContext(ctx, `
+		INSERT INTO poll_options(id, poll_id, position, text)
+		VALUES(?1, ?2, ?3, ?4)
+		RETURNING id, poll_id, position, text`,
+		uuid.New(), arg.PollID, arg.Position, arg.Text,
+	))
+}
+
+func (s *SQLite) GetPollByChirpID(ctx context.Context, chirpID uuid.UUID) (database.Poll, error) {
+	return scanPoll(s.q.QueryRowContext(ctx, `
+		SELECT `+sqlitePollColumns+` FROM polls
+		JOIN chirps ON chirps.id = polls.chirp_id
+		WHERE polls.chirp_id = ?1 AND chirps.deleted_at IS NULL`,
+		chirpID,
+	))
+}
+
+func (s *SQLite) GetPollsByChirpIDs(ctx context.Context, chirpIds []uuid.UUID) ([]database.Poll, error) {
+	return sqliteQuery(ctx, s.q, scanPoll, `
+		SELECT `+sqlitePollColumns+` FROM polls
+		WHERE chirp_id IN (SELECT value FROM json_each(?1))`,
+		sqliteJSON(chirpIds),
+	)
+}
+
+func (s *SQLite) GetPollOption(ctx context.Context, arg database.GetPollOptionParams) (database.PollOption, error) {
+	return scanPollOption(s.q.QueryRowContext(ctx, `
+		SELECT id, poll_id, position, text FROM poll_options WHERE id = ?1 AND poll_id = ?2`,
+		arg.ID, arg.PollID,
+	))
+}
+
+func (s *SQLite) GetPollResults(ctx context.Context, pollIds []uuid.UUID) ([]database.GetPollResultsRow, error) {
+	return sqliteQuery(ctx, s.q, func(row scanner) (database.GetPollResultsRow, error) {
+		var i database.GetPollResultsRow
+		err := row.Scan(&i.ID, &i.PollID, &i.Position, &i.Text, &i.Votes)
+		return i, err
+	}, `
+		SELECT poll_options.id, poll_options.poll_id, poll_options.position, poll_options.text,
+			COUNT(poll_votes.user_id) AS votes
+		FROM poll_options
+		LEFT JOIN poll_votes ON poll_votes.option_id = poll_options.id
+		WHERE poll_options.poll_id IN (SELECT value FROM json_each(?1))
+		GROUP BY poll_options.id
+		ORDER BY poll_options.poll_id, poll_options.position`,
+		sqliteJSON(pollIds),
+	)
+}
+
+func (s *SQLite) GetUserPollVotes(ctx context.Context, arg database.GetUserPollVotesParams) ([]database.PollVote, error) {
+	return sqliteQuery(ctx, s.q, func(row scanner) (database.PollVote, error) {
+		var i database.PollVote
+		err := row.Scan(&i.PollID, &i.UserID, &i.OptionID, &i.CreatedAt)
+		return i, err
+	}, `
+		SELECT poll_id, user_id, option_id, created_at FROM poll_votes
+		WHERE user_id = ?1 AND poll_id IN (SELECT value FROM json_each(?2))`,
+		arg.UserID, sqliteJSON(arg.PollIds),
+	)
+}
+
+func (s *SQLite) CreatePollVote(ctx context.Context, arg database.CreatePollVoteParams) (int64, error) {
+	return sqliteExecRows(ctx, s.q, `
+		INSERT INTO poll_votes(poll_id, user_id, option_id, created_at)
+		VALUES(?1, ?2, ?3, ?4)
+		ON CONFLICT (poll_id, user_id) DO NOTHING`,
+		arg.PollID, arg.UserID, arg.OptionID, sqliteNow(),
+	)
+}
+
+// GetClosedPollsToNotify func has no row lock to take, sqlite has one writer at a time
+func (s *SQLite) GetClosedPollsToNotify(ctx context.Context, arg database.GetClosedPollsToNotifyParams) ([]database.Poll, error) {
+	return sqliteQuery(ctx, s.q, scanPoll, `
+		SELECT `+sqlitePollColumns+` FROM polls
+		WHERE closes_at <= ?1 AND closed_notified_at IS NULL
+		AND EXISTS (SELECT 1 FROM chirps WHERE chirps.id = polls.chirp_id AND chirps.deleted_at IS NULL)
+		ORDER BY closes_at ASC
+		LIMIT ?2`,
+		sqliteTime(arg.Now), arg.MaxPolls,
+	)
+}
+
+func (s *SQLite) MarkPollNotified(ctx context.Context, id uuid.UUID) error {
+	_, err := s.q.ExecContext(ctx, `UPDATE polls SET closed_notified_at = ?2 WHERE id = ?1`, id, sqliteNow())
+	return err
+}
+
+// drafts
+
+const sqliteChirpDraftColumns = `id, created_at, updated_at, body, user_id, publish_at`
+
+func scanChirpDraft(row scanner) (database.ChirpDraft, error) {
+	var i database.ChirpDraft
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.PublishAt,
+	)
+	return i, err
+}
+
+func (s *SQLite) CreateChirpDraft(ctx context.Context, arg database.CreateChirpDraftParams) (database.ChirpDraft, error) {
+	return scanChirpDraft(s.q.QueryRowContext(ctx, `
+		INSERT INTO chirp_drafts(id, created_at, updated_at, body, user_id, publish_at)
+		VALUES(?1, ?2, ?2, ?3, ?4, ?5)
+		RETURNING `+sqliteChirpDraftColumns,
+		uuid.New(), sqliteNow(), arg.Body, arg.UserID, sqliteNullTime(arg.PublishAt),
+	))
+}
+
+func (s *SQLite) GetChirpDrafts(ctx context.Context, userID uuid.UUID) ([]database.ChirpDraft, error) {
+	return sqliteQuery(ctx, s.q, scanChirpDraft, `
+		SELECT `+sqliteChirpDraftColumns+` FROM chirp_drafts
+		WHERE user_id = ?1
+		ORDER BY created_at ASC`,
+		userID,
+	)
+}
+
+func (s *SQLite) UpdateChirpDraft(ctx context.Context, arg database.UpdateChirpDraftParams) (database.ChirpDraft, error) {
+	return scanChirpDraft(s.q.QueryRowContext(ctx, `
+		UPDATE chirp_drafts
+		SET body = ?1, publish_at = ?2, updated_at = ?5
+		WHERE id = ?3 AND user_id = ?4
+		RETURNING `+sqliteChirpDraftColumns,
+		arg.Body, sqliteNullTime(arg.PublishAt), arg.ID, arg.UserID, sqliteNow(),
+	))
+}
+
+func (s *SQLite) DeleteChirpDraft(ctx context.Context, arg database.DeleteChirpDraftParams) (int64, error) {
+	return sqliteExecRows(ctx, s.q, `DELETE FROM chirp_drafts WHERE id = ?1 AND user_id = ?2`, arg.ID, arg.UserID)
+}
+
+// GetDueChirpDrafts func has no row lock to take, sqlite has one writer at a time
+func (s *SQLite) GetDueChirpDrafts(ctx context.Context, arg database.GetDueChirpDraftsParams) ([]database.ChirpDraft, error) {
+	return sqliteQuery(ctx, s.q, scanChirpDraft, `
+		SELECT `+sqliteChirpDraftColumns+` FROM chirp_drafts
+		WHERE publish_at <= ?1
+		ORDER BY publish_at ASC
+		LIMIT ?2`,
+		sqliteTime(arg.Now), arg.MaxDrafts,
+	)
+}
+
+func (s *SQLite) DeletePublishedChirpDraft(ctx context.Context, id uuid.UUID) error {
+	_, err := s.q.ExecContext(ctx, `DELETE FROM chirp_drafts WHERE id = ?1`, id)
+	return err
+}
+
+func (s *SQLite) UnscheduleChirpDraft(ctx context.Context, id uuid.UUID) error {
+	_, err := s.q.ExecContext(ctx, `UPDATE chirp_drafts SET publish_at = NULL, updated_at = ?2 WHERE id = ?1`, id, sqliteNow())
+	return err
+}
+
+// collections
+
+const sqliteCollectionColumns = `id, created_at, updated_at, user_id, name`
+
+func scanCollection(row scanner) (database.Collection, error) {
+	var i database.Collection
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Name,
+	)
+	return i, err
+}
+
+func (s *SQLite) CreateCollection(ctx context.Context, arg database.CreateCollectionParams) (database.Collection, error) {
+	return scanCollection(s.q.QueryRowContext(ctx, `
+		INSERT INTO collections(id, created_at, updated_at, user_id, name)
+		VALUES(?1, ?2, ?2, ?3, ?4)
+		RETURNING `+sqliteCollectionColumns,
+		uuid.New(), sqliteNow(), arg.UserID, arg.Name,
+	))
+}
+
+func (s *SQLite) GetCollections(ctx context.Context, userID uuid.UUID) ([]database.Collection, error) {
+	return sqliteQuery(ctx, s.q, scanCollection, `
+		SELECT `+sqliteCollectionColumns+` FROM collections
+		WHERE user_id = ?1
+		ORDER BY name ASC`,
+		userID,
+	)
+}
+
+func (s *SQLite) GetCollection(ctx context.Context, arg database.GetCollectionParams) (database.Collection, error) {
+	return scanCollection(s.q.QueryRowContext(ctx, `
+		SELECT `+sqliteCollectionColumns+` FROM collections WHERE id = ?1 AND user_id = ?2`,
+		arg.ID, arg.UserID,
+	))
+}
+
+func (s *SQLite) RenameCollection(ctx context.Context, arg database.RenameCollectionParams) (database.Collection, error) {
+	return scanCollection(s.q.QueryRowContext(ctx, `
+		UPDATE collections
+		SET name = ?1, updated_at = ?4
+		WHERE id = ?2 AND user_id = ?3
+		RETURNING `+sqliteCollectionColumns,
+		arg.Name, arg.ID, arg.UserID, sqliteNow(),
+	))
+}
+
+func (s *SQLite) DeleteCollection(ctx context.Context, arg database.DeleteCollectionParams) (int64, error) {
+	return sqliteExecRows(ctx, s.q, `DELETE FROM collections WHERE id = ?1 AND user_id = ?2`, arg.ID, arg.UserID)
+}
+
+func (s *SQLite) AddBookmark(ctx context.Context, arg database.AddBookmarkParams) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO bookmarks(collection_id, chirp_id, created_at)
+		VALUES(?1, ?2, ?3)
+		ON CONFLICT (collection_id, chirp_id) DO NOTHING`,
+		arg.CollectionID, arg.ChirpID, sqliteNow(),
+	)
+	return err
+}
+
+func (s *SQLite) RemoveBookmark(ctx context.Context, arg database.RemoveBookmarkParams) (int64, error) {
+	return sqliteExecRows(ctx, s.q, `DELETE FROM bookmarks WHERE collection_id = ?1 AND chirp_id = ?2`,
+		arg.CollectionID, arg.ChirpID,
+	)
+}
+
+// GetBookmarks func returns the bookmarks of deleted chirps too, they're unavailable
+func (s *SQLite) GetBookmarks(ctx context.Context, arg database.GetBookmarksParams) ([]database.GetBookmarksRow, error) {
+	return sqliteQuery(ctx, s.q, func(row scanner) (database.GetBookmarksRow, error) {
+		var i database.GetBookmarksRow
+		err := row.Scan(
+			&i.ChirpID,
+			&i.BookmarkedAt,
+			&i.Available,
+			&i.ChirpCreatedAt,
+			&i.ChirpUpdatedAt,
+			&i.Body,
+			&i.UserID,
+		)
+		return i, err
+	}, `
+		SELECT bookmarks.chirp_id,
+			bookmarks.created_at,
+			chirps.id IS NOT NULL AND chirps.deleted_at IS NULL,
+			chirps.created_at,
+			chirps.updated_at,
+			chirps.body,
+			chirps.user_id
+		FROM bookmarks
+		LEFT JOIN chirps ON chirps.id = bookmarks.chirp_id
+		WHERE bookmarks.collection_id = ?1
+		ORDER BY bookmarks.created_at DESC, bookmarks.chirp_id
+		LIMIT ?2 OFFSET ?3`,
+		arg.CollectionID, arg.Limit, arg.Offset,
+	)
+}
+
+// notifications
+
+// NotifyPollVoters func makes a notification for every voter, each with its own id
+func (s *SQLite) NotifyPollVoters(ctx context.Context, pollID uuid.UUID) (int64, error) {
+	voters, err := sqliteQuery(ctx, s.q, func(row scanner) ([2]uuid.UUID, error) {
+		var i [2]uuid.UUID
+		err := row.Scan(&i[0], &i[1])
+		return i, err
+	}, `
+		SELECT poll_votes.user_id, polls.chirp_id FROM poll_votes
+		JOIN polls ON polls.id = poll_votes.poll_id
+		WHERE poll_votes.poll_id = ?1`,
+		pollID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	createdAt := sqliteNow()
+	for _, voter := range voters {
+		if _, err := s.q.ExecContext(ctx, `
+			INSERT INTO notifications(id, created_at, user_id, kind, chirp_id)
+			VALUES(?1, ?2, ?3, 'poll_closed', ?4)`,
+			uuid.New(), createdAt, voter[0], voter[1],
+		); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(voters)), nil
+}
+
+func scanNotification(row scanner) (database.Notification, error) {
+	var i database.Notification
+	err := row.Scan(&i.ID, &i.CreatedAt, &i.UserID, &i.Kind, &i.ChirpID, &i.ReadAt)
+	return i, err
+}
+
+func (s *SQLite) GetNotifications(ctx context.Context, arg database.GetNotificationsParams) ([]database.Notification, error) {
+	return sqliteQuery(ctx, s.q, scanNotification, `
+		SELECT id, created_at, user_id, kind, chirp_id, read_at FROM notifications
+		WHERE user_id = ?1
+		ORDER BY created_at DESC
+		LIMIT ?2`,
+		arg.UserID, arg.Limit,
+	)
+}
+
+func (s *SQLite) MarkNotificationsRead(ctx context.Context, userID uuid.UUID) error {
+	_, err := s.q.ExecContext(ctx, `UPDATE notifications SET read_at = ?2 WHERE user_id = ?1 AND read_at IS NULL`,
+		userID, sqliteNow(),
+	)
+	return err
+}
+
+// oauth clients
+
+const sqliteOAuthClientColumns = `id, created_at, updated_at, user_id, name, redirect_uris, secret_hash`
+
+func scanOAuthClient(row scanner) (database.OauthClient, error) {
+	var i database.OauthClient
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Name,
+		(*sqliteStrings)(&i.RedirectUris),
+		&i.SecretHash,
+	)
+	return i, err
+}
+
+func (s *SQLite) CreateOAuthClient(ctx context.Context, arg database.CreateOAuthClientParams) (database.OauthClient, error) {
+	return scanOAuthClient(s.q.QueryRowContext(ctx, `
+		INSERT INTO oauth_clients(id, created_at, updated_at, user_id, name, redirect_uris, secret_hash)
+		VALUES(?1, ?2, ?2, ?3, ?4, ?5, ?6)
+		RETURNING `+sqliteOAuthClientColumns,
+		arg.ID, sqliteNow(), arg.UserID, arg.Name, sqliteJSON(arg.RedirectUris), arg.SecretHash,
+	))
+}
+
+func (s *SQLite) GetOAuthClient(ctx context.Context, id string) (database.OauthClient, error) {
+	return scanOAuthClient(s.q.QueryRowContext(ctx, `SELECT `+sqliteOAuthClientColumns+` FROM oauth_clients WHERE id = ?1`, id))
+}
+
+func (s *SQLite) GetOAuthClientsByUser(ctx context.Context, userID uuid.UUID) ([]database.OauthClient, error) {
+	return sqliteQuery(ctx, s.q, scanOAuthClient, `
+		SELECT `+sqliteOAuthClientColumns+` FROM oauth_clients
+		WHERE user_id = ?1
+		ORDER BY created_at ASC`,
+		userID,
+	)
+}
+
+func (s *SQLite) GetOAuthClientGrants(ctx context.Context, clientID sql.NullString) ([]uuid.UUID, error) {
+	return sqliteQuery(ctx, s.q, scanUUID, `
+		SELECT DISTINCT grant_id FROM refresh_tokens
+		WHERE client_id = ?1 AND grant_id IS NOT NULL`,
+		clientID,
+	)
+}
+
+func (s *SQLite) DeleteOAuthClient(ctx context.Context, arg database.DeleteOAuthClientParams) (int64, error) {
+	return sqliteExecRows(ctx, s.q, `DELETE FROM oauth_clients WHERE id = ?1 AND user_id = ?2`, arg.ID, arg.UserID)
+}
+
+func (s *SQLite) CreateOAuthCode(ctx context.Context, arg database.CreateOAuthCodeParams) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO oauth_codes(code_hash, created_at, client_id, user_id, redirect_uri, scopes, code_challenge, expires_at)
+		VALUES(?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8)`,
+		arg.CodeHash, sqliteNow(), arg.ClientID, arg.UserID, arg.RedirectUri, sqliteJSON(arg.Scopes), arg.CodeChallenge,
+		sqliteTime(arg.ExpiresAt),
+	)
+	return err
+}
+
+// UseOAuthCode func marks the code as used, a code can only be exchanged once
+func (s *SQLite) UseOAuthCode(ctx context.Context, codeHash string) (database.OauthCode, error) {
+	var i database.OauthCode
+	err := s.q.QueryRowContext(ctx, `
+		UPDATE oauth_codes SET used_at = ?2
+		WHERE code_hash = ?1 AND used_at IS NULL AND expires_at > ?2
+		RETURNING code_hash, created_at, client_id, user_id, redirect_uri, scopes, code_challenge, expires_at, used_at`,
+		codeHash, sqliteNow(),
+	).Scan(
+		&i.CodeHash,
+		&i.CreatedAt,
+		&i.ClientID,
+		&i.UserID,
+		&i.RedirectUri,
+		(*sqliteStrings)(&i.Scopes),
+		&i.CodeChallenge,
+		&i.ExpiresAt,
+		&i.UsedAt,
+	)
+	return i, err
+}
+
+// refresh tokens
+
+const sqliteRefreshTokenColumns = `token, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scopes, id,
+	user_agent, ip, last_used_at, grant_id`
+
+func scanRefreshToken(row scanner) (database.RefreshToken, error) {
+	var i database.RefreshToken
+	err := row.Scan(
+		&i.Token,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.ClientID,
+		(*sqliteStrings)(&i.Scopes),
+		&i.ID,
+		&i.UserAgent,
+		&i.Ip,
+		&i.LastUsedAt,
+		&i.GrantID,
+	)
+	return i, err
+}
+
+func (s *SQLite) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error) {
+	return scanRefreshToken(s.q.QueryRowContext(ctx, `
+		INSERT INTO refresh_tokens(token, created_at, updated_at, user_id, expires_at, revoked_at, user_agent, ip, id)
+		VALUES (?1, ?2, ?2, ?3, ?4, NULL, ?5, ?6, ?7)
+		RETURNING `+sqliteRefreshTokenColumns,
+		arg.Token, sqliteNow(), arg.UserID, sqliteTime(arg.ExpiresAt), arg.UserAgent, arg.Ip, uuid.New(),
+	))
+}
+
+func (s *SQLite) CreateOAuthRefreshToken(ctx context.Context, arg database.CreateOAuthRefreshTokenParams) (database.RefreshToken, error) {
+	return scanRefreshToken(s.q.QueryRowContext(ctx, `
+		INSERT INTO refresh_tokens(token, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scopes, id, grant_id)
+		VALUES (?1, ?2, ?2, ?3, ?4, NULL, ?5, ?6, ?7, ?8)
+		RETURNING `+sqliteRefreshTokenColumns,
+		arg.Token, sqliteNow(), arg.UserID, sqliteTime(arg.ExpiresAt), arg.ClientID, sqliteStrings(arg.Scopes), uuid.New(), arg.GrantID,
+	))
+}
+
+func (s *SQLite) GetRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	return scanRefreshToken(s.q.QueryRowContext(ctx, `SELECT `+sqliteRefreshTokenColumns+` FROM refresh_tokens WHERE token = ?1`, token))
+}
+
+// UseRefreshToken func only uses first-party refresh tokens (sessions), third-party apps refresh through the oauth
+// token endpoint
+func (s *SQLite) UseRefreshToken(ctx context.Context, arg database.UseRefreshTokenParams) (database.RefreshToken, error) {
+	return scanRefreshToken(s.q.QueryRowContext(ctx, `
+		UPDATE refresh_tokens
+		SET last_used_at = ?3, ip = ?2
+		WHERE token = ?1
+		AND client_id IS NULL
+		AND revoked_at IS NULL
+		AND expires_at > ?3
+		RETURNING `+sqliteRefreshTokenColumns,
+		arg.Token, arg.Ip, sqliteNow(),
+	))
+}
+
+func (s *SQLite) SetRevokedAtToken(ctx context.Context, token string) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE refresh_tokens
+		SET revoked_at = ?2, updated_at = ?2
+		WHERE token = ?1`,
+		token, sqliteNow(),
+	)
+	return err
+}
+
+func (s *SQLite) RevokeOAuthRefreshToken(ctx context.Context, arg database.RevokeOAuthRefreshTokenParams) (int64, error) {
+	return sqliteExecRows(ctx, s.q, `
+		UPDATE refresh_tokens
+		SET revoked_at = ?3, updated_at = ?3
+		WHERE token = ?1 AND client_id = ?2 AND revoked_at IS NULL`,
+		arg.Token, arg.ClientID, sqliteNow(),
+	)
+}
+
+// UseOAuthRefreshToken func revokes the refresh token of the client, it can only be used once
+func (s *SQLite) UseOAuthRefreshToken(ctx context.Context, arg database.UseOAuthRefreshTokenParams) (database.RefreshToken, error) {
+	return scanRefreshToken(s.q.QueryRowContext(ctx, `
+		UPDATE refresh_tokens
+		SET revoked_at = ?3, updated_at = ?3
+		WHERE token = ?1
+		AND client_id = ?2
+		AND revoked_at IS NULL
+		AND expires_at > ?3
+		RETURNING `+sqliteRefreshTokenColumns,
+		arg.Token, arg.ClientID, sqliteNow(),
+	))
+}
+
+func (s *SQLite) RevokeOAuthGrant(ctx context.Context, grantID uuid.UUID) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE refresh_tokens
+		SET revoked_at = ?2, updated_at = ?2
+		WHERE grant_id = ?1 AND revoked_at IS NULL`,
+		grantID, sqliteNow(),
+	)
+	return err
+}
+
+func (s *SQLite) GetSessions(ctx context.Context, userID uuid.UUID) ([]database.RefreshToken, error) {
+	return sqliteQuery(ctx, s.q, scanRefreshToken, `
+		SELECT `+sqliteRefreshTokenColumns+` FROM refresh_tokens
+		WHERE user_id = ?1
+		AND client_id IS NULL
+		AND revoked_at IS NULL
+		AND expires_at > ?2
+		ORDER BY COALESCE(last_used_at, created_at) DESC`,
+		userID, sqliteNow(),
+	)
+}
+
+func (s *SQLite) RevokeSession(ctx context.Context, arg database.RevokeSessionParams) (int64, error) {
+	return sqliteExecRows(ctx, s.q, `
+		UPDATE refresh_tokens
+		SET revoked_at = ?3, updated_at = ?3
+		WHERE id = ?1 AND user_id = ?2 AND client_id IS NULL AND revoked_at IS NULL`,
+		arg.ID, arg.UserID, sqliteNow(),
+	)
+}
+
+// RevokeOtherSessions func logs out everywhere else, every session of the user but the current one
+func (s *SQLite) RevokeOtherSessions(ctx context.Context, arg database.RevokeOtherSessionsParams) ([]uuid.UUID, error) {
+	return sqliteQuery(ctx, s.q, scanUUID, `
+		UPDATE refresh_tokens
+		SET revoked_at = ?3, updated_at = ?3
+		WHERE user_id = ?1 AND id <> ?2 AND client_id IS NULL AND revoked_at IS NULL
+		RETURNING id`,
+		arg.UserID, arg.CurrentID, sqliteNow(),
+	)
+}
+
+// RevokeUserRefreshTokens func revokes every session of the user and every refresh token given to oauth clients
+func (s *SQLite) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE refresh_tokens
+		SET revoked_at = ?2, updated_at = ?2
+		WHERE user_id = ?1 AND revoked_at IS NULL`,
+		userID, sqliteNow(),
+	)
+	return err
+}
+
+// personal access tokens
+
+const sqliteAPITokenColumns = `id, created_at, user_id, name, token_hash, scopes, expires_at, last_used_at, revoked_at`
+
+func scanAPIToken(row scanner) (database.ApiToken, error) {
+	var i database.ApiToken
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.Name,
+		&i.TokenHash,
+		(*sqliteStrings)(&i.Scopes),
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
+func (s *SQLite) CreateAPIToken(ctx context.Context, arg database.CreateAPITokenParams) (database.ApiToken, error) {
+	return scanAPIToken(s.q.QueryRowContext(ctx, `
+		INSERT INTO api_tokens(id, created_at, user_id, name, token_hash, scopes, expires_at)
+		VALUES(?1, ?2, ?3, ?4, ?5, ?6, ?7)
+		RETURNING `+sqliteAPITokenColumns,
+		uuid.New(), sqliteNow(), arg.UserID, arg.Name, arg.TokenHash, sqliteStrings(arg.Scopes), sqliteNullTime(arg.ExpiresAt),
+	))
+}
+
+func (s *SQLite) GetAPITokens(ctx context.Context, userID uuid.UUID) ([]database.ApiToken, error) {
+	return sqliteQuery(ctx, s.q, scanAPIToken, `
+		SELECT `+sqliteAPITokenColumns+` FROM api_tokens
+		WHERE user_id = ?1 AND revoked_at IS NULL
+		ORDER BY created_at ASC`,
+		userID,
+	)
+}
+
+func (s *SQLite) GetValidAPIToken(ctx context.Context, tokenHash string) (database.ApiToken, error) {
+	return scanAPIToken(s.q.QueryRowContext(ctx, `
+		SELECT `+sqliteAPITokenColumns+` FROM api_tokens
+		WHERE token_hash = ?1
+		AND revoked_at IS NULL
+		AND (expires_at IS NULL OR expires_at > ?2)`,
+		tokenHash, sqliteNow(),
+	))
+}
+
+// TouchAPIToken func only writes last_used_at once a minute at most to keep authentication cheap
+func (s *SQLite) TouchAPIToken(ctx context.Context, id uuid.UUID) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE api_tokens SET last_used_at = ?2
+		WHERE id = ?1
+		AND (last_used_at IS NULL OR last_used_at < ?3)`,
+		id, sqliteNow(), sqliteTime(time.Now().Add(-time.Minute)),
+	)
+	return err
+}
+
+func (s *SQLite) RevokeAPIToken(ctx context.Context, arg database.RevokeAPITokenParams) (int64, error) {
+	return sqliteExecRows(ctx, s.q, `
+		UPDATE api_tokens SET revoked_at = ?3
+		WHERE id = ?1 AND user_id = ?2 AND revoked_at IS NULL`,
+		arg.ID, arg.UserID, sqliteNow(),
+	)
+}
+
+func (s *SQLite) RevokeUserAPITokens(ctx context.Context, userID uuid.UUID) error {
+	_, err := s.q.ExecContext(ctx, `UPDATE api_tokens SET revoked_at = ?2 WHERE user_id = ?1 AND revoked_at IS NULL`,
+		userID, sqliteNow(),
+	)
+	return err
+}
+
+// revoked access tokens
+
+func (s *SQLite) RevokeToken(ctx context.Context, arg database.RevokeTokenParams) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO revoked_tokens(id, created_at, expires_at)
+		VALUES(?1, ?2, ?3)
+		ON CONFLICT (id) DO NOTHING`,
+		arg.ID, sqliteNow(), sqliteTime(arg.ExpiresAt),
+	)
+	return err
+}
+
+func (s *SQLite) GetRevokedTokens(ctx context.Context) ([]database.RevokedToken, error) {
+	return sqliteQuery(ctx, s.q, func(row scanner) (database.RevokedToken, error) {
+		var i database.RevokedToken
+		err := row.Scan(&i.ID, &i.CreatedAt, &i.ExpiresAt)
+		return i, err
+	}, `SELECT id, created_at, expires_at FROM revoked_tokens WHERE expires_at > ?1`, sqliteNow())
+}
+
+func (s *SQLite) PurgeRevokedTokens(ctx context.Context) error {
+	_, err := s.q.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_at <= ?1`, sqliteNow())
+	return err
+}
+
+// webhooks
+
+// CreateWebhookDeliveries func queues the event for every enabled endpoint of the user that subscribed to it
+func (s *SQLite) CreateWebhookDeliveries(ctx context.Context, arg database.CreateWebhookDeliveriesParams) (int64, error) {
+	endpointIDs, err := sqliteQuery(ctx, s.q, scanUUID, `
+		SELECT id FROM webhook_endpoints
+		WHERE user_id = ?1
+		AND disabled_at IS NULL
+		AND EXISTS (SELECT 1 FROM json_each(webhook_endpoints.events) WHERE value = ?2)`,
+		arg.UserID, arg.Event,
+	)
+	if err != nil {
+		return 0, err
+	}
+	createdAt := sqliteNow()
+	for _, endpointID := range endpointIDs {
+		if _, err := s.q.ExecContext(ctx, `
+			INSERT INTO webhook_deliveries(id, created_at, endpoint_id, event, payload, status, attempts, next_attempt_at)
+			VALUES(?1, ?2, ?3, ?4, ?5, 'pending', 0, ?2)`,
+			uuid.New(), createdAt, endpointID, arg.Event, arg.Payload,
+		); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(endpointIDs)), nil
+}
+
+const sqliteWebhookEndpointColumns = `id, created_at, updated_at, user_id, client_id, url, secret, events, failure_count,
+	disabled_at`
+
+func scanWebhookEndpoint(row scanner) (database.WebhookEndpoint, error) {
+	var i database.WebhookEndpoint
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ClientID,
+		&i.Url,
+		&i.Secret,
+		(*sqliteStrings)(&i.Events),
+		&i.FailureCount,
+		&i.DisabledAt,
+	)
+	return i, err
+}
+
+func (s *SQLite) CreateWebhookEndpoint(ctx context.Context, arg database.CreateWebhookEndpointParams) (database.WebhookEndpoint, error) {
+	return scanWebhookEndpoint(s.q.QueryRowContext(ctx, `
+		INSERT INTO webhook_endpoints(id, created_at, updated_at, user_id, client_id, url, secret, events)
+		VALUES (?1, ?2, ?2, ?3, ?4, ?5, ?6, ?7)
+		RETURNING `+sqliteWebhookEndpointColumns,
+		uuid.New(), sqliteNow(), arg.UserID, arg.ClientID, arg.Url, arg.Secret, sqliteJSON(arg.Events),
+	))
+}
+
+// GetWebhookEndpoints func returns the endpoints of the user, an app only sees the endpoints it registered
+func (s *SQLite) GetWebhookEndpoints(ctx context.Context, arg database.GetWebhookEndpointsParams) ([]database.WebhookEndpoint, error) {
+	return sqliteQuery(ctx, s.q, scanWebhookEndpoint, `
+		SELECT `+sqliteWebhookEndpointColumns+` FROM webhook_endpoints
+		WHERE user_id = ?1
+		AND (client_id = ?2 OR ?2 IS NULL)
+		ORDER BY created_at`,
+		arg.UserID, arg.ClientID,
+	)
+}
+
+func (s *SQLite) GetWebhookEndpoint(ctx context.Context, arg database.GetWebhookEndpointParams) (database.WebhookEndpoint, error) {
+	return scanWebhookEndpoint(s.q.QueryRowContext(ctx, `
+		SELECT `+sqliteWebhookEndpointColumns+` FROM webhook_endpoints
+		WHERE id = ?1 AND user_id = ?2
+		AND (client_id = ?3 OR ?3 IS NULL)`,
+		arg.ID, arg.UserID, arg.ClientID,
+	))
+}
+
+func (s *SQLite) UpdateWebhookEndpoint(ctx context.Context, arg database.UpdateWebhookEndpointParams) (database.WebhookEndpoint, error) {
+	return scanWebhookEndpoint(s.q.QueryRowContext(ctx, `
+		UPDATE webhook_endpoints
+		SET url = ?2, events = ?3, failure_count = ?4, disabled_at = ?5, updated_at = ?6
+		WHERE id = ?1
+		RETURNING `+sqliteWebhookEndpointColumns,
+		arg.ID, arg.Url, sqliteJSON(arg.Events), arg.FailureCount, sqliteNullTime(arg.DisabledAt), sqliteNow(),
+	))
+}
+
+func (s *SQLite) DeleteWebhookEndpoint(ctx context.Context, arg database.DeleteWebhookEndpointParams) (int64, error) {
+	return sqliteExecRows(ctx, s.q, `
+		DELETE FROM webhook_endpoints
+		WHERE id = ?1 AND user_id = ?2
+		AND (client_id = ?3 OR ?3 IS NULL)`,
+		arg.ID, arg.UserID, arg.ClientID,
+	)
+}
+
+func (s *SQLite) RecordWebhookEndpointSuccess(ctx context.Context, id uuid.UUID) error {
+	_, err := s.q.ExecContext(ctx, `UPDATE webhook_endpoints SET failure_count = 0 WHERE id = ?1`, id)
+	return err
+}
+
+// RecordWebhookEndpointFailure func disables the endpoint when it reaches max_failures, the pending deliveries wait
+// until it's enabled again
+func (s *SQLite) RecordWebhookEndpointFailure(ctx context.Context, arg database.RecordWebhookEndpointFailureParams) (database.WebhookEndpoint, error) {
+	return scanWebhookEndpoint(s.q.QueryRowContext(ctx, `
+		UPDATE webhook_endpoints
+		SET failure_count = failure_count + 1,
+			disabled_at = CASE WHEN failure_count + 1 >= ?1 THEN COALESCE(disabled_at, ?3) ELSE disabled_at END
+		WHERE id = ?2
+		RETURNING `+sqliteWebhookEndpointColumns,
+		arg.MaxFailures, arg.ID, sqliteNow(),
+	))
+}
+
+// ClaimWebhookDeliveries func leases the due deliveries until lease_until, so they aren't sent twice while they're
+// in flight. it has no row lock to take, sqlite has one writer at a time
+func (s *SQLite) ClaimWebhookDeliveries(ctx context.Context, arg database.ClaimWebhookDeliveriesParams) ([]database.ClaimWebhookDeliveriesRow, error) {
+	return sqliteQuery(ctx, s.q, func(row scanner) (database.ClaimWebhookDeliveriesRow, error) {
+		var i database.ClaimWebhookDeliveriesRow
+		err := row.Scan(
+			&i.ID,
+			&i.EndpointID,
+			&i.Event,
+			&i.Payload,
+			&i.Attempts,
+			&i.Url,
+			&i.Secret,
+		)
+		return i, err
+	}, `
+		UPDATE webhook_deliveries
+		SET next_attempt_at = ?1
+		WHERE id IN (
+			SELECT d.id FROM webhook_deliveries d
+			JOIN webhook_endpoints e ON e.id = d.endpoint_id
+			WHERE d.status = 'pending' AND d.next_attempt_at <= ?3 AND e.disabled_at IS NULL
+			ORDER BY d.next_attempt_at
+			LIMIT ?2
+		)
+		RETURNING id, endpoint_id, event, payload, attempts,
+			(SELECT url FROM webhook_endpoints WHERE webhook_endpoints.id = endpoint_id),
+			(SELECT secret FROM webhook_endpoints WHERE webhook_endpoints.id = endpoint_id)`,
+		sqliteTime(arg.LeaseUntil), arg.Limit, sqliteNow(),
+	)
+}
+
+func (s *SQLite) CompleteWebhookDelivery(ctx context.Context, arg database.CompleteWebhookDeliveryParams) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = 'delivered', attempts = attempts + 1, last_attempt_at = ?3, response_status = ?2,
+			last_error = '', delivered_at = ?3
+		WHERE id = ?1`,
+		arg.ID, arg.ResponseStatus, sqliteNow(),
+	)
+	return err
+}
+
+func (s *SQLite) FailWebhookDelivery(ctx context.Context, arg database.FailWebhookDeliveryParams) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = ?2, attempts = attempts + 1, next_attempt_at = ?3, last_attempt_at = ?6, response_status = ?4,
+			last_error = ?5
+		WHERE id = ?1`,
+		arg.ID, arg.Status, sqliteTime(arg.NextAttemptAt), arg.ResponseStatus, arg.LastError, sqliteNow(),
+	)
+	return err
+}
+
+func (s *SQLite) GetWebhookDeliveries(ctx context.Context, arg database.GetWebhookDeliveriesParams) ([]database.WebhookDelivery, error) {
+	return sqliteQuery(ctx, s.q, func(row scanner) (database.WebhookDelivery, error) {
+		var i database.WebhookDelivery
+		err := row.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.EndpointID,
+			&i.Event,
+			&i.Payload,
+			&i.Status,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.LastAttemptAt,
+			&i.ResponseStatus,
+			&i.LastError,
+			&i.DeliveredAt,
+		)
+		return i, err
+	}, `
+		SELECT id, created_at, endpoint_id, event, payload, status, attempts, next_attempt_at, last_attempt_at,
+			response_status, last_error, delivered_at
+		FROM webhook_deliveries
+		WHERE endpoint_id = ?1
+		ORDER BY created_at DESC, id
+		LIMIT ?2 OFFSET ?3`,
+		arg.EndpointID, arg.Limit, arg.Offset,
+	)
+}
+
+func (s *SQLite) PurgeWebhookDeliveries(ctx context.Context, createdAt time.Time) (int64, error) {
+	return sqliteExecRows(ctx, s.q, `DELETE FROM webhook_deliveries WHERE status <> 'pending' AND created_at < ?1`,
+		sqliteTime(createdAt),
+	)
+}
+
+// polka events
+
+const sqliteWebhookEventColumns = `id, created_at, event, user_id, payload, sent_at, status, attempts, next_attempt_at,
+	last_error, processed_at`
+
+func scanWebhookEvent(row scanner) (database.WebhookEvent, error) {
+	var i database.WebhookEvent
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Event,
+		&i.UserID,
+		&i.Payload,
+		&i.SentAt,
+		&i.Status,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.LastError,
+		&i.ProcessedAt,
+	)
+	return i, err
+}
+
+// CreateWebhookEvent func stores the event, 0 rows means the event was already received
+func (s *SQLite) CreateWebhookEvent(ctx context.Context, arg database.CreateWebhookEventParams) (int64, error) {
+	return sqliteExecRows(ctx, s.q, `
+		INSERT INTO webhook_events(id, created_at, event, user_id, payload, sent_at, status, attempts, next_attempt_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, 'pending', 0, ?2)
+		ON CONFLICT (id) DO NOTHING`,
+		arg.ID, sqliteNow(), arg.Event, arg.UserID, arg.Payload, sqliteTime(arg.SentAt),
+	)
+}
+
+// ClaimWebhookEvent func returns the oldest due event whose user has no earlier pending event (even one waiting for
+// a retry), so the events of a user are processed in the order they happened. it has no row lock to take, the
+// transaction holds the only writer until the event is completed or failed
+func (s *SQLite) ClaimWebhookEvent(ctx context.Context) (database.WebhookEvent, error) {
+	return scanWebhookEvent(s.q.QueryRowContext(ctx, `
+		SELECT `+sqliteWebhookEventColumns+` FROM webhook_events e
+		WHERE e.status = 'pending' AND e.next_attempt_at <= ?1
+		AND NOT EXISTS (
+			SELECT 1 FROM webhook_events earlier
+			WHERE earlier.user_id = e.user_id AND earlier.status = 'pending'
+			AND (earlier.sent_at, earlier.created_at) < (e.sent_at, e.created_at)
+		)
+		ORDER BY e.sent_at, e.created_at
+		LIMIT 1`,
+		sqliteNow(),
+	))
+}
+
+func (s *SQLite) CompleteWebhookEvent(ctx context.Context, id string) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE webhook_events
+		SET status = 'processed', attempts = attempts + 1, last_error = '', processed_at = ?2
+		WHERE id = ?1`,
+		id, sqliteNow(),
+	)
+	return err
+}
+
+func (s *SQLite) FailWebhookEvent(ctx context.Context, arg database.FailWebhookEventParams) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE webhook_events
+		SET status = ?2, attempts = attempts + 1, next_attempt_at = ?3, last_error = ?4
+		WHERE id = ?1`,
+		arg.ID, arg.Status, sqliteTime(arg.NextAttemptAt), arg.LastError,
+	)
+	return err
+}
+
+func (s *SQLite) GetWebhookEvent(ctx context.Context, id string) (database.WebhookEvent, error) {
+	return scanWebhookEvent(s.q.QueryRowContext(ctx, `SELECT `+sqliteWebhookEventColumns+` FROM webhook_events WHERE id = ?1`, id))
+}
+
+func (s *SQLite) GetWebhookEventsByStatus(ctx context.Context, arg database.GetWebhookEventsByStatusParams) ([]database.WebhookEvent, error) {
+	return sqliteQuery(ctx, s.q, scanWebhookEvent, `
+		SELECT `+sqliteWebhookEventColumns+` FROM webhook_events
+		WHERE status = ?1
+		ORDER BY created_at DESC, id
+		LIMIT ?2 OFFSET ?3`,
+		arg.Status, arg.Limit, arg.Offset,
+	)
+}
+
+// ReplayWebhookEvent func gives a failed event all its attempts back
+func (s *SQLite) ReplayWebhookEvent(ctx context.Context, id string) (database.WebhookEvent, error) {
+	return scanWebhookEvent(s.q.QueryRowContext(ctx, `
+		UPDATE webhook_events
+		SET status = 'pending', attempts = 0, next_attempt_at = ?2, last_error = ''
+		WHERE id = ?1 AND status = 'failed'
+		RETURNING `+sqliteWebhookEventColumns,
+		id, sqliteNow(),
+	))
+}
+
+// PurgeWebhookEvents func deletes the processed events created before createdAt, failed and pending events are kept
+// until they're processed
+func (s *SQLite) PurgeWebhookEvents(ctx context.Context, createdAt time.Time) (int64, error) {
+	return sqliteExecRows(ctx, s.q, `DELETE FROM webhook_events WHERE status = 'processed' AND created_at < ?1`,
+		sqliteTime(createdAt),
+	)
+}
+
+const sqliteSubscriptionColumns = `id, created_at, updated_at, user_id, plan, status, current_period_end, cancel_at,
+	last_event_at`
+
+func scanSubscription(row scanner) (database.Subscription, error) {
+	var i database.Subscription
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Plan,
+		&i.Status,
+		&i.CurrentPeriodEnd,
+		&i.CancelAt,
+		&i.LastEventAt,
+	)
+	return i, err
+}
+
+func (s *SQLite) GetSubscription(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+	return scanSubscription(s.q.QueryRowContext(ctx, `SELECT `+sqliteSubscriptionColumns+` FROM subscriptions WHERE user_id = ?1`, userID))
+}
+
+func (s *SQLite) UpsertSubscription(ctx context.Context, arg database.UpsertSubscriptionParams) (database.Subscription, error) {
+	return scanSubscription(s.q.QueryRowContext(ctx, `
+		INSERT INTO subscriptions(id, created_at, updated_at, user_id, plan, status, current_period_end, cancel_at,
+			last_event_at)
+		VALUES (?1, ?2, ?2, ?3, ?4, ?5, ?6, ?7, ?8)
+		ON CONFLICT (user_id) DO UPDATE
+		SET plan = excluded.plan, status = excluded.status, current_period_end = excluded.current_period_end,
+			cancel_at = excluded.cancel_at, last_event_at = excluded.last_event_at, updated_at = excluded.updated_at
+		RETURNING `+sqliteSubscriptionColumns,
+		uuid.New(), sqliteNow(), arg.UserID, arg.Plan, arg.Status, sqliteTime(arg.CurrentPeriodEnd),
+		sqliteNullTime(arg.CancelAt), sqliteTime(arg.LastEventAt),
+	))
+}
+
+// data exports
+
+func (s *SQLite) CreateDataExport(ctx context.Context, userID uuid.UUID) (database.CreateDataExportRow, error) {
+	var i database.CreateDataExportRow
+	err := s.q.QueryRowContext(ctx, `
+		INSERT INTO data_exports(id, created_at, user_id)
+		VALUES (?1, ?2, ?3)
+		RETURNING id, created_at, status, completed_at, expires_at`,
+		uuid.New(), sqliteNow(), userID,
+	).Scan(&i.ID, &i.CreatedAt, &i.Status, &i.CompletedAt, &i.ExpiresAt)
+	return i, err
+}
+
+func (s *SQLite) GetDataExports(ctx context.Context, userID uuid.UUID) ([]database.GetDataExportsRow, error) {
+	return sqliteQuery(ctx, s.q, func(row scanner) (database.GetDataExportsRow, error) {
+		var i database.GetDataExportsRow
+		err := row.Scan(&i.ID, &i.CreatedAt, &i.Status, &i.CompletedAt, &i.ExpiresAt)
+		return i, err
+	}, `
+		SELECT id, created_at, status, completed_at, expires_at FROM data_exports
+		WHERE user_id = ?1
+		ORDER BY created_at DESC, id`,
+		userID,
+	)
+}
+
+func (s *SQLite) GetDataExportArchive(ctx context.Context, arg database.GetDataExportArchiveParams) (database.GetDataExportArchiveRow, error) {
+	var i database.GetDataExportArchiveRow
+	err := s.q.QueryRowContext(ctx, `SELECT status, archive, expires_at FROM data_exports WHERE id = ?1 AND user_id = ?2`,
+		arg.ID, arg.UserID,
+	).Scan(&i.Status, &i.Archive, &i.ExpiresAt)
+	return i, err
+}
+
+// ClaimDataExports func leases the oldest pending exports until lease_until, so they aren't generated twice
+func (s *SQLite) ClaimDataExports(ctx context.Context, arg database.ClaimDataExportsParams) ([]database.ClaimDataExportsRow, error) {
+	return sqliteQuery(ctx, s.q, func(row scanner) (database.ClaimDataExportsRow, error) {
+		var i database.ClaimDataExportsRow
+		err := row.Scan(&i.ID, &i.UserID)
+		return i, err
+	}, `
+		UPDATE data_exports
+		SET lease_until = ?1
+		WHERE id IN (
+			SELECT id FROM data_exports
+			WHERE status = 'pending' AND (lease_until IS NULL OR lease_until <= ?2)
+			ORDER BY created_at
+			LIMIT ?3
+		)
+		RETURNING id, user_id`,
+		sqliteTime(arg.LeaseUntil), sqliteTime(arg.Now), arg.Limit,
+	)
+}
+
+func (s *SQLite) CompleteDataExport(ctx context.Context, arg database.CompleteDataExportParams) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE data_exports
+		SET status = ?2, archive = ?3, completed_at = ?5, expires_at = ?4
+		WHERE id = ?1`,
+		arg.ID, arg.Status, arg.Archive, sqliteNullTime(arg.ExpiresAt), sqliteNow(),
+	)
+	return err
+}
+
+func (s *SQLite) PurgeExpiredDataExports(ctx context.Context) (int64, error) {
+	return sqliteExecRows(ctx, s.q, `DELETE FROM data_exports WHERE expires_at <= ?1`, sqliteNow())
+}
+
+// ExportChirps func returns every chirp of the user, including the ones in the trash
+func (s *SQLite) ExportChirps(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error) {
+	return sqliteQuery(ctx, s.q, scanChirp, `
+		SELECT `+sqliteChirpColumns+` FROM chirps
+		WHERE user_id = ?1
+		ORDER BY created_at, id`,
+		userID,
+	)
+}
+
+func (s *SQLite) ExportFollowing(ctx context.Context, followerID uuid.UUID) ([]database.ExportFollowingRow, error) {
+	return sqliteQuery(ctx, s.q, func(row scanner) (database.ExportFollowingRow, error) {
+		var i database.ExportFollowingRow
+		err := row.Scan(&i.ID, &i.Handle, &i.CreatedAt)
+		return i, err
+	}, `
+		SELECT users.id, users.handle, follows.created_at FROM follows
+		JOIN users ON users.id = follows.followee_id
+		WHERE follows.follower_id = ?1
+		ORDER BY follows.created_at, users.id`,
+		followerID,
+	)
+}
+
+func (s *SQLite) ExportFollowers(ctx context.Context, followeeID uuid.UUID) ([]database.ExportFollowersRow, error) {
+	return sqliteQuery(ctx, s.q, func(row scanner) (database.ExportFollowersRow, error) {
+		var i database.ExportFollowersRow
+		err := row.Scan(&i.ID, &i.Handle, &i.CreatedAt)
+		return i, err
+	}, `
+		SELECT users.id, users.handle, follows.created_at FROM follows
+		JOIN users ON users.id = follows.follower_id
+		WHERE follows.followee_id = ?1
+		ORDER BY follows.created_at, users.id`,
+		followeeID,
+	)
+}
+
+func (s *SQLite) ExportBookmarks(ctx context.Context, userID uuid.UUID) ([]database.ExportBookmarksRow, error) {
+	return sqliteQuery(ctx, s.q, func(row scanner) (database.ExportBookmarksRow, error) {
+		var i database.ExportBookmarksRow
+		err := row.Scan(&i.Collection, &i.ChirpID, &i.CreatedAt)
+		return i, err
+	}, `
+		SELECT collections.name, bookmarks.chirp_id, bookmarks.created_at FROM bookmarks
+		JOIN collections ON collections.id = bookmarks.collection_id
+		WHERE collections.user_id = ?1
+		ORDER BY bookmarks.created_at, bookmarks.collection_id, bookmarks.chirp_id`,
+		userID,
+	)
+}
+
+func (s *SQLite) ExportPollVotes(ctx context.Context, userID uuid.UUID) ([]database.ExportPollVotesRow, error) {
+	return sqliteQuery(ctx, s.q, func(row scanner) (database.ExportPollVotesRow, error) {
+		var i database.ExportPollVotesRow
+		err := row.Scan(&i.ChirpID, &i.Option, &i.CreatedAt)
+		return i, err
+	}, `
+		SELECT polls.chirp_id, poll_options.text, poll_votes.created_at FROM poll_votes
+		JOIN polls ON polls.id = poll_votes.poll_id
+		JOIN poll_options ON poll_options.id = poll_votes.option_id
+		WHERE poll_votes.user_id = ?1
+		ORDER BY poll_votes.created_at, poll_votes.poll_id`,
+		userID,
+	)
+}
+
+func (s *SQLite) ExportNotifications(ctx context.Context, userID uuid.UUID) ([]database.Notification, error) {
+	return sqliteQuery(ctx, s.q, scanNotification, `
+		SELECT id, created_at, user_id, kind, chirp_id, read_at FROM notifications
+		WHERE user_id = ?1
+		ORDER BY created_at, id`,
+		userID,
+	)
+}
+
+func (s *SQLite) ExportUserIdentities(ctx context.Context, userID uuid.UUID) ([]database.UserIdentity, error) {
+	return sqliteQuery(ctx, s.q, func(row scanner) (database.UserIdentity, error) {
+		var i database.UserIdentity
+		err := row.Scan(&i.Provider, &i.Subject, &i.CreatedAt, &i.UserID, &i.Email)
+		return i, err
+	}, `
+		SELECT provider, subject, created_at, user_id, email FROM user_identities
+		WHERE user_id = ?1
+		ORDER BY created_at, provider, subject`,
+		userID,
+	)
+}
@@ -0,0 +1,58 @@
+-- +goose Up
+-- the sqlite schema of the store, it follows the postgres one.
+-- uuids are saved as text, and timestamps as UTC text with microseconds (2006-01-02 15:04:05.000000), both are
+-- made by the store since sqlite has no gen_random_uuid() or NOW()
+CREATE TABLE users(
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    email TEXT NOT NULL UNIQUE,
+    hashed_password TEXT NOT NULL,
+    handle TEXT,
+    display_name TEXT NOT NULL DEFAULT '',
+    bio TEXT NOT NULL DEFAULT '',
+    avatar_url TEXT NOT NULL DEFAULT '',
+    tokens_valid_after TIMESTAMP,
+    delete_after TIMESTAMP,
+    chirpy_red_until TIMESTAMP
+);
+
+-- handles are unique regardless of their case
+CREATE UNIQUE INDEX users_handle_lower_idx ON users(LOWER(handle));
+CREATE INDEX users_delete_after_idx ON users(delete_after) WHERE delete_after IS NOT NULL;
+
+CREATE TABLE roles(
+    name TEXT PRIMARY KEY
+);
+
+CREATE TABLE permissions(
+    name TEXT PRIMARY KEY
+);
+
+CREATE TABLE role_permissions(
+    role TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    permission TEXT NOT NULL REFERENCES permissions(name) ON DELETE CASCADE,
+    PRIMARY KEY(role, permission)
+);
+
+CREATE TABLE user_roles(
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY(user_id, role)
+);
+
+INSERT INTO roles(name) VALUES ('admin'), ('moderator');
+INSERT INTO permissions(name) VALUES ('chirps:delete_any'), ('users:manage'), ('webhooks:manage');
+INSERT INTO role_permissions(role, permission) VALUES
+    ('admin', 'chirps:delete_any'),
+    ('admin', 'users:manage'),
+    ('admin', 'webhooks:manage'),
+    ('moderator', 'chirps:delete_any');
+
+-- +goose Down
+DROP TABLE user_roles;
+DROP TABLE role_permissions;
+DROP TABLE permissions;
+DROP TABLE roles;
+DROP TABLE users;
@@ -0,0 +1,41 @@
+-- +goose Up
+CREATE TABLE chirps(
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    body TEXT NOT NULL,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    deleted_at TIMESTAMP
+);
+
+CREATE INDEX chirps_user_id_idx ON chirps(user_id);
+
+CREATE TABLE polls(
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    chirp_id TEXT NOT NULL UNIQUE REFERENCES chirps(id) ON DELETE CASCADE,
+    closes_at TIMESTAMP NOT NULL,
+    closed_notified_at TIMESTAMP
+);
+
+CREATE TABLE poll_options(
+    id TEXT PRIMARY KEY,
+    poll_id TEXT NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    text TEXT NOT NULL,
+    UNIQUE(poll_id, position)
+);
+
+CREATE TABLE poll_votes(
+    poll_id TEXT NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    option_id TEXT NOT NULL REFERENCES poll_options(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY(poll_id, user_id)
+);
+
+-- +goose Down
+DROP TABLE poll_votes;
+DROP TABLE poll_options;
+DROP TABLE polls;
+DROP TABLE chirps;
@@ -0,0 +1,8 @@
+-- +goose Up
+ALTER TABLE refresh_tokens ADD COLUMN grant_id TEXT;
+
+CREATE INDEX refresh_tokens_grant_id_idx ON refresh_tokens(grant_id);
+
+-- +goose Down
+DROP INDEX refresh_tokens_grant_id_idx;
+ALTER TABLE refresh_tokens DROP COLUMN grant_id;
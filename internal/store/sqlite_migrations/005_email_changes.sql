@@ -0,0 +1,20 @@
+-- +goose Up
+-- email changes waiting for a confirmation from the new address, the old address gets a link to undo them
+CREATE TABLE email_changes(
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    old_email TEXT NOT NULL,
+    new_email TEXT NOT NULL,
+    confirm_token_hash TEXT UNIQUE NOT NULL,
+    undo_token_hash TEXT UNIQUE NOT NULL,
+    expires_at TIMESTAMP NOT NULL, -- of the confirmation link
+    undo_expires_at TIMESTAMP NOT NULL,
+    confirmed_at TIMESTAMP,
+    undone_at TIMESTAMP
+);
+
+CREATE INDEX email_changes_user_id_idx ON email_changes(user_id);
+
+-- +goose Down
+DROP TABLE email_changes;
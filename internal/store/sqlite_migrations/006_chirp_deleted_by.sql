@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE chirps ADD COLUMN deleted_by TEXT;
+
+UPDATE chirps SET deleted_by = user_id WHERE deleted_at IS NOT NULL;
+
+-- +goose Down
+ALTER TABLE chirps DROP COLUMN deleted_by;
@@ -0,0 +1,24 @@
+-- +goose Up
+-- accounts at external OpenID Connect providers linked to a user
+CREATE TABLE user_identities(
+    provider TEXT NOT NULL, -- issuer of the provider
+    subject TEXT NOT NULL, -- id of the user at the provider
+    created_at TIMESTAMP NOT NULL,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    PRIMARY KEY (provider, subject)
+);
+
+-- pending logins, between the redirect to the provider and its callback
+CREATE TABLE oidc_logins(
+    state_hash TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    restore BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+-- +goose Down
+DROP TABLE oidc_logins;
+DROP TABLE user_identities;
@@ -0,0 +1,41 @@
+-- +goose Up
+CREATE TABLE follows(
+    follower_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    followee_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY(follower_id, followee_id),
+    CHECK(follower_id <> followee_id)
+);
+
+CREATE INDEX follows_followee_id_idx ON follows(followee_id);
+
+CREATE TABLE notifications(
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    chirp_id TEXT REFERENCES chirps(id) ON DELETE CASCADE,
+    read_at TIMESTAMP
+);
+
+CREATE INDEX notifications_user_id_idx ON notifications(user_id, created_at);
+
+-- personal access tokens
+CREATE TABLE api_tokens(
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT NOT NULL, -- json array
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX api_tokens_user_id_idx ON api_tokens(user_id);
+
+-- +goose Down
+DROP TABLE api_tokens;
+DROP TABLE notifications;
+DROP TABLE follows;
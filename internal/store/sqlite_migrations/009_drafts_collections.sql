@@ -0,0 +1,34 @@
+-- +goose Up
+CREATE TABLE chirp_drafts(
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    body TEXT NOT NULL,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    publish_at TIMESTAMP
+);
+
+CREATE INDEX chirp_drafts_user_id_idx ON chirp_drafts(user_id);
+CREATE INDEX chirp_drafts_publish_at_idx ON chirp_drafts(publish_at) WHERE publish_at IS NOT NULL;
+
+CREATE TABLE collections(
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    UNIQUE(user_id, name)
+);
+
+-- chirp_id has no foreign key on purpose: a bookmark outlives its chirp and shows up as unavailable
+CREATE TABLE bookmarks(
+    collection_id TEXT NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+    chirp_id TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY(collection_id, chirp_id)
+);
+
+-- +goose Down
+DROP TABLE bookmarks;
+DROP TABLE collections;
+DROP TABLE chirp_drafts;
@@ -0,0 +1,38 @@
+-- +goose Up
+CREATE TABLE oauth_clients(
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    redirect_uris TEXT NOT NULL, -- json array
+    secret_hash TEXT -- NULL for public clients (e.g. mobile or single page apps)
+);
+
+CREATE INDEX oauth_clients_user_id_idx ON oauth_clients(user_id);
+
+CREATE TABLE oauth_codes(
+    code_hash TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    client_id TEXT NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT NOT NULL, -- json array
+    code_challenge TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+
+-- sqlite can't add a foreign key to refresh_tokens.client_id, the trigger deletes the refresh tokens of a deleted
+-- client like ON DELETE CASCADE would
+-- +goose StatementBegin
+CREATE TRIGGER oauth_clients_delete_refresh_tokens AFTER DELETE ON oauth_clients
+BEGIN
+    DELETE FROM refresh_tokens WHERE client_id = OLD.id;
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TRIGGER oauth_clients_delete_refresh_tokens;
+DROP TABLE oauth_codes;
+DROP TABLE oauth_clients;
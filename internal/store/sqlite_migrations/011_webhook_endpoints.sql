@@ -0,0 +1,38 @@
+-- +goose Up
+CREATE TABLE webhook_endpoints(
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_id TEXT REFERENCES oauth_clients(id) ON DELETE CASCADE, -- the app that registered it, NULL for the user
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL, -- kept as is since every delivery is signed with it
+    events TEXT NOT NULL, -- json array
+    failure_count INTEGER NOT NULL DEFAULT 0, -- failed attempts in a row, the endpoint is disabled after too many
+    disabled_at TIMESTAMP
+);
+
+CREATE INDEX webhook_endpoints_user_id_idx ON webhook_endpoints(user_id);
+
+-- the deliveries of the events to the endpoints, both the queue of the sender and the log shown to the user
+CREATE TABLE webhook_deliveries(
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    endpoint_id TEXT NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+    event TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL, -- pending, delivered or failed
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_attempt_at TIMESTAMP,
+    response_status INTEGER, -- NULL when the endpoint couldn't be reached
+    last_error TEXT NOT NULL DEFAULT '',
+    delivered_at TIMESTAMP
+);
+
+CREATE INDEX webhook_deliveries_pending_idx ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX webhook_deliveries_endpoint_id_idx ON webhook_deliveries(endpoint_id, created_at);
+
+-- +goose Down
+DROP TABLE webhook_deliveries;
+DROP TABLE webhook_endpoints;
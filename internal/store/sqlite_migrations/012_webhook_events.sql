@@ -0,0 +1,35 @@
+-- +goose Up
+-- every polka event is stored when it's received and processed later by a worker, in order per user
+CREATE TABLE webhook_events(
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    event TEXT NOT NULL,
+    user_id TEXT, -- no foreign key, the event may be about a user that doesn't exist
+    payload TEXT NOT NULL,
+    sent_at TIMESTAMP NOT NULL,
+    status TEXT NOT NULL, -- pending, processed or failed
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    processed_at TIMESTAMP
+);
+
+CREATE INDEX webhook_events_pending_idx ON webhook_events(user_id, sent_at) WHERE status = 'pending';
+CREATE INDEX webhook_events_status_idx ON webhook_events(status, created_at);
+
+-- chirpy red subscriptions, updated from the polka events
+CREATE TABLE subscriptions(
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id TEXT NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    plan TEXT NOT NULL,
+    status TEXT NOT NULL, -- active, past_due or canceled
+    current_period_end TIMESTAMP NOT NULL,
+    cancel_at TIMESTAMP, -- a canceled subscription ends at this time
+    last_event_at TIMESTAMP NOT NULL -- the time of the last polka event applied to the subscription
+);
+
+-- +goose Down
+DROP TABLE subscriptions;
+DROP TABLE webhook_events;
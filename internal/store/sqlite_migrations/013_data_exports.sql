@@ -0,0 +1,18 @@
+-- +goose Up
+-- personal data exports, the archive is generated in the background
+CREATE TABLE data_exports(
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending', -- pending, ready or failed
+    archive BLOB, -- zip archive of json files, set once ready
+    completed_at TIMESTAMP,
+    expires_at TIMESTAMP, -- the archive is purged after this time
+    lease_until TIMESTAMP -- set while the archive is generated
+);
+
+-- a user has at most one export being generated
+CREATE UNIQUE INDEX data_exports_pending_idx ON data_exports(user_id) WHERE status = 'pending';
+
+-- +goose Down
+DROP TABLE data_exports;
@@ -0,0 +1,258 @@
+// Package store defines the data the handlers depend on, from the users and their chirps to the webhooks and the
+// data exports.
+// the methods match the queries generated by sqlc, so the postgres store is the sqlc code itself,
+// and the other stores have to behave like those queries (errors included: a missing row is sql.ErrNoRows)
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/database"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// ErrConflict is returned by the memory store when a change breaks a unique constraint
+var ErrConflict = errors.New("unique constraint violation")
+
+// Users are the accounts with their roles, their email changes, the provider accounts linked to them and who they
+// follow
+type Users interface {
+	CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error)
+	DeleteUsers(ctx context.Context) error
+	GetUserByEmail(ctx context.Context, email string) (database.User, error)
+	GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error)
+	UpdateUserEmail(ctx context.Context, arg database.UpdateUserEmailParams) (database.User, error)
+	ChangeUserPassword(ctx context.Context, arg database.ChangeUserPasswordParams) (database.User, error)
+	UpdateUserPassword(ctx context.Context, arg database.UpdateUserPasswordParams) error
+	UpdateUserProfile(ctx context.Context, arg database.UpdateUserProfileParams) (database.User, error)
+	GetProfileByHandle(ctx context.Context, handle string) (database.GetProfileByHandleRow, error)
+	GetAuthors(ctx context.Context, ids []uuid.UUID) ([]database.GetAuthorsRow, error)
+	GetUsers(ctx context.Context, arg database.GetUsersParams) ([]database.User, error)
+	DeleteUser(ctx context.Context, id uuid.UUID) (int64, error)
+	ScheduleUserDeletion(ctx context.Context, arg database.ScheduleUserDeletionParams) (database.User, error)
+	RestoreUser(ctx context.Context, id uuid.UUID) (database.User, error)
+	PurgeDeletedUsers(ctx context.Context) (int64, error)
+	SetTokensValidAfter(ctx context.Context, arg database.SetTokensValidAfterParams) error
+	SetChirpyRedUntil(ctx context.Context, arg database.SetChirpyRedUntilParams) error
+	GetTokensValidAfter(ctx context.Context, since time.Time) ([]database.GetTokensValidAfterRow, error)
+
+	GetUserRoles(ctx context.Context, userID uuid.UUID) ([]string, error)
+	GetUserPermissions(ctx context.Context, userID uuid.UUID) ([]string, error)
+	AssignUserRole(ctx context.Context, arg database.AssignUserRoleParams) error
+	RemoveUserRole(ctx context.Context, arg database.RemoveUserRoleParams) (int64, error)
+
+	CreateEmailChange(ctx context.Context, arg database.CreateEmailChangeParams) (database.EmailChange, error)
+	CancelEmailChanges(ctx context.Context, userID uuid.UUID) error
+	ConfirmEmailChange(ctx context.Context, confirmTokenHash string) (database.EmailChange, error)
+	UndoEmailChange(ctx context.Context, undoTokenHash string) (database.EmailChange, error)
+
+	CreateUserIdentity(ctx context.Context, arg database.CreateUserIdentityParams) error
+	GetUserByIdentity(ctx context.Context, arg database.GetUserByIdentityParams) (database.User, error)
+	CreateOIDCLogin(ctx context.Context, arg database.CreateOIDCLoginParams) error
+	UseOIDCLogin(ctx context.Context, stateHash string) (database.OidcLogin, error)
+
+	FollowUser(ctx context.Context, arg database.FollowUserParams) (int64, error)
+	UnfollowUser(ctx context.Context, arg database.UnfollowUserParams) (int64, error)
+}
+
+// Chirps are the chirps with their polls
+type Chirps interface {
+	CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error)
+	GetAllChirps(ctx context.Context, userID uuid.NullUUID) ([]database.Chirp, error)
+	GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error)
+	SoftDeleteChirp(ctx context.Context, arg database.SoftDeleteChirpParams) (int64, error)
+	GetTrashedChirps(ctx context.Context, arg database.GetTrashedChirpsParams) ([]database.Chirp, error)
+	RestoreChirp(ctx context.Context, arg database.RestoreChirpParams) (database.Chirp, error)
+	PurgeTrashedChirps(ctx context.Context, cutoff time.Time) (int64, error)
+
+	CreatePoll(ctx context.Context, arg database.CreatePollParams) (database.Poll, error)
+	CreatePollOption(ctx context.Context, arg database.CreatePollOptionParams) (database.PollOption, error)
+	GetPollByChirpID(ctx context.Context, chirpID uuid.UUID) (database.Poll, error)
+	GetPollsByChirpIDs(ctx context.Context, chirpIds []uuid.UUID) ([]database.Poll, error)
+	GetPollOption(ctx context.Context, arg database.GetPollOptionParams) (database.PollOption, error)
+	GetPollResults(ctx context.Context, pollIds []uuid.UUID) ([]database.GetPollResultsRow, error)
+	GetUserPollVotes(ctx context.Context, arg database.GetUserPollVotesParams) ([]database.PollVote, error)
+	CreatePollVote(ctx context.Context, arg database.CreatePollVoteParams) (int64, error)
+	GetClosedPollsToNotify(ctx context.Context, arg database.GetClosedPollsToNotifyParams) ([]database.Poll, error)
+	MarkPollNotified(ctx context.Context, id uuid.UUID) error
+}
+
+// Drafts are the chirps the users haven't published yet, some of them scheduled
+type Drafts interface {
+	CreateChirpDraft(ctx context.Context, arg database.CreateChirpDraftParams) (database.ChirpDraft, error)
+	GetChirpDrafts(ctx context.Context, userID uuid.UUID) ([]database.ChirpDraft, error)
+	UpdateChirpDraft(ctx context.Context, arg database.UpdateChirpDraftParams) (database.ChirpDraft, error)
+	DeleteChirpDraft(ctx context.Context, arg database.DeleteChirpDraftParams) (int64, error)
+	GetDueChirpDrafts(ctx context.Context, arg database.GetDueChirpDraftsParams) ([]database.ChirpDraft, error)
+	DeletePublishedChirpDraft(ctx context.Context, id uuid.UUID) error
+	UnscheduleChirpDraft(ctx context.Context, id uuid.UUID) error
+}
+
+// Collections are the named lists of bookmarked chirps of the users
+type Collections interface {
+	CreateCollection(ctx context.Context, arg database.CreateCollectionParams) (database.Collection, error)
+	GetCollections(ctx context.Context, userID uuid.UUID) ([]database.Collection, error)
+	GetCollection(ctx context.Context, arg database.GetCollectionParams) (database.Collection, error)
+	RenameCollection(ctx context.Context, arg database.RenameCollectionParams) (database.Collection, error)
+	DeleteCollection(ctx context.Context, arg database.DeleteCollectionParams) (int64, error)
+	AddBookmark(ctx context.Context, arg database.AddBookmarkParams) error
+	RemoveBookmark(ctx context.Context, arg database.RemoveBookmarkParams) (int64, error)
+	GetBookmarks(ctx context.Context, arg database.GetBookmarksParams) ([]database.GetBookmarksRow, error)
+}
+
+// Notifications are what the users are told about, like the polls they voted on closing
+type Notifications interface {
+	NotifyPollVoters(ctx context.Context, pollID uuid.UUID) (int64, error)
+	GetNotifications(ctx context.Context, arg database.GetNotificationsParams) ([]database.Notification, error)
+	MarkNotificationsRead(ctx context.Context, userID uuid.UUID) error
+}
+
+// OAuthClients are the third-party apps registered by the users, with the authorization codes they're given
+type OAuthClients interface {
+	CreateOAuthClient(ctx context.Context, arg database.CreateOAuthClientParams) (database.OauthClient, error)
+	GetOAuthClient(ctx context.Context, id string) (database.OauthClient, error)
+	GetOAuthClientsByUser(ctx context.Context, userID uuid.UUID) ([]database.OauthClient, error)
+	GetOAuthClientGrants(ctx context.Context, clientID sql.NullString) ([]uuid.UUID, error)
+	DeleteOAuthClient(ctx context.Context, arg database.DeleteOAuthClientParams) (int64, error)
+	CreateOAuthCode(ctx context.Context, arg database.CreateOAuthCodeParams) error
+	UseOAuthCode(ctx context.Context, codeHash string) (database.OauthCode, error)
+}
+
+// RefreshTokens are the sessions of the users and the refresh tokens given to oauth clients,
+// with the access tokens revoked before they expire and the personal access tokens of the users
+type RefreshTokens interface {
+	CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error)
+	CreateOAuthRefreshToken(ctx context.Context, arg database.CreateOAuthRefreshTokenParams) (database.RefreshToken, error)
+	GetRefreshToken(ctx context.Context, token string) (database.RefreshToken, error)
+	UseRefreshToken(ctx context.Context, arg database.UseRefreshTokenParams) (database.RefreshToken, error)
+	SetRevokedAtToken(ctx context.Context, token string) error
+	RevokeOAuthRefreshToken(ctx context.Context, arg database.RevokeOAuthRefreshTokenParams) (int64, error)
+	UseOAuthRefreshToken(ctx context.Context, arg database.UseOAuthRefreshTokenParams) (database.RefreshToken, error)
+	RevokeOAuthGrant(ctx context.Context, grantID uuid.UUID) error
+	GetSessions(ctx context.Context, userID uuid.UUID) ([]database.RefreshToken, error)
+	RevokeSession(ctx context.Context, arg database.RevokeSessionParams) (int64, error)
+	RevokeOtherSessions(ctx context.Context, arg database.RevokeOtherSessionsParams) ([]uuid.UUID, error)
+	RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) error
+
+	CreateAPIToken(ctx context.Context, arg database.CreateAPITokenParams) (database.ApiToken, error)
+	GetAPITokens(ctx context.Context, userID uuid.UUID) ([]database.ApiToken, error)
+	GetValidAPIToken(ctx context.Context, tokenHash string) (database.ApiToken, error)
+	TouchAPIToken(ctx context.Context, id uuid.UUID) error
+	RevokeAPIToken(ctx context.Context, arg database.RevokeAPITokenParams) (int64, error)
+	RevokeUserAPITokens(ctx context.Context, userID uuid.UUID) error
+
+	RevokeToken(ctx context.Context, arg database.RevokeTokenParams) error
+	GetRevokedTokens(ctx context.Context) ([]database.RevokedToken, error)
+	PurgeRevokedTokens(ctx context.Context) error
+}
+
+// Webhooks queues the webhooks of the changes, in the transaction of the change
+type Webhooks interface {
+	CreateWebhookDeliveries(ctx context.Context, arg database.CreateWebhookDeliveriesParams) (int64, error)
+}
+
+// WebhookEndpoints are the urls the users send their events to, with the deliveries of the events queued for them
+type WebhookEndpoints interface {
+	CreateWebhookEndpoint(ctx context.Context, arg database.CreateWebhookEndpointParams) (database.WebhookEndpoint, error)
+	GetWebhookEndpoints(ctx context.Context, arg database.GetWebhookEndpointsParams) ([]database.WebhookEndpoint, error)
+	GetWebhookEndpoint(ctx context.Context, arg database.GetWebhookEndpointParams) (database.WebhookEndpoint, error)
+	UpdateWebhookEndpoint(ctx context.Context, arg database.UpdateWebhookEndpointParams) (database.WebhookEndpoint, error)
+	DeleteWebhookEndpoint(ctx context.Context, arg database.DeleteWebhookEndpointParams) (int64, error)
+	RecordWebhookEndpointSuccess(ctx context.Context, id uuid.UUID) error
+	RecordWebhookEndpointFailure(ctx context.Context, arg database.RecordWebhookEndpointFailureParams) (database.WebhookEndpoint, error)
+
+	ClaimWebhookDeliveries(ctx context.Context, arg database.ClaimWebhookDeliveriesParams) ([]database.ClaimWebhookDeliveriesRow, error)
+	CompleteWebhookDelivery(ctx context.Context, arg database.CompleteWebhookDeliveryParams) error
+	FailWebhookDelivery(ctx context.Context, arg database.FailWebhookDeliveryParams) error
+	GetWebhookDeliveries(ctx context.Context, arg database.GetWebhookDeliveriesParams) ([]database.WebhookDelivery, error)
+	PurgeWebhookDeliveries(ctx context.Context, createdAt time.Time) (int64, error)
+}
+
+// WebhookEvents are the events received from polka (the payment provider), queued until they're processed,
+// with the chirpy red subscriptions they update
+type WebhookEvents interface {
+	CreateWebhookEvent(ctx context.Context, arg database.CreateWebhookEventParams) (int64, error)
+	ClaimWebhookEvent(ctx context.Context) (database.WebhookEvent, error)
+	CompleteWebhookEvent(ctx context.Context, id string) error
+	FailWebhookEvent(ctx context.Context, arg database.FailWebhookEventParams) error
+	GetWebhookEvent(ctx context.Context, id string) (database.WebhookEvent, error)
+	GetWebhookEventsByStatus(ctx context.Context, arg database.GetWebhookEventsByStatusParams) ([]database.WebhookEvent, error)
+	ReplayWebhookEvent(ctx context.Context, id string) (database.WebhookEvent, error)
+	PurgeWebhookEvents(ctx context.Context, createdAt time.Time) (int64, error)
+
+	GetSubscription(ctx context.Context, userID uuid.UUID) (database.Subscription, error)
+	UpsertSubscription(ctx context.Context, arg database.UpsertSubscriptionParams) (database.Subscription, error)
+}
+
+// DataExports are the archives of their personal data the users ask for, with the queries that collect that data
+type DataExports interface {
+	CreateDataExport(ctx context.Context, userID uuid.UUID) (database.CreateDataExportRow, error)
+	GetDataExports(ctx context.Context, userID uuid.UUID) ([]database.GetDataExportsRow, error)
+	GetDataExportArchive(ctx context.Context, arg database.GetDataExportArchiveParams) (database.GetDataExportArchiveRow, error)
+	ClaimDataExports(ctx context.Context, arg database.ClaimDataExportsParams) ([]database.ClaimDataExportsRow, error)
+	CompleteDataExport(ctx context.Context, arg database.CompleteDataExportParams) error
+	PurgeExpiredDataExports(ctx context.Context) (int64, error)
+
+	ExportChirps(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error)
+	ExportFollowing(ctx context.Context, followerID uuid.UUID) ([]database.ExportFollowingRow, error)
+	ExportFollowers(ctx context.Context, followeeID uuid.UUID) ([]database.ExportFollowersRow, error)
+	ExportBookmarks(ctx context.Context, userID uuid.UUID) ([]database.ExportBookmarksRow, error)
+	ExportPollVotes(ctx context.Context, userID uuid.UUID) ([]database.ExportPollVotesRow, error)
+	ExportNotifications(ctx context.Context, userID uuid.UUID) ([]database.Notification, error)
+	ExportUserIdentities(ctx context.Context, userID uuid.UUID) ([]database.UserIdentity, error)
+}
+
+// Store is every store the handlers depend on
+type Store interface {
+	Users
+	Chirps
+	Drafts
+	Collections
+	Notifications
+	OAuthClients
+	RefreshTokens
+	Webhooks
+	WebhookEndpoints
+	WebhookEvents
+	DataExports
+
+	// InTx runs fn in a transaction, the changes made through tx are only kept if fn returns nil.
+	// fn must only use tx, the store itself may be locked until fn returns. called on a store bound to a
+	// transaction, fn runs in a savepoint: when it fails only its own changes are undone
+	InTx(ctx context.Context, fn func(tx Store) error) error
+}
+
+// inSavepoint func runs fn in a savepoint of the transaction tx, the changes of fn are rolled back if it fails
+// while the transaction goes on
+func inSavepoint(ctx context.Context, tx database.DBTX, fn func() error) error {
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT store_tx"); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		if _, rollbackErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT store_tx"); rollbackErr != nil {
+			return errors.Join(err, rollbackErr)
+		}
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT store_tx")
+	return err
+}
+
+// IsConflict func reports whether err comes from a unique constraint, of postgres or of another store
+func IsConflict(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	}
+	return errors.Is(err, ErrConflict)
+}
@@ -0,0 +1,1582 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/database"
+	_ "github.com/lib/pq"
+)
+
+func TestMemory(t *testing.T) {
+	testStore(t, func(t *testing.T) Store { return NewMemory() })
+}
+
+func TestSQLite(t *testing.T) {
+	testStore(t, func(t *testing.T) Store {
+		s, err := OpenSQLite(context.Background(), filepath.Join(t.TempDir(), "chirpy.db"))
+		if err != nil {
+			t.Fatalf("OpenSQLite() error = %v", err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+// TestPostgres runs against the migrated database of TEST_DB_URL, every user in it is deleted
+func TestPostgres(t *testing.T) {
+	dbURL := os.Getenv("TEST_DB_URL")
+	if dbURL == "" && os.Getenv("CI") != "" {
+		t.Fatal("TEST_DB_URL must be set in ci, the postgres store would never be tested")
+	}
+	if dbURL == "" {
+		t.Skip("TEST_DB_URL isn't set")
+	}
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("couldn't open the database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	testStore(t, func(t *testing.T) Store {
+		s := NewPostgres(db)
+		if err := s.DeleteUsers(context.Background()); err != nil {
+			t.Fatalf("couldn't empty the database: %v", err)
+		}
+		return s
+	})
+}
+
+// testStore func runs the conformance tests, every store has to behave like the postgres one.
+// newStore returns a store without users
+func testStore(t *testing.T, newStore func(t *testing.T) Store) {
+	ctx := context.Background()
+
+	createUser := func(t *testing.T, s Store) database.User {
+		t.Helper()
+		user, err := s.CreateUser(ctx, database.CreateUserParams{
+			Email:          uuid.NewString() + "@example.com",
+			HashedPassword: "hash",
+		})
+		if err != nil {
+			t.Fatalf("CreateUser() error = %v", err)
+		}
+		return user
+	}
+	createChirp := func(t *testing.T, s Store, userID uuid.UUID, body string) database.Chirp {
+		t.Helper()
+		chirp, err := s.CreateChirp(ctx, database.CreateChirpParams{Body: body, UserID: userID})
+		if err != nil {
+			t.Fatalf("CreateChirp() error = %v", err)
+		}
+		return chirp
+	}
+	createSession := func(t *testing.T, s Store, userID uuid.UUID, expiresAt time.Time) database.RefreshToken {
+		t.Helper()
+		session, err := s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+			Token:     uuid.NewString(),
+			UserID:    userID,
+			ExpiresAt: expiresAt,
+			UserAgent: "test",
+			Ip:        "192.0.2.1",
+		})
+		if err != nil {
+			t.Fatalf("CreateRefreshToken() error = %v", err)
+		}
+		return session
+	}
+
+	t.Run("Users", func(t *testing.T) {
+		s := newStore(t)
+		user := createUser(t, s)
+		if user.ID == uuid.Nil || user.CreatedAt.IsZero() || user.Handle.Valid || user.DeleteAfter.Valid {
+			t.Fatalf("CreateUser() = %+v, want a new user without handle", user)
+		}
+		if _, err := s.CreateUser(ctx, database.CreateUserParams{Email: user.Email, HashedPassword: "hash"}); !IsConflict(err) {
+			t.Errorf("CreateUser() with a taken email error = %v, want a conflict", err)
+		}
+
+		if got, err := s.GetUserByEmail(ctx, user.Email); err != nil || got.ID != user.ID {
+			t.Errorf("GetUserByEmail() = %v, %v, want the user", got.ID, err)
+		}
+		if got, err := s.GetUserByID(ctx, user.ID); err != nil || got.Email != user.Email {
+			t.Errorf("GetUserByID() = %v, %v, want the user", got.Email, err)
+		}
+		if _, err := s.GetUserByID(ctx, uuid.New()); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetUserByID() of a missing user error = %v, want sql.ErrNoRows", err)
+		}
+
+		changed, err := s.ChangeUserPassword(ctx, database.ChangeUserPasswordParams{ID: user.ID, HashedPassword: "new hash"})
+		if err != nil || changed.HashedPassword != "new hash" || changed.UpdatedAt.Before(user.UpdatedAt) {
+			t.Errorf("ChangeUserPassword() = %+v, %v, want the new hash", changed, err)
+		}
+		if err := s.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{ID: user.ID, HashedPassword: "rehashed"}); err != nil {
+			t.Errorf("UpdateUserPassword() error = %v", err)
+		}
+		if got, _ := s.GetUserByID(ctx, user.ID); got.HashedPassword != "rehashed" || !got.UpdatedAt.Equal(changed.UpdatedAt) {
+			t.Errorf("UpdateUserPassword() left %+v, want the new hash with the same updated_at", got)
+		}
+
+		newEmail := uuid.NewString() + "@example.com"
+		if updated, err := s.UpdateUserEmail(ctx, database.UpdateUserEmailParams{ID: user.ID, Email: newEmail}); err != nil || updated.Email != newEmail {
+			t.Errorf("UpdateUserEmail() = %+v, %v, want the new email", updated, err)
+		}
+		taken := createUser(t, s)
+		if _, err := s.UpdateUserEmail(ctx, database.UpdateUserEmailParams{ID: taken.ID, Email: newEmail}); !IsConflict(err) {
+			t.Errorf("UpdateUserEmail() with a taken email error = %v, want a conflict", err)
+		}
+		if _, err := s.DeleteUser(ctx, taken.ID); err != nil {
+			t.Fatalf("DeleteUser() error = %v", err)
+		}
+
+		profile := database.UpdateUserProfileParams{
+			Handle:      sql.NullString{String: "Alice", Valid: true},
+			DisplayName: "Alice",
+			Bio:         "hello",
+			ID:          user.ID,
+		}
+		if updated, err := s.UpdateUserProfile(ctx, profile); err != nil || updated.Handle.String != "Alice" || updated.Bio != "hello" {
+			t.Errorf("UpdateUserProfile() = %+v, %v, want the profile", updated, err)
+		}
+		other := createUser(t, s)
+		profile.ID = other.ID
+		profile.Handle.String = "alice"
+		if _, err := s.UpdateUserProfile(ctx, profile); !IsConflict(err) {
+			t.Errorf("UpdateUserProfile() with a taken handle error = %v, want a conflict", err)
+		}
+		profile.ID = uuid.New()
+		profile.Handle.String = "bob"
+		if _, err := s.UpdateUserProfile(ctx, profile); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("UpdateUserProfile() of a missing user error = %v, want sql.ErrNoRows", err)
+		}
+
+		createChirp(t, s, user.ID, "first")
+		deleted := createChirp(t, s, user.ID, "second")
+		if _, err := s.SoftDeleteChirp(ctx, database.SoftDeleteChirpParams{ID: deleted.ID, DeletedBy: user.ID}); err != nil {
+			t.Fatalf("SoftDeleteChirp() error = %v", err)
+		}
+		if got, err := s.GetProfileByHandle(ctx, "ALICE"); err != nil || got.ID != user.ID || got.ChirpsCount != 1 {
+			t.Errorf("GetProfileByHandle() = %+v, %v, want the profile with 1 chirp", got, err)
+		}
+		if _, err := s.GetProfileByHandle(ctx, "nobody"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetProfileByHandle() of a missing handle error = %v, want sql.ErrNoRows", err)
+		}
+
+		authors, err := s.GetAuthors(ctx, []uuid.UUID{user.ID, other.ID, uuid.New()})
+		if err != nil || len(authors) != 2 {
+			t.Errorf("GetAuthors() = %+v, %v, want the 2 users", authors, err)
+		}
+
+		users, err := s.GetUsers(ctx, database.GetUsersParams{Limit: 10, Offset: 0})
+		if err != nil || len(users) != 2 || users[0].ID != user.ID || users[1].ID != other.ID {
+			t.Errorf("GetUsers() = %+v, %v, want the users by creation", users, err)
+		}
+		if users, err := s.GetUsers(ctx, database.GetUsersParams{Limit: 10, Offset: 1}); err != nil || len(users) != 1 || users[0].ID != other.ID {
+			t.Errorf("GetUsers() from offset 1 = %+v, %v, want the second user", users, err)
+		}
+
+		if deleted, err := s.DeleteUser(ctx, other.ID); err != nil || deleted != 1 {
+			t.Errorf("DeleteUser() = %v, %v, want 1", deleted, err)
+		}
+		if deleted, err := s.DeleteUser(ctx, other.ID); err != nil || deleted != 0 {
+			t.Errorf("DeleteUser() of a deleted user = %v, %v, want 0", deleted, err)
+		}
+	})
+
+	t.Run("Deleting a user deletes their data", func(t *testing.T) {
+		s := newStore(t)
+		user := createUser(t, s)
+		chirp := createChirp(t, s, user.ID, "chirp")
+		session := createSession(t, s, user.ID, time.Now().UTC().Add(time.Hour))
+
+		if _, err := s.DeleteUser(ctx, user.ID); err != nil {
+			t.Fatalf("DeleteUser() error = %v", err)
+		}
+		if _, err := s.GetChirp(ctx, chirp.ID); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetChirp() error = %v, want the chirp deleted with the user", err)
+		}
+		if _, err := s.GetRefreshToken(ctx, session.Token); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetRefreshToken() error = %v, want the session deleted with the user", err)
+		}
+
+		createUser(t, s)
+		if err := s.DeleteUsers(ctx); err != nil {
+			t.Fatalf("DeleteUsers() error = %v", err)
+		}
+		if users, err := s.GetUsers(ctx, database.GetUsersParams{Limit: 10}); err != nil || len(users) != 0 {
+			t.Errorf("GetUsers() = %+v, %v, want no user left", users, err)
+		}
+	})
+
+	t.Run("Restore and purge deleted users", func(t *testing.T) {
+		s := newStore(t)
+		user := createUser(t, s)
+		if _, err := s.RestoreUser(ctx, user.ID); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("RestoreUser() of a user that isn't deleted error = %v, want sql.ErrNoRows", err)
+		}
+		if purged, err := s.PurgeDeletedUsers(ctx); err != nil || purged != 0 {
+			t.Errorf("PurgeDeletedUsers() = %v, %v, want 0", purged, err)
+		}
+
+		deleteAfter := sql.NullTime{Time: time.Now().UTC().Add(time.Hour).Truncate(time.Microsecond), Valid: true}
+		scheduled, err := s.ScheduleUserDeletion(ctx, database.ScheduleUserDeletionParams{ID: user.ID, DeleteAfter: deleteAfter})
+		if err != nil || !scheduled.DeleteAfter.Valid || !scheduled.DeleteAfter.Time.Equal(deleteAfter.Time) {
+			t.Fatalf("ScheduleUserDeletion() = %+v, %v, want deleted after %v", scheduled.DeleteAfter, err, deleteAfter.Time)
+		}
+		if _, err := s.ScheduleUserDeletion(ctx, database.ScheduleUserDeletionParams{ID: user.ID, DeleteAfter: deleteAfter}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("ScheduleUserDeletion() of a user already scheduled error = %v, want sql.ErrNoRows", err)
+		}
+		if restored, err := s.RestoreUser(ctx, user.ID); err != nil || restored.DeleteAfter.Valid {
+			t.Errorf("RestoreUser() = %+v, %v, want the deletion cancelled", restored.DeleteAfter, err)
+		}
+
+		expired := sql.NullTime{Time: time.Now().UTC().Add(-time.Minute), Valid: true}
+		if _, err := s.ScheduleUserDeletion(ctx, database.ScheduleUserDeletionParams{ID: user.ID, DeleteAfter: expired}); err != nil {
+			t.Fatalf("ScheduleUserDeletion() error = %v", err)
+		}
+		if _, err := s.RestoreUser(ctx, user.ID); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("RestoreUser() after the grace period error = %v, want sql.ErrNoRows", err)
+		}
+		if purged, err := s.PurgeDeletedUsers(ctx); err != nil || purged != 1 {
+			t.Errorf("PurgeDeletedUsers() = %v, %v, want 1", purged, err)
+		}
+	})
+
+	t.Run("Email changes", func(t *testing.T) {
+		s := newStore(t)
+		user := createUser(t, s)
+		createChange := func(t *testing.T, token string, expiresAt time.Time) database.EmailChange {
+			t.Helper()
+			change, err := s.CreateEmailChange(ctx, database.CreateEmailChangeParams{
+				UserID:           user.ID,
+				OldEmail:         user.Email,
+				NewEmail:         "new-" + user.Email,
+				ConfirmTokenHash: "confirm-" + token,
+				UndoTokenHash:    "undo-" + token,
+				ExpiresAt:        expiresAt,
+				UndoExpiresAt:    expiresAt.Add(time.Hour),
+			})
+			if err != nil {
+				t.Fatalf("CreateEmailChange() error = %v", err)
+			}
+			return change
+		}
+		later := time.Now().UTC().Add(time.Hour)
+
+		cancelled := createChange(t, "cancelled", later)
+		if cancelled.ID == uuid.Nil || cancelled.UserID != user.ID || cancelled.ConfirmedAt.Valid || cancelled.UndoneAt.Valid {
+			t.Fatalf("CreateEmailChange() = %+v, want a pending change of the user", cancelled)
+		}
+		if _, err := s.CreateEmailChange(ctx, database.CreateEmailChangeParams{
+			UserID:           user.ID,
+			ConfirmTokenHash: cancelled.ConfirmTokenHash,
+			UndoTokenHash:    "undo-other",
+			ExpiresAt:        later,
+			UndoExpiresAt:    later,
+		}); !IsConflict(err) {
+			t.Errorf("CreateEmailChange() with a taken token error = %v, want a conflict", err)
+		}
+		if err := s.CancelEmailChanges(ctx, user.ID); err != nil {
+			t.Fatalf("CancelEmailChanges() error = %v", err)
+		}
+		if _, err := s.ConfirmEmailChange(ctx, cancelled.ConfirmTokenHash); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("ConfirmEmailChange() of a cancelled change error = %v, want sql.ErrNoRows", err)
+		}
+
+		change := createChange(t, "confirmed", later)
+		confirmed, err := s.ConfirmEmailChange(ctx, change.ConfirmTokenHash)
+		if err != nil || confirmed.ID != change.ID || !confirmed.ConfirmedAt.Valid {
+			t.Fatalf("ConfirmEmailChange() = %+v, %v, want the change confirmed", confirmed, err)
+		}
+		if _, err := s.ConfirmEmailChange(ctx, change.ConfirmTokenHash); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("ConfirmEmailChange() of a confirmed change error = %v, want sql.ErrNoRows", err)
+		}
+		if err := s.CancelEmailChanges(ctx, user.ID); err != nil {
+			t.Fatalf("CancelEmailChanges() error = %v", err)
+		}
+		// a confirmed change isn't cancelled, it can still be undone
+		undone, err := s.UndoEmailChange(ctx, change.UndoTokenHash)
+		if err != nil || undone.ID != change.ID || !undone.ConfirmedAt.Valid || !undone.UndoneAt.Valid {
+			t.Fatalf("UndoEmailChange() = %+v, %v, want the confirmed change undone", undone, err)
+		}
+		if _, err := s.UndoEmailChange(ctx, change.UndoTokenHash); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("UndoEmailChange() of an undone change error = %v, want sql.ErrNoRows", err)
+		}
+
+		expired := createChange(t, "expired", time.Now().UTC().Add(-2*time.Hour))
+		if _, err := s.ConfirmEmailChange(ctx, expired.ConfirmTokenHash); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("ConfirmEmailChange() of an expired change error = %v, want sql.ErrNoRows", err)
+		}
+		if _, err := s.UndoEmailChange(ctx, expired.UndoTokenHash); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("UndoEmailChange() of an expired change error = %v, want sql.ErrNoRows", err)
+		}
+	})
+
+	t.Run("Identities", func(t *testing.T) {
+		s := newStore(t)
+		user := createUser(t, s)
+		identity := database.GetUserByIdentityParams{Provider: "https://idp.example.com", Subject: "subject-1"}
+		if _, err := s.GetUserByIdentity(ctx, identity); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("GetUserByIdentity() of an unlinked account error = %v, want sql.ErrNoRows", err)
+		}
+		link := database.CreateUserIdentityParams{Provider: identity.Provider, Subject: identity.Subject, UserID: user.ID, Email: user.Email}
+		if err := s.CreateUserIdentity(ctx, link); err != nil {
+			t.Fatalf("CreateUserIdentity() error = %v", err)
+		}
+		if err := s.CreateUserIdentity(ctx, link); !IsConflict(err) {
+			t.Errorf("CreateUserIdentity() of a linked account error = %v, want a conflict", err)
+		}
+		if got, err := s.GetUserByIdentity(ctx, identity); err != nil || got.ID != user.ID {
+			t.Errorf("GetUserByIdentity() = %v, %v, want user %v", got.ID, err, user.ID)
+		}
+
+		if err := s.CreateOIDCLogin(ctx, database.CreateOIDCLoginParams{
+			StateHash: "state", Nonce: "nonce", CodeVerifier: "verifier", ExpiresAt: time.Now().UTC().Add(time.Minute), Restore: true,
+		}); err != nil {
+			t.Fatalf("CreateOIDCLogin() error = %v", err)
+		}
+		if err := s.CreateOIDCLogin(ctx, database.CreateOIDCLoginParams{
+			StateHash: "expired", Nonce: "nonce", CodeVerifier: "verifier", ExpiresAt: time.Now().UTC().Add(-time.Minute),
+		}); err != nil {
+			t.Fatalf("CreateOIDCLogin() error = %v", err)
+		}
+		if login, err := s.UseOIDCLogin(ctx, "state"); err != nil || login.Nonce != "nonce" || !login.Restore {
+			t.Errorf("UseOIDCLogin() = %+v, %v, want the login", login, err)
+		}
+		if _, err := s.UseOIDCLogin(ctx, "state"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("UseOIDCLogin() a second time error = %v, want sql.ErrNoRows", err)
+		}
+		if _, err := s.UseOIDCLogin(ctx, "expired"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("UseOIDCLogin() of an expired login error = %v, want sql.ErrNoRows", err)
+		}
+
+		if _, err := s.DeleteUser(ctx, user.ID); err != nil {
+			t.Fatalf("DeleteUser() error = %v", err)
+		}
+		if _, err := s.GetUserByIdentity(ctx, identity); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetUserByIdentity() after deleting the user error = %v, want sql.ErrNoRows", err)
+		}
+	})
+
+	t.Run("Roles", func(t *testing.T) {
+		s := newStore(t)
+		user := createUser(t, s)
+		for _, role := range []string{"moderator", "admin", "admin"} {
+			if err := s.AssignUserRole(ctx, database.AssignUserRoleParams{UserID: user.ID, Role: role}); err != nil {
+				t.Fatalf("AssignUserRole(%v) error = %v", role, err)
+			}
+		}
+		if err := s.AssignUserRole(ctx, database.AssignUserRoleParams{UserID: user.ID, Role: "owner"}); err == nil {
+			t.Error("AssignUserRole() of an unknown role succeeded")
+		}
+		if err := s.AssignUserRole(ctx, database.AssignUserRoleParams{UserID: uuid.New(), Role: "admin"}); err == nil {
+			t.Error("AssignUserRole() to a missing user succeeded")
+		}
+
+		if roles, err := s.GetUserRoles(ctx, user.ID); err != nil || !slices.Equal(roles, []string{"admin", "moderator"}) {
+			t.Errorf("GetUserRoles() = %v, %v, want [admin moderator]", roles, err)
+		}
+		permissions, err := s.GetUserPermissions(ctx, user.ID)
+		if err != nil || !slices.Equal(permissions, []string{"chirps:delete_any", "users:manage", "webhooks:manage"}) {
+			t.Errorf("GetUserPermissions() = %v, %v, want the distinct permissions of the roles", permissions, err)
+		}
+
+		if removed, err := s.RemoveUserRole(ctx, database.RemoveUserRoleParams{UserID: user.ID, Role: "admin"}); err != nil || removed != 1 {
+			t.Errorf("RemoveUserRole() = %v, %v, want 1", removed, err)
+		}
+		if removed, err := s.RemoveUserRole(ctx, database.RemoveUserRoleParams{UserID: user.ID, Role: "admin"}); err != nil || removed != 0 {
+			t.Errorf("RemoveUserRole() of a removed role = %v, %v, want 0", removed, err)
+		}
+		if permissions, err := s.GetUserPermissions(ctx, user.ID); err != nil || !slices.Equal(permissions, []string{"chirps:delete_any"}) {
+			t.Errorf("GetUserPermissions() = %v, %v, want the permissions of the moderator", permissions, err)
+		}
+	})
+
+	t.Run("Follows", func(t *testing.T) {
+		s := newStore(t)
+		user := createUser(t, s)
+		followee := createUser(t, s)
+		profile := database.UpdateUserProfileParams{ID: followee.ID, Handle: sql.NullString{String: "followee", Valid: true}}
+		if _, err := s.UpdateUserProfile(ctx, profile); err != nil {
+			t.Fatalf("UpdateUserProfile() error = %v", err)
+		}
+
+		follow := database.FollowUserParams{FollowerID: user.ID, FolloweeID: followee.ID}
+		if followed, err := s.FollowUser(ctx, follow); err != nil || followed != 1 {
+			t.Errorf("FollowUser() = %v, %v, want 1", followed, err)
+		}
+		if followed, err := s.FollowUser(ctx, follow); err != nil || followed != 0 {
+			t.Errorf("FollowUser() again = %v, %v, want 0", followed, err)
+		}
+		if _, err := s.FollowUser(ctx, database.FollowUserParams{FollowerID: user.ID, FolloweeID: user.ID}); err == nil {
+			t.Error("FollowUser() of themselves error = nil, want an error")
+		}
+		if got, err := s.GetProfileByHandle(ctx, "followee"); err != nil || got.FollowersCount != 1 || got.FollowingCount != 0 {
+			t.Errorf("GetProfileByHandle() = %+v, %v, want 1 follower", got, err)
+		}
+
+		unfollow := database.UnfollowUserParams{FollowerID: user.ID, FolloweeID: followee.ID}
+		if unfollowed, err := s.UnfollowUser(ctx, unfollow); err != nil || unfollowed != 1 {
+			t.Errorf("UnfollowUser() = %v, %v, want 1", unfollowed, err)
+		}
+		if unfollowed, err := s.UnfollowUser(ctx, unfollow); err != nil || unfollowed != 0 {
+			t.Errorf("UnfollowUser() again = %v, %v, want 0", unfollowed, err)
+		}
+
+		// the follows of a deleted user go with them
+		if _, err := s.FollowUser(ctx, follow); err != nil {
+			t.Fatalf("FollowUser() error = %v", err)
+		}
+		if _, err := s.DeleteUser(ctx, user.ID); err != nil {
+			t.Fatalf("DeleteUser() error = %v", err)
+		}
+		if got, err := s.GetProfileByHandle(ctx, "followee"); err != nil || got.FollowersCount != 0 {
+			t.Errorf("GetProfileByHandle() = %+v, %v, want no follower", got, err)
+		}
+	})
+
+	t.Run("Chirps", func(t *testing.T) {
+		s := newStore(t)
+		user := createUser(t, s)
+		other := createUser(t, s)
+		if _, err := s.CreateChirp(ctx, database.CreateChirpParams{Body: "chirp", UserID: uuid.New()}); err == nil {
+			t.Error("CreateChirp() of a missing user succeeded")
+		}
+		first := createChirp(t, s, user.ID, "first")
+		second := createChirp(t, s, other.ID, "second")
+		third := createChirp(t, s, user.ID, "third")
+
+		ids := func(chirps []database.Chirp) []uuid.UUID {
+			res := []uuid.UUID{}
+			for _, chirp := range chirps {
+				res = append(res, chirp.ID)
+			}
+			return res
+		}
+		if chirps, err := s.GetAllChirps(ctx, uuid.NullUUID{}); err != nil || !slices.Equal(ids(chirps), []uuid.UUID{first.ID, second.ID, third.ID}) {
+			t.Errorf("GetAllChirps() = %v, %v, want every chirp by creation", ids(chirps), err)
+		}
+		if chirps, err := s.GetAllChirps(ctx, uuid.NullUUID{UUID: user.ID, Valid: true}); err != nil || !slices.Equal(ids(chirps), []uuid.UUID{first.ID, third.ID}) {
+			t.Errorf("GetAllChirps() of the user = %v, %v, want their chirps", ids(chirps), err)
+		}
+		if chirp, err := s.GetChirp(ctx, first.ID); err != nil || chirp.Body != "first" || chirp.UserID != user.ID {
+			t.Errorf("GetChirp() = %+v, %v, want the chirp", chirp, err)
+		}
+
+		if deleted, err := s.SoftDeleteChirp(ctx, database.SoftDeleteChirpParams{ID: first.ID, DeletedBy: user.ID}); err != nil || deleted != 1 {
+			t.Errorf("SoftDeleteChirp() = %v, %v, want 1", deleted, err)
+		}
+		if deleted, err := s.SoftDeleteChirp(ctx, database.SoftDeleteChirpParams{ID: first.ID, DeletedBy: user.ID}); err != nil || deleted != 0 {
+			t.Errorf("SoftDeleteChirp() of a deleted chirp = %v, %v, want 0", deleted, err)
+		}
+		if _, err := s.GetChirp(ctx, first.ID); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetChirp() of a deleted chirp error = %v, want sql.ErrNoRows", err)
+		}
+		if chirps, err := s.GetAllChirps(ctx, uuid.NullUUID{}); err != nil || !slices.Equal(ids(chirps), []uuid.UUID{second.ID, third.ID}) {
+			t.Errorf("GetAllChirps() = %v, %v, want the chirps that aren't deleted", ids(chirps), err)
+		}
+
+		now := time.Now().UTC()
+		trashed, err := s.GetTrashedChirps(ctx, database.GetTrashedChirpsParams{UserID: user.ID, Cutoff: now.Add(-time.Hour)})
+		if err != nil || !slices.Equal(ids(trashed), []uuid.UUID{first.ID}) || !trashed[0].DeletedAt.Valid {
+			t.Errorf("GetTrashedChirps() = %+v, %v, want the deleted chirp", trashed, err)
+		}
+		if trashed, err := s.GetTrashedChirps(ctx, database.GetTrashedChirpsParams{UserID: user.ID, Cutoff: now.Add(time.Hour)}); err != nil || len(trashed) != 0 {
+			t.Errorf("GetTrashedChirps() after the cutoff = %+v, %v, want none", trashed, err)
+		}
+		if _, err := s.RestoreChirp(ctx, database.RestoreChirpParams{ID: first.ID, UserID: other.ID, Cutoff: now.Add(-time.Hour)}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("RestoreChirp() by another user error = %v, want sql.ErrNoRows", err)
+		}
+		restored, err := s.RestoreChirp(ctx, database.RestoreChirpParams{ID: first.ID, UserID: user.ID, Cutoff: now.Add(-time.Hour)})
+		if err != nil || restored.DeletedAt.Valid || restored.DeletedBy.Valid {
+			t.Errorf("RestoreChirp() = %+v, %v, want the chirp out of the trash", restored, err)
+		}
+
+		// a chirp removed by a moderator isn't in the trash of its author
+		if _, err := s.SoftDeleteChirp(ctx, database.SoftDeleteChirpParams{ID: second.ID, DeletedBy: user.ID}); err != nil {
+			t.Fatalf("SoftDeleteChirp() by a moderator error = %v", err)
+		}
+		if trashed, err := s.GetTrashedChirps(ctx, database.GetTrashedChirpsParams{UserID: other.ID, Cutoff: now.Add(-time.Hour)}); err != nil || len(trashed) != 0 {
+			t.Errorf("GetTrashedChirps() = %+v, %v, want no chirp removed by a moderator", trashed, err)
+		}
+		if _, err := s.RestoreChirp(ctx, database.RestoreChirpParams{ID: second.ID, UserID: other.ID, Cutoff: now.Add(-time.Hour)}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("RestoreChirp() of a chirp removed by a moderator error = %v, want sql.ErrNoRows", err)
+		}
+
+		if _, err := s.SoftDeleteChirp(ctx, database.SoftDeleteChirpParams{ID: third.ID, DeletedBy: user.ID}); err != nil {
+			t.Fatalf("SoftDeleteChirp() error = %v", err)
+		}
+		if purged, err := s.PurgeTrashedChirps(ctx, now.Add(-time.Hour)); err != nil || purged != 0 {
+			t.Errorf("PurgeTrashedChirps() before the cutoff = %v, %v, want 0", purged, err)
+		}
+		if purged, err := s.PurgeTrashedChirps(ctx, now.Add(time.Hour)); err != nil || purged != 2 { // the removed chirp too
+			t.Errorf("PurgeTrashedChirps() = %v, %v, want 2", purged, err)
+		}
+		if _, err := s.RestoreChirp(ctx, database.RestoreChirpParams{ID: third.ID, UserID: user.ID, Cutoff: now.Add(-time.Hour)}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("RestoreChirp() of a purged chirp error = %v, want sql.ErrNoRows", err)
+		}
+	})
+
+	t.Run("Polls", func(t *testing.T) {
+		s := newStore(t)
+		user := createUser(t, s)
+		voter := createUser(t, s)
+		chirp := createChirp(t, s, user.ID, "which one?")
+		closesAt := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+
+		poll, err := s.CreatePoll(ctx, database.CreatePollParams{ChirpID: chirp.ID, ClosesAt: closesAt})
+		if err != nil || poll.ChirpID != chirp.ID || !poll.ClosesAt.Equal(closesAt) {
+			t.Fatalf("CreatePoll() = %+v, %v, want the poll of the chirp", poll, err)
+		}
+		if _, err := s.CreatePoll(ctx, database.CreatePollParams{ChirpID: chirp.ID, ClosesAt: closesAt}); !IsConflict(err) {
+			t.Errorf("CreatePoll() of a chirp with a poll error = %v, want a conflict", err)
+		}
+		options := []database.PollOption{}
+		for idx, text := range []string{"yes", "no"} {
+			option, err := s.CreatePollOption(ctx, database.CreatePollOptionParams{PollID: poll.ID, Position: int32(idx), Text: text})
+			if err != nil {
+				t.Fatalf("CreatePollOption() error = %v", err)
+			}
+			options = append(options, option)
+		}
+
+		if got, err := s.GetPollByChirpID(ctx, chirp.ID); err != nil || got.ID != poll.ID {
+			t.Errorf("GetPollByChirpID() = %+v, %v, want the poll", got, err)
+		}
+		if polls, err := s.GetPollsByChirpIDs(ctx, []uuid.UUID{chirp.ID, uuid.New()}); err != nil || len(polls) != 1 || polls[0].ID != poll.ID {
+			t.Errorf("GetPollsByChirpIDs() = %+v, %v, want the poll", polls, err)
+		}
+		if _, err := s.GetPollOption(ctx, database.GetPollOptionParams{ID: options[1].ID, PollID: poll.ID}); err != nil {
+			t.Errorf("GetPollOption() error = %v", err)
+		}
+		if _, err := s.GetPollOption(ctx, database.GetPollOptionParams{ID: options[1].ID, PollID: uuid.New()}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetPollOption() of another poll error = %v, want sql.ErrNoRows", err)
+		}
+
+		vote := database.CreatePollVoteParams{PollID: poll.ID, UserID: voter.ID, OptionID: options[1].ID}
+		if voted, err := s.CreatePollVote(ctx, vote); err != nil || voted != 1 {
+			t.Errorf("CreatePollVote() = %v, %v, want 1", voted, err)
+		}
+		vote.OptionID = options[0].ID
+		if voted, err := s.CreatePollVote(ctx, vote); err != nil || voted != 0 {
+			t.Errorf("CreatePollVote() of a second vote = %v, %v, want 0", voted, err)
+		}
+
+		results, err := s.GetPollResults(ctx, []uuid.UUID{poll.ID})
+		if err != nil || len(results) != 2 || results[0].Text != "yes" || results[0].Votes != 0 || results[1].Text != "no" || results[1].Votes != 1 {
+			t.Errorf("GetPollResults() = %+v, %v, want the options by position with their votes", results, err)
+		}
+		votes, err := s.GetUserPollVotes(ctx, database.GetUserPollVotesParams{UserID: voter.ID, PollIds: []uuid.UUID{poll.ID}})
+		if err != nil || len(votes) != 1 || votes[0].OptionID != options[1].ID {
+			t.Errorf("GetUserPollVotes() = %+v, %v, want the vote", votes, err)
+		}
+
+		if _, err := s.SoftDeleteChirp(ctx, database.SoftDeleteChirpParams{ID: chirp.ID, DeletedBy: user.ID}); err != nil {
+			t.Fatalf("SoftDeleteChirp() error = %v", err)
+		}
+		if _, err := s.GetPollByChirpID(ctx, chirp.ID); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetPollByChirpID() of a deleted chirp error = %v, want sql.ErrNoRows", err)
+		}
+	})
+
+	t.Run("Drafts", func(t *testing.T) {
+		s := newStore(t)
+		user := createUser(t, s)
+		now := time.Now().UTC().Truncate(time.Microsecond)
+		create := func(t *testing.T, body string, publishAt sql.NullTime) database.ChirpDraft {
+			t.Helper()
+			draft, err := s.CreateChirpDraft(ctx, database.CreateChirpDraftParams{Body: body, UserID: user.ID, PublishAt: publishAt})
+			if err != nil {
+				t.Fatalf("CreateChirpDraft() error = %v", err)
+			}
+			return draft
+		}
+		unscheduled := create(t, "later", sql.NullTime{})
+		due := create(t, "due", sql.NullTime{Time: now.Add(-time.Minute), Valid: true})
+		create(t, "not yet", sql.NullTime{Time: now.Add(time.Hour), Valid: true})
+
+		if drafts, err := s.GetChirpDrafts(ctx, user.ID); err != nil || len(drafts) != 3 || drafts[0].ID != unscheduled.ID {
+			t.Errorf("GetChirpDrafts() = %+v, %v, want the 3 drafts in creation order", drafts, err)
+		}
+		updated, err := s.UpdateChirpDraft(ctx, database.UpdateChirpDraftParams{ID: unscheduled.ID, UserID: user.ID, Body: "now", PublishAt: sql.NullTime{Time: now.Add(-time.Hour), Valid: true}})
+		if err != nil || updated.Body != "now" || !updated.PublishAt.Time.Equal(now.Add(-time.Hour)) {
+			t.Errorf("UpdateChirpDraft() = %+v, %v, want the new body and time", updated, err)
+		}
+		if _, err := s.UpdateChirpDraft(ctx, database.UpdateChirpDraftParams{ID: unscheduled.ID, UserID: uuid.New(), Body: "stolen"}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("UpdateChirpDraft() of another user error = %v, want sql.ErrNoRows", err)
+		}
+
+		dueDrafts, err := s.GetDueChirpDrafts(ctx, database.GetDueChirpDraftsParams{Now: now, MaxDrafts: 10})
+		if err != nil || len(dueDrafts) != 2 || dueDrafts[0].ID != unscheduled.ID || dueDrafts[1].ID != due.ID {
+			t.Fatalf("GetDueChirpDrafts() = %+v, %v, want the 2 due drafts, the earliest first", dueDrafts, err)
+		}
+		if dueDrafts, err := s.GetDueChirpDrafts(ctx, database.GetDueChirpDraftsParams{Now: now, MaxDrafts: 1}); err != nil || len(dueDrafts) != 1 {
+			t.Errorf("GetDueChirpDrafts() = %+v, %v, want 1 draft", dueDrafts, err)
+		}
+		if err := s.UnscheduleChirpDraft(ctx, unscheduled.ID); err != nil {
+			t.Fatalf("UnscheduleChirpDraft() error = %v", err)
+		}
+		if err := s.DeletePublishedChirpDraft(ctx, due.ID); err != nil {
+			t.Fatalf("DeletePublishedChirpDraft() error = %v", err)
+		}
+		if dueDrafts, err := s.GetDueChirpDrafts(ctx, database.GetDueChirpDraftsParams{Now: now, MaxDrafts: 10}); err != nil || len(dueDrafts) != 0 {
+			t.Errorf("GetDueChirpDrafts() = %+v, %v, want none", dueDrafts, err)
+		}
+
+		if deleted, err := s.DeleteChirpDraft(ctx, database.DeleteChirpDraftParams{ID: unscheduled.ID, UserID: uuid.New()}); err != nil || deleted != 0 {
+			t.Errorf("DeleteChirpDraft() of another user = %v, %v, want 0", deleted, err)
+		}
+		if deleted, err := s.DeleteChirpDraft(ctx, database.DeleteChirpDraftParams{ID: unscheduled.ID, UserID: user.ID}); err != nil || deleted != 1 {
+			t.Errorf("DeleteChirpDraft() = %v, %v, want 1", deleted, err)
+		}
+		if drafts, err := s.GetChirpDrafts(ctx, user.ID); err != nil || len(drafts) != 1 {
+			t.Errorf("GetChirpDrafts() = %+v, %v, want 1 draft left", drafts, err)
+		}
+	})
+
+	t.Run("Collections", func(t *testing.T) {
+		s := newStore(t)
+		user := createUser(t, s)
+		reads, err := s.CreateCollection(ctx, database.CreateCollectionParams{UserID: user.ID, Name: "reads"})
+		if err != nil || reads.Name != "reads" {
+			t.Fatalf("CreateCollection() = %+v, %v, want the collection", reads, err)
+		}
+		if _, err := s.CreateCollection(ctx, database.CreateCollectionParams{UserID: user.ID, Name: "reads"}); !IsConflict(err) {
+			t.Errorf("CreateCollection() with a taken name error = %v, want a conflict", err)
+		}
+		later, err := s.CreateCollection(ctx, database.CreateCollectionParams{UserID: user.ID, Name: "later"})
+		if err != nil {
+			t.Fatalf("CreateCollection() error = %v", err)
+		}
+		if _, err := s.RenameCollection(ctx, database.RenameCollectionParams{ID: later.ID, UserID: user.ID, Name: "reads"}); !IsConflict(err) {
+			t.Errorf("RenameCollection() to a taken name error = %v, want a conflict", err)
+		}
+		if renamed, err := s.RenameCollection(ctx, database.RenameCollectionParams{ID: later.ID, UserID: user.ID, Name: "archive"}); err != nil || renamed.Name != "archive" {
+			t.Errorf("RenameCollection() = %+v, %v, want the new name", renamed, err)
+		}
+		if collections, err := s.GetCollections(ctx, user.ID); err != nil || len(collections) != 2 || collections[0].Name != "archive" {
+			t.Errorf("GetCollections() = %+v, %v, want the collections by name", collections, err)
+		}
+		if _, err := s.GetCollection(ctx, database.GetCollectionParams{ID: reads.ID, UserID: uuid.New()}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetCollection() of another user error = %v, want sql.ErrNoRows", err)
+		}
+
+		chirp := createChirp(t, s, user.ID, "bookmark me")
+		deleted := createChirp(t, s, user.ID, "gone")
+		for _, chirpID := range []uuid.UUID{chirp.ID, deleted.ID, deleted.ID} {
+			if err := s.AddBookmark(ctx, database.AddBookmarkParams{CollectionID: reads.ID, ChirpID: chirpID}); err != nil {
+				t.Fatalf("AddBookmark() error = %v", err)
+			}
+		}
+		if _, err := s.SoftDeleteChirp(ctx, database.SoftDeleteChirpParams{ID: deleted.ID, DeletedBy: user.ID}); err != nil {
+			t.Fatalf("SoftDeleteChirp() error = %v", err)
+		}
+		bookmarks, err := s.GetBookmarks(ctx, database.GetBookmarksParams{CollectionID: reads.ID, Limit: 10})
+		if err != nil || len(bookmarks) != 2 || bookmarks[0].ChirpID != deleted.ID || bookmarks[0].Available ||
+			bookmarks[1].ChirpID != chirp.ID || !bookmarks[1].Available || bookmarks[1].Body.String != "bookmark me" {
+			t.Fatalf("GetBookmarks() = %+v, %v, want the latest bookmark first, the deleted chirp unavailable", bookmarks, err)
+		}
+		if bookmarks, err := s.GetBookmarks(ctx, database.GetBookmarksParams{CollectionID: reads.ID, Limit: 10, Offset: 1}); err != nil || len(bookmarks) != 1 || bookmarks[0].ChirpID != chirp.ID {
+			t.Errorf("GetBookmarks() with an offset = %+v, %v, want the second bookmark", bookmarks, err)
+		}
+		if removed, err := s.RemoveBookmark(ctx, database.RemoveBookmarkParams{CollectionID: reads.ID, ChirpID: deleted.ID}); err != nil || removed != 1 {
+			t.Errorf("RemoveBookmark() = %v, %v, want 1", removed, err)
+		}
+		if removed, err := s.RemoveBookmark(ctx, database.RemoveBookmarkParams{CollectionID: reads.ID, ChirpID: deleted.ID}); err != nil || removed != 0 {
+			t.Errorf("RemoveBookmark() again = %v, %v, want 0", removed, err)
+		}
+
+		if deleted, err := s.DeleteCollection(ctx, database.DeleteCollectionParams{ID: reads.ID, UserID: user.ID}); err != nil || deleted != 1 {
+			t.Errorf("DeleteCollection() = %v, %v, want 1", deleted, err)
+		}
+		if bookmarks, err := s.GetBookmarks(ctx, database.GetBookmarksParams{CollectionID: reads.ID, Limit: 10}); err != nil || len(bookmarks) != 0 {
+			t.Errorf("GetBookmarks() of a deleted collection = %+v, %v, want none", bookmarks, err)
+		}
+	})
+
+	t.Run("Poll notifications", func(t *testing.T) {
+		s := newStore(t)
+		user := createUser(t, s)
+		voter := createUser(t, s)
+		chirp := createChirp(t, s, user.ID, "which one?")
+		open := createChirp(t, s, user.ID, "still open")
+
+		closed, err := s.CreatePoll(ctx, database.CreatePollParams{ChirpID: chirp.ID, ClosesAt: time.Now().UTC().Add(-time.Minute)})
+		if err != nil {
+			t.Fatalf("CreatePoll() error = %v", err)
+		}
+		if _, err := s.CreatePoll(ctx, database.CreatePollParams{ChirpID: open.ID, ClosesAt: time.Now().UTC().Add(time.Hour)}); err != nil {
+			t.Fatalf("CreatePoll() error = %v", err)
+		}
+		option, err := s.CreatePollOption(ctx, database.CreatePollOptionParams{PollID: closed.ID, Position: 0, Text: "yes"})
+		if err != nil {
+			t.Fatalf("CreatePollOption() error = %v", err)
+		}
+		if _, err := s.CreatePollVote(ctx, database.CreatePollVoteParams{PollID: closed.ID, UserID: voter.ID, OptionID: option.ID}); err != nil {
+			t.Fatalf("CreatePollVote() error = %v", err)
+		}
+
+		trashed := createChirp(t, s, user.ID, "in the trash")
+		if _, err := s.CreatePoll(ctx, database.CreatePollParams{ChirpID: trashed.ID, ClosesAt: time.Now().UTC().Add(-time.Minute)}); err != nil {
+			t.Fatalf("CreatePoll() error = %v", err)
+		}
+		if _, err := s.SoftDeleteChirp(ctx, database.SoftDeleteChirpParams{ID: trashed.ID, DeletedBy: user.ID}); err != nil {
+			t.Fatalf("SoftDeleteChirp() error = %v", err)
+		}
+
+		closedPolls := func(now time.Time) database.GetClosedPollsToNotifyParams {
+			return database.GetClosedPollsToNotifyParams{Now: now, MaxPolls: 10}
+		}
+		polls, err := s.GetClosedPollsToNotify(ctx, closedPolls(time.Now().UTC()))
+		if err != nil || len(polls) != 1 || polls[0].ID != closed.ID {
+			t.Fatalf("GetClosedPollsToNotify() = %+v, %v, want the closed poll without the one in the trash", polls, err)
+		}
+		// the polls are closed as of now, whatever the clock of the database
+		if polls, err := s.GetClosedPollsToNotify(ctx, closedPolls(time.Now().UTC().Add(2*time.Hour))); err != nil || len(polls) != 2 {
+			t.Errorf("GetClosedPollsToNotify() in 2 hours = %+v, %v, want both polls that aren't in the trash", polls, err)
+		}
+		if polls, err := s.GetClosedPollsToNotify(ctx, closedPolls(time.Now().UTC().Add(-2*time.Minute))); err != nil || len(polls) != 0 {
+			t.Errorf("GetClosedPollsToNotify() 2 minutes ago = %+v, %v, want none", polls, err)
+		}
+		if notified, err := s.NotifyPollVoters(ctx, closed.ID); err != nil || notified != 1 {
+			t.Errorf("NotifyPollVoters() = %v, %v, want 1", notified, err)
+		}
+		if err := s.MarkPollNotified(ctx, closed.ID); err != nil {
+			t.Fatalf("MarkPollNotified() error = %v", err)
+		}
+		if polls, err := s.GetClosedPollsToNotify(ctx, closedPolls(time.Now().UTC())); err != nil || len(polls) != 0 {
+			t.Errorf("GetClosedPollsToNotify() after notifying = %+v, %v, want none", polls, err)
+		}
+		if _, err := s.RestoreChirp(ctx, database.RestoreChirpParams{ID: trashed.ID, UserID: user.ID, Cutoff: time.Now().UTC().Add(-time.Hour)}); err != nil {
+			t.Fatalf("RestoreChirp() error = %v", err)
+		}
+		if polls, err := s.GetClosedPollsToNotify(ctx, closedPolls(time.Now().UTC())); err != nil || len(polls) != 1 || polls[0].ChirpID != trashed.ID {
+			t.Errorf("GetClosedPollsToNotify() after the restore = %+v, %v, want the poll of the restored chirp", polls, err)
+		}
+
+		notifications, err := s.GetNotifications(ctx, database.GetNotificationsParams{UserID: voter.ID, Limit: 10})
+		if err != nil || len(notifications) != 1 || notifications[0].Kind != "poll_closed" ||
+			notifications[0].ChirpID.UUID != chirp.ID || notifications[0].ReadAt.Valid {
+			t.Fatalf("GetNotifications() = %+v, %v, want the unread notification of the poll", notifications, err)
+		}
+		if err := s.MarkNotificationsRead(ctx, voter.ID); err != nil {
+			t.Fatalf("MarkNotificationsRead() error = %v", err)
+		}
+		if notifications, err := s.GetNotifications(ctx, database.GetNotificationsParams{UserID: voter.ID, Limit: 10}); err != nil || len(notifications) != 1 || !notifications[0].ReadAt.Valid {
+			t.Errorf("GetNotifications() = %+v, %v, want the notification read", notifications, err)
+		}
+		if notifications, err := s.GetNotifications(ctx, database.GetNotificationsParams{UserID: user.ID, Limit: 10}); err != nil || len(notifications) != 0 {
+			t.Errorf("GetNotifications() of the author = %+v, %v, want none", notifications, err)
+		}
+	})
+
+	t.Run("Sessions", func(t *testing.T) {
+		s := newStore(t)
+		user := createUser(t, s)
+		now := time.Now().UTC()
+		current := createSession(t, s, user.ID, now.Add(time.Hour))
+		other := createSession(t, s, user.ID, now.Add(time.Hour))
+		expired := createSession(t, s, user.ID, now.Add(-time.Hour))
+		if current.ID == uuid.Nil || current.ID == other.ID || current.RevokedAt.Valid || current.ClientID.Valid {
+			t.Fatalf("CreateRefreshToken() = %+v, want a new session", current)
+		}
+		if _, err := s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{Token: current.Token, UserID: user.ID, ExpiresAt: now}); !IsConflict(err) {
+			t.Errorf("CreateRefreshToken() with a taken token error = %v, want a conflict", err)
+		}
+
+		used, err := s.UseRefreshToken(ctx, database.UseRefreshTokenParams{Token: current.Token, Ip: "198.51.100.1"})
+		if err != nil || used.ID != current.ID || used.Ip != "198.51.100.1" || !used.LastUsedAt.Valid {
+			t.Errorf("UseRefreshToken() = %+v, %v, want the session with its new ip", used, err)
+		}
+		if _, err := s.UseRefreshToken(ctx, database.UseRefreshTokenParams{Token: expired.Token}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("UseRefreshToken() of an expired token error = %v, want sql.ErrNoRows", err)
+		}
+
+		sessions, err := s.GetSessions(ctx, user.ID)
+		if err != nil || len(sessions) != 2 || sessions[0].ID != current.ID {
+			t.Errorf("GetSessions() = %+v, %v, want the 2 valid sessions, the last used first", sessions, err)
+		}
+
+		revoked, err := s.RevokeOtherSessions(ctx, database.RevokeOtherSessionsParams{UserID: user.ID, CurrentID: current.ID})
+		if err != nil || !slices.Contains(revoked, other.ID) || slices.Contains(revoked, current.ID) {
+			t.Errorf("RevokeOtherSessions() = %v, %v, want the other sessions", revoked, err)
+		}
+		if _, err := s.UseRefreshToken(ctx, database.UseRefreshTokenParams{Token: other.Token}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("UseRefreshToken() of a revoked token error = %v, want sql.ErrNoRows", err)
+		}
+
+		if revoked, err := s.RevokeSession(ctx, database.RevokeSessionParams{ID: current.ID, UserID: uuid.New()}); err != nil || revoked != 0 {
+			t.Errorf("RevokeSession() of another user = %v, %v, want 0", revoked, err)
+		}
+		if revoked, err := s.RevokeSession(ctx, database.RevokeSessionParams{ID: current.ID, UserID: user.ID}); err != nil || revoked != 1 {
+			t.Errorf("RevokeSession() = %v, %v, want 1", revoked, err)
+		}
+		if sessions, err := s.GetSessions(ctx, user.ID); err != nil || len(sessions) != 0 {
+			t.Errorf("GetSessions() = %+v, %v, want none left", sessions, err)
+		}
+
+		last := createSession(t, s, user.ID, now.Add(time.Hour))
+		if err := s.SetRevokedAtToken(ctx, last.Token); err != nil {
+			t.Fatalf("SetRevokedAtToken() error = %v", err)
+		}
+		if got, err := s.GetRefreshToken(ctx, last.Token); err != nil || !got.RevokedAt.Valid {
+			t.Errorf("GetRefreshToken() = %+v, %v, want the revoked token", got, err)
+		}
+		if _, err := s.GetRefreshToken(ctx, "missing"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetRefreshToken() of a missing token error = %v, want sql.ErrNoRows", err)
+		}
+	})
+
+	t.Run("OAuth clients", func(t *testing.T) {
+		s := newStore(t)
+		user := createUser(t, s)
+		other := createUser(t, s)
+		createClient := func(t *testing.T, userID uuid.UUID) database.OauthClient {
+			t.Helper()
+			client, err := s.CreateOAuthClient(ctx, database.CreateOAuthClientParams{
+				ID:           uuid.NewString(),
+				UserID:       userID,
+				Name:         "app",
+				RedirectUris: []string{"https://app.example.com/callback"},
+				SecretHash:   sql.NullString{String: "hash", Valid: true},
+			})
+			if err != nil {
+				t.Fatalf("CreateOAuthClient() error = %v", err)
+			}
+			return client
+		}
+		client := createClient(t, user.ID)
+		second := createClient(t, user.ID)
+		createClient(t, other.ID)
+		if _, err := s.CreateOAuthClient(ctx, database.CreateOAuthClientParams{ID: client.ID, UserID: user.ID, Name: "copy", RedirectUris: []string{}}); !IsConflict(err) {
+			t.Errorf("CreateOAuthClient() with a taken id error = %v, want a conflict", err)
+		}
+
+		got, err := s.GetOAuthClient(ctx, client.ID)
+		if err != nil || got.UserID != user.ID || got.Name != "app" || !slices.Equal(got.RedirectUris, client.RedirectUris) || got.SecretHash.String != "hash" {
+			t.Errorf("GetOAuthClient() = %+v, %v, want the client", got, err)
+		}
+		if _, err := s.GetOAuthClient(ctx, uuid.NewString()); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetOAuthClient() of a missing client error = %v, want sql.ErrNoRows", err)
+		}
+		clients, err := s.GetOAuthClientsByUser(ctx, user.ID)
+		if err != nil || len(clients) != 2 || clients[0].ID != client.ID || clients[1].ID != second.ID {
+			t.Errorf("GetOAuthClientsByUser() = %+v, %v, want the 2 clients of the user, oldest first", clients, err)
+		}
+
+		createCode := func(t *testing.T, expiresAt time.Time) string {
+			t.Helper()
+			codeHash := uuid.NewString()
+			if err := s.CreateOAuthCode(ctx, database.CreateOAuthCodeParams{
+				CodeHash:      codeHash,
+				ClientID:      client.ID,
+				UserID:        user.ID,
+				RedirectUri:   client.RedirectUris[0],
+				Scopes:        []string{"chirps:read"},
+				CodeChallenge: "challenge",
+				ExpiresAt:     expiresAt,
+			}); err != nil {
+				t.Fatalf("CreateOAuthCode() error = %v", err)
+			}
+			return codeHash
+		}
+		now := time.Now().UTC()
+		codeHash := createCode(t, now.Add(time.Minute))
+		expiredHash := createCode(t, now.Add(-time.Minute))
+		unusedHash := createCode(t, now.Add(time.Minute))
+		code, err := s.UseOAuthCode(ctx, codeHash)
+		if err != nil || code.ClientID != client.ID || code.UserID != user.ID || !code.UsedAt.Valid || !slices.Equal(code.Scopes, []string{"chirps:read"}) {
+			t.Errorf("UseOAuthCode() = %+v, %v, want the used code", code, err)
+		}
+		if _, err := s.UseOAuthCode(ctx, codeHash); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("UseOAuthCode() again error = %v, want sql.ErrNoRows", err)
+		}
+		if _, err := s.UseOAuthCode(ctx, expiredHash); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("UseOAuthCode() of an expired code error = %v, want sql.ErrNoRows", err)
+		}
+
+		grantID := uuid.New()
+		var tokens []database.RefreshToken
+		for _, grant := range []uuid.UUID{grantID, grantID, uuid.New()} {
+			token, err := s.CreateOAuthRefreshToken(ctx, database.CreateOAuthRefreshTokenParams{
+				Token:     uuid.NewString(),
+				UserID:    user.ID,
+				ExpiresAt: now.Add(time.Hour),
+				ClientID:  sql.NullString{String: client.ID, Valid: true},
+				Scopes:    []string{"chirps:read"},
+				GrantID:   uuid.NullUUID{UUID: grant, Valid: true},
+			})
+			if err != nil {
+				t.Fatalf("CreateOAuthRefreshToken() error = %v", err)
+			}
+			tokens = append(tokens, token)
+		}
+		grants, err := s.GetOAuthClientGrants(ctx, sql.NullString{String: client.ID, Valid: true})
+		if err != nil || len(grants) != 2 || !slices.Contains(grants, grantID) || !slices.Contains(grants, tokens[2].GrantID.UUID) {
+			t.Errorf("GetOAuthClientGrants() = %v, %v, want the 2 grants of the client", grants, err)
+		}
+
+		if deleted, err := s.DeleteOAuthClient(ctx, database.DeleteOAuthClientParams{ID: client.ID, UserID: other.ID}); err != nil || deleted != 0 {
+			t.Errorf("DeleteOAuthClient() by another user = %v, %v, want 0", deleted, err)
+		}
+		if deleted, err := s.DeleteOAuthClient(ctx, database.DeleteOAuthClientParams{ID: client.ID, UserID: user.ID}); err != nil || deleted != 1 {
+			t.Errorf("DeleteOAuthClient() = %v, %v, want 1", deleted, err)
+		}
+		if _, err := s.GetOAuthClient(ctx, client.ID); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetOAuthClient() of the deleted client error = %v, want sql.ErrNoRows", err)
+		}
+		if _, err := s.UseOAuthCode(ctx, unusedHash); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("UseOAuthCode() of the deleted client error = %v, want sql.ErrNoRows", err)
+		}
+		if _, err := s.GetRefreshToken(ctx, tokens[0].Token); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetRefreshToken() of the deleted client error = %v, want sql.ErrNoRows", err)
+		}
+	})
+
+	t.Run("OAuth refresh tokens", func(t *testing.T) {
+		s := newStore(t)
+		user := createUser(t, s)
+		clientID := uuid.NewString()
+		if _, err := s.CreateOAuthClient(ctx, database.CreateOAuthClientParams{ID: clientID, UserID: user.ID, Name: "app", RedirectUris: []string{}}); err != nil {
+			t.Fatalf("CreateOAuthClient() error = %v", err)
+		}
+		grantID := uuid.New()
+		createToken := func(t *testing.T, grantID uuid.UUID, expiresAt time.Time) database.RefreshToken {
+			t.Helper()
+			token, err := s.CreateOAuthRefreshToken(ctx, database.CreateOAuthRefreshTokenParams{
+				Token:     uuid.NewString(),
+				UserID:    user.ID,
+				ExpiresAt: expiresAt,
+				ClientID:  sql.NullString{String: clientID, Valid: true},
+				Scopes:    []string{"chirps:read"},
+				GrantID:   uuid.NullUUID{UUID: grantID, Valid: true},
+			})
+			if err != nil {
+				t.Fatalf("CreateOAuthRefreshToken() error = %v", err)
+			}
+			return token
+		}
+		now := time.Now().UTC()
+		first := createToken(t, grantID, now.Add(time.Hour))
+		second := createToken(t, grantID, now.Add(time.Hour))
+		other := createToken(t, uuid.New(), now.Add(time.Hour))
+		expired := createToken(t, grantID, now.Add(-time.Hour))
+		if first.GrantID.UUID != grantID || !slices.Equal(first.Scopes, []string{"chirps:read"}) {
+			t.Fatalf("CreateOAuthRefreshToken() = %+v, want the token of the grant", first)
+		}
+
+		if _, err := s.UseOAuthRefreshToken(ctx, database.UseOAuthRefreshTokenParams{Token: first.Token, ClientID: uuid.NewString()}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("UseOAuthRefreshToken() by another client error = %v, want sql.ErrNoRows", err)
+		}
+		used, err := s.UseOAuthRefreshToken(ctx, database.UseOAuthRefreshTokenParams{Token: first.Token, ClientID: clientID})
+		if err != nil || used.ID != first.ID || !used.RevokedAt.Valid || used.GrantID.UUID != grantID {
+			t.Errorf("UseOAuthRefreshToken() = %+v, %v, want the used token", used, err)
+		}
+		if _, err := s.UseOAuthRefreshToken(ctx, database.UseOAuthRefreshTokenParams{Token: first.Token, ClientID: clientID}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("UseOAuthRefreshToken() again error = %v, want sql.ErrNoRows", err)
+		}
+		if _, err := s.UseOAuthRefreshToken(ctx, database.UseOAuthRefreshTokenParams{Token: expired.Token, ClientID: clientID}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("UseOAuthRefreshToken() of an expired token error = %v, want sql.ErrNoRows", err)
+		}
+
+		if err := s.RevokeOAuthGrant(ctx, grantID); err != nil {
+			t.Fatalf("RevokeOAuthGrant() error = %v", err)
+		}
+		if got, err := s.GetRefreshToken(ctx, second.Token); err != nil || !got.RevokedAt.Valid {
+			t.Errorf("GetRefreshToken() = %+v, %v, want the token revoked with its grant", got, err)
+		}
+		if got, err := s.GetRefreshToken(ctx, other.Token); err != nil || got.RevokedAt.Valid {
+			t.Errorf("GetRefreshToken() = %+v, %v, want the token of another grant left alone", got, err)
+		}
+	})
+
+	t.Run("Revoked access tokens", func(t *testing.T) {
+		s := newStore(t)
+		user := createUser(t, s)
+		now := time.Now().UTC()
+		revokedID, expiredID := uuid.NewString(), uuid.NewString()
+		for id, expiresAt := range map[string]time.Time{revokedID: now.Add(time.Hour), expiredID: now.Add(-time.Hour)} {
+			if err := s.RevokeToken(ctx, database.RevokeTokenParams{ID: id, ExpiresAt: expiresAt}); err != nil {
+				t.Fatalf("RevokeToken() error = %v", err)
+			}
+		}
+		if err := s.RevokeToken(ctx, database.RevokeTokenParams{ID: revokedID, ExpiresAt: now.Add(time.Hour)}); err != nil {
+			t.Errorf("RevokeToken() of a revoked token error = %v", err)
+		}
+
+		contains := func(revokedTokens []database.RevokedToken, id string) bool {
+			return slices.ContainsFunc(revokedTokens, func(token database.RevokedToken) bool { return token.ID == id })
+		}
+		revokedTokens, err := s.GetRevokedTokens(ctx)
+		if err != nil || !contains(revokedTokens, revokedID) || contains(revokedTokens, expiredID) {
+			t.Errorf("GetRevokedTokens() = %+v, %v, want only the unexpired revocation", revokedTokens, err)
+		}
+		if err := s.PurgeRevokedTokens(ctx); err != nil {
+			t.Errorf("PurgeRevokedTokens() error = %v", err)
+		}
+
+		validAfter := now.Truncate(time.Second)
+		if err := s.SetTokensValidAfter(ctx, database.SetTokensValidAfterParams{
+			ID:               user.ID,
+			TokensValidAfter: sql.NullTime{Time: validAfter, Valid: true},
+		}); err != nil {
+			t.Fatalf("SetTokensValidAfter() error = %v", err)
+		}
+		rows, err := s.GetTokensValidAfter(ctx, now.Add(-time.Hour))
+		if err != nil || len(rows) != 1 || rows[0].ID != user.ID || !rows[0].TokensValidAfter.Time.Equal(validAfter) {
+			t.Errorf("GetTokensValidAfter() = %+v, %v, want the user", rows, err)
+		}
+		if rows, err := s.GetTokensValidAfter(ctx, now.Add(time.Hour)); err != nil || len(rows) != 0 {
+			t.Errorf("GetTokensValidAfter() since later = %+v, %v, want none", rows, err)
+		}
+	})
+
+	t.Run("API tokens", func(t *testing.T) {
+		s := newStore(t)
+		user := createUser(t, s)
+		create := func(t *testing.T, expiresAt sql.NullTime) database.ApiToken {
+			t.Helper()
+			apiToken, err := s.CreateAPIToken(ctx, database.CreateAPITokenParams{
+				UserID:    user.ID,
+				Name:      "token",
+				TokenHash: uuid.NewString(),
+				Scopes:    []string{"chirps:read", "chirps:write"},
+				ExpiresAt: expiresAt,
+			})
+			if err != nil {
+				t.Fatalf("CreateAPIToken() error = %v", err)
+			}
+			return apiToken
+		}
+		apiToken := create(t, sql.NullTime{})
+		expired := create(t, sql.NullTime{Time: time.Now().UTC().Add(-time.Minute), Valid: true})
+		if !slices.Equal(apiToken.Scopes, []string{"chirps:read", "chirps:write"}) || apiToken.LastUsedAt.Valid {
+			t.Errorf("CreateAPIToken() = %+v, want the token with its scopes", apiToken)
+		}
+		if _, err := s.CreateAPIToken(ctx, database.CreateAPITokenParams{UserID: user.ID, Name: "copy", TokenHash: apiToken.TokenHash, Scopes: []string{}}); !IsConflict(err) {
+			t.Errorf("CreateAPIToken() with a taken hash error = %v, want a conflict", err)
+		}
+
+		if got, err := s.GetValidAPIToken(ctx, apiToken.TokenHash); err != nil || got.ID != apiToken.ID {
+			t.Errorf("GetValidAPIToken() = %+v, %v, want the token", got, err)
+		}
+		if _, err := s.GetValidAPIToken(ctx, expired.TokenHash); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetValidAPIToken() of an expired token error = %v, want sql.ErrNoRows", err)
+		}
+		if err := s.TouchAPIToken(ctx, apiToken.ID); err != nil {
+			t.Fatalf("TouchAPIToken() error = %v", err)
+		}
+		touched, err := s.GetValidAPIToken(ctx, apiToken.TokenHash)
+		if err != nil || !touched.LastUsedAt.Valid {
+			t.Fatalf("GetValidAPIToken() = %+v, %v, want it used", touched, err)
+		}
+		if err := s.TouchAPIToken(ctx, apiToken.ID); err != nil {
+			t.Fatalf("TouchAPIToken() error = %v", err)
+		}
+		if got, _ := s.GetValidAPIToken(ctx, apiToken.TokenHash); !got.LastUsedAt.Time.Equal(touched.LastUsedAt.Time) {
+			t.Errorf("TouchAPIToken() within a minute moved last_used_at from %v to %v", touched.LastUsedAt.Time, got.LastUsedAt.Time)
+		}
+
+		if revoked, err := s.RevokeAPIToken(ctx, database.RevokeAPITokenParams{ID: apiToken.ID, UserID: uuid.New()}); err != nil || revoked != 0 {
+			t.Errorf("RevokeAPIToken() of another user = %v, %v, want 0", revoked, err)
+		}
+		if revoked, err := s.RevokeAPIToken(ctx, database.RevokeAPITokenParams{ID: apiToken.ID, UserID: user.ID}); err != nil || revoked != 1 {
+			t.Errorf("RevokeAPIToken() = %v, %v, want 1", revoked, err)
+		}
+		if _, err := s.GetValidAPIToken(ctx, apiToken.TokenHash); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetValidAPIToken() of a revoked token error = %v, want sql.ErrNoRows", err)
+		}
+		if apiTokens, err := s.GetAPITokens(ctx, user.ID); err != nil || len(apiTokens) != 1 || apiTokens[0].ID != expired.ID {
+			t.Errorf("GetAPITokens() = %+v, %v, want the token that isn't revoked", apiTokens, err)
+		}
+		if err := s.RevokeUserAPITokens(ctx, user.ID); err != nil {
+			t.Fatalf("RevokeUserAPITokens() error = %v", err)
+		}
+		if apiTokens, err := s.GetAPITokens(ctx, user.ID); err != nil || len(apiTokens) != 0 {
+			t.Errorf("GetAPITokens() = %+v, %v, want every token revoked", apiTokens, err)
+		}
+	})
+
+	t.Run("Webhook endpoints", func(t *testing.T) {
+		s := newStore(t)
+		user := createUser(t, s)
+		other := createUser(t, s)
+		client, err := s.CreateOAuthClient(ctx, database.CreateOAuthClientParams{ID: uuid.NewString(), UserID: user.ID, Name: "app", RedirectUris: []string{}})
+		if err != nil {
+			t.Fatalf("CreateOAuthClient() error = %v", err)
+		}
+		createEndpoint := func(t *testing.T, userID uuid.UUID, clientID sql.NullString, events ...string) database.WebhookEndpoint {
+			t.Helper()
+			endpoint, err := s.CreateWebhookEndpoint(ctx, database.CreateWebhookEndpointParams{
+				UserID:   userID,
+				ClientID: clientID,
+				Url:      "https://hooks.example.com/" + uuid.NewString(),
+				Secret:   "whsec_secret",
+				Events:   events,
+			})
+			if err != nil {
+				t.Fatalf("CreateWebhookEndpoint() error = %v", err)
+			}
+			return endpoint
+		}
+		appClient := sql.NullString{String: client.ID, Valid: true}
+		endpoint := createEndpoint(t, user.ID, sql.NullString{}, "chirp.created", "chirp.deleted")
+		appEndpoint := createEndpoint(t, user.ID, appClient, "chirp.created")
+		otherEndpoint := createEndpoint(t, other.ID, sql.NullString{}, "chirp.created")
+		if endpoint.UserID != user.ID || endpoint.ClientID.Valid || endpoint.Secret != "whsec_secret" || !slices.Equal(endpoint.Events, []string{"chirp.created", "chirp.deleted"}) ||
+			endpoint.FailureCount != 0 || endpoint.DisabledAt.Valid {
+			t.Errorf("CreateWebhookEndpoint() = %+v, want an enabled endpoint of the user", endpoint)
+		}
+
+		endpoints, err := s.GetWebhookEndpoints(ctx, database.GetWebhookEndpointsParams{UserID: user.ID})
+		if err != nil || len(endpoints) != 2 || endpoints[0].ID != endpoint.ID || endpoints[1].ID != appEndpoint.ID {
+			t.Errorf("GetWebhookEndpoints() = %+v, %v, want the 2 endpoints of the user", endpoints, err)
+		}
+		endpoints, err = s.GetWebhookEndpoints(ctx, database.GetWebhookEndpointsParams{UserID: user.ID, ClientID: appClient})
+		if err != nil || len(endpoints) != 1 || endpoints[0].ID != appEndpoint.ID {
+			t.Errorf("GetWebhookEndpoints() of the app = %+v, %v, want the endpoint it registered", endpoints, err)
+		}
+		if _, err := s.GetWebhookEndpoint(ctx, database.GetWebhookEndpointParams{ID: endpoint.ID, UserID: user.ID, ClientID: appClient}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetWebhookEndpoint() by the app of an endpoint of the user error = %v, want sql.ErrNoRows", err)
+		}
+		if _, err := s.GetWebhookEndpoint(ctx, database.GetWebhookEndpointParams{ID: endpoint.ID, UserID: other.ID}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetWebhookEndpoint() by another user error = %v, want sql.ErrNoRows", err)
+		}
+
+		queued, err := s.CreateWebhookDeliveries(ctx, database.CreateWebhookDeliveriesParams{Event: "chirp.created", Payload: `{"n":1}`, UserID: user.ID})
+		if err != nil || queued != 2 {
+			t.Errorf("CreateWebhookDeliveries() = %v, %v, want 2 endpoints", queued, err)
+		}
+		if queued, err := s.CreateWebhookDeliveries(ctx, database.CreateWebhookDeliveriesParams{Event: "follower.created", Payload: `{}`, UserID: user.ID}); err != nil || queued != 0 {
+			t.Errorf("CreateWebhookDeliveries() of an event nobody subscribed to = %v, %v, want 0", queued, err)
+		}
+
+		leaseUntil := time.Now().UTC().Add(time.Minute).Truncate(time.Microsecond)
+		claimed, err := s.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{LeaseUntil: leaseUntil, Limit: 10})
+		if err != nil || len(claimed) != 2 {
+			t.Fatalf("ClaimWebhookDeliveries() = %+v, %v, want the 2 deliveries", claimed, err)
+		}
+		for _, delivery := range claimed {
+			want := endpoint
+			if delivery.EndpointID == appEndpoint.ID {
+				want = appEndpoint
+			}
+			if delivery.Event != "chirp.created" || delivery.Payload != `{"n":1}` || delivery.Url != want.Url || delivery.Secret != want.Secret || delivery.Attempts != 0 {
+				t.Errorf("claimed delivery = %+v, want it with the url and secret of its endpoint", delivery)
+			}
+		}
+		if claimed, err := s.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{LeaseUntil: leaseUntil, Limit: 10}); err != nil || len(claimed) != 0 {
+			t.Errorf("ClaimWebhookDeliveries() of leased deliveries = %+v, %v, want none", claimed, err)
+		}
+
+		delivered, failed := claimed[0], claimed[1]
+		if err := s.CompleteWebhookDelivery(ctx, database.CompleteWebhookDeliveryParams{ID: delivered.ID, ResponseStatus: sql.NullInt32{Int32: 200, Valid: true}}); err != nil {
+			t.Fatalf("CompleteWebhookDelivery() error = %v", err)
+		}
+		retryAt := time.Now().UTC().Add(-time.Second).Truncate(time.Microsecond)
+		if err := s.FailWebhookDelivery(ctx, database.FailWebhookDeliveryParams{
+			ID:            failed.ID,
+			Status:        "pending",
+			NextAttemptAt: retryAt,
+			LastError:     "connection refused",
+		}); err != nil {
+			t.Fatalf("FailWebhookDelivery() error = %v", err)
+		}
+		deliveries, err := s.GetWebhookDeliveries(ctx, database.GetWebhookDeliveriesParams{EndpointID: delivered.EndpointID, Limit: 10})
+		if err != nil || len(deliveries) != 1 || deliveries[0].Status != "delivered" || deliveries[0].Attempts != 1 || !deliveries[0].DeliveredAt.Valid ||
+			!deliveries[0].LastAttemptAt.Valid || deliveries[0].ResponseStatus.Int32 != 200 {
+			t.Errorf("GetWebhookDeliveries() = %+v, %v, want the delivered delivery", deliveries, err)
+		}
+		deliveries, err = s.GetWebhookDeliveries(ctx, database.GetWebhookDeliveriesParams{EndpointID: failed.EndpointID, Limit: 10})
+		if err != nil || len(deliveries) != 1 || deliveries[0].Status != "pending" || deliveries[0].Attempts != 1 || deliveries[0].LastError != "connection refused" ||
+			!deliveries[0].NextAttemptAt.Equal(retryAt) || deliveries[0].ResponseStatus.Valid || deliveries[0].DeliveredAt.Valid {
+			t.Errorf("GetWebhookDeliveries() = %+v, %v, want the failed attempt", deliveries, err)
+		}
+
+		// the deliveries of a disabled endpoint wait until it's enabled again
+		for range 2 {
+			if _, err := s.RecordWebhookEndpointFailure(ctx, database.RecordWebhookEndpointFailureParams{MaxFailures: 2, ID: failed.EndpointID}); err != nil {
+				t.Fatalf("RecordWebhookEndpointFailure() error = %v", err)
+			}
+		}
+		disabled, err := s.GetWebhookEndpoint(ctx, database.GetWebhookEndpointParams{ID: failed.EndpointID, UserID: user.ID})
+		if err != nil || disabled.FailureCount != 2 || !disabled.DisabledAt.Valid {
+			t.Errorf("GetWebhookEndpoint() = %+v, %v, want it disabled after max_failures", disabled, err)
+		}
+		if claimed, err := s.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{LeaseUntil: leaseUntil, Limit: 10}); err != nil || len(claimed) != 0 {
+			t.Errorf("ClaimWebhookDeliveries() of a disabled endpoint = %+v, %v, want none", claimed, err)
+		}
+		if queued, err := s.CreateWebhookDeliveries(ctx, database.CreateWebhookDeliveriesParams{Event: "chirp.created", Payload: `{}`, UserID: user.ID}); err != nil || queued != 1 {
+			t.Errorf("CreateWebhookDeliveries() with a disabled endpoint = %v, %v, want 1", queued, err)
+		}
+		enabled, err := s.UpdateWebhookEndpoint(ctx, database.UpdateWebhookEndpointParams{ID: disabled.ID, Url: "https://hooks.example.com/new", Events: []string{"follower.created"}})
+		if err != nil || enabled.Url != "https://hooks.example.com/new" || !slices.Equal(enabled.Events, []string{"follower.created"}) || enabled.FailureCount != 0 || enabled.DisabledAt.Valid ||
+			!enabled.UpdatedAt.After(disabled.UpdatedAt) {
+			t.Errorf("UpdateWebhookEndpoint() = %+v, %v, want the endpoint enabled with its new url and events", enabled, err)
+		}
+		if claimed, err := s.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{LeaseUntil: leaseUntil, Limit: 1}); err != nil || len(claimed) != 1 || claimed[0].ID != failed.ID {
+			t.Errorf("ClaimWebhookDeliveries() = %+v, %v, want the oldest due delivery", claimed, err)
+		}
+		if err := s.RecordWebhookEndpointSuccess(ctx, enabled.ID); err != nil {
+			t.Errorf("RecordWebhookEndpointSuccess() error = %v", err)
+		}
+
+		if purged, err := s.PurgeWebhookDeliveries(ctx, time.Now().UTC().Add(time.Minute)); err != nil || purged != 1 {
+			t.Errorf("PurgeWebhookDeliveries() = %v, %v, want the delivered delivery purged", purged, err)
+		}
+
+		if deleted, err := s.DeleteWebhookEndpoint(ctx, database.DeleteWebhookEndpointParams{ID: endpoint.ID, UserID: user.ID, ClientID: appClient}); err != nil || deleted != 0 {
+			t.Errorf("DeleteWebhookEndpoint() by the app of an endpoint of the user = %v, %v, want 0", deleted, err)
+		}
+		if deleted, err := s.DeleteWebhookEndpoint(ctx, database.DeleteWebhookEndpointParams{ID: endpoint.ID, UserID: user.ID}); err != nil || deleted != 1 {
+			t.Errorf("DeleteWebhookEndpoint() = %v, %v, want 1", deleted, err)
+		}
+		if deliveries, err := s.GetWebhookDeliveries(ctx, database.GetWebhookDeliveriesParams{EndpointID: endpoint.ID, Limit: 10}); err != nil || len(deliveries) != 0 {
+			t.Errorf("GetWebhookDeliveries() of the deleted endpoint = %+v, %v, want none", deliveries, err)
+		}
+		// the endpoints an app registered go with it
+		if _, err := s.DeleteOAuthClient(ctx, database.DeleteOAuthClientParams{ID: client.ID, UserID: user.ID}); err != nil {
+			t.Fatalf("DeleteOAuthClient() error = %v", err)
+		}
+		if _, err := s.GetWebhookEndpoint(ctx, database.GetWebhookEndpointParams{ID: appEndpoint.ID, UserID: user.ID}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetWebhookEndpoint() of the deleted app error = %v, want sql.ErrNoRows", err)
+		}
+		if _, err := s.GetWebhookEndpoint(ctx, database.GetWebhookEndpointParams{ID: otherEndpoint.ID, UserID: other.ID}); err != nil {
+			t.Errorf("GetWebhookEndpoint() of another user error = %v", err)
+		}
+	})
+
+	t.Run("Polka events", func(t *testing.T) {
+		s := newStore(t)
+		user := createUser(t, s)
+		other := createUser(t, s)
+		sentAt := time.Now().UTC().Add(-time.Minute).Truncate(time.Microsecond)
+		createEvent := func(t *testing.T, id string, userID uuid.UUID, sentAt time.Time) {
+			t.Helper()
+			created, err := s.CreateWebhookEvent(ctx, database.CreateWebhookEventParams{
+				ID:      id,
+				Event:   "user.upgraded",
+				UserID:  uuid.NullUUID{UUID: userID, Valid: true},
+				Payload: `{"id":"` + id + `"}`,
+				SentAt:  sentAt,
+			})
+			if err != nil || created != 1 {
+				t.Fatalf("CreateWebhookEvent() = %v, %v, want the event created", created, err)
+			}
+		}
+		createEvent(t, "later", user.ID, sentAt.Add(time.Second))
+		createEvent(t, "first", user.ID, sentAt)
+		createEvent(t, "other", other.ID, sentAt.Add(2*time.Second))
+		if created, err := s.CreateWebhookEvent(ctx, database.CreateWebhookEventParams{ID: "first", Payload: "{}", SentAt: sentAt}); err != nil || created != 0 {
+			t.Errorf("CreateWebhookEvent() of a received event = %v, %v, want 0 rows", created, err)
+		}
+
+		claim := func(t *testing.T) database.WebhookEvent {
+			t.Helper()
+			event, err := s.ClaimWebhookEvent(ctx)
+			if err != nil {
+				t.Fatalf("ClaimWebhookEvent() error = %v", err)
+			}
+			return event
+		}
+		event := claim(t)
+		if event.ID != "first" || event.Status != "pending" || event.Payload != `{"id":"first"}` || !event.SentAt.Equal(sentAt) {
+			t.Errorf("ClaimWebhookEvent() = %+v, want the event sent first", event)
+		}
+		// the event of the user waiting for a retry holds back the later one, but not the events of other users
+		if err := s.FailWebhookEvent(ctx, database.FailWebhookEventParams{ID: "first", Status: "pending", NextAttemptAt: time.Now().UTC().Add(time.Hour), LastError: "boom"}); err != nil {
+			t.Fatalf("FailWebhookEvent() error = %v", err)
+		}
+		if event := claim(t); event.ID != "other" {
+			t.Errorf("ClaimWebhookEvent() = %v, want the event of the other user", event.ID)
+		}
+		if err := s.CompleteWebhookEvent(ctx, "other"); err != nil {
+			t.Fatalf("CompleteWebhookEvent() error = %v", err)
+		}
+		if _, err := s.ClaimWebhookEvent(ctx); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("ClaimWebhookEvent() error = %v, want sql.ErrNoRows while the first event waits", err)
+		}
+		// a failed event doesn't hold back the next ones
+		if err := s.FailWebhookEvent(ctx, database.FailWebhookEventParams{ID: "first", Status: "failed", NextAttemptAt: time.Now().UTC(), LastError: "boom"}); err != nil {
+			t.Fatalf("FailWebhookEvent() error = %v", err)
+		}
+		if event := claim(t); event.ID != "later" {
+			t.Errorf("ClaimWebhookEvent() = %v, want the later event", event.ID)
+		}
+
+		failed, err := s.GetWebhookEventsByStatus(ctx, database.GetWebhookEventsByStatusParams{Status: "failed", Limit: 10})
+		if err != nil || len(failed) != 1 || failed[0].ID != "first" || failed[0].Attempts != 2 || failed[0].LastError != "boom" {
+			t.Errorf("GetWebhookEventsByStatus() = %+v, %v, want the failed event with its 2 attempts", failed, err)
+		}
+		processed, err := s.GetWebhookEvent(ctx, "other")
+		if err != nil || processed.Status != "processed" || processed.Attempts != 1 || !processed.ProcessedAt.Valid {
+			t.Errorf("GetWebhookEvent() = %+v, %v, want the processed event", processed, err)
+		}
+		if _, err := s.GetWebhookEvent(ctx, "unknown"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetWebhookEvent() of an unknown event error = %v, want sql.ErrNoRows", err)
+		}
+
+		replayed, err := s.ReplayWebhookEvent(ctx, "first")
+		if err != nil || replayed.Status != "pending" || replayed.Attempts != 0 || replayed.LastError != "" {
+			t.Errorf("ReplayWebhookEvent() = %+v, %v, want the event pending with all its attempts", replayed, err)
+		}
+		if _, err := s.ReplayWebhookEvent(ctx, "other"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("ReplayWebhookEvent() of a processed event error = %v, want sql.ErrNoRows", err)
+		}
+
+		if purged, err := s.PurgeWebhookEvents(ctx, time.Now().UTC().Add(time.Minute)); err != nil || purged != 1 {
+			t.Errorf("PurgeWebhookEvents() = %v, %v, want the processed event purged", purged, err)
+		}
+		if _, err := s.GetWebhookEvent(ctx, "first"); err != nil {
+			t.Errorf("GetWebhookEvent() of a pending event error = %v, want it kept", err)
+		}
+	})
+
+	t.Run("Subscriptions", func(t *testing.T) {
+		s := newStore(t)
+		user := createUser(t, s)
+		if _, err := s.GetSubscription(ctx, user.ID); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetSubscription() error = %v, want sql.ErrNoRows", err)
+		}
+		periodEnd := time.Now().UTC().Add(30 * 24 * time.Hour).Truncate(time.Microsecond)
+		eventAt := time.Now().UTC().Truncate(time.Microsecond)
+		sub, err := s.UpsertSubscription(ctx, database.UpsertSubscriptionParams{
+			UserID:           user.ID,
+			Plan:             "chirpy_red",
+			Status:           "active",
+			CurrentPeriodEnd: periodEnd,
+			LastEventAt:      eventAt,
+		})
+		if err != nil || sub.UserID != user.ID || sub.Status != "active" || !sub.CurrentPeriodEnd.Equal(periodEnd) || sub.CancelAt.Valid || !sub.LastEventAt.Equal(eventAt) {
+			t.Fatalf("UpsertSubscription() = %+v, %v, want the active subscription", sub, err)
+		}
+		cancelAt := sql.NullTime{Time: periodEnd, Valid: true}
+		updated, err := s.UpsertSubscription(ctx, database.UpsertSubscriptionParams{
+			UserID:           user.ID,
+			Plan:             "chirpy_red",
+			Status:           "canceled",
+			CurrentPeriodEnd: periodEnd,
+			CancelAt:         cancelAt,
+			LastEventAt:      eventAt.Add(time.Second),
+		})
+		if err != nil || updated.ID != sub.ID || updated.Status != "canceled" || !updated.CancelAt.Valid || !updated.CancelAt.Time.Equal(periodEnd) {
+			t.Errorf("UpsertSubscription() = %+v, %v, want the subscription updated", updated, err)
+		}
+		if got, err := s.GetSubscription(ctx, user.ID); err != nil || got.Status != "canceled" {
+			t.Errorf("GetSubscription() = %+v, %v, want the canceled subscription", got, err)
+		}
+		if _, err := s.UpsertSubscription(ctx, database.UpsertSubscriptionParams{UserID: uuid.New(), Plan: "chirpy_red", Status: "active"}); err == nil {
+			t.Error("UpsertSubscription() of an unknown user error = nil, want an error")
+		}
+
+		if err := s.SetChirpyRedUntil(ctx, database.SetChirpyRedUntilParams{ID: user.ID, ChirpyRedUntil: sql.NullTime{Time: periodEnd, Valid: true}}); err != nil {
+			t.Fatalf("SetChirpyRedUntil() error = %v", err)
+		}
+		if got, err := s.GetUserByID(ctx, user.ID); err != nil || !got.ChirpyRedUntil.Valid || !got.ChirpyRedUntil.Time.Equal(periodEnd) {
+			t.Errorf("GetUserByID() = %+v, %v, want the user chirpy red until the end of the period", got, err)
+		}
+
+		if _, err := s.DeleteUser(ctx, user.ID); err != nil {
+			t.Fatalf("DeleteUser() error = %v", err)
+		}
+		if _, err := s.GetSubscription(ctx, user.ID); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetSubscription() of a deleted user error = %v, want sql.ErrNoRows", err)
+		}
+	})
+
+	t.Run("Data exports", func(t *testing.T) {
+		s := newStore(t)
+		user := createUser(t, s)
+		other := createUser(t, s)
+
+		export, err := s.CreateDataExport(ctx, user.ID)
+		if err != nil || export.Status != "pending" || export.CompletedAt.Valid {
+			t.Fatalf("CreateDataExport() = %+v, %v, want a pending export", export, err)
+		}
+		if _, err := s.CreateDataExport(ctx, user.ID); !IsConflict(err) {
+			t.Errorf("CreateDataExport() while one is pending error = %v, want a conflict", err)
+		}
+		otherExport, err := s.CreateDataExport(ctx, other.ID)
+		if err != nil {
+			t.Fatalf("CreateDataExport() error = %v", err)
+		}
+
+		now := time.Now().UTC()
+		claimed, err := s.ClaimDataExports(ctx, database.ClaimDataExportsParams{LeaseUntil: now.Add(time.Minute), Now: now, Limit: 1})
+		if err != nil || len(claimed) != 1 || claimed[0].ID != export.ID || claimed[0].UserID != user.ID {
+			t.Fatalf("ClaimDataExports() = %+v, %v, want the oldest export", claimed, err)
+		}
+		claimed, err = s.ClaimDataExports(ctx, database.ClaimDataExportsParams{LeaseUntil: now.Add(time.Minute), Now: now, Limit: 10})
+		if err != nil || len(claimed) != 1 || claimed[0].ID != otherExport.ID {
+			t.Errorf("ClaimDataExports() = %+v, %v, want the export that isn't leased", claimed, err)
+		}
+		// the lease of an export whose generation stopped halfway runs out
+		claimed, err = s.ClaimDataExports(ctx, database.ClaimDataExportsParams{LeaseUntil: now.Add(3 * time.Minute), Now: now.Add(2 * time.Minute), Limit: 10})
+		if err != nil || len(claimed) != 2 {
+			t.Errorf("ClaimDataExports() after the lease = %+v, %v, want both exports", claimed, err)
+		}
+
+		expiresAt := sql.NullTime{Time: now.Add(time.Hour).Truncate(time.Microsecond), Valid: true}
+		if err := s.CompleteDataExport(ctx, database.CompleteDataExportParams{ID: export.ID, Status: "ready", Archive: []byte("zip"), ExpiresAt: expiresAt}); err != nil {
+			t.Fatalf("CompleteDataExport() error = %v", err)
+		}
+		if err := s.CompleteDataExport(ctx, database.CompleteDataExportParams{
+			ID:        otherExport.ID,
+			Status:    "failed",
+			ExpiresAt: sql.NullTime{Time: now.Add(-time.Hour), Valid: true},
+		}); err != nil {
+			t.Fatalf("CompleteDataExport() error = %v", err)
+		}
+		exports, err := s.GetDataExports(ctx, user.ID)
+		if err != nil || len(exports) != 1 || exports[0].Status != "ready" || !exports[0].CompletedAt.Valid || !exports[0].ExpiresAt.Time.Equal(expiresAt.Time) {
+			t.Errorf("GetDataExports() = %+v, %v, want the ready export", exports, err)
+		}
+		archive, err := s.GetDataExportArchive(ctx, database.GetDataExportArchiveParams{ID: export.ID, UserID: user.ID})
+		if err != nil || string(archive.Archive) != "zip" || archive.Status != "ready" {
+			t.Errorf("GetDataExportArchive() = %+v, %v, want the archive", archive, err)
+		}
+		if _, err := s.GetDataExportArchive(ctx, database.GetDataExportArchiveParams{ID: export.ID, UserID: other.ID}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetDataExportArchive() of another user error = %v, want sql.ErrNoRows", err)
+		}
+		if _, err := s.CreateDataExport(ctx, user.ID); err != nil {
+			t.Errorf("CreateDataExport() once the export is ready error = %v", err)
+		}
+
+		if purged, err := s.PurgeExpiredDataExports(ctx); err != nil || purged != 1 {
+			t.Errorf("PurgeExpiredDataExports() = %v, %v, want the expired export purged", purged, err)
+		}
+		if exports, err := s.GetDataExports(ctx, other.ID); err != nil || len(exports) != 0 {
+			t.Errorf("GetDataExports() = %+v, %v, want no export left", exports, err)
+		}
+	})
+
+	t.Run("Export the data of a user", func(t *testing.T) {
+		s := newStore(t)
+		user := createUser(t, s)
+		friend := createUser(t, s)
+		chirp := createChirp(t, s, friend.ID, "which one?")
+		trashed := createChirp(t, s, user.ID, "trashed")
+		if _, err := s.SoftDeleteChirp(ctx, database.SoftDeleteChirpParams{ID: trashed.ID, DeletedBy: user.ID}); err != nil {
+			t.Fatalf("SoftDeleteChirp() error = %v", err)
+		}
+		if chirps, err := s.ExportChirps(ctx, user.ID); err != nil || len(chirps) != 1 || chirps[0].ID != trashed.ID {
+			t.Errorf("ExportChirps() = %+v, %v, want the chirp in the trash", chirps, err)
+		}
+
+		for _, follow := range []database.FollowUserParams{{FollowerID: user.ID, FolloweeID: friend.ID}, {FollowerID: friend.ID, FolloweeID: user.ID}} {
+			if _, err := s.FollowUser(ctx, follow); err != nil {
+				t.Fatalf("FollowUser() error = %v", err)
+			}
+		}
+		if following, err := s.ExportFollowing(ctx, user.ID); err != nil || len(following) != 1 || following[0].ID != friend.ID {
+			t.Errorf("ExportFollowing() = %+v, %v, want the friend", following, err)
+		}
+		if followers, err := s.ExportFollowers(ctx, user.ID); err != nil || len(followers) != 1 || followers[0].ID != friend.ID {
+			t.Errorf("ExportFollowers() = %+v, %v, want the friend", followers, err)
+		}
+
+		collection, err := s.CreateCollection(ctx, database.CreateCollectionParams{UserID: user.ID, Name: "later"})
+		if err != nil {
+			t.Fatalf("CreateCollection() error = %v", err)
+		}
+		if err := s.AddBookmark(ctx, database.AddBookmarkParams{CollectionID: collection.ID, ChirpID: chirp.ID}); err != nil {
+			t.Fatalf("AddBookmark() error = %v", err)
+		}
+		if bookmarks, err := s.ExportBookmarks(ctx, user.ID); err != nil || len(bookmarks) != 1 || bookmarks[0].Collection != "later" || bookmarks[0].ChirpID != chirp.ID {
+			t.Errorf("ExportBookmarks() = %+v, %v, want the bookmark with its collection", bookmarks, err)
+		}
+
+		poll, err := s.CreatePoll(ctx, database.CreatePollParams{ChirpID: chirp.ID, ClosesAt: time.Now().UTC().Add(time.Hour)})
+		if err != nil {
+			t.Fatalf("CreatePoll() error = %v", err)
+		}
+		option, err := s.CreatePollOption(ctx, database.CreatePollOptionParams{PollID: poll.ID, Text: "yes"})
+		if err != nil {
+			t.Fatalf("CreatePollOption() error = %v", err)
+		}
+		if _, err := s.CreatePollVote(ctx, database.CreatePollVoteParams{PollID: poll.ID, UserID: user.ID, OptionID: option.ID}); err != nil {
+			t.Fatalf("CreatePollVote() error = %v", err)
+		}
+		if votes, err := s.ExportPollVotes(ctx, user.ID); err != nil || len(votes) != 1 || votes[0].ChirpID != chirp.ID || votes[0].Option != "yes" {
+			t.Errorf("ExportPollVotes() = %+v, %v, want the vote with its option", votes, err)
+		}
+
+		if err := s.CreateUserIdentity(ctx, database.CreateUserIdentityParams{Provider: "https://accounts.example.com", Subject: "42", UserID: user.ID, Email: user.Email}); err != nil {
+			t.Fatalf("CreateUserIdentity() error = %v", err)
+		}
+		if identities, err := s.ExportUserIdentities(ctx, user.ID); err != nil || len(identities) != 1 || identities[0].Subject != "42" {
+			t.Errorf("ExportUserIdentities() = %+v, %v, want the linked identity", identities, err)
+		}
+		if _, err := s.NotifyPollVoters(ctx, poll.ID); err != nil {
+			t.Fatalf("NotifyPollVoters() error = %v", err)
+		}
+		if notifications, err := s.ExportNotifications(ctx, user.ID); err != nil || len(notifications) != 1 || notifications[0].ChirpID.UUID != chirp.ID {
+			t.Errorf("ExportNotifications() = %+v, %v, want the notification of the poll", notifications, err)
+		}
+	})
+
+	t.Run("Transactions", func(t *testing.T) {
+		s := newStore(t)
+		user := createUser(t, s)
+		errRollback := errors.New("rollback")
+
+		var rolledBack database.Chirp
+		err := s.InTx(ctx, func(tx Store) error {
+			rolledBack = createChirp(t, tx, user.ID, "rolled back")
+			if _, err := tx.GetChirp(ctx, rolledBack.ID); err != nil {
+				t.Errorf("GetChirp() in the transaction error = %v", err)
+			}
+			return errRollback
+		})
+		if !errors.Is(err, errRollback) {
+			t.Fatalf("InTx() error = %v, want the error of fn", err)
+		}
+		if _, err := s.GetChirp(ctx, rolledBack.ID); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetChirp() error = %v, want the chirp rolled back", err)
+		}
+
+		var committed database.Chirp
+		if err := s.InTx(ctx, func(tx Store) error {
+			committed = createChirp(t, tx, user.ID, "committed")
+			return tx.InTx(ctx, func(tx Store) error { // nested, part of the same transaction
+				_, err := tx.SoftDeleteChirp(ctx, database.SoftDeleteChirpParams{ID: committed.ID, DeletedBy: user.ID})
+				return err
+			})
+		}); err != nil {
+			t.Fatalf("InTx() error = %v", err)
+		}
+		trashed, err := s.GetTrashedChirps(ctx, database.GetTrashedChirpsParams{UserID: user.ID, Cutoff: time.Now().UTC().Add(-time.Hour)})
+		if err != nil || len(trashed) != 1 || trashed[0].ID != committed.ID {
+			t.Errorf("GetTrashedChirps() = %+v, %v, want the committed chirp", trashed, err)
+		}
+
+		// a nested transaction that fails only undoes its own changes
+		var kept, undone database.Chirp
+		if err := s.InTx(ctx, func(tx Store) error {
+			kept = createChirp(t, tx, user.ID, "kept")
+			err := tx.InTx(ctx, func(tx Store) error {
+				undone = createChirp(t, tx, user.ID, "undone")
+				return errRollback
+			})
+			if !errors.Is(err, errRollback) {
+				t.Errorf("nested InTx() error = %v, want the error of fn", err)
+			}
+			return nil
+		}); err != nil {
+			t.Fatalf("InTx() error = %v", err)
+		}
+		if _, err := s.GetChirp(ctx, kept.ID); err != nil {
+			t.Errorf("GetChirp() error = %v, want the chirp of the transaction kept", err)
+		}
+		if _, err := s.GetChirp(ctx, undone.ID); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetChirp() error = %v, want the chirp of the nested transaction rolled back", err)
+		}
+	})
+}
@@ -0,0 +1,19 @@
+package webhook
+
+import "time"
+
+// Backoff func returns how long to wait before retrying after the given number of failed attempts,
+// the delay doubles from base after every attempt and is capped at max
+func Backoff(attempts int, base, max time.Duration) time.Duration {
+	if attempts < 1 {
+		return 0
+	}
+	delay := base
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= max {
+			return max
+		}
+	}
+	return min(delay, max)
+}
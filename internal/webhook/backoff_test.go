@@ -0,0 +1,29 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts int
+		want     time.Duration
+	}{
+		{name: "No failed attempt", attempts: 0, want: 0},
+		{name: "First retry", attempts: 1, want: 30 * time.Second},
+		{name: "Second retry", attempts: 2, want: time.Minute},
+		{name: "Fifth retry", attempts: 5, want: 8 * time.Minute},
+		{name: "Capped", attempts: 10, want: time.Hour},
+		{name: "Doesn't overflow", attempts: 100, want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Backoff(tt.attempts, 30*time.Second, time.Hour); got != tt.want {
+				t.Errorf("Backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxResponseSize is how much of the response body is read, receivers are only expected to acknowledge
+const maxResponseSize = 64 << 10
+
+var ErrUnexpectedStatus = errors.New("webhook receiver didn't respond with 2xx")
+
+// Sender posts signed webhooks, receivers check them with a Verifier holding the same secret
+type Sender struct {
+	Client          *http.Client // should have a timeout and not follow redirects
+	TimestampHeader string       // e.g. X-Chirpy-Timestamp
+	SignatureHeader string       // e.g. X-Chirpy-Signature
+}
+
+// Send func posts the json body to url, signed with the secret at now. header is added to the request.
+// any response that isn't 2xx is an error, statusCode is 0 when no response was received
+func (s Sender) Send(ctx context.Context, url, secret string, body []byte, header http.Header, now time.Time) (statusCode int, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(s.TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(s.SignatureHeader, Sign(secret, now, body))
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	// the body is drained so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(res.Body, maxResponseSize))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("%w: %v", ErrUnexpectedStatus, res.Status)
+	}
+	return res.StatusCode, nil
+}
@@ -0,0 +1,93 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSend(t *testing.T) {
+	body := []byte(`{"id":"evt_1","event":"chirp.created"}`)
+	sender := Sender{
+		Client:          &http.Client{Timeout: time.Second},
+		TimestampHeader: "X-Test-Timestamp",
+		SignatureHeader: "X-Test-Signature",
+	}
+	verifier := Verifier{Secrets: []string{"secret"}, Tolerance: time.Minute}
+
+	tests := []struct {
+		name       string
+		secret     string
+		status     int
+		wantStatus int
+		wantErr    error
+	}{
+		{
+			name:       "Delivered",
+			secret:     "secret",
+			status:     http.StatusNoContent,
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "Receiver error",
+			secret:     "secret",
+			status:     http.StatusInternalServerError,
+			wantStatus: http.StatusInternalServerError,
+			wantErr:    ErrUnexpectedStatus,
+		},
+		{
+			name:       "Rejected by the receiver",
+			secret:     "wrong-secret",
+			status:     http.StatusNoContent,
+			wantStatus: http.StatusUnauthorized,
+			wantErr:    ErrUnexpectedStatus,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Errorf("couldn't read the body: %v", err)
+				}
+				if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+					t.Errorf("received %v with content type %v, want a json POST", r.Method, r.Header.Get("Content-Type"))
+				}
+				if got := r.Header.Get("X-Test-Event"); got != "chirp.created" {
+					t.Errorf("X-Test-Event = %v, want the extra header", got)
+				}
+				if err := verifier.Verify(received, r.Header.Get("X-Test-Timestamp"), r.Header.Get("X-Test-Signature"), time.Now()); err != nil {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer receiver.Close()
+
+			header := http.Header{}
+			header.Set("X-Test-Event", "chirp.created")
+			status, err := sender.Send(context.Background(), receiver.URL, tt.secret, body, header, time.Now())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("Send() status = %d, want %d", status, tt.wantStatus)
+			}
+		})
+	}
+
+	t.Run("Unreachable receiver", func(t *testing.T) {
+		receiver := httptest.NewServer(http.NotFoundHandler())
+		receiver.Close()
+
+		status, err := sender.Send(context.Background(), receiver.URL, "secret", body, nil, time.Now())
+		if err == nil || status != 0 {
+			t.Errorf("Send() = %d, %v, want no status and an error", status, err)
+		}
+	})
+}
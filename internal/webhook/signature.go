@@ -0,0 +1,76 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// signatureVersion prefixes the signatures in the signature header, e.g. v1=5257a869...
+const signatureVersion = "v1"
+
+var (
+	ErrMissingSignature = errors.New("webhook signature or timestamp is missing")
+	ErrInvalidTimestamp = errors.New("webhook timestamp is invalid")
+	ErrTimestampExpired = errors.New("webhook timestamp is outside the tolerance window")
+	ErrInvalidSignature = errors.New("webhook signature doesn't match")
+)
+
+// Sign func returns the signature of a webhook sent at timestamp: an HMAC-SHA256 of "<unix timestamp>.<body>",
+// so neither the body nor the timestamp can be changed without the secret
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp.Unix())
+	mac.Write(body)
+	return signatureVersion + "=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verifier checks the signatures of incoming webhooks
+type Verifier struct {
+	Secrets   []string      // the current secret, and the previous one while the secret is rotated
+	Tolerance time.Duration // how far the timestamp can be from now, older webhooks are rejected as replays
+}
+
+// Verify func checks the timestamp and signature headers of a webhook with the raw body. the signature header can
+// hold several signatures separated by commas (e.g. signed with the old and new secret during a rotation),
+// one of them has to match one of the secrets
+func (v Verifier) Verify(body []byte, timestamp, signature string, now time.Time) error {
+	if timestamp == "" || signature == "" {
+		return ErrMissingSignature
+	}
+	sentAt, err := ParseTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
+	if sentAt.Before(now.Add(-v.Tolerance)) || sentAt.After(now.Add(v.Tolerance)) {
+		return ErrTimestampExpired
+	}
+
+	for _, secret := range v.Secrets {
+		if secret == "" {
+			continue
+		}
+		expected := []byte(Sign(secret, sentAt, body))
+		for _, candidate := range strings.Split(signature, ",") {
+			// hmac.Equal compares in constant time, so the signature can't be guessed byte by byte
+			if hmac.Equal([]byte(strings.TrimSpace(candidate)), expected) {
+				return nil
+			}
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// ParseTimestamp func returns the time of the timestamp header of a webhook
+func ParseTimestamp(timestamp string) (time.Time, error) {
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return time.Time{}, ErrInvalidTimestamp
+	}
+	return time.Unix(unix, 0).UTC(), nil
+}
@@ -0,0 +1,112 @@
+package webhook
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	body := []byte(`{"id":"evt_1","event":"user.upgraded","data":{"user_id":"3311741c-680c-4546-99f3-fc9efac2036c"}}`)
+	verifier := Verifier{Secrets: []string{"new-secret", "old-secret"}, Tolerance: 5 * time.Minute}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	tests := []struct {
+		name      string
+		body      []byte
+		timestamp string
+		signature string
+		wantErr   error
+	}{
+		{
+			name:      "Signed with the current secret",
+			body:      body,
+			timestamp: timestamp,
+			signature: Sign("new-secret", now, body),
+		},
+		{
+			name:      "Signed with the previous secret",
+			body:      body,
+			timestamp: timestamp,
+			signature: Sign("old-secret", now, body),
+		},
+		{
+			name:      "Signed with both secrets",
+			body:      body,
+			timestamp: timestamp,
+			signature: Sign("unknown-secret", now, body) + ", " + Sign("new-secret", now, body),
+		},
+		{
+			name:      "Timestamp within the tolerance",
+			body:      body,
+			timestamp: strconv.FormatInt(now.Add(-4*time.Minute).Unix(), 10),
+			signature: Sign("new-secret", now.Add(-4*time.Minute), body),
+		},
+		{
+			name:      "Unknown secret",
+			body:      body,
+			timestamp: timestamp,
+			signature: Sign("unknown-secret", now, body),
+			wantErr:   ErrInvalidSignature,
+		},
+		{
+			name:      "Tampered body",
+			body:      []byte(`{"id":"evt_1","event":"user.upgraded","data":{"user_id":"00000000-0000-0000-0000-000000000000"}}`),
+			timestamp: timestamp,
+			signature: Sign("new-secret", now, body),
+			wantErr:   ErrInvalidSignature,
+		},
+		{
+			name:      "Timestamp changed after signing",
+			body:      body,
+			timestamp: strconv.FormatInt(now.Add(time.Minute).Unix(), 10),
+			signature: Sign("new-secret", now, body),
+			wantErr:   ErrInvalidSignature,
+		},
+		{
+			name:      "Replayed after the tolerance",
+			body:      body,
+			timestamp: strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10),
+			signature: Sign("new-secret", now.Add(-10*time.Minute), body),
+			wantErr:   ErrTimestampExpired,
+		},
+		{
+			name:      "Timestamp in the future",
+			body:      body,
+			timestamp: strconv.FormatInt(now.Add(10*time.Minute).Unix(), 10),
+			signature: Sign("new-secret", now.Add(10*time.Minute), body),
+			wantErr:   ErrTimestampExpired,
+		},
+		{
+			name:      "Invalid timestamp",
+			body:      body,
+			timestamp: "yesterday",
+			signature: Sign("new-secret", now, body),
+			wantErr:   ErrInvalidTimestamp,
+		},
+		{
+			name:      "Missing signature",
+			body:      body,
+			timestamp: timestamp,
+			wantErr:   ErrMissingSignature,
+		},
+		{
+			name:      "Signature without its version",
+			body:      body,
+			timestamp: timestamp,
+			signature: Sign("new-secret", now, body)[len("v1="):],
+			wantErr:   ErrInvalidSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifier.Verify(tt.body, tt.timestamp, tt.signature, now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
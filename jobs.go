@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// runEvery func runs job right away and then every interval until ctx is done
+func runEvery(ctx context.Context, interval time.Duration, job func(ctx context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		job(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if ctx.Err() != nil { // the select picks either when both are ready
+				return
+			}
+		}
+	}
+}
+
+// jobs are the background jobs of the server, they share a context that's canceled when the server stops
+type jobs struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newJobs() *jobs {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &jobs{ctx: ctx, cancel: cancel}
+}
+
+// every func runs job in the background right away and then every interval, until the jobs are stopped
+func (j *jobs) every(interval time.Duration, job func(ctx context.Context)) {
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		runEvery(j.ctx, interval, job)
+	}()
+}
+
+// stop func cancels the context of the jobs, the runs in progress see it and no job is run again
+func (j *jobs) stop() {
+	j.cancel()
+}
+
+// wait func waits for the runs in progress to return after the jobs were stopped, or for ctx to be done
+func (j *jobs) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		j.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
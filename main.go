@@ -1,86 +1,341 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
-	"github.com/h0dy/http-server/internal/database"
+	"github.com/h0dy/http-server/internal/auth"
+	"github.com/h0dy/http-server/internal/mail"
+	"github.com/h0dy/http-server/internal/store"
+	"github.com/h0dy/http-server/internal/webhook"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
 
 type apiConfig struct {
-	db        *database.Queries
-	platform  string
-	jwtSecret string
-	polkaKey  string
+	store         store.Store // every data of the api, in postgres, sqlite or memory
+	platform      string
+	jwtSecret     string
+	polkaVerifier webhook.Verifier   // checks the signatures of polka webhooks
+	webhookSender webhook.Sender     // sends the webhooks registered by users
+	oidc          *auth.OIDCProvider // nil when login with an external provider isn't configured
+	denylist      *auth.Denylist     // revoked access tokens
+	mailer        mail.Mailer
+	baseURL       string // public url of the server, used in the links sent by email
+
+	passwordParams auth.Argon2Params // argon2id parameters of new password hashes
+
+	draining atomic.Bool // set when the server starts shutting down, the readiness check fails from then on
 }
 
 func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run func serves the api until the process gets SIGINT or SIGTERM, it returns once the server is drained
+// so the deferred cleanups run
+func run() error {
 	if err := godotenv.Load(); err != nil {
-		log.Fatalf("error in loading env file: %v", err)
+		return fmt.Errorf("error in loading env file: %v", err)
+	}
+
+	// the sqlite database is always migrated when it's opened
+	autoMigrate := flag.Bool("migrate", false, "apply the pending migrations of the postgres database before serving")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: chirpy [-migrate]\n       %v\n", migrateUsage)
+		flag.PrintDefaults()
 	}
+	flag.Parse()
 
 	// get env variables for api configuration
-	dbURL := os.Getenv("DB_URL")
+	dbURL := os.Getenv("DB_URL") // postgres://... or sqlite://<path to the file>
 	if dbURL == "" {
-		log.Fatalf("make sure you set up DB_URL")
+		return errors.New("make sure you set up DB_URL")
+	}
+
+	// the migrate subcommand only needs the database
+	if flag.Arg(0) == "migrate" {
+		if strings.HasPrefix(dbURL, "sqlite://") {
+			return errors.New("the sqlite database is migrated when the server starts, there is nothing to run")
+		}
+		db, err := sql.Open("postgres", dbURL)
+		if err != nil {
+			return fmt.Errorf("error in connecting to database %v", err)
+		}
+		defer db.Close()
+		return runMigrate(context.Background(), db, flag.Args()[1:])
+	}
+	if flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
 	}
 	platform := os.Getenv("PLATFORM") // in what mode the app is running (e.g. dev or prod)
 	if platform == "" {
-		log.Fatal("make sure you set up PLATFORM")
+		return errors.New("make sure you set up PLATFORM")
 	}
 	jwtSecret := os.Getenv("JWT_SECRET")
 	if jwtSecret == "" {
-		log.Fatal("make sure you set up JWT_SECRET")
+		return errors.New("make sure you set up JWT_SECRET")
 	}
-	polkaKey := os.Getenv("POLKA_KEY") // polka key is an api key for webhook
+	polkaKey := os.Getenv("POLKA_KEY") // polka key is the secret polka webhooks are signed with
 	if polkaKey == "" {
-		log.Fatal("make sure you set up polkaKey")
+		return errors.New("make sure you set up POLKA_KEY")
 	}
-
-	db, err := sql.Open("postgres", dbURL) // open connection to database
+	polkaKeys := []string{polkaKey}
+	// optional: webhooks signed with the previous key are still accepted while the key is rotated
+	if previousKey := os.Getenv("POLKA_PREVIOUS_KEY"); previousKey != "" {
+		polkaKeys = append(polkaKeys, previousKey)
+	}
+	passwordParams, err := argon2ParamsFromEnv()
 	if err != nil {
-		log.Fatalf("error in connecting to database %v", err)
+		return err
+	}
+	serverCfg, err := serverConfigFromEnv()
+	if err != nil {
+		return err
+	}
+
+	var dataStore store.Store
+	if path, ok := strings.CutPrefix(dbURL, "sqlite://"); ok {
+		// local development and small deployments
+		sqliteStore, err := store.OpenSQLite(context.Background(), path)
+		if err != nil {
+			return fmt.Errorf("error in opening the sqlite database: %v", err)
+		}
+		defer sqliteStore.Close()
+		dataStore = sqliteStore
+		log.Printf("using the sqlite database %v", path)
+	} else {
+		pg, err := sql.Open("postgres", dbURL) // open connection to database
+		if err != nil {
+			return fmt.Errorf("error in connecting to database %v", err)
+		}
+		defer pg.Close()
+		if err := prepareSchema(context.Background(), pg, *autoMigrate); err != nil {
+			return fmt.Errorf("error in preparing the database schema: %v", err)
+		}
+		dataStore = store.NewPostgres(pg)
 	}
-	defer db.Close()
 
-	dbQueries := database.New(db) // register the generated functions for our database queries from sqlc
 	apiCfg := &apiConfig{
-		db:        dbQueries,
+		store:     dataStore,
 		platform:  platform,
 		jwtSecret: jwtSecret,
-		polkaKey:  polkaKey,
+		polkaVerifier: webhook.Verifier{
+			Secrets:   polkaKeys,
+			Tolerance: polkaSignatureTolerance,
+		},
+		webhookSender: webhook.Sender{
+			Client:          newWebhookClient(webhookDeliveryTimeout),
+			TimestampHeader: chirpyTimestampHeader,
+			SignatureHeader: chirpySignatureHeader,
+		},
+		denylist: auth.NewDenylist(),
+		mailer:   mail.LogMailer{},
+		baseURL:  "http://localhost:8080",
+
+		passwordParams: passwordParams,
+	}
+
+	// optional: give the admin role to an existing user, there is no other way to get the first admin
+	if adminEmail := os.Getenv("ADMIN_EMAIL"); adminEmail != "" {
+		if err := apiCfg.bootstrapAdmin(context.Background(), adminEmail); err != nil {
+			log.Printf("couldn't bootstrap admin %v: %v", adminEmail, err)
+		}
+	}
+
+	if baseURL := os.Getenv("BASE_URL"); baseURL != "" {
+		apiCfg.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+
+	// optional: send emails through an SMTP server, they are written to the log otherwise
+	if smtpAddr := os.Getenv("SMTP_ADDR"); smtpAddr != "" {
+		mailer, err := mail.NewSMTPMailer(smtpAddr, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), os.Getenv("MAIL_FROM"))
+		if err != nil {
+			return fmt.Errorf("couldn't set up the SMTP mailer: %v", err)
+		}
+		apiCfg.mailer = mailer
+	}
+
+	// optional: login with an external OpenID Connect provider
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		provider, err := auth.DiscoverOIDC(
+			context.Background(),
+			issuer,
+			os.Getenv("OIDC_CLIENT_ID"),
+			os.Getenv("OIDC_CLIENT_SECRET"),
+			os.Getenv("OIDC_REDIRECT_URL"), // e.g. http://localhost:8080/api/login/oidc/callback
+		)
+		if err != nil {
+			log.Printf("couldn't set up OIDC login with %v: %v", issuer, err)
+		}
+		apiCfg.oidc = provider
 	}
 
 	const port = "8080"
 	const filepath = "."
+
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return fmt.Errorf("couldn't listen on port %v: %v", port, err)
+	}
+
+	// background jobs, stopped when the server shuts down
+	backgroundJobs := newJobs()
+	backgroundJobs.every(time.Hour, apiCfg.purgeTrashedChirps)   // purge chirps that stayed too long in the trash
+	backgroundJobs.every(10*time.Second, apiCfg.syncDenylist)    // load the tokens revoked by other servers
+	backgroundJobs.every(time.Hour, apiCfg.purgeDeletedAccounts) // delete the accounts whose grace period is over
+	backgroundJobs.every(time.Minute, apiCfg.publishDueDrafts)   // publish scheduled drafts
+	backgroundJobs.every(time.Minute, apiCfg.notifyClosedPolls)  // notify the voters of closed polls
+	backgroundJobs.every(5*time.Second, apiCfg.deliverWebhooks)  // send the webhooks registered by users
+	backgroundJobs.every(time.Hour, apiCfg.purgeWebhookDeliveries)
+	backgroundJobs.every(5*time.Second, apiCfg.processWebhookEvents) // process the stored polka events
+	backgroundJobs.every(time.Hour, apiCfg.purgeWebhookEvents)
+	backgroundJobs.every(time.Minute, apiCfg.generateDataExports) // generate the archives of the data exports
+	backgroundJobs.every(time.Hour, apiCfg.purgeExpiredDataExports)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop) // a second signal kills the process right away, without draining the server
+
+	log.Printf("serving on port: %v\n", port)
+	return apiCfg.serve(ctx, newServer(apiCfg.routes(filepath), serverCfg), listener, backgroundJobs, serverCfg)
+}
+
+// routes func registers every endpoint of the api, filepathRoot is the directory of the homepage
+func (cfg *apiConfig) routes(filepathRoot string) *http.ServeMux {
 	mux := http.NewServeMux() // NewServeMux method returns ServeMux
 	// "ServeMux is an HTTP request multiplexer. It matches the URL of each incoming request against a list of registered patterns and calls the handler for the pattern that most closely matches the URL." from go documents
-	serveApp := http.StripPrefix("/app/", http.FileServer(http.Dir(filepath)))
+	serveApp := http.StripPrefix("/app/", http.FileServer(http.Dir(filepathRoot)))
 
-	mux.Handle("/app/", serveApp)                            // serves the homepage (HTML page)
-	mux.HandleFunc("POST /admin/reset", apiCfg.handlerReset) // resets the database
-	mux.HandleFunc("GET /api/healthz", handlerReadiness)     // checks if the server is running
+	mux.Handle("/app/", serveApp)                           // serves the homepage (HTML page)
+	mux.HandleFunc("GET /api/healthz", handlerLiveness)     // checks if the server is running, even while it drains
+	mux.HandleFunc("GET /api/readyz", cfg.handlerReadiness) // checks if the server takes requests
 
-	mux.HandleFunc("POST /api/users", apiCfg.handlerCreateUser)
-	mux.HandleFunc("PUT /api/users", apiCfg.handlerUpdateUser)
-	mux.HandleFunc("POST /api/login", apiCfg.handlerUserLogin)
+	// admin endpoints are gated by the permissions embedded in the access token
+	manageUsers := auth.RequirePermission(cfg.jwtSecret, cfg.denylist, auth.PermissionManageUsers)
+	mux.Handle("POST /admin/reset", manageUsers(http.HandlerFunc(cfg.handlerReset))) // resets the database, only in dev
+	mux.Handle("GET /admin/users", manageUsers(http.HandlerFunc(cfg.handlerAdminGetUsers)))
+	mux.Handle("DELETE /admin/users/{userID}", manageUsers(http.HandlerFunc(cfg.handlerAdminDeleteUser)))
+	mux.Handle("PUT /admin/users/{userID}/roles/{role}", manageUsers(http.HandlerFunc(cfg.handlerAdminAssignRole)))
+	mux.Handle("DELETE /admin/users/{userID}/roles/{role}", manageUsers(http.HandlerFunc(cfg.handlerAdminRemoveRole)))
+	manageWebhooks := auth.RequirePermission(cfg.jwtSecret, cfg.denylist, auth.PermissionManageWebhooks)
+	mux.Handle("GET /admin/webhooks/events", manageWebhooks(http.HandlerFunc(cfg.handlerAdminGetWebhookEvents))) // ?status=failed by default
+	mux.Handle("POST /admin/webhooks/events/{eventID}/replay", manageWebhooks(http.HandlerFunc(cfg.handlerAdminReplayWebhookEvent)))
 
-	mux.HandleFunc("POST /api/refresh", apiCfg.handlerRefreshToken) // refresh access token (JWT)
-	mux.HandleFunc("POST /api/revoke", apiCfg.handlerRevokeToken)   // revoke refresh token
+	mux.HandleFunc("POST /api/users", cfg.handlerCreateUser)
+	mux.HandleFunc("PATCH /api/users", cfg.handlerUpdateUser)                      // change the email and/or the password
+	mux.HandleFunc("POST /api/users/email/confirm", cfg.handlerConfirmEmailChange) // from the link sent to the new email
+	mux.HandleFunc("POST /api/users/email/undo", cfg.handlerUndoEmailChange)       // from the link sent to the old email
+	mux.HandleFunc("DELETE /api/users", cfg.handlerDeleteAccount)                  // scheduled, with a grace period
+	mux.HandleFunc("POST /api/users/restore", cfg.handlerRestoreAccount)           // cancel the deletion during the grace period
+	mux.HandleFunc("POST /api/users/exports", cfg.handlerCreateDataExport)         // archive of the personal data
+	mux.HandleFunc("GET /api/users/exports", cfg.handlerGetDataExports)
+	mux.HandleFunc("GET /api/users/exports/{exportID}/archive", cfg.handlerDownloadDataExport)
+	mux.HandleFunc("POST /api/login", cfg.handlerUserLogin)
+	mux.HandleFunc("GET /api/login/oidc", cfg.handlerOIDCLogin) // redirects to the identity provider
+	mux.HandleFunc("GET /api/login/oidc/callback", cfg.handlerOIDCCallback)
+	mux.HandleFunc("PUT /api/profile", cfg.handlerUpdateProfile)     // set handle, display name, bio and avatar
+	mux.HandleFunc("GET /api/users/{handle}", cfg.handlerGetProfile) // public profile
+	mux.HandleFunc("POST /api/users/{handle}/follow", cfg.handlerFollowUser)
+	mux.HandleFunc("DELETE /api/users/{handle}/follow", cfg.handlerUnfollowUser)
 
-	mux.HandleFunc("POST /api/chirps", apiCfg.handlerCreateChirp)
-	mux.HandleFunc("GET /api/chirps", apiCfg.handlerGetChirps)
-	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.handlerGetSingleChirp)
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.handlerDeleteChirp)
+	mux.HandleFunc("POST /api/tokens", cfg.handlerCreateAPIToken) // personal access tokens for bots and API clients
+	mux.HandleFunc("GET /api/tokens", cfg.handlerGetAPITokens)
+	mux.HandleFunc("DELETE /api/tokens/{tokenID}", cfg.handlerRevokeAPIToken)
 
-	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerChirpyUpgrade) // webhook endpoint
+	mux.HandleFunc("POST /api/oauth/clients", cfg.handlerCreateOAuthClient) // register a third-party app
+	mux.HandleFunc("GET /api/oauth/clients", cfg.handlerGetOAuthClients)
+	mux.HandleFunc("DELETE /api/oauth/clients/{clientID}", cfg.handlerDeleteOAuthClient)
 
-	server := &http.Server{Addr: ":" + port, Handler: mux}
+	mux.HandleFunc("POST /api/webhooks", cfg.handlerCreateWebhookEndpoint) // urls the events of the account are sent to
+	mux.HandleFunc("GET /api/webhooks", cfg.handlerGetWebhookEndpoints)
+	mux.HandleFunc("PATCH /api/webhooks/{webhookID}", cfg.handlerUpdateWebhookEndpoint)
+	mux.HandleFunc("DELETE /api/webhooks/{webhookID}", cfg.handlerDeleteWebhookEndpoint)
+	mux.HandleFunc("GET /api/webhooks/{webhookID}/deliveries", cfg.handlerGetWebhookDeliveries)
 
-	log.Printf("serving on port: %v\n", port)
-	log.Fatal(server.ListenAndServe())
+	// oauth2 authorization server (authorization code flow with PKCE)
+	mux.HandleFunc("GET /oauth/authorize", cfg.handlerOAuthAuthorize)              // redirects to the consent page
+	mux.HandleFunc("POST /oauth/authorize", cfg.handlerOAuthConsent)               // the user approves or denies the app
+	mux.HandleFunc("GET /oauth/clients/{clientID}", cfg.handlerGetOAuthClientInfo) // public client info for the consent page
+	mux.HandleFunc("POST /oauth/token", cfg.handlerOAuthToken)
+	mux.HandleFunc("POST /oauth/introspect", cfg.handlerOAuthIntrospect)
+	mux.HandleFunc("POST /oauth/revoke", cfg.handlerOAuthRevoke)
+
+	mux.HandleFunc("GET /api/sessions", cfg.handlerGetSessions) // devices the user is logged in from
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", cfg.handlerRevokeSession)
+	mux.HandleFunc("POST /api/sessions/revoke-others", cfg.handlerRevokeOtherSessions) // log out everywhere else
+
+	mux.HandleFunc("POST /api/refresh", cfg.handlerRefreshToken) // refresh access token (JWT)
+	mux.HandleFunc("POST /api/revoke", cfg.handlerRevokeToken)   // revoke refresh token
+
+	mux.HandleFunc("POST /api/chirps", cfg.handlerCreateChirp)
+	mux.HandleFunc("GET /api/chirps", cfg.handlerGetChirps)
+	mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.handlerGetSingleChirp)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}", cfg.handlerDeleteChirp)
+	mux.HandleFunc("GET /api/chirps/trash", cfg.handlerGetTrashedChirps)          // deleted chirps that can still be restored
+	mux.HandleFunc("POST /api/chirps/{chirpID}/restore", cfg.handlerRestoreChirp) // restore a chirp from the trash
+	mux.HandleFunc("POST /api/chirps/{chirpID}/poll/votes", cfg.handlerVotePoll)
+
+	mux.HandleFunc("POST /api/drafts", cfg.handlerCreateDraft)
+	mux.HandleFunc("GET /api/drafts", cfg.handlerGetDrafts)
+	mux.HandleFunc("PUT /api/drafts/{draftID}", cfg.handlerUpdateDraft)
+	mux.HandleFunc("DELETE /api/drafts/{draftID}", cfg.handlerDeleteDraft)
+
+	mux.HandleFunc("POST /api/collections", cfg.handlerCreateCollection)
+	mux.HandleFunc("GET /api/collections", cfg.handlerGetCollections)
+	mux.HandleFunc("PUT /api/collections/{collectionID}", cfg.handlerRenameCollection)
+	mux.HandleFunc("DELETE /api/collections/{collectionID}", cfg.handlerDeleteCollection)
+	mux.HandleFunc("GET /api/collections/{collectionID}/bookmarks", cfg.handlerGetBookmarks) // paginated with limit and offset
+	mux.HandleFunc("POST /api/collections/{collectionID}/bookmarks", cfg.handlerAddBookmark)
+	mux.HandleFunc("DELETE /api/collections/{collectionID}/bookmarks/{chirpID}", cfg.handlerRemoveBookmark)
+
+	mux.HandleFunc("GET /api/notifications", cfg.handlerGetNotifications)
+	mux.HandleFunc("POST /api/notifications/read", cfg.handlerReadNotifications) // mark all notifications as read
+
+	mux.HandleFunc("POST /api/polka/webhooks", cfg.handlerChirpyUpgrade) // webhook endpoint, the events are stored and processed in the background
+
+	return mux
+}
+
+// argon2ParamsFromEnv func returns the default argon2id parameters, overridden by the optional
+// ARGON2_MEMORY (KiB), ARGON2_ITERATIONS and ARGON2_PARALLELISM env variables.
+// existing hashes are rehashed with the new parameters when their users log in
+func argon2ParamsFromEnv() (auth.Argon2Params, error) {
+	params := auth.DefaultArgon2Params
+	for _, setting := range []struct {
+		env  string
+		set  func(uint64)
+		bits int
+	}{
+		{"ARGON2_MEMORY", func(v uint64) { params.Memory = uint32(v) }, 32},
+		{"ARGON2_ITERATIONS", func(v uint64) { params.Iterations = uint32(v) }, 32},
+		{"ARGON2_PARALLELISM", func(v uint64) { params.Parallelism = uint8(v) }, 8},
+	} {
+		value := os.Getenv(setting.env)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseUint(value, 10, setting.bits)
+		if err != nil || parsed == 0 {
+			return auth.Argon2Params{}, fmt.Errorf("make sure %v is a positive number", setting.env)
+		}
+		setting.set(parsed)
+	}
+	return params, nil
 }
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/h0dy/http-server/sql/schema"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+const migrateUsage = "chirpy migrate up|down|status|redo"
+
+// newMigrator func returns the goose provider of the migrations embedded in the binary. the migrations are applied
+// under a postgres advisory lock, so the instances starting at once apply them one at a time
+func newMigrator(db *sql.DB) (*goose.Provider, error) {
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return nil, err
+	}
+	return goose.NewProvider(goose.DialectPostgres, db, schema.Migrations, goose.WithSessionLocker(locker))
+}
+
+// runMigrate func runs the migrate subcommand: up applies the pending migrations, down rolls back the latest one,
+// status lists them and redo rolls back the latest one and applies it again
+func runMigrate(ctx context.Context, db *sql.DB, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: " + migrateUsage)
+	}
+	migrator, err := newMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		results, err := migrator.Up(ctx)
+		for _, result := range results {
+			log.Println(result)
+		}
+		if err == nil && len(results) == 0 {
+			log.Println("no migrations to apply, the database is up to date")
+		}
+		return err
+	case "down":
+		result, err := migrator.Down(ctx)
+		if result != nil {
+			log.Println(result)
+		}
+		return err
+	case "redo":
+		result, err := migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		log.Println(result)
+		result, err = migrator.ApplyVersion(ctx, result.Source.Version, true)
+		if result != nil {
+			log.Println(result)
+		}
+		return err
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "Applied At\tMigration")
+		for _, status := range statuses {
+			appliedAt := "Pending"
+			if status.State == goose.StateApplied {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%v\t%v\n", appliedAt, status.Source.Path)
+		}
+		return w.Flush()
+	}
+	return errors.New("usage: " + migrateUsage)
+}
+
+// prepareSchema func checks the database schema is one the binary knows, and applies the pending migrations when
+// autoMigrate is set. a newer schema may have changed what the queries of this binary use, so the server doesn't start
+func prepareSchema(ctx context.Context, db *sql.DB, autoMigrate bool) error {
+	migrator, err := newMigrator(db)
+	if err != nil {
+		return err
+	}
+	current, latest, err := migrator.GetVersions(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't get the version of the database schema: %w", err)
+	}
+	if err := checkSchemaVersion(current, latest); err != nil {
+		return err
+	}
+
+	if !autoMigrate {
+		if current < latest {
+			log.Printf("the database schema is at version %d of %d, apply the migrations with `chirpy migrate up` or start with -migrate", current, latest)
+		}
+		return nil
+	}
+	results, err := migrator.Up(ctx)
+	for _, result := range results {
+		log.Println(result)
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't apply the migrations: %w", err)
+	}
+	// another instance may have applied newer migrations while this one waited for the lock
+	current, err = migrator.GetDBVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't get the version of the database schema: %w", err)
+	}
+	return checkSchemaVersion(current, latest)
+}
+
+// checkSchemaVersion func returns an error when the database schema is newer than the latest migration of the binary
+func checkSchemaVersion(current, latest int64) error {
+	if current > latest {
+		return fmt.Errorf("the database schema is at version %d, newer than the latest migration this binary knows (%d); deploy a newer binary", current, latest)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	db, err := sql.Open("postgres", "") // never connected, the migrations are only listed
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	migrator, err := newMigrator(db)
+	if err != nil {
+		t.Fatalf("newMigrator() error = %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join("sql", "schema", "*.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := migrator.ListSources()
+	if len(sources) != len(files) {
+		t.Fatalf("embedded %d migrations, want the %d of sql/schema", len(sources), len(files))
+	}
+	// goose applies them by version, a gap or a duplicate is a misnamed file
+	for i, source := range sources {
+		if source.Version != int64(i+1) {
+			t.Errorf("migration %v has version %d, want %d", source.Path, source.Version, i+1)
+		}
+	}
+	if _, err := os.Stat(filepath.Join("sql", "schema", sources[len(sources)-1].Path)); err != nil {
+		t.Errorf("latest migration isn't in sql/schema: %v", err)
+	}
+}
+
+func TestCheckSchemaVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		current int64
+		wantErr bool
+	}{
+		{name: "Empty database", current: 0},
+		{name: "Pending migrations", current: 20},
+		{name: "Up to date", current: 23},
+		{name: "Newer schema", current: 24, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSchemaVersion(tt.current, 23)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkSchemaVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// parsePagination func reads the optional limit and offset query parameters, they're parsed as 32 bits numbers
+// so a huge offset is refused instead of overflowing
+func parsePagination(r *http.Request) (limit, offset int32, err error) {
+	limit = defaultPageSize
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || parsed < 1 || parsed > maxPageSize {
+			return 0, 0, errors.New("limit must be a number between 1 and 100")
+		}
+		limit = int32(parsed)
+	}
+	if value := r.URL.Query().Get("offset"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || parsed < 0 {
+			return 0, 0, fmt.Errorf("offset must be a number between 0 and %d", math.MaxInt32)
+		}
+		offset = int32(parsed)
+	}
+	return limit, offset, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParsePagination(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantLimit  int32
+		wantOffset int32
+		wantErr    bool
+	}{
+		{name: "Defaults", query: "", wantLimit: defaultPageSize},
+		{name: "Limit and offset", query: "?limit=50&offset=100", wantLimit: 50, wantOffset: 100},
+		{name: "Largest offset", query: "?offset=2147483647", wantLimit: defaultPageSize, wantOffset: 2147483647},
+		{name: "Limit too small", query: "?limit=0", wantErr: true},
+		{name: "Limit too large", query: "?limit=101", wantErr: true},
+		{name: "Limit past 32 bits", query: "?limit=4294967297", wantErr: true},
+		{name: "Negative offset", query: "?offset=-1", wantErr: true},
+		{name: "Offset past 32 bits", query: "?offset=2147483648", wantErr: true},
+		{name: "Offset past 64 bits", query: "?offset=99999999999999999999", wantErr: true},
+		{name: "Not a number", query: "?offset=ten", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit, offset, err := parsePagination(httptest.NewRequest("GET", "/api/chirps"+tt.query, nil))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePagination() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (limit != tt.wantLimit || offset != tt.wantOffset) {
+				t.Errorf("parsePagination() = %v, %v, want %v, %v", limit, offset, tt.wantLimit, tt.wantOffset)
+			}
+		})
+	}
+}
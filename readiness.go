@@ -2,8 +2,25 @@ package main
 
 import "net/http"
 
-func handlerReadiness(w http.ResponseWriter, r *http.Request) {
+// handlerLiveness func reports that the process is up, it keeps answering while the server drains so the server
+// isn't restarted before it stops by itself
+func handlerLiveness(w http.ResponseWriter, r *http.Request) {
+	respondWithStatus(w, http.StatusOK)
+}
+
+// handlerReadiness func reports whether the server takes requests, it fails while the server drains before it stops
+// so the load balancer sends the requests to the other servers
+func (cfg *apiConfig) handlerReadiness(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	if cfg.draining.Load() {
+		status = http.StatusServiceUnavailable
+	}
+	respondWithStatus(w, status)
+}
+
+// respondWithStatus func writes the status with its text as a plain text body
+func respondWithStatus(w http.ResponseWriter, status int) {
 	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(http.StatusText(http.StatusOK)))
+	w.WriteHeader(status)
+	w.Write([]byte(http.StatusText(status)))
 }
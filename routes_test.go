@@ -0,0 +1,1457 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/auth"
+	"github.com/h0dy/http-server/internal/database"
+	"github.com/h0dy/http-server/internal/mail"
+	"github.com/h0dy/http-server/internal/store"
+	"github.com/h0dy/http-server/internal/webhook"
+)
+
+const testPassword = "violet-Mango-7-trombone"
+
+type testServer struct {
+	*httptest.Server
+	cfg   *apiConfig
+	store *store.Memory
+}
+
+// newTestServer func serves every route of the api with the in-memory store
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	t.Setenv("PLATFORM", "dev") // the reset endpoint reads it from the environment
+
+	memory := store.NewMemory()
+	cfg := &apiConfig{
+		store:     memory,
+		platform:  "dev",
+		jwtSecret: "test-secret",
+		polkaVerifier: webhook.Verifier{
+			Secrets:   []string{"polka-key"},
+			Tolerance: polkaSignatureTolerance,
+		},
+		denylist: auth.NewDenylist(),
+		mailer:   mail.LogMailer{},
+		baseURL:  "http://localhost:8080",
+
+		// the default parameters make every signup and login take a while
+		passwordParams: auth.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+	}
+	server := httptest.NewServer(cfg.routes("."))
+	t.Cleanup(server.Close)
+	return &testServer{Server: server, cfg: cfg, store: memory}
+}
+
+// request func sends body as json with the bearer token (when they aren't empty) and decodes the json response into out
+// (when it isn't nil), it returns the status code of the response
+func (s *testServer) request(t *testing.T, method, path, token string, body, out any) int {
+	t.Helper()
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("couldn't encode the request body: %v", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, s.URL+path, reqBody)
+	if err != nil {
+		t.Fatalf("couldn't create the request: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return s.do(t, req, out)
+}
+
+func (s *testServer) do(t *testing.T, req *http.Request, out any) int {
+	t.Helper()
+	res, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%v %v: %v", req.Method, req.URL.Path, err)
+	}
+	defer res.Body.Close()
+	if out != nil && res.StatusCode < 300 {
+		if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+			t.Fatalf("couldn't decode the response of %v %v: %v", req.Method, req.URL.Path, err)
+		}
+	}
+	return res.StatusCode
+}
+
+// expect func fails the test when the status code isn't the wanted one
+func expect(t *testing.T, what string, got, want int) {
+	t.Helper()
+	if got != want {
+		t.Fatalf("%v: status = %d, want %d", what, got, want)
+	}
+}
+
+type testUser struct {
+	ID           uuid.UUID `json:"id"`
+	Email        string    `json:"email"`
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+}
+
+// signup func creates a user with the test password and logs them in
+func (s *testServer) signup(t *testing.T, roles ...string) testUser {
+	t.Helper()
+	email := "user-" + uuid.NewString()[:8] + "@example.com"
+	user := testUser{}
+	expect(t, "signup", s.request(t, "POST", "/api/users", "", map[string]string{"email": email, "password": testPassword}, &user), http.StatusCreated)
+	for _, role := range roles {
+		if err := s.store.AssignUserRole(context.Background(), database.AssignUserRoleParams{UserID: user.ID, Role: role}); err != nil {
+			t.Fatalf("couldn't assign role %v: %v", role, err)
+		}
+	}
+	return s.login(t, email)
+}
+
+func (s *testServer) login(t *testing.T, email string) testUser {
+	t.Helper()
+	user := testUser{}
+	expect(t, "login", s.request(t, "POST", "/api/login", "", map[string]string{"email": email, "password": testPassword}, &user), http.StatusOK)
+	return user
+}
+
+func (s *testServer) createChirp(t *testing.T, user testUser, body any) Chirp {
+	t.Helper()
+	chirp := Chirp{}
+	expect(t, "create chirp", s.request(t, "POST", "/api/chirps", user.Token, body, &chirp), http.StatusCreated)
+	return chirp
+}
+
+func (s *testServer) createCollection(t *testing.T, user testUser, name string) Collection {
+	t.Helper()
+	collection := Collection{}
+	expect(t, "create collection", s.request(t, "POST", "/api/collections", user.Token, map[string]string{"name": name}, &collection), http.StatusCreated)
+	return collection
+}
+
+// createOAuthClient func registers an app of user, the client secret is only set for a confidential app
+func (s *testServer) createOAuthClient(t *testing.T, user testUser, confidential bool) (OAuthClient, string) {
+	t.Helper()
+	created := struct {
+		OAuthClient
+		ClientSecret string `json:"client_secret"`
+	}{}
+	expect(t, "create app", s.request(t, "POST", "/api/oauth/clients", user.Token, map[string]any{
+		"name":          "app",
+		"redirect_uris": []string{"https://app.example.com/callback"},
+		"confidential":  confidential,
+	}, &created), http.StatusCreated)
+	return created.OAuthClient, created.ClientSecret
+}
+
+// authorizeOAuthClient func returns the authorization code of user approving the app for scope, with the code
+// verifier of its PKCE challenge
+func (s *testServer) authorizeOAuthClient(t *testing.T, user testUser, client OAuthClient, scope string) (code, verifier string) {
+	t.Helper()
+	verifier = uuid.NewString() + uuid.NewString()
+	consent := struct {
+		RedirectTo string `json:"redirect_to"`
+	}{}
+	expect(t, "approve", s.request(t, "POST", "/oauth/authorize", user.Token, map[string]any{
+		"response_type":         "code",
+		"client_id":             client.ClientID,
+		"redirect_uri":          client.RedirectURIs[0],
+		"scope":                 scope,
+		"state":                 "xyz",
+		"code_challenge":        auth.MakeCodeChallenge(verifier),
+		"code_challenge_method": auth.PKCEMethodS256,
+		"approved":              true,
+	}, &consent), http.StatusOK)
+	redirect, err := url.Parse(consent.RedirectTo)
+	if err != nil {
+		t.Fatalf("couldn't parse the redirect %q: %v", consent.RedirectTo, err)
+	}
+	if redirect.Query().Get("state") != "xyz" || redirect.Query().Get("code") == "" {
+		t.Fatalf("redirect = %v, want the code with the state", consent.RedirectTo)
+	}
+	return redirect.Query().Get("code"), verifier
+}
+
+type oauthTokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// oauthForm func posts form to an oauth endpoint, authenticated as the app with http basic auth
+func (s *testServer) oauthForm(t *testing.T, path string, client OAuthClient, secret string, form url.Values, out any) int {
+	t.Helper()
+	req, err := http.NewRequest("POST", s.URL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatalf("couldn't create the request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(client.ClientID, secret)
+	return s.do(t, req, out)
+}
+
+// oauthTokens func exchanges the authorization code of user approving the app for scope
+func (s *testServer) oauthTokens(t *testing.T, user testUser, client OAuthClient, secret, scope string) oauthTokens {
+	t.Helper()
+	code, verifier := s.authorizeOAuthClient(t, user, client, scope)
+	tokens := oauthTokens{}
+	expect(t, "exchange the code", s.oauthForm(t, "/oauth/token", client, secret, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {client.RedirectURIs[0]},
+		"code_verifier": {verifier},
+	}, &tokens), http.StatusOK)
+	return tokens
+}
+
+type testWebhookEndpoint struct {
+	WebhookEndpoint
+	Secret string `json:"secret"`
+}
+
+// sendPolkaEvent func sends the polka webhook with body, signed with the polka key
+func (s *testServer) sendPolkaEvent(t *testing.T, body string) int {
+	t.Helper()
+	req, err := http.NewRequest("POST", s.URL+"/api/polka/webhooks", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	req.Header.Set(polkaTimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(polkaSignatureHeader, webhook.Sign("polka-key", now, []byte(body)))
+	return s.do(t, req, nil)
+}
+
+// failedPolkaEvent func stores a polka event for a user that doesn't exist and fails it for good
+func (s *testServer) failedPolkaEvent(t *testing.T) string {
+	t.Helper()
+	id := uuid.NewString()
+	expect(t, "send event", s.sendPolkaEvent(t, `{"id":"`+id+`","event":"user.upgraded","data":{"user_id":"`+uuid.NewString()+`"}}`), http.StatusNoContent)
+	s.cfg.processWebhookEvents(context.Background())
+	if err := s.cfg.store.FailWebhookEvent(context.Background(), database.FailWebhookEventParams{
+		ID:            id,
+		Status:        webhookEventFailed,
+		NextAttemptAt: time.Now().UTC(),
+		LastError:     "couldn't find the user",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// createWebhookEndpoint func registers a webhook of user for the events
+func (s *testServer) createWebhookEndpoint(t *testing.T, user testUser, url string, events ...string) testWebhookEndpoint {
+	t.Helper()
+	endpoint := testWebhookEndpoint{}
+	expect(t, "create webhook", s.request(t, "POST", "/api/webhooks", user.Token, map[string]any{"url": url, "events": events}, &endpoint), http.StatusCreated)
+	return endpoint
+}
+
+// webhookReceiver func serves the webhooks sent by the server with handler, every endpoint url is sent to it whatever
+// its host. the certificate of the receiver is valid for example.com, the urls of the endpoints have to use it
+func (s *testServer) webhookReceiver(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	receiver := httptest.NewTLSServer(handler)
+	t.Cleanup(receiver.Close)
+	transport := receiver.Client().Transport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, receiver.Listener.Addr().String())
+	}
+	s.cfg.webhookSender = webhook.Sender{
+		Client:          &http.Client{Timeout: time.Second, Transport: transport},
+		TimestampHeader: chirpyTimestampHeader,
+		SignatureHeader: chirpySignatureHeader,
+	}
+}
+
+// closedPollVoter func returns a user who voted on a poll of author that closed, once its voters are notified
+func (s *testServer) closedPollVoter(t *testing.T, author testUser) testUser {
+	t.Helper()
+	ctx := context.Background()
+	voter := s.signup(t)
+	chirp := s.createChirp(t, author, map[string]string{"body": "lunch?"})
+	// the api only creates polls that close in the future
+	poll, err := s.store.CreatePoll(ctx, database.CreatePollParams{ChirpID: chirp.ID, ClosesAt: time.Now().UTC().Add(-time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	option, err := s.store.CreatePollOption(ctx, database.CreatePollOptionParams{PollID: poll.ID, Text: "pizza"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.store.CreatePollVote(ctx, database.CreatePollVoteParams{PollID: poll.ID, UserID: voter.ID, OptionID: option.ID}); err != nil {
+		t.Fatal(err)
+	}
+	s.cfg.notifyClosedPolls(ctx)
+	return voter
+}
+
+// routeTests has a test for every route registered in routes, they run end to end with the in-memory store
+var routeTests = map[string]func(t *testing.T, s *testServer){
+	"/app/": func(t *testing.T, s *testServer) {
+		res, err := s.Client().Get(s.URL + "/app/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		expect(t, "homepage", res.StatusCode, http.StatusOK)
+		if !strings.Contains(string(body), "Welcome to Chirpy") {
+			t.Errorf("homepage = %q, want the index.html page", body)
+		}
+	},
+	"POST /admin/reset": func(t *testing.T, s *testServer) {
+		admin := s.signup(t, auth.RoleAdmin)
+		moderator := s.signup(t, auth.RoleModerator)
+		user := s.signup(t)
+		expect(t, "no token", s.request(t, "POST", "/admin/reset", "", nil, nil), http.StatusUnauthorized)
+		expect(t, "user token", s.request(t, "POST", "/admin/reset", user.Token, nil, nil), http.StatusForbidden)
+		expect(t, "moderator token", s.request(t, "POST", "/admin/reset", moderator.Token, nil, nil), http.StatusForbidden)
+		expect(t, "reset", s.request(t, "POST", "/admin/reset", admin.Token, nil, nil), http.StatusOK)
+		expect(t, "login after reset", s.request(t, "POST", "/api/login", "", map[string]string{"email": user.Email, "password": testPassword}, nil), http.StatusBadRequest)
+
+		t.Setenv("PLATFORM", "prod")
+		admin = s.signup(t, auth.RoleAdmin)
+		expect(t, "reset in prod", s.request(t, "POST", "/admin/reset", admin.Token, nil, nil), http.StatusForbidden)
+	},
+	"GET /api/healthz": func(t *testing.T, s *testServer) {
+		expect(t, "healthz", s.request(t, "GET", "/api/healthz", "", nil, nil), http.StatusOK)
+		s.cfg.draining.Store(true)
+		expect(t, "healthz while draining", s.request(t, "GET", "/api/healthz", "", nil, nil), http.StatusOK)
+	},
+	"GET /api/readyz": func(t *testing.T, s *testServer) {
+		expect(t, "readyz", s.request(t, "GET", "/api/readyz", "", nil, nil), http.StatusOK)
+		s.cfg.draining.Store(true)
+		expect(t, "readyz while draining", s.request(t, "GET", "/api/readyz", "", nil, nil), http.StatusServiceUnavailable)
+	},
+
+	"GET /admin/users": func(t *testing.T, s *testServer) {
+		admin := s.signup(t, auth.RoleAdmin)
+		user := s.signup(t)
+		expect(t, "no token", s.request(t, "GET", "/admin/users", "", nil, nil), http.StatusUnauthorized)
+		expect(t, "user token", s.request(t, "GET", "/admin/users", user.Token, nil, nil), http.StatusForbidden)
+
+		users := []struct {
+			ID    uuid.UUID `json:"id"`
+			Roles []string  `json:"roles"`
+		}{}
+		expect(t, "admin token", s.request(t, "GET", "/admin/users", admin.Token, nil, &users), http.StatusOK)
+		if len(users) != 2 {
+			t.Fatalf("got %d users, want 2", len(users))
+		}
+		for _, u := range users {
+			if u.ID == admin.ID && !slices.Equal(u.Roles, []string{auth.RoleAdmin}) {
+				t.Errorf("roles of the admin = %v, want [%v]", u.Roles, auth.RoleAdmin)
+			}
+		}
+	},
+	"DELETE /admin/users/{userID}": func(t *testing.T, s *testServer) {
+		admin := s.signup(t, auth.RoleAdmin)
+		user := s.signup(t)
+		expect(t, "delete", s.request(t, "DELETE", "/admin/users/"+user.ID.String(), admin.Token, nil, nil), http.StatusNoContent)
+		expect(t, "delete again", s.request(t, "DELETE", "/admin/users/"+user.ID.String(), admin.Token, nil, nil), http.StatusNotFound)
+		expect(t, "login of the deleted user", s.request(t, "POST", "/api/login", "", map[string]string{"email": user.Email, "password": testPassword}, nil), http.StatusBadRequest)
+	},
+	"PUT /admin/users/{userID}/roles/{role}": func(t *testing.T, s *testServer) {
+		admin := s.signup(t, auth.RoleAdmin)
+		user := s.signup(t)
+		expect(t, "unknown role", s.request(t, "PUT", "/admin/users/"+user.ID.String()+"/roles/owner", admin.Token, nil, nil), http.StatusBadRequest)
+		expect(t, "assign", s.request(t, "PUT", "/admin/users/"+user.ID.String()+"/roles/"+auth.RoleModerator, admin.Token, nil, nil), http.StatusNoContent)
+
+		// the permissions of the role are in the next access token, a moderator can delete the chirps of others
+		chirp := s.createChirp(t, admin, map[string]string{"body": "moderate me"})
+		moderator := s.login(t, user.Email)
+		expect(t, "moderator deletes a chirp", s.request(t, "DELETE", "/api/chirps/"+chirp.ID.String(), moderator.Token, nil, nil), http.StatusNoContent)
+	},
+	"DELETE /admin/users/{userID}/roles/{role}": func(t *testing.T, s *testServer) {
+		admin := s.signup(t, auth.RoleAdmin)
+		user := s.signup(t, auth.RoleModerator)
+		other := s.signup(t)
+		chirp := s.createChirp(t, other, map[string]string{"body": "hello"})
+		path := "/admin/users/" + user.ID.String() + "/roles/" + auth.RoleModerator
+		// the revocation covers the tokens issued before the second it's made in
+		time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+		expect(t, "remove", s.request(t, "DELETE", path, admin.Token, nil, nil), http.StatusNoContent)
+		expect(t, "delete a chirp with the old token", s.request(t, "DELETE", "/api/chirps/"+chirp.ID.String(), user.Token, nil, nil), http.StatusUnauthorized)
+
+		refreshed := struct {
+			Token string `json:"token"`
+		}{}
+		expect(t, "refresh", s.request(t, "POST", "/api/refresh", user.RefreshToken, nil, &refreshed), http.StatusOK)
+		expect(t, "delete a chirp without the role", s.request(t, "DELETE", "/api/chirps/"+chirp.ID.String(), refreshed.Token, nil, nil), http.StatusForbidden)
+		expect(t, "remove again", s.request(t, "DELETE", path, admin.Token, nil, nil), http.StatusNotFound)
+		expect(t, "remove own admin role", s.request(t, "DELETE", "/admin/users/"+admin.ID.String()+"/roles/"+auth.RoleAdmin, admin.Token, nil, nil), http.StatusBadRequest)
+	},
+	"GET /admin/webhooks/events": func(t *testing.T, s *testServer) {
+		admin := s.signup(t, auth.RoleAdmin)
+		user := s.signup(t)
+		failed := s.failedPolkaEvent(t)
+		expect(t, "send event", s.sendPolkaEvent(t, `{"id":"pending","event":"user.upgraded","data":{"user_id":"`+uuid.NewString()+`"}}`), http.StatusNoContent)
+
+		events := []WebhookEvent{}
+		expect(t, "list failed", s.request(t, "GET", "/admin/webhooks/events", admin.Token, nil, &events), http.StatusOK)
+		if len(events) != 1 || events[0].ID != failed || events[0].Status != webhookEventFailed || events[0].Attempts != 2 {
+			t.Errorf("events = %+v, want the failed event", events)
+		}
+		expect(t, "list pending", s.request(t, "GET", "/admin/webhooks/events?status=pending", admin.Token, nil, &events), http.StatusOK)
+		if len(events) != 1 || events[0].ID != "pending" || events[0].Event != "user.upgraded" {
+			t.Errorf("events = %+v, want the pending event", events)
+		}
+		expect(t, "user token", s.request(t, "GET", "/admin/webhooks/events", user.Token, nil, nil), http.StatusForbidden)
+		expect(t, "unknown status", s.request(t, "GET", "/admin/webhooks/events?status=bogus", admin.Token, nil, nil), http.StatusBadRequest)
+		expect(t, "offset past 32 bits", s.request(t, "GET", "/admin/webhooks/events?offset=4294967296", admin.Token, nil, nil), http.StatusBadRequest)
+	},
+	"POST /admin/webhooks/events/{eventID}/replay": func(t *testing.T, s *testServer) {
+		admin := s.signup(t, auth.RoleAdmin)
+		user := s.signup(t)
+		path := "/admin/webhooks/events/" + s.failedPolkaEvent(t) + "/replay"
+		event := WebhookEvent{}
+		expect(t, "replay", s.request(t, "POST", path, admin.Token, nil, &event), http.StatusOK)
+		if event.Status != webhookEventPending || event.Attempts != 0 || event.LastError != "" {
+			t.Errorf("replayed event = %+v, want it pending with all its attempts", event)
+		}
+		expect(t, "replay a pending event", s.request(t, "POST", path, admin.Token, nil, nil), http.StatusConflict)
+		expect(t, "unknown event", s.request(t, "POST", "/admin/webhooks/events/"+uuid.NewString()+"/replay", admin.Token, nil, nil), http.StatusNotFound)
+		expect(t, "no token", s.request(t, "POST", path, "", nil, nil), http.StatusUnauthorized)
+		expect(t, "user token", s.request(t, "POST", path, user.Token, nil, nil), http.StatusForbidden)
+	},
+
+	"POST /api/users": func(t *testing.T, s *testServer) {
+		user := testUser{}
+		expect(t, "signup", s.request(t, "POST", "/api/users", "", map[string]string{"email": "new@example.com", "password": testPassword}, &user), http.StatusCreated)
+		if user.Email != "new@example.com" || user.ID == uuid.Nil {
+			t.Errorf("signup returned %+v", user)
+		}
+		expect(t, "no email", s.request(t, "POST", "/api/users", "", map[string]string{"password": testPassword}, nil), http.StatusBadRequest)
+		expect(t, "weak password", s.request(t, "POST", "/api/users", "", map[string]string{"email": "weak@example.com", "password": "123"}, nil), http.StatusBadRequest)
+	},
+	"PATCH /api/users": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		other := s.login(t, user.Email) // a second session
+		newPassword := "copper-Lantern-4-walrus"
+		expect(t, "wrong password", s.request(t, "PATCH", "/api/users", user.Token, map[string]any{"current_password": "nope", "password": newPassword}, nil), http.StatusUnauthorized)
+		expect(t, "password like the new email", s.request(t, "PATCH", "/api/users", user.Token, map[string]any{
+			"current_password": testPassword,
+			"email":            "copper.lantern@example.com",
+			"password":         newPassword,
+		}, nil), http.StatusBadRequest)
+
+		res := struct {
+			Token           string `json:"token"`
+			RevokedSessions int64  `json:"revoked_sessions"`
+		}{}
+		expect(t, "change password", s.request(t, "PATCH", "/api/users", user.Token, map[string]any{
+			"current_password":      testPassword,
+			"password":              newPassword,
+			"revoke_other_sessions": true,
+		}, &res), http.StatusOK)
+		if res.Token == "" || res.RevokedSessions != 1 {
+			t.Errorf("change password returned %+v, want a token and 1 revoked session", res)
+		}
+		expect(t, "refresh the other session", s.request(t, "POST", "/api/refresh", other.RefreshToken, nil, nil), http.StatusUnauthorized)
+		expect(t, "login with the old password", s.request(t, "POST", "/api/login", "", map[string]string{"email": user.Email, "password": testPassword}, nil), http.StatusUnauthorized)
+		expect(t, "login with the new password", s.request(t, "POST", "/api/login", "", map[string]string{"email": user.Email, "password": newPassword}, nil), http.StatusOK)
+	},
+	"POST /api/users/email/confirm": func(t *testing.T, s *testServer) {
+		expect(t, "no token", s.request(t, "POST", "/api/users/email/confirm", "", "not an object", nil), http.StatusBadRequest)
+	},
+	"POST /api/users/email/undo": func(t *testing.T, s *testServer) {
+		expect(t, "no token", s.request(t, "POST", "/api/users/email/undo", "", "not an object", nil), http.StatusBadRequest)
+		expect(t, "no new password", s.request(t, "POST", "/api/users/email/undo", "", map[string]string{"token": "token"}, nil), http.StatusBadRequest)
+	},
+	"DELETE /api/users": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		expect(t, "no token", s.request(t, "DELETE", "/api/users", "", map[string]string{"password": testPassword}, nil), http.StatusUnauthorized)
+		expect(t, "wrong password", s.request(t, "DELETE", "/api/users", user.Token, map[string]string{"password": "nope"}, nil), http.StatusUnauthorized)
+
+		deleted := struct {
+			DeleteAfter *time.Time `json:"delete_after"`
+		}{}
+		expect(t, "delete", s.request(t, "DELETE", "/api/users", user.Token, map[string]string{"password": testPassword}, &deleted), http.StatusOK)
+		if deleted.DeleteAfter == nil || deleted.DeleteAfter.Before(time.Now().Add(accountDeletionGracePeriod-time.Hour)) {
+			t.Errorf("delete returned delete_after %v, want in %v", deleted.DeleteAfter, accountDeletionGracePeriod)
+		}
+		expect(t, "refresh the session", s.request(t, "POST", "/api/refresh", user.RefreshToken, nil, nil), http.StatusUnauthorized)
+		expect(t, "login", s.request(t, "POST", "/api/login", "", map[string]string{"email": user.Email, "password": testPassword}, nil), http.StatusForbidden)
+
+		restored := testUser{}
+		expect(t, "restore", s.request(t, "POST", "/api/users/restore", "", map[string]string{"email": user.Email, "password": testPassword}, &restored), http.StatusOK)
+		if restored.Token == "" {
+			t.Errorf("restore returned %+v, want the tokens", restored)
+		}
+		s.login(t, user.Email)
+	},
+	"POST /api/users/restore": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		expect(t, "wrong password", s.request(t, "POST", "/api/users/restore", "", map[string]string{"email": user.Email, "password": "nope"}, nil), http.StatusUnauthorized)
+		expect(t, "not scheduled", s.request(t, "POST", "/api/users/restore", "", map[string]string{"email": user.Email, "password": testPassword}, nil), http.StatusBadRequest)
+	},
+	"POST /api/users/exports": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		export := DataExport{}
+		expect(t, "create", s.request(t, "POST", "/api/users/exports", user.Token, nil, &export), http.StatusAccepted)
+		if export.Status != dataExportPending || export.CompletedAt != nil {
+			t.Errorf("export = %+v, want it pending", export)
+		}
+		expect(t, "create while pending", s.request(t, "POST", "/api/users/exports", user.Token, nil, nil), http.StatusConflict)
+		s.cfg.generateDataExports(context.Background())
+		expect(t, "create once ready", s.request(t, "POST", "/api/users/exports", user.Token, nil, nil), http.StatusAccepted)
+		expect(t, "no token", s.request(t, "POST", "/api/users/exports", "", nil, nil), http.StatusUnauthorized)
+	},
+	"GET /api/users/exports": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		expect(t, "create", s.request(t, "POST", "/api/users/exports", user.Token, nil, nil), http.StatusAccepted)
+		expect(t, "create for another user", s.request(t, "POST", "/api/users/exports", s.signup(t).Token, nil, nil), http.StatusAccepted)
+		s.cfg.generateDataExports(context.Background())
+
+		exports := []DataExport{}
+		expect(t, "list", s.request(t, "GET", "/api/users/exports", user.Token, nil, &exports), http.StatusOK)
+		if len(exports) != 1 || exports[0].Status != dataExportReady || exports[0].CompletedAt == nil || exports[0].ExpiresAt == nil {
+			t.Errorf("exports = %+v, want the ready export of the user", exports)
+		}
+		expect(t, "no token", s.request(t, "GET", "/api/users/exports", "", nil, nil), http.StatusUnauthorized)
+	},
+	"GET /api/users/exports/{exportID}/archive": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		s.createChirp(t, user, map[string]string{"body": "exported"})
+		export := DataExport{}
+		expect(t, "create", s.request(t, "POST", "/api/users/exports", user.Token, nil, &export), http.StatusAccepted)
+		path := "/api/users/exports/" + export.ID.String() + "/archive"
+		expect(t, "download while pending", s.request(t, "GET", path, user.Token, nil, nil), http.StatusConflict)
+		s.cfg.generateDataExports(context.Background())
+
+		req, err := http.NewRequest("GET", s.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+user.Token)
+		res, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		if err != nil || res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "application/zip" {
+			t.Fatalf("download = %v %v, %v, want the zip archive", res.StatusCode, res.Header.Get("Content-Type"), err)
+		}
+		archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		if err != nil {
+			t.Fatalf("couldn't read the archive: %v", err)
+		}
+		files := map[string]string{}
+		for _, file := range archive.File {
+			content, err := file.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(content)
+			content.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[file.Name] = string(data)
+		}
+		if !strings.Contains(files["profile.json"], user.Email) || !strings.Contains(files["chirps.json"], "exported") {
+			t.Errorf("archive = %v, want the profile and the chirps of the user", files)
+		}
+
+		expect(t, "download by another user", s.request(t, "GET", path, s.signup(t).Token, nil, nil), http.StatusNotFound)
+		expect(t, "invalid id", s.request(t, "GET", "/api/users/exports/not-an-id/archive", user.Token, nil, nil), http.StatusBadRequest)
+		expect(t, "no token", s.request(t, "GET", path, "", nil, nil), http.StatusUnauthorized)
+	},
+	"POST /api/login": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		if user.Token == "" || user.RefreshToken == "" {
+			t.Errorf("login returned %+v, want the tokens", user)
+		}
+		expect(t, "wrong password", s.request(t, "POST", "/api/login", "", map[string]string{"email": user.Email, "password": "nope"}, nil), http.StatusUnauthorized)
+		expect(t, "unknown email", s.request(t, "POST", "/api/login", "", map[string]string{"email": "nobody@example.com", "password": testPassword}, nil), http.StatusBadRequest)
+	},
+	"GET /api/login/oidc": func(t *testing.T, s *testServer) {
+		expect(t, "not configured", s.request(t, "GET", "/api/login/oidc", "", nil, nil), http.StatusNotFound)
+	},
+	"GET /api/login/oidc/callback": func(t *testing.T, s *testServer) {
+		expect(t, "not configured", s.request(t, "GET", "/api/login/oidc/callback?code=x&state=y", "", nil, nil), http.StatusNotFound)
+	},
+	"PUT /api/profile": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		other := s.signup(t)
+		expect(t, "set handle", s.request(t, "PUT", "/api/profile", user.Token, map[string]string{"handle": "Chirper"}, nil), http.StatusOK)
+		expect(t, "taken handle", s.request(t, "PUT", "/api/profile", other.Token, map[string]string{"handle": "chirper"}, nil), http.StatusConflict)
+		expect(t, "invalid handle", s.request(t, "PUT", "/api/profile", other.Token, map[string]string{"handle": "no spaces"}, nil), http.StatusBadRequest)
+		expect(t, "reserved handle", s.request(t, "PUT", "/api/profile", other.Token, map[string]string{"handle": "exports"}, nil), http.StatusBadRequest)
+		expect(t, "no token", s.request(t, "PUT", "/api/profile", "", map[string]string{"handle": "anon"}, nil), http.StatusUnauthorized)
+	},
+	"GET /api/users/{handle}": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		expect(t, "set handle", s.request(t, "PUT", "/api/profile", user.Token, map[string]string{"handle": "chirper", "bio": "hi"}, nil), http.StatusOK)
+		s.createChirp(t, user, map[string]string{"body": "first"})
+
+		profile := Profile{}
+		expect(t, "get profile", s.request(t, "GET", "/api/users/@chirper", "", nil, &profile), http.StatusOK)
+		if profile.ID != user.ID || profile.Bio != "hi" || profile.ChirpsCount != 1 {
+			t.Errorf("profile = %+v", profile)
+		}
+		expect(t, "unknown handle", s.request(t, "GET", "/api/users/nobody", "", nil, nil), http.StatusNotFound)
+	},
+	"POST /api/users/{handle}/follow": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		follower := s.signup(t)
+		expect(t, "set handle", s.request(t, "PUT", "/api/profile", user.Token, map[string]string{"handle": "chirper"}, nil), http.StatusOK)
+		expect(t, "follow", s.request(t, "POST", "/api/users/chirper/follow", follower.Token, nil, nil), http.StatusNoContent)
+		expect(t, "follow again", s.request(t, "POST", "/api/users/@chirper/follow", follower.Token, nil, nil), http.StatusNoContent)
+
+		profile := Profile{}
+		expect(t, "get profile", s.request(t, "GET", "/api/users/chirper", "", nil, &profile), http.StatusOK)
+		if profile.FollowersCount != 1 {
+			t.Errorf("profile has %d followers, want 1", profile.FollowersCount)
+		}
+		expect(t, "follow yourself", s.request(t, "POST", "/api/users/chirper/follow", user.Token, nil, nil), http.StatusBadRequest)
+		expect(t, "unknown handle", s.request(t, "POST", "/api/users/nobody/follow", user.Token, nil, nil), http.StatusNotFound)
+	},
+	"DELETE /api/users/{handle}/follow": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		follower := s.signup(t)
+		expect(t, "set handle", s.request(t, "PUT", "/api/profile", user.Token, map[string]string{"handle": "chirper"}, nil), http.StatusOK)
+		expect(t, "follow", s.request(t, "POST", "/api/users/chirper/follow", follower.Token, nil, nil), http.StatusNoContent)
+		expect(t, "unfollow", s.request(t, "DELETE", "/api/users/chirper/follow", follower.Token, nil, nil), http.StatusNoContent)
+		expect(t, "unfollow again", s.request(t, "DELETE", "/api/users/chirper/follow", follower.Token, nil, nil), http.StatusNotFound)
+
+		profile := Profile{}
+		expect(t, "get profile", s.request(t, "GET", "/api/users/chirper", "", nil, &profile), http.StatusOK)
+		if profile.FollowersCount != 0 {
+			t.Errorf("profile has %d followers, want 0", profile.FollowersCount)
+		}
+		expect(t, "unknown handle", s.request(t, "DELETE", "/api/users/nobody/follow", user.Token, nil, nil), http.StatusNotFound)
+	},
+
+	"POST /api/tokens": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		created := struct {
+			APIToken
+			Token string `json:"token"`
+		}{}
+		expect(t, "create", s.request(t, "POST", "/api/tokens", user.Token, map[string]any{"name": "bot", "scopes": []string{auth.ScopeChirpsWrite}}, &created), http.StatusCreated)
+		if !strings.HasPrefix(created.Token, auth.APITokenPrefix) || created.Name != "bot" {
+			t.Errorf("created token = %+v", created)
+		}
+
+		// the token works like an access token with its scopes only
+		s.createChirp(t, testUser{Token: created.Token}, map[string]string{"body": "beep"})
+		expect(t, "outside its scopes", s.request(t, "GET", "/api/tokens", created.Token, nil, nil), http.StatusForbidden)
+		expect(t, "unknown scope", s.request(t, "POST", "/api/tokens", user.Token, map[string]any{"name": "bot", "scopes": []string{"everything"}}, nil), http.StatusBadRequest)
+		expect(t, "expired", s.request(t, "POST", "/api/tokens", user.Token, map[string]any{"name": "bot", "scopes": []string{auth.ScopeChirpsRead}, "expires_at": time.Now().Add(-time.Hour)}, nil), http.StatusBadRequest)
+	},
+	"GET /api/tokens": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		created := APIToken{}
+		expect(t, "create", s.request(t, "POST", "/api/tokens", user.Token, map[string]any{"name": "bot", "scopes": []string{auth.ScopeChirpsRead}}, &created), http.StatusCreated)
+		apiTokens := []APIToken{}
+		expect(t, "list", s.request(t, "GET", "/api/tokens", user.Token, nil, &apiTokens), http.StatusOK)
+		if len(apiTokens) != 1 || apiTokens[0].ID != created.ID {
+			t.Errorf("tokens = %+v, want the created token", apiTokens)
+		}
+		expect(t, "no token", s.request(t, "GET", "/api/tokens", "", nil, nil), http.StatusUnauthorized)
+	},
+	"DELETE /api/tokens/{tokenID}": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		created := struct {
+			APIToken
+			Token string `json:"token"`
+		}{}
+		expect(t, "create", s.request(t, "POST", "/api/tokens", user.Token, map[string]any{"name": "bot", "scopes": []string{auth.ScopeChirpsRead}}, &created), http.StatusCreated)
+		expect(t, "use", s.request(t, "GET", "/api/notifications", created.Token, nil, nil), http.StatusOK)
+		expect(t, "revoke", s.request(t, "DELETE", "/api/tokens/"+created.ID.String(), user.Token, nil, nil), http.StatusNoContent)
+		expect(t, "revoke again", s.request(t, "DELETE", "/api/tokens/"+created.ID.String(), user.Token, nil, nil), http.StatusNotFound)
+		expect(t, "use after revoke", s.request(t, "GET", "/api/notifications", created.Token, nil, nil), http.StatusUnauthorized)
+		expect(t, "invalid id", s.request(t, "DELETE", "/api/tokens/not-an-id", user.Token, nil, nil), http.StatusBadRequest)
+	},
+
+	"POST /api/oauth/clients": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		client, secret := s.createOAuthClient(t, user, true)
+		if !strings.HasPrefix(client.ClientID, "chirpy_") || !client.Confidential || secret == "" {
+			t.Errorf("created app = %+v with secret %q, want a confidential app with its secret", client, secret)
+		}
+		public, secret := s.createOAuthClient(t, user, false)
+		if public.Confidential || secret != "" {
+			t.Errorf("created app = %+v with secret %q, want a public app without secret", public, secret)
+		}
+		expect(t, "http redirect uri", s.request(t, "POST", "/api/oauth/clients", user.Token, map[string]any{"name": "app", "redirect_uris": []string{"http://app.example.com/callback"}}, nil), http.StatusBadRequest)
+		expect(t, "no name", s.request(t, "POST", "/api/oauth/clients", user.Token, map[string]any{"redirect_uris": []string{"https://app.example.com/callback"}}, nil), http.StatusBadRequest)
+		expect(t, "no token", s.request(t, "POST", "/api/oauth/clients", "", map[string]any{"name": "app"}, nil), http.StatusUnauthorized)
+	},
+	"GET /api/oauth/clients": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		other := s.signup(t)
+		first, _ := s.createOAuthClient(t, user, true)
+		second, _ := s.createOAuthClient(t, user, false)
+		s.createOAuthClient(t, other, false)
+		clients := []OAuthClient{}
+		expect(t, "list", s.request(t, "GET", "/api/oauth/clients", user.Token, nil, &clients), http.StatusOK)
+		if len(clients) != 2 || clients[0].ClientID != first.ClientID || clients[1].ClientID != second.ClientID {
+			t.Errorf("apps = %+v, want the 2 apps of the user", clients)
+		}
+		expect(t, "no token", s.request(t, "GET", "/api/oauth/clients", "", nil, nil), http.StatusUnauthorized)
+	},
+	"DELETE /api/oauth/clients/{clientID}": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		other := s.signup(t)
+		client, secret := s.createOAuthClient(t, user, true)
+		tokens := s.oauthTokens(t, other, client, secret, auth.ScopeChirpsRead)
+		expect(t, "use the access token", s.request(t, "GET", "/api/notifications", tokens.AccessToken, nil, nil), http.StatusOK)
+
+		path := "/api/oauth/clients/" + client.ClientID
+		expect(t, "delete by another user", s.request(t, "DELETE", path, other.Token, nil, nil), http.StatusNotFound)
+		expect(t, "delete", s.request(t, "DELETE", path, user.Token, nil, nil), http.StatusNoContent)
+		expect(t, "delete again", s.request(t, "DELETE", path, user.Token, nil, nil), http.StatusNotFound)
+		expect(t, "use the access token of the deleted app", s.request(t, "GET", "/api/notifications", tokens.AccessToken, nil, nil), http.StatusUnauthorized)
+		expect(t, "refresh by the deleted app", s.oauthForm(t, "/oauth/token", client, secret, url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {tokens.RefreshToken},
+		}, nil), http.StatusUnauthorized)
+	},
+
+	"POST /api/webhooks": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		endpoint := s.createWebhookEndpoint(t, user, "https://example.com/hooks", webhookChirpCreated, webhookChirpCreated)
+		if !strings.HasPrefix(endpoint.Secret, webhookSecretPrefix) || !endpoint.Enabled || endpoint.ClientID != nil ||
+			!slices.Equal(endpoint.Events, []string{webhookChirpCreated}) {
+			t.Errorf("created webhook = %+v, want an enabled webhook with its secret", endpoint)
+		}
+		for what, body := range map[string]map[string]any{
+			"ftp url":       {"url": "ftp://example.com", "events": []string{webhookChirpCreated}},
+			"local network": {"url": "https://127.0.0.1/hooks", "events": []string{webhookChirpCreated}},
+			"unknown event": {"url": "https://example.com/hooks", "events": []string{"chirp.liked"}},
+			"no events":     {"url": "https://example.com/hooks"},
+		} {
+			expect(t, what, s.request(t, "POST", "/api/webhooks", user.Token, body, nil), http.StatusBadRequest)
+		}
+		for range maxWebhookEndpoints - 1 {
+			s.createWebhookEndpoint(t, user, "https://example.com/hooks", webhookChirpDeleted)
+		}
+		expect(t, "too many", s.request(t, "POST", "/api/webhooks", user.Token, map[string]any{"url": "https://example.com/hooks", "events": []string{webhookChirpCreated}}, nil), http.StatusConflict)
+		expect(t, "no token", s.request(t, "POST", "/api/webhooks", "", map[string]any{"url": "https://example.com/hooks"}, nil), http.StatusUnauthorized)
+	},
+	"GET /api/webhooks": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		first := s.createWebhookEndpoint(t, user, "https://example.com/first", webhookChirpCreated)
+		second := s.createWebhookEndpoint(t, user, "https://example.com/second", webhookFollowerCreated)
+		s.createWebhookEndpoint(t, s.signup(t), "https://example.com/other", webhookChirpCreated)
+		endpoints := []WebhookEndpoint{}
+		expect(t, "list", s.request(t, "GET", "/api/webhooks", user.Token, nil, &endpoints), http.StatusOK)
+		if len(endpoints) != 2 || endpoints[0].ID != first.ID || endpoints[1].ID != second.ID {
+			t.Errorf("webhooks = %+v, want the 2 webhooks of the user", endpoints)
+		}
+		expect(t, "no token", s.request(t, "GET", "/api/webhooks", "", nil, nil), http.StatusUnauthorized)
+	},
+	"PATCH /api/webhooks/{webhookID}": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		path := "/api/webhooks/" + s.createWebhookEndpoint(t, user, "https://example.com/hooks", webhookChirpCreated).ID.String()
+		updated := WebhookEndpoint{}
+		expect(t, "disable", s.request(t, "PATCH", path, user.Token, map[string]any{"enabled": false}, &updated), http.StatusOK)
+		if updated.Enabled || updated.DisabledAt == nil {
+			t.Errorf("webhook = %+v, want it disabled", updated)
+		}
+		expect(t, "enable with new events", s.request(t, "PATCH", path, user.Token, map[string]any{
+			"enabled": true,
+			"url":     "https://example.com/new",
+			"events":  []string{webhookChirpDeleted},
+		}, &updated), http.StatusOK)
+		if !updated.Enabled || updated.DisabledAt != nil || updated.URL != "https://example.com/new" || !slices.Equal(updated.Events, []string{webhookChirpDeleted}) {
+			t.Errorf("webhook = %+v, want it enabled with the new url and events", updated)
+		}
+		expect(t, "http url", s.request(t, "PATCH", path, user.Token, map[string]any{"url": "http://example.com/hooks"}, nil), http.StatusBadRequest)
+		expect(t, "webhook of another user", s.request(t, "PATCH", path, s.signup(t).Token, map[string]any{"enabled": false}, nil), http.StatusNotFound)
+		expect(t, "invalid id", s.request(t, "PATCH", "/api/webhooks/not-an-id", user.Token, map[string]any{}, nil), http.StatusBadRequest)
+	},
+	"DELETE /api/webhooks/{webhookID}": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		path := "/api/webhooks/" + s.createWebhookEndpoint(t, user, "https://example.com/hooks", webhookChirpCreated).ID.String()
+		expect(t, "delete by another user", s.request(t, "DELETE", path, s.signup(t).Token, nil, nil), http.StatusNotFound)
+		expect(t, "delete", s.request(t, "DELETE", path, user.Token, nil, nil), http.StatusNoContent)
+		expect(t, "delete again", s.request(t, "DELETE", path, user.Token, nil, nil), http.StatusNotFound)
+		expect(t, "invalid id", s.request(t, "DELETE", "/api/webhooks/not-an-id", user.Token, nil, nil), http.StatusBadRequest)
+	},
+	"GET /api/webhooks/{webhookID}/deliveries": func(t *testing.T, s *testServer) {
+		received := make(chan webhookPayload, 10)
+		s.webhookReceiver(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/down" {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			payload := webhookPayload{}
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			received <- payload
+		})
+		user := s.signup(t)
+		endpoint := s.createWebhookEndpoint(t, user, "https://example.com/hooks", webhookChirpCreated)
+		down := s.createWebhookEndpoint(t, user, "https://example.com/down", webhookChirpCreated)
+		chirp := s.createChirp(t, user, map[string]string{"body": "hello hooks"})
+		s.cfg.deliverWebhooks(context.Background())
+
+		select {
+		case payload := <-received:
+			if payload.Event != webhookChirpCreated {
+				t.Errorf("received %+v, want the chirp.created webhook", payload)
+			}
+		default:
+			t.Fatal("the webhook wasn't received")
+		}
+		deliveries := []WebhookDelivery{}
+		expect(t, "list", s.request(t, "GET", "/api/webhooks/"+endpoint.ID.String()+"/deliveries", user.Token, nil, &deliveries), http.StatusOK)
+		if len(deliveries) != 1 || deliveries[0].Status != webhookDeliveryDelivered || deliveries[0].Attempts != 1 ||
+			deliveries[0].ResponseStatus == nil || *deliveries[0].ResponseStatus != http.StatusOK || !strings.Contains(string(deliveries[0].Payload), chirp.ID.String()) {
+			t.Errorf("deliveries = %+v, want the delivered chirp.created webhook", deliveries)
+		}
+		expect(t, "list of the failing webhook", s.request(t, "GET", "/api/webhooks/"+down.ID.String()+"/deliveries", user.Token, nil, &deliveries), http.StatusOK)
+		if len(deliveries) != 1 || deliveries[0].Status != webhookDeliveryPending || deliveries[0].Attempts != 1 || deliveries[0].NextAttemptAt == nil ||
+			deliveries[0].ResponseStatus == nil || *deliveries[0].ResponseStatus != http.StatusServiceUnavailable || deliveries[0].LastError == "" {
+			t.Errorf("deliveries = %+v, want the failed attempt to be retried", deliveries)
+		}
+
+		expect(t, "webhook of another user", s.request(t, "GET", "/api/webhooks/"+endpoint.ID.String()+"/deliveries", s.signup(t).Token, nil, nil), http.StatusNotFound)
+		expect(t, "invalid id", s.request(t, "GET", "/api/webhooks/not-an-id/deliveries", user.Token, nil, nil), http.StatusBadRequest)
+	},
+
+	"GET /oauth/authorize": func(t *testing.T, s *testServer) {
+		client, _ := s.createOAuthClient(t, s.signup(t), false)
+		// the redirects are checked, not followed
+		noRedirect := *s.Client()
+		noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+		authorize := func(t *testing.T, query url.Values) *http.Response {
+			t.Helper()
+			res, err := noRedirect.Get(s.URL + "/oauth/authorize?" + query.Encode())
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			return res
+		}
+		query := url.Values{
+			"response_type":         {"code"},
+			"client_id":             {client.ClientID},
+			"redirect_uri":          {client.RedirectURIs[0]},
+			"scope":                 {auth.ScopeChirpsRead},
+			"state":                 {"xyz"},
+			"code_challenge":        {auth.MakeCodeChallenge(uuid.NewString() + uuid.NewString())},
+			"code_challenge_method": {auth.PKCEMethodS256},
+		}
+		if res := authorize(t, query); res.StatusCode != http.StatusFound || !strings.HasPrefix(res.Header.Get("Location"), oauthConsentPage+"?") {
+			t.Errorf("authorize = %v to %q, want a redirect to the consent page", res.StatusCode, res.Header.Get("Location"))
+		}
+
+		withoutPKCE := url.Values{}
+		for key, values := range query {
+			if key != "code_challenge" {
+				withoutPKCE[key] = values
+			}
+		}
+		res := authorize(t, withoutPKCE)
+		location, _ := url.Parse(res.Header.Get("Location"))
+		if res.StatusCode != http.StatusFound || location == nil || location.Host != "app.example.com" || location.Query().Get("error") != "invalid_request" || location.Query().Get("state") != "xyz" {
+			t.Errorf("authorize without PKCE = %v to %q, want the error sent to the app", res.StatusCode, res.Header.Get("Location"))
+		}
+
+		unregistered := url.Values{}
+		for key, values := range query {
+			unregistered[key] = values
+		}
+		unregistered.Set("redirect_uri", "https://evil.example.com/callback")
+		expect(t, "unregistered redirect uri", authorize(t, unregistered).StatusCode, http.StatusBadRequest)
+		unregistered.Set("client_id", uuid.NewString())
+		expect(t, "unknown client", authorize(t, unregistered).StatusCode, http.StatusBadRequest)
+	},
+	"POST /oauth/authorize": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		client, _ := s.createOAuthClient(t, s.signup(t), false)
+		s.authorizeOAuthClient(t, user, client, auth.ScopeChirpsRead)
+
+		params := map[string]any{
+			"response_type":         "code",
+			"client_id":             client.ClientID,
+			"redirect_uri":          client.RedirectURIs[0],
+			"scope":                 auth.ScopeChirpsRead,
+			"state":                 "xyz",
+			"code_challenge":        auth.MakeCodeChallenge(uuid.NewString() + uuid.NewString()),
+			"code_challenge_method": auth.PKCEMethodS256,
+			"approved":              false,
+		}
+		consent := struct {
+			RedirectTo string `json:"redirect_to"`
+		}{}
+		expect(t, "deny", s.request(t, "POST", "/oauth/authorize", user.Token, params, &consent), http.StatusOK)
+		if denied, err := url.Parse(consent.RedirectTo); err != nil || denied.Query().Get("error") != "access_denied" || denied.Query().Get("code") != "" {
+			t.Errorf("redirect = %q, want access_denied without a code", consent.RedirectTo)
+		}
+		params["approved"], params["scope"] = true, "everything"
+		expect(t, "unknown scope", s.request(t, "POST", "/oauth/authorize", user.Token, params, nil), http.StatusBadRequest)
+		expect(t, "no token", s.request(t, "POST", "/oauth/authorize", "", params, nil), http.StatusUnauthorized)
+	},
+	"GET /oauth/clients/{clientID}": func(t *testing.T, s *testServer) {
+		client, _ := s.createOAuthClient(t, s.signup(t), true)
+		info := struct {
+			ClientID string `json:"client_id"`
+			Name     string `json:"name"`
+		}{}
+		expect(t, "get", s.request(t, "GET", "/oauth/clients/"+client.ClientID, "", nil, &info), http.StatusOK)
+		if info.ClientID != client.ClientID || info.Name != "app" {
+			t.Errorf("app info = %+v, want the name of the app", info)
+		}
+		expect(t, "unknown app", s.request(t, "GET", "/oauth/clients/"+uuid.NewString(), "", nil, nil), http.StatusNotFound)
+	},
+	"POST /oauth/token": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		client, secret := s.createOAuthClient(t, s.signup(t), true)
+		code, verifier := s.authorizeOAuthClient(t, user, client, auth.ScopeChirpsRead)
+		exchange := url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"redirect_uri":  {client.RedirectURIs[0]},
+			"code_verifier": {"wrong-" + verifier},
+		}
+		expect(t, "wrong secret", s.oauthForm(t, "/oauth/token", client, "wrong", exchange, nil), http.StatusUnauthorized)
+		expect(t, "wrong verifier", s.oauthForm(t, "/oauth/token", client, secret, exchange, nil), http.StatusBadRequest)
+
+		code, verifier = s.authorizeOAuthClient(t, user, client, auth.ScopeChirpsRead)
+		exchange.Set("code", code)
+		exchange.Set("code_verifier", verifier)
+		tokens := oauthTokens{}
+		expect(t, "exchange the code", s.oauthForm(t, "/oauth/token", client, secret, exchange, &tokens), http.StatusOK)
+		if tokens.AccessToken == "" || tokens.RefreshToken == "" || tokens.Scope != auth.ScopeChirpsRead {
+			t.Errorf("tokens = %+v, want both tokens with the scope", tokens)
+		}
+		expect(t, "exchange the code again", s.oauthForm(t, "/oauth/token", client, secret, exchange, nil), http.StatusBadRequest)
+		expect(t, "read", s.request(t, "GET", "/api/notifications", tokens.AccessToken, nil, nil), http.StatusOK)
+		expect(t, "write outside the scope", s.request(t, "POST", "/api/chirps", tokens.AccessToken, map[string]string{"body": "hi"}, nil), http.StatusForbidden)
+
+		refresh := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tokens.RefreshToken}}
+		rotated := oauthTokens{}
+		expect(t, "refresh", s.oauthForm(t, "/oauth/token", client, secret, refresh, &rotated), http.StatusOK)
+		if rotated.RefreshToken == "" || rotated.RefreshToken == tokens.RefreshToken {
+			t.Errorf("refreshed tokens = %+v, want a new refresh token", rotated)
+		}
+		// a reused refresh token may have leaked, the whole grant is revoked
+		expect(t, "refresh again", s.oauthForm(t, "/oauth/token", client, secret, refresh, nil), http.StatusBadRequest)
+		expect(t, "refresh with the new token", s.oauthForm(t, "/oauth/token", client, secret, url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {rotated.RefreshToken},
+		}, nil), http.StatusBadRequest)
+		expect(t, "read after the reuse", s.request(t, "GET", "/api/notifications", rotated.AccessToken, nil, nil), http.StatusUnauthorized)
+		expect(t, "unknown grant type", s.oauthForm(t, "/oauth/token", client, secret, url.Values{"grant_type": {"password"}}, nil), http.StatusBadRequest)
+	},
+	"POST /oauth/introspect": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		client, secret := s.createOAuthClient(t, s.signup(t), true)
+		tokens := s.oauthTokens(t, user, client, secret, auth.ScopeChirpsRead)
+		introspection := struct {
+			Active    bool   `json:"active"`
+			Scope     string `json:"scope"`
+			ClientID  string `json:"client_id"`
+			Subject   string `json:"sub"`
+			TokenType string `json:"token_type"`
+		}{}
+		for token, tokenType := range map[string]string{tokens.AccessToken: "access_token", tokens.RefreshToken: "refresh_token"} {
+			expect(t, "introspect", s.oauthForm(t, "/oauth/introspect", client, secret, url.Values{"token": {token}}, &introspection), http.StatusOK)
+			if !introspection.Active || introspection.TokenType != tokenType || introspection.Subject != user.ID.String() ||
+				introspection.ClientID != client.ClientID || introspection.Scope != auth.ScopeChirpsRead {
+				t.Errorf("introspection = %+v, want the active %v of the user", introspection, tokenType)
+			}
+		}
+
+		other, otherSecret := s.createOAuthClient(t, s.signup(t), true)
+		expect(t, "introspect by another app", s.oauthForm(t, "/oauth/introspect", other, otherSecret, url.Values{"token": {tokens.AccessToken}}, &introspection), http.StatusOK)
+		if introspection.Active {
+			t.Errorf("introspection by another app = %+v, want inactive", introspection)
+		}
+		public, _ := s.createOAuthClient(t, user, false)
+		expect(t, "public app", s.oauthForm(t, "/oauth/introspect", public, "", url.Values{"token": {tokens.AccessToken}}, nil), http.StatusUnauthorized)
+	},
+	"POST /oauth/revoke": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		client, _ := s.createOAuthClient(t, s.signup(t), false)
+		tokens := s.oauthTokens(t, user, client, "", auth.ScopeChirpsRead)
+		expect(t, "revoke an unknown token", s.oauthForm(t, "/oauth/revoke", client, "", url.Values{"token": {"unknown"}}, nil), http.StatusOK)
+		expect(t, "read", s.request(t, "GET", "/api/notifications", tokens.AccessToken, nil, nil), http.StatusOK)
+
+		// revoking the refresh token revokes its grant, the access token included
+		expect(t, "revoke", s.oauthForm(t, "/oauth/revoke", client, "", url.Values{"token": {tokens.RefreshToken}}, nil), http.StatusOK)
+		expect(t, "read after the revoke", s.request(t, "GET", "/api/notifications", tokens.AccessToken, nil, nil), http.StatusUnauthorized)
+		expect(t, "refresh after the revoke", s.oauthForm(t, "/oauth/token", client, "", url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {tokens.RefreshToken},
+		}, nil), http.StatusBadRequest)
+
+		tokens = s.oauthTokens(t, user, client, "", auth.ScopeChirpsRead)
+		expect(t, "revoke the access token", s.oauthForm(t, "/oauth/revoke", client, "", url.Values{"token": {tokens.AccessToken}}, nil), http.StatusOK)
+		expect(t, "read with the revoked access token", s.request(t, "GET", "/api/notifications", tokens.AccessToken, nil, nil), http.StatusUnauthorized)
+		expect(t, "unknown app", s.oauthForm(t, "/oauth/revoke", OAuthClient{ClientID: uuid.NewString()}, "", url.Values{"token": {tokens.RefreshToken}}, nil), http.StatusUnauthorized)
+	},
+
+	"GET /api/sessions": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		s.login(t, user.Email)
+		sessions := []Session{}
+		expect(t, "list", s.request(t, "GET", "/api/sessions", user.Token, nil, &sessions), http.StatusOK)
+		current := 0
+		for _, session := range sessions {
+			if session.Current {
+				current++
+			}
+		}
+		if len(sessions) != 2 || current != 1 {
+			t.Errorf("got %d sessions with %d current, want 2 with 1 current", len(sessions), current)
+		}
+		expect(t, "no token", s.request(t, "GET", "/api/sessions", "", nil, nil), http.StatusUnauthorized)
+	},
+	"DELETE /api/sessions/{sessionID}": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		other := s.login(t, user.Email)
+		sessions := []Session{}
+		expect(t, "list", s.request(t, "GET", "/api/sessions", other.Token, nil, &sessions), http.StatusOK)
+		var otherID uuid.UUID
+		for _, session := range sessions {
+			if session.Current {
+				otherID = session.ID
+			}
+		}
+		expect(t, "revoke", s.request(t, "DELETE", "/api/sessions/"+otherID.String(), user.Token, nil, nil), http.StatusNoContent)
+		expect(t, "revoke again", s.request(t, "DELETE", "/api/sessions/"+otherID.String(), user.Token, nil, nil), http.StatusNotFound)
+		expect(t, "refresh the revoked session", s.request(t, "POST", "/api/refresh", other.RefreshToken, nil, nil), http.StatusUnauthorized)
+		expect(t, "access token of the revoked session", s.request(t, "GET", "/api/sessions", other.Token, nil, nil), http.StatusUnauthorized)
+		expect(t, "invalid id", s.request(t, "DELETE", "/api/sessions/not-an-id", user.Token, nil, nil), http.StatusBadRequest)
+	},
+	"POST /api/sessions/revoke-others": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		other := s.login(t, user.Email)
+		res := struct {
+			RevokedSessions int64 `json:"revoked_sessions"`
+		}{}
+		expect(t, "revoke others", s.request(t, "POST", "/api/sessions/revoke-others", user.Token, nil, &res), http.StatusOK)
+		if res.RevokedSessions != 1 {
+			t.Errorf("revoked %d sessions, want 1", res.RevokedSessions)
+		}
+		expect(t, "refresh the other session", s.request(t, "POST", "/api/refresh", other.RefreshToken, nil, nil), http.StatusUnauthorized)
+		expect(t, "refresh the current session", s.request(t, "POST", "/api/refresh", user.RefreshToken, nil, nil), http.StatusOK)
+	},
+
+	"POST /api/refresh": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		res := struct {
+			Token string `json:"token"`
+		}{}
+		expect(t, "refresh", s.request(t, "POST", "/api/refresh", user.RefreshToken, nil, &res), http.StatusOK)
+		expect(t, "new access token", s.request(t, "GET", "/api/sessions", res.Token, nil, nil), http.StatusOK)
+		expect(t, "unknown refresh token", s.request(t, "POST", "/api/refresh", "not-a-token", nil, nil), http.StatusUnauthorized)
+		expect(t, "no refresh token", s.request(t, "POST", "/api/refresh", "", nil, nil), http.StatusBadRequest)
+	},
+	"POST /api/revoke": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		expect(t, "revoke", s.request(t, "POST", "/api/revoke", user.RefreshToken, nil, nil), http.StatusNoContent)
+		expect(t, "refresh after revoke", s.request(t, "POST", "/api/refresh", user.RefreshToken, nil, nil), http.StatusUnauthorized)
+		expect(t, "access token after revoke", s.request(t, "GET", "/api/sessions", user.Token, nil, nil), http.StatusUnauthorized)
+	},
+
+	"POST /api/chirps": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		chirp := s.createChirp(t, user, map[string]any{
+			"body": "lunch?",
+			"poll": map[string]any{"options": []string{"pizza", "tacos"}, "closes_at": time.Now().Add(time.Hour)},
+		})
+		if chirp.UserID != user.ID || chirp.Author == nil || chirp.Poll == nil || len(chirp.Poll.Options) != 2 {
+			t.Errorf("created chirp = %+v", chirp)
+		}
+		expect(t, "too long", s.request(t, "POST", "/api/chirps", user.Token, map[string]string{"body": strings.Repeat("a", 141)}, nil), http.StatusBadRequest)
+		expect(t, "no token", s.request(t, "POST", "/api/chirps", "", map[string]string{"body": "hi"}, nil), http.StatusUnauthorized)
+	},
+	"GET /api/chirps": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		other := s.signup(t)
+		first := s.createChirp(t, user, map[string]string{"body": "first"})
+		s.createChirp(t, other, map[string]string{"body": "other"})
+		last := s.createChirp(t, user, map[string]string{"body": "last"})
+
+		chirps := []Chirp{}
+		expect(t, "list", s.request(t, "GET", "/api/chirps", "", nil, &chirps), http.StatusOK)
+		if len(chirps) != 3 {
+			t.Errorf("got %d chirps, want 3", len(chirps))
+		}
+		expect(t, "by author", s.request(t, "GET", "/api/chirps?author_id="+user.ID.String()+"&sort=desc", "", nil, &chirps), http.StatusOK)
+		if len(chirps) != 2 || chirps[0].ID != last.ID || chirps[1].ID != first.ID {
+			t.Errorf("chirps of the author = %+v, want the last then the first", chirps)
+		}
+	},
+	"GET /api/chirps/{chirpID}": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		created := s.createChirp(t, user, map[string]string{"body": "hello"})
+		chirp := Chirp{}
+		expect(t, "get", s.request(t, "GET", "/api/chirps/"+created.ID.String(), "", nil, &chirp), http.StatusOK)
+		if chirp.Body != "hello" {
+			t.Errorf("body = %q, want hello", chirp.Body)
+		}
+		expect(t, "unknown id", s.request(t, "GET", "/api/chirps/"+uuid.NewString(), "", nil, nil), http.StatusNotFound)
+		expect(t, "invalid id", s.request(t, "GET", "/api/chirps/not-an-id", "", nil, nil), http.StatusBadRequest)
+	},
+	"DELETE /api/chirps/{chirpID}": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		other := s.signup(t)
+		chirp := s.createChirp(t, user, map[string]string{"body": "hello"})
+		path := "/api/chirps/" + chirp.ID.String()
+		expect(t, "not the owner", s.request(t, "DELETE", path, other.Token, nil, nil), http.StatusForbidden)
+		expect(t, "delete", s.request(t, "DELETE", path, user.Token, nil, nil), http.StatusNoContent)
+		expect(t, "get deleted", s.request(t, "GET", path, "", nil, nil), http.StatusNotFound)
+		expect(t, "delete again", s.request(t, "DELETE", path, user.Token, nil, nil), http.StatusNotFound)
+
+		moderator := s.signup(t, auth.RoleModerator)
+		chirp = s.createChirp(t, other, map[string]string{"body": "spam"})
+		path = "/api/chirps/" + chirp.ID.String()
+		expect(t, "not the owner", s.request(t, "DELETE", path, user.Token, nil, nil), http.StatusForbidden)
+		expect(t, "moderator deletes another user's chirp", s.request(t, "DELETE", path, moderator.Token, nil, nil), http.StatusNoContent)
+		expect(t, "get deleted by the moderator", s.request(t, "GET", path, "", nil, nil), http.StatusNotFound)
+	},
+	"GET /api/chirps/trash": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		chirp := s.createChirp(t, user, map[string]string{"body": "oops"})
+		expect(t, "delete", s.request(t, "DELETE", "/api/chirps/"+chirp.ID.String(), user.Token, nil, nil), http.StatusNoContent)
+		chirps := []Chirp{}
+		expect(t, "trash", s.request(t, "GET", "/api/chirps/trash", user.Token, nil, &chirps), http.StatusOK)
+		if len(chirps) != 1 || chirps[0].ID != chirp.ID || chirps[0].DeletedAt == nil {
+			t.Errorf("trash = %+v, want the deleted chirp", chirps)
+		}
+	},
+	"POST /api/chirps/{chirpID}/restore": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		chirp := s.createChirp(t, user, map[string]string{"body": "oops"})
+		path := "/api/chirps/" + chirp.ID.String()
+		expect(t, "restore a chirp not in the trash", s.request(t, "POST", path+"/restore", user.Token, nil, nil), http.StatusNotFound)
+		expect(t, "delete", s.request(t, "DELETE", path, user.Token, nil, nil), http.StatusNoContent)
+		expect(t, "restore", s.request(t, "POST", path+"/restore", user.Token, nil, nil), http.StatusOK)
+		expect(t, "get restored", s.request(t, "GET", path, "", nil, nil), http.StatusOK)
+
+		// a chirp removed by a moderator stays removed
+		moderator := s.signup(t, auth.RoleModerator)
+		expect(t, "moderator deletes the chirp", s.request(t, "DELETE", path, moderator.Token, nil, nil), http.StatusNoContent)
+		expect(t, "author restores the removed chirp", s.request(t, "POST", path+"/restore", user.Token, nil, nil), http.StatusNotFound)
+		expect(t, "moderator restores the removed chirp", s.request(t, "POST", path+"/restore", moderator.Token, nil, nil), http.StatusNotFound)
+		chirps := []Chirp{}
+		expect(t, "trash", s.request(t, "GET", "/api/chirps/trash", user.Token, nil, &chirps), http.StatusOK)
+		if len(chirps) != 0 {
+			t.Errorf("trash = %+v, want no chirp removed by a moderator", chirps)
+		}
+		expect(t, "get removed", s.request(t, "GET", path, "", nil, nil), http.StatusNotFound)
+	},
+	"POST /api/chirps/{chirpID}/poll/votes": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		voter := s.signup(t)
+		chirp := s.createChirp(t, user, map[string]any{
+			"body": "lunch?",
+			"poll": map[string]any{"options": []string{"pizza", "tacos"}, "closes_at": time.Now().Add(time.Hour)},
+		})
+		path := "/api/chirps/" + chirp.ID.String() + "/poll/votes"
+		vote := map[string]any{"option_id": chirp.Poll.Options[1].ID}
+
+		poll := Poll{}
+		expect(t, "vote", s.request(t, "POST", path, voter.Token, vote, &poll), http.StatusOK)
+		if poll.VotedOptionID == nil || *poll.VotedOptionID != chirp.Poll.Options[1].ID || poll.TotalVotes == nil || *poll.TotalVotes != 1 {
+			t.Errorf("poll after the vote = %+v", poll)
+		}
+		expect(t, "vote again", s.request(t, "POST", path, voter.Token, vote, nil), http.StatusConflict)
+
+		noPoll := s.createChirp(t, user, map[string]string{"body": "no poll"})
+		expect(t, "chirp without a poll", s.request(t, "POST", "/api/chirps/"+noPoll.ID.String()+"/poll/votes", voter.Token, vote, nil), http.StatusNotFound)
+	},
+
+	"POST /api/drafts": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		draft := ChirpDraft{}
+		publishAt := time.Now().Add(time.Hour)
+		expect(t, "create", s.request(t, "POST", "/api/drafts", user.Token, map[string]any{"body": "later", "publish_at": publishAt}, &draft), http.StatusCreated)
+		if draft.Body != "later" || draft.UserID != user.ID || draft.PublishAt == nil || draft.PublishAt.Sub(publishAt).Abs() > time.Millisecond {
+			t.Errorf("created draft = %+v", draft)
+		}
+
+		// a due draft is published as a chirp by the job
+		expect(t, "create due", s.request(t, "POST", "/api/drafts", user.Token, map[string]any{"body": "now", "publish_at": time.Now().Add(-time.Minute)}, nil), http.StatusCreated)
+		s.cfg.publishDueDrafts(context.Background())
+		drafts := []ChirpDraft{}
+		expect(t, "list", s.request(t, "GET", "/api/drafts", user.Token, nil, &drafts), http.StatusOK)
+		if len(drafts) != 1 || drafts[0].Body != "later" {
+			t.Errorf("drafts = %+v, want only the scheduled one", drafts)
+		}
+		chirps := []Chirp{}
+		expect(t, "chirps", s.request(t, "GET", "/api/chirps?author_id="+user.ID.String(), "", nil, &chirps), http.StatusOK)
+		if len(chirps) != 1 || chirps[0].Body != "now" {
+			t.Errorf("chirps = %+v, want the published draft", chirps)
+		}
+
+		expect(t, "too long", s.request(t, "POST", "/api/drafts", user.Token, map[string]string{"body": strings.Repeat("a", 141)}, nil), http.StatusBadRequest)
+		expect(t, "no token", s.request(t, "POST", "/api/drafts", "", map[string]string{"body": "hi"}, nil), http.StatusUnauthorized)
+	},
+	"GET /api/drafts": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		other := s.signup(t)
+		expect(t, "create", s.request(t, "POST", "/api/drafts", user.Token, map[string]string{"body": "first"}, nil), http.StatusCreated)
+		expect(t, "create", s.request(t, "POST", "/api/drafts", user.Token, map[string]string{"body": "second"}, nil), http.StatusCreated)
+		expect(t, "create of another user", s.request(t, "POST", "/api/drafts", other.Token, map[string]string{"body": "other"}, nil), http.StatusCreated)
+
+		drafts := []ChirpDraft{}
+		expect(t, "list", s.request(t, "GET", "/api/drafts", user.Token, nil, &drafts), http.StatusOK)
+		if len(drafts) != 2 || drafts[0].Body != "first" || drafts[1].Body != "second" {
+			t.Errorf("drafts = %+v, want the 2 drafts of the user", drafts)
+		}
+		expect(t, "no token", s.request(t, "GET", "/api/drafts", "", nil, nil), http.StatusUnauthorized)
+	},
+	"PUT /api/drafts/{draftID}": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		other := s.signup(t)
+		draft := ChirpDraft{}
+		expect(t, "create", s.request(t, "POST", "/api/drafts", user.Token, map[string]string{"body": "typo"}, &draft), http.StatusCreated)
+		path := "/api/drafts/" + draft.ID.String()
+		expect(t, "update", s.request(t, "PUT", path, user.Token, map[string]string{"body": "fixed"}, &draft), http.StatusOK)
+		if draft.Body != "fixed" {
+			t.Errorf("body = %q, want fixed", draft.Body)
+		}
+		expect(t, "update of another user", s.request(t, "PUT", path, other.Token, map[string]string{"body": "mine"}, nil), http.StatusNotFound)
+		expect(t, "invalid id", s.request(t, "PUT", "/api/drafts/not-an-id", user.Token, map[string]string{"body": "hi"}, nil), http.StatusBadRequest)
+	},
+	"DELETE /api/drafts/{draftID}": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		draft := ChirpDraft{}
+		expect(t, "create", s.request(t, "POST", "/api/drafts", user.Token, map[string]string{"body": "nah"}, &draft), http.StatusCreated)
+		path := "/api/drafts/" + draft.ID.String()
+		expect(t, "delete", s.request(t, "DELETE", path, user.Token, nil, nil), http.StatusNoContent)
+		expect(t, "delete again", s.request(t, "DELETE", path, user.Token, nil, nil), http.StatusNotFound)
+		expect(t, "invalid id", s.request(t, "DELETE", "/api/drafts/not-an-id", user.Token, nil, nil), http.StatusBadRequest)
+	},
+
+	"POST /api/collections": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		collection := Collection{}
+		expect(t, "create", s.request(t, "POST", "/api/collections", user.Token, map[string]string{"name": " reads "}, &collection), http.StatusCreated)
+		if collection.Name != "reads" {
+			t.Errorf("name = %q, want reads", collection.Name)
+		}
+		expect(t, "taken name", s.request(t, "POST", "/api/collections", user.Token, map[string]string{"name": "reads"}, nil), http.StatusConflict)
+		expect(t, "no name", s.request(t, "POST", "/api/collections", user.Token, map[string]string{"name": " "}, nil), http.StatusBadRequest)
+	},
+	"GET /api/collections": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		s.createCollection(t, user, "reads")
+		s.createCollection(t, user, "archive")
+		collections := []Collection{}
+		expect(t, "list", s.request(t, "GET", "/api/collections", user.Token, nil, &collections), http.StatusOK)
+		if len(collections) != 2 || collections[0].Name != "archive" || collections[1].Name != "reads" {
+			t.Errorf("collections = %+v, want them by name", collections)
+		}
+		expect(t, "no token", s.request(t, "GET", "/api/collections", "", nil, nil), http.StatusUnauthorized)
+	},
+	"PUT /api/collections/{collectionID}": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		other := s.signup(t)
+		reads := s.createCollection(t, user, "reads")
+		s.createCollection(t, user, "archive")
+		path := "/api/collections/" + reads.ID.String()
+		renamed := Collection{}
+		expect(t, "rename", s.request(t, "PUT", path, user.Token, map[string]string{"name": "later"}, &renamed), http.StatusOK)
+		if renamed.Name != "later" {
+			t.Errorf("name = %q, want later", renamed.Name)
+		}
+		expect(t, "taken name", s.request(t, "PUT", path, user.Token, map[string]string{"name": "archive"}, nil), http.StatusConflict)
+		expect(t, "collection of another user", s.request(t, "PUT", path, other.Token, map[string]string{"name": "mine"}, nil), http.StatusNotFound)
+		expect(t, "invalid id", s.request(t, "PUT", "/api/collections/not-an-id", user.Token, map[string]string{"name": "reads"}, nil), http.StatusBadRequest)
+	},
+	"DELETE /api/collections/{collectionID}": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		path := "/api/collections/" + s.createCollection(t, user, "reads").ID.String()
+		expect(t, "delete", s.request(t, "DELETE", path, user.Token, nil, nil), http.StatusNoContent)
+		expect(t, "delete again", s.request(t, "DELETE", path, user.Token, nil, nil), http.StatusNotFound)
+		expect(t, "bookmarks of the deleted collection", s.request(t, "GET", path+"/bookmarks", user.Token, nil, nil), http.StatusNotFound)
+		expect(t, "invalid id", s.request(t, "DELETE", "/api/collections/not-an-id", user.Token, nil, nil), http.StatusBadRequest)
+	},
+	"GET /api/collections/{collectionID}/bookmarks": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		other := s.signup(t)
+		path := "/api/collections/" + s.createCollection(t, user, "reads").ID.String() + "/bookmarks"
+		kept := s.createChirp(t, other, map[string]string{"body": "keep"})
+		deleted := s.createChirp(t, other, map[string]string{"body": "oops"})
+		for _, chirp := range []Chirp{kept, deleted} {
+			expect(t, "add", s.request(t, "POST", path, user.Token, map[string]any{"chirp_id": chirp.ID}, nil), http.StatusNoContent)
+		}
+		expect(t, "delete the chirp", s.request(t, "DELETE", "/api/chirps/"+deleted.ID.String(), other.Token, nil, nil), http.StatusNoContent)
+
+		bookmarks := []Bookmark{}
+		expect(t, "list", s.request(t, "GET", path, user.Token, nil, &bookmarks), http.StatusOK)
+		if len(bookmarks) != 2 || bookmarks[0].ChirpID != deleted.ID || bookmarks[0].Available || bookmarks[0].Chirp != nil ||
+			bookmarks[1].ChirpID != kept.ID || !bookmarks[1].Available || bookmarks[1].Chirp == nil || bookmarks[1].Chirp.Body != "keep" {
+			t.Errorf("bookmarks = %+v, want the newest first, the deleted chirp unavailable", bookmarks)
+		}
+		expect(t, "second page", s.request(t, "GET", path+"?limit=1&offset=1", user.Token, nil, &bookmarks), http.StatusOK)
+		if len(bookmarks) != 1 || bookmarks[0].ChirpID != kept.ID {
+			t.Errorf("second page = %+v, want the oldest bookmark", bookmarks)
+		}
+		expect(t, "collection of another user", s.request(t, "GET", path, other.Token, nil, nil), http.StatusNotFound)
+		expect(t, "invalid id", s.request(t, "GET", "/api/collections/not-an-id/bookmarks", user.Token, nil, nil), http.StatusBadRequest)
+	},
+	"POST /api/collections/{collectionID}/bookmarks": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		path := "/api/collections/" + s.createCollection(t, user, "reads").ID.String() + "/bookmarks"
+		chirp := s.createChirp(t, user, map[string]string{"body": "keep"})
+		expect(t, "add", s.request(t, "POST", path, user.Token, map[string]any{"chirp_id": chirp.ID}, nil), http.StatusNoContent)
+		expect(t, "add again", s.request(t, "POST", path, user.Token, map[string]any{"chirp_id": chirp.ID}, nil), http.StatusNoContent)
+		bookmarks := []Bookmark{}
+		expect(t, "list", s.request(t, "GET", path, user.Token, nil, &bookmarks), http.StatusOK)
+		if len(bookmarks) != 1 {
+			t.Errorf("got %d bookmarks, want 1", len(bookmarks))
+		}
+		expect(t, "unknown chirp", s.request(t, "POST", path, user.Token, map[string]string{"chirp_id": uuid.NewString()}, nil), http.StatusNotFound)
+		expect(t, "invalid id", s.request(t, "POST", "/api/collections/not-an-id/bookmarks", user.Token, map[string]string{"chirp_id": uuid.NewString()}, nil), http.StatusBadRequest)
+	},
+	"DELETE /api/collections/{collectionID}/bookmarks/{chirpID}": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		collectionPath := "/api/collections/" + s.createCollection(t, user, "reads").ID.String()
+		chirp := s.createChirp(t, user, map[string]string{"body": "keep"})
+		expect(t, "add", s.request(t, "POST", collectionPath+"/bookmarks", user.Token, map[string]any{"chirp_id": chirp.ID}, nil), http.StatusNoContent)
+		path := collectionPath + "/bookmarks/" + chirp.ID.String()
+		expect(t, "remove", s.request(t, "DELETE", path, user.Token, nil, nil), http.StatusNoContent)
+		expect(t, "remove again", s.request(t, "DELETE", path, user.Token, nil, nil), http.StatusNotFound)
+		expect(t, "invalid id", s.request(t, "DELETE", collectionPath+"/bookmarks/not-an-id", user.Token, nil, nil), http.StatusBadRequest)
+	},
+
+	"GET /api/notifications": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		voter := s.closedPollVoter(t, user)
+		notifications := []Notification{}
+		expect(t, "list", s.request(t, "GET", "/api/notifications", voter.Token, nil, &notifications), http.StatusOK)
+		if len(notifications) != 1 || notifications[0].Kind != "poll_closed" || notifications[0].Read {
+			t.Errorf("notifications = %+v, want the unread notification of the poll", notifications)
+		}
+		expect(t, "list of the author", s.request(t, "GET", "/api/notifications", user.Token, nil, &notifications), http.StatusOK)
+		if len(notifications) != 0 {
+			t.Errorf("notifications of the author = %+v, want none", notifications)
+		}
+		expect(t, "no token", s.request(t, "GET", "/api/notifications", "", nil, nil), http.StatusUnauthorized)
+	},
+	"POST /api/notifications/read": func(t *testing.T, s *testServer) {
+		voter := s.closedPollVoter(t, s.signup(t))
+		expect(t, "read", s.request(t, "POST", "/api/notifications/read", voter.Token, nil, nil), http.StatusNoContent)
+		notifications := []Notification{}
+		expect(t, "list", s.request(t, "GET", "/api/notifications", voter.Token, nil, &notifications), http.StatusOK)
+		if len(notifications) != 1 || !notifications[0].Read {
+			t.Errorf("notifications = %+v, want the notification read", notifications)
+		}
+		expect(t, "no token", s.request(t, "POST", "/api/notifications/read", "", nil, nil), http.StatusUnauthorized)
+	},
+
+	"POST /api/polka/webhooks": func(t *testing.T, s *testServer) {
+		user := s.signup(t)
+		upgrade := `{"id":"` + uuid.NewString() + `","event":"user.upgraded","data":{"user_id":"` + user.ID.String() + `"}}`
+		expect(t, "upgrade", s.sendPolkaEvent(t, upgrade), http.StatusNoContent)
+		expect(t, "upgrade again", s.sendPolkaEvent(t, upgrade), http.StatusNoContent) // acknowledged, not stored again
+		s.cfg.processWebhookEvents(context.Background())
+
+		loggedIn := User{}
+		expect(t, "login", s.request(t, "POST", "/api/login", "", map[string]string{"email": user.Email, "password": testPassword}, &loggedIn), http.StatusOK)
+		if !loggedIn.IsChirpyRed {
+			t.Errorf("user = %+v, want them chirpy red after the upgrade", loggedIn)
+		}
+		events := []WebhookEvent{}
+		expect(t, "list processed", s.request(t, "GET", "/admin/webhooks/events?status=processed", s.signup(t, auth.RoleAdmin).Token, nil, &events), http.StatusOK)
+		if len(events) != 1 || events[0].UserID == nil || *events[0].UserID != user.ID {
+			t.Errorf("processed events = %+v, want the upgrade once", events)
+		}
+
+		body := []byte(`{"event":"user.upgraded","data":{"user_id":"` + uuid.NewString() + `"}}`)
+		expect(t, "unsigned", s.request(t, "POST", "/api/polka/webhooks", "", json.RawMessage(body), nil), http.StatusUnauthorized)
+		expect(t, "signed without an id", s.sendPolkaEvent(t, `{"event":"user.upgraded","data":{}}`), http.StatusBadRequest)
+	},
+}
+
+// routePatterns func returns the patterns registered in routes, they are read from main.go so a new route fails
+// the tests until it has one
+func routePatterns(t *testing.T) []string {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "main.go", nil, 0)
+	if err != nil {
+		t.Fatalf("couldn't parse main.go: %v", err)
+	}
+	patterns := []string{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		fun, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || (fun.Sel.Name != "Handle" && fun.Sel.Name != "HandleFunc") {
+			return true
+		}
+		if mux, ok := fun.X.(*ast.Ident); !ok || mux.Name != "mux" {
+			return true
+		}
+		if lit, ok := call.Args[0].(*ast.BasicLit); ok {
+			if pattern, err := strconv.Unquote(lit.Value); err == nil {
+				patterns = append(patterns, pattern)
+			}
+		}
+		return true
+	})
+	return patterns
+}
+
+// TestReservedHandles checks that the routes under /api/users/ can't be hidden by a profile, every literal segment
+// where GET /api/users/{handle} matches too has to be a reserved handle
+func TestReservedHandles(t *testing.T) {
+	for _, pattern := range routePatterns(t) {
+		_, path, _ := strings.Cut(pattern, " ")
+		rest, ok := strings.CutPrefix(path, "/api/users/")
+		if !ok {
+			continue
+		}
+		segment, _, _ := strings.Cut(rest, "/")
+		if segment != "" && !strings.HasPrefix(segment, "{") && !slices.Contains(reservedHandles, segment) {
+			t.Errorf("route %q: the handle %q isn't reserved", pattern, segment)
+		}
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	patterns := routePatterns(t)
+	if len(patterns) == 0 {
+		t.Fatal("found no routes in main.go")
+	}
+	for _, pattern := range patterns {
+		t.Run(pattern, func(t *testing.T) {
+			test, ok := routeTests[pattern]
+			if !ok {
+				t.Fatalf("route %q has no test", pattern)
+			}
+			test(t, newTestServer(t))
+		})
+	}
+	for pattern := range routeTests {
+		if !slices.Contains(patterns, pattern) {
+			t.Errorf("test of route %q that isn't registered", pattern)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// serverConfig holds the limits of the http server and how it shuts down
+type serverConfig struct {
+	ReadTimeout       time.Duration // to read a whole request, its body included
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration // from the end of the request headers to the end of the response
+	IdleTimeout       time.Duration // how long a keep-alive connection waits for the next request
+	MaxHeaderBytes    int
+	DrainDelay        time.Duration // how long the server keeps serving once it isn't ready, so the load balancer stops sending it requests
+	ShutdownTimeout   time.Duration // how long the requests in progress and the background jobs get to finish
+}
+
+var defaultServerConfig = serverConfig{
+	ReadTimeout:       30 * time.Second,
+	ReadHeaderTimeout: 5 * time.Second,
+	WriteTimeout:      60 * time.Second, // data export archives can be large
+	IdleTimeout:       2 * time.Minute,
+	MaxHeaderBytes:    64 << 10,
+	DrainDelay:        5 * time.Second,
+	ShutdownTimeout:   30 * time.Second,
+}
+
+// serverConfigFromEnv func returns the default server config, overridden by the optional HTTP_READ_TIMEOUT,
+// HTTP_READ_HEADER_TIMEOUT, HTTP_WRITE_TIMEOUT, HTTP_IDLE_TIMEOUT, SHUTDOWN_DRAIN_DELAY and SHUTDOWN_TIMEOUT
+// env variables (durations, e.g. 30s) and HTTP_MAX_HEADER_BYTES
+func serverConfigFromEnv() (serverConfig, error) {
+	config := defaultServerConfig
+	for _, setting := range []struct {
+		env      string
+		duration *time.Duration
+	}{
+		{"HTTP_READ_TIMEOUT", &config.ReadTimeout},
+		{"HTTP_READ_HEADER_TIMEOUT", &config.ReadHeaderTimeout},
+		{"HTTP_WRITE_TIMEOUT", &config.WriteTimeout},
+		{"HTTP_IDLE_TIMEOUT", &config.IdleTimeout},
+		{"SHUTDOWN_DRAIN_DELAY", &config.DrainDelay},
+		{"SHUTDOWN_TIMEOUT", &config.ShutdownTimeout},
+	} {
+		value := os.Getenv(setting.env)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			return serverConfig{}, fmt.Errorf("make sure %v is a duration (e.g. 30s)", setting.env)
+		}
+		*setting.duration = parsed
+	}
+	if value := os.Getenv("HTTP_MAX_HEADER_BYTES"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return serverConfig{}, errors.New("make sure HTTP_MAX_HEADER_BYTES is a positive number")
+		}
+		config.MaxHeaderBytes = parsed
+	}
+	return config, nil
+}
+
+// newServer func returns the http server of the api with the limits of the config
+func newServer(handler http.Handler, config serverConfig) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadTimeout:       config.ReadTimeout,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+		MaxHeaderBytes:    config.MaxHeaderBytes,
+	}
+}
+
+// serve func serves the requests of the listener until ctx is done, then drains them: the readiness check fails
+// for the drain delay while requests are still served, then the server stops taking requests and the ones in
+// progress and the runs of the jobs get the shutdown timeout to finish
+func (cfg *apiConfig) serve(ctx context.Context, server *http.Server, listener net.Listener, jobs *jobs, config serverConfig) error {
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.Serve(listener) }()
+
+	select {
+	case err := <-serveErr:
+		jobs.stop()
+		jobs.wait(context.Background())
+		return fmt.Errorf("couldn't serve: %v", err)
+	case <-ctx.Done():
+	}
+
+	log.Printf("shutting down, draining for %v", config.DrainDelay)
+	cfg.draining.Store(true)
+	server.SetKeepAlivesEnabled(false) // the clients open their next connection to another server
+	time.Sleep(config.DrainDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+	jobs.stop()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("couldn't finish the requests in progress: %v", err)
+	}
+	if err := jobs.wait(shutdownCtx); err != nil {
+		return fmt.Errorf("couldn't finish the background jobs: %v", err)
+	}
+	log.Print("server stopped")
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestServerConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    func(config *serverConfig)
+		wantErr bool
+	}{
+		{name: "Defaults"},
+		{
+			name: "Overridden",
+			env:  map[string]string{"HTTP_WRITE_TIMEOUT": "2m", "SHUTDOWN_DRAIN_DELAY": "0s", "HTTP_MAX_HEADER_BYTES": "8192"},
+			want: func(config *serverConfig) {
+				config.WriteTimeout = 2 * time.Minute
+				config.DrainDelay = 0
+				config.MaxHeaderBytes = 8192
+			},
+		},
+		{name: "Duration without unit", env: map[string]string{"SHUTDOWN_TIMEOUT": "30"}, wantErr: true},
+		{name: "Negative duration", env: map[string]string{"HTTP_IDLE_TIMEOUT": "-1s"}, wantErr: true},
+		{name: "Zero header size", env: map[string]string{"HTTP_MAX_HEADER_BYTES": "0"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for env, value := range tt.env {
+				t.Setenv(env, value)
+			}
+			got, err := serverConfigFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("serverConfigFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			want := defaultServerConfig
+			if tt.want != nil {
+				tt.want(&want)
+			}
+			if got != want {
+				t.Errorf("serverConfigFromEnv() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestServe(t *testing.T) {
+	tests := []struct {
+		name            string
+		requestDuration time.Duration
+		wantErr         bool
+	}{
+		{name: "Drained", requestDuration: 100 * time.Millisecond},
+		{name: "Request longer than the shutdown timeout", requestDuration: 2 * time.Second, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &apiConfig{}
+			started := make(chan struct{})
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /api/readyz", cfg.handlerReadiness)
+			mux.HandleFunc("GET /slow", func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				time.Sleep(tt.requestDuration)
+				w.Write([]byte("done"))
+			})
+			config := defaultServerConfig
+			config.DrainDelay = 200 * time.Millisecond
+			config.ShutdownTimeout = time.Second
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			url := "http://" + listener.Addr().String()
+
+			// the job runs until it's stopped
+			var jobStopped atomic.Bool
+			jobs := newJobs()
+			jobs.every(time.Hour, func(ctx context.Context) {
+				<-ctx.Done()
+				jobStopped.Store(true)
+			})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			served := make(chan error, 1)
+			go func() { served <- cfg.serve(ctx, newServer(mux, config), listener, jobs, config) }()
+
+			slowStatus := make(chan int, 1)
+			go func() {
+				resp, err := http.Get(url + "/slow")
+				if err != nil {
+					slowStatus <- 0
+					return
+				}
+				resp.Body.Close()
+				slowStatus <- resp.StatusCode
+			}()
+			<-started
+			cancel()
+
+			// the server still answers during the drain, but isn't ready anymore
+			deadline := time.Now().Add(config.DrainDelay)
+			for {
+				resp, err := http.Get(url + "/api/readyz")
+				if err != nil {
+					t.Fatalf("readiness check during the drain: %v", err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode == http.StatusServiceUnavailable {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("readiness check during the drain: status = %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			err = <-served
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("serve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !strings.Contains(err.Error(), "requests in progress") {
+					t.Errorf("serve() error = %v, want the requests in progress to time out", err)
+				}
+				return
+			}
+			if status := <-slowStatus; status != http.StatusOK {
+				t.Errorf("request in progress: status = %d, want %d", status, http.StatusOK)
+			}
+			if !jobStopped.Load() {
+				t.Error("the background job wasn't stopped")
+			}
+			if _, err := http.Get(url + "/api/readyz"); err == nil {
+				t.Error("the server still takes requests after serve() returned")
+			}
+		})
+	}
+}
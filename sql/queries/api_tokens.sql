@@ -0,0 +1,29 @@
+-- name: CreateAPIToken :one
+INSERT INTO api_tokens(id, created_at, user_id, name, token_hash, scopes, expires_at)
+VALUES(gen_random_uuid(), NOW(), $1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: GetAPITokens :many
+SELECT * FROM api_tokens
+WHERE user_id = $1 AND revoked_at IS NULL
+ORDER BY created_at ASC;
+
+-- name: GetValidAPIToken :one
+SELECT * FROM api_tokens
+WHERE token_hash = $1
+AND revoked_at IS NULL
+AND (expires_at IS NULL OR expires_at > NOW());
+
+-- name: TouchAPIToken :exec
+-- last_used_at is only written once a minute at most to keep authentication cheap
+UPDATE api_tokens SET last_used_at = NOW()
+WHERE id = $1
+AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute');
+
+-- name: RevokeAPIToken :execrows
+UPDATE api_tokens SET revoked_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeUserAPITokens :exec
+UPDATE api_tokens SET revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
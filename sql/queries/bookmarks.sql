@@ -0,0 +1,43 @@
+-- name: CreateCollection :one
+INSERT INTO collections(id, created_at, updated_at, user_id, name)
+VALUES(gen_random_uuid(), NOW(), NOW(), $1, $2)
+RETURNING *;
+
+-- name: GetCollections :many
+SELECT * FROM collections
+WHERE user_id = $1
+ORDER BY name ASC;
+
+-- name: GetCollection :one
+SELECT * FROM collections WHERE id = $1 AND user_id = $2;
+
+-- name: RenameCollection :one
+UPDATE collections
+SET name = $1, updated_at = NOW()
+WHERE id = $2 AND user_id = $3
+RETURNING *;
+
+-- name: DeleteCollection :execrows
+DELETE FROM collections WHERE id = $1 AND user_id = $2;
+
+-- name: AddBookmark :exec
+INSERT INTO bookmarks(collection_id, chirp_id, created_at)
+VALUES($1, $2, NOW())
+ON CONFLICT (collection_id, chirp_id) DO NOTHING;
+
+-- name: RemoveBookmark :execrows
+DELETE FROM bookmarks WHERE collection_id = $1 AND chirp_id = $2;
+
+-- name: GetBookmarks :many
+SELECT bookmarks.chirp_id,
+    bookmarks.created_at AS bookmarked_at,
+    (chirps.id IS NOT NULL AND chirps.deleted_at IS NULL)::boolean AS available,
+    chirps.created_at AS chirp_created_at,
+    chirps.updated_at AS chirp_updated_at,
+    chirps.body,
+    chirps.user_id
+FROM bookmarks
+LEFT JOIN chirps ON chirps.id = bookmarks.chirp_id
+WHERE bookmarks.collection_id = $1
+ORDER BY bookmarks.created_at DESC, bookmarks.chirp_id
+LIMIT $2 OFFSET $3;
@@ -0,0 +1,34 @@
+-- name: CreateChirpDraft :one
+INSERT INTO chirp_drafts(id, created_at, updated_at, body, user_id, publish_at)
+VALUES(gen_random_uuid(), NOW(), NOW(), $1, $2, $3)
+RETURNING *;
+
+-- name: GetChirpDrafts :many
+SELECT * FROM chirp_drafts
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: UpdateChirpDraft :one
+UPDATE chirp_drafts
+SET body = $1, publish_at = $2, updated_at = NOW()
+WHERE id = $3 AND user_id = $4
+RETURNING *;
+
+-- name: DeleteChirpDraft :execrows
+DELETE FROM chirp_drafts WHERE id = $1 AND user_id = $2;
+
+-- name: GetDueChirpDrafts :many
+-- locks the due drafts so other server instances skip them while they get published
+SELECT * FROM chirp_drafts
+WHERE publish_at <= sqlc.arg('now')::timestamp
+ORDER BY publish_at ASC
+LIMIT sqlc.arg('max_drafts')
+FOR UPDATE SKIP LOCKED;
+
+-- name: DeletePublishedChirpDraft :exec
+DELETE FROM chirp_drafts WHERE id = $1;
+
+-- name: UnscheduleChirpDraft :exec
+UPDATE chirp_drafts
+SET publish_at = NULL, updated_at = NOW()
+WHERE id = $1;
@@ -6,11 +6,34 @@ RETURNING *;
 -- name: GetAllChirps :many
 SELECT * FROM chirps
 WHERE (user_id = sqlc.narg('user_id') OR sqlc.narg('user_id') IS NULL)
+AND deleted_at IS NULL
 ORDER BY created_at ASC; 
 
 
 -- name: GetChirp :one
-SELECT * FROM chirps WHERE id = $1;
+SELECT * FROM chirps WHERE id = $1 AND deleted_at IS NULL;
 
--- name: DeleteChirpById :exec
-DELETE FROM chirps WHERE id = $1;
\ No newline at end of file
+-- name: SoftDeleteChirp :execrows
+UPDATE chirps
+SET deleted_at = NOW(), updated_at = NOW(), deleted_by = sqlc.arg('deleted_by')::uuid
+WHERE id = sqlc.arg('id') AND deleted_at IS NULL;
+
+-- name: GetTrashedChirps :many
+-- the chirps removed by a moderator aren't in the trash of their author
+SELECT * FROM chirps
+WHERE user_id = $1
+AND deleted_by = user_id
+AND deleted_at > sqlc.arg('cutoff')::timestamp
+ORDER BY deleted_at DESC;
+
+-- name: RestoreChirp :one
+UPDATE chirps
+SET deleted_at = NULL, deleted_by = NULL, updated_at = NOW()
+WHERE id = $1
+AND user_id = $2
+AND deleted_by = user_id
+AND deleted_at > sqlc.arg('cutoff')::timestamp
+RETURNING *;
+
+-- name: PurgeTrashedChirps :execrows
+DELETE FROM chirps WHERE deleted_at <= sqlc.arg('cutoff')::timestamp;
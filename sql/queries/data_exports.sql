@@ -0,0 +1,75 @@
+-- name: CreateDataExport :one
+INSERT INTO data_exports(id, created_at, user_id)
+VALUES (gen_random_uuid(), NOW(), $1)
+RETURNING id, created_at, status, completed_at, expires_at;
+
+-- name: GetDataExports :many
+SELECT id, created_at, status, completed_at, expires_at FROM data_exports
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: GetDataExportArchive :one
+SELECT status, archive, expires_at FROM data_exports
+WHERE id = $1 AND user_id = $2;
+
+-- name: ClaimDataExports :many
+-- the pending exports are leased until lease_until, so other server instances skip them while they get generated
+UPDATE data_exports
+SET lease_until = sqlc.arg('lease_until')::timestamp
+WHERE id IN (
+    SELECT e.id FROM data_exports e
+    WHERE e.status = 'pending' AND (e.lease_until IS NULL OR e.lease_until <= sqlc.arg('now')::timestamp)
+    ORDER BY e.created_at ASC
+    LIMIT sqlc.arg('limit')
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, user_id;
+
+-- name: CompleteDataExport :exec
+UPDATE data_exports
+SET status = $2, archive = $3, completed_at = NOW(), expires_at = $4
+WHERE id = $1;
+
+-- name: PurgeExpiredDataExports :execrows
+DELETE FROM data_exports WHERE expires_at <= NOW();
+
+-- name: ExportChirps :many
+-- every chirp of the user, including the ones in the trash
+SELECT * FROM chirps
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: ExportFollowing :many
+SELECT users.id, users.handle, follows.created_at FROM follows
+JOIN users ON users.id = follows.followee_id
+WHERE follows.follower_id = $1
+ORDER BY follows.created_at ASC;
+
+-- name: ExportFollowers :many
+SELECT users.id, users.handle, follows.created_at FROM follows
+JOIN users ON users.id = follows.follower_id
+WHERE follows.followee_id = $1
+ORDER BY follows.created_at ASC;
+
+-- name: ExportBookmarks :many
+SELECT collections.name AS collection, bookmarks.chirp_id, bookmarks.created_at FROM bookmarks
+JOIN collections ON collections.id = bookmarks.collection_id
+WHERE collections.user_id = $1
+ORDER BY bookmarks.created_at ASC;
+
+-- name: ExportPollVotes :many
+SELECT polls.chirp_id, poll_options.text AS option, poll_votes.created_at FROM poll_votes
+JOIN polls ON polls.id = poll_votes.poll_id
+JOIN poll_options ON poll_options.id = poll_votes.option_id
+WHERE poll_votes.user_id = $1
+ORDER BY poll_votes.created_at ASC;
+
+-- name: ExportNotifications :many
+SELECT * FROM notifications
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: ExportUserIdentities :many
+SELECT * FROM user_identities
+WHERE user_id = $1
+ORDER BY created_at ASC;
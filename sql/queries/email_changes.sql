@@ -0,0 +1,20 @@
+-- name: CreateEmailChange :one
+INSERT INTO email_changes(id, created_at, user_id, old_email, new_email, confirm_token_hash, undo_token_hash, expires_at, undo_expires_at)
+VALUES (gen_random_uuid(), NOW(), $1, $2, $3, $4, $5, $6, $7)
+RETURNING *;
+
+-- name: CancelEmailChanges :exec
+-- a new email change replaces the pending ones
+UPDATE email_changes SET undone_at = NOW()
+WHERE user_id = $1 AND confirmed_at IS NULL AND undone_at IS NULL;
+
+-- name: ConfirmEmailChange :one
+-- a change can be confirmed once, before it expires and unless it was undone
+UPDATE email_changes SET confirmed_at = NOW()
+WHERE confirm_token_hash = $1 AND confirmed_at IS NULL AND undone_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: UndoEmailChange :one
+UPDATE email_changes SET undone_at = NOW()
+WHERE undo_token_hash = $1 AND undone_at IS NULL AND undo_expires_at > NOW()
+RETURNING *;
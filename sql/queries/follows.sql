@@ -0,0 +1,8 @@
+-- name: FollowUser :execrows
+-- 0 rows means the user already follows them
+INSERT INTO follows(follower_id, followee_id, created_at)
+VALUES($1, $2, NOW())
+ON CONFLICT (follower_id, followee_id) DO NOTHING;
+
+-- name: UnfollowUser :execrows
+DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2;
@@ -0,0 +1,18 @@
+-- name: CreateUserIdentity :exec
+INSERT INTO user_identities(provider, subject, created_at, user_id, email)
+VALUES($1, $2, NOW(), $3, $4);
+
+-- name: GetUserByIdentity :one
+SELECT users.* FROM users
+JOIN user_identities ON users.id = user_identities.user_id
+WHERE user_identities.provider = $1 AND user_identities.subject = $2;
+
+-- name: CreateOIDCLogin :exec
+INSERT INTO oidc_logins(state_hash, created_at, nonce, code_verifier, expires_at, restore)
+VALUES($1, NOW(), $2, $3, $4, $5);
+
+-- name: UseOIDCLogin :one
+-- a login can only be completed once
+DELETE FROM oidc_logins
+WHERE state_hash = $1 AND expires_at > NOW()
+RETURNING *;
@@ -0,0 +1,16 @@
+-- name: NotifyPollVoters :execrows
+INSERT INTO notifications(id, created_at, user_id, kind, chirp_id)
+SELECT gen_random_uuid(), NOW(), poll_votes.user_id, 'poll_closed', polls.chirp_id
+FROM poll_votes
+JOIN polls ON polls.id = poll_votes.poll_id
+WHERE poll_votes.poll_id = $1;
+
+-- name: GetNotifications :many
+SELECT * FROM notifications
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
+
+-- name: MarkNotificationsRead :exec
+UPDATE notifications SET read_at = NOW()
+WHERE user_id = $1 AND read_at IS NULL;
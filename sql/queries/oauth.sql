@@ -0,0 +1,30 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients(id, created_at, updated_at, user_id, name, redirect_uris, secret_hash)
+VALUES($1, NOW(), NOW(), $2, $3, $4, $5)
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients WHERE id = $1;
+
+-- name: GetOAuthClientsByUser :many
+SELECT * FROM oauth_clients
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: GetOAuthClientGrants :many
+-- the grants of the client, the access tokens issued with them stay valid until they're revoked
+SELECT DISTINCT grant_id::uuid FROM refresh_tokens
+WHERE client_id = $1 AND grant_id IS NOT NULL;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients WHERE id = $1 AND user_id = $2;
+
+-- name: CreateOAuthCode :exec
+INSERT INTO oauth_codes(code_hash, created_at, client_id, user_id, redirect_uri, scopes, code_challenge, expires_at)
+VALUES($1, NOW(), $2, $3, $4, $5, $6, $7);
+
+-- name: UseOAuthCode :one
+-- a code can only be exchanged once
+UPDATE oauth_codes SET used_at = NOW()
+WHERE code_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
@@ -0,0 +1,50 @@
+-- name: CreatePoll :one
+INSERT INTO polls(id, created_at, chirp_id, closes_at)
+VALUES(gen_random_uuid(), NOW(), $1, $2)
+RETURNING *;
+
+-- name: CreatePollOption :one
+INSERT INTO poll_options(id, poll_id, position, text)
+VALUES(gen_random_uuid(), $1, $2, $3)
+RETURNING *;
+
+-- name: GetPollByChirpID :one
+SELECT polls.* FROM polls
+JOIN chirps ON chirps.id = polls.chirp_id
+WHERE polls.chirp_id = $1 AND chirps.deleted_at IS NULL;
+
+-- name: GetPollsByChirpIDs :many
+SELECT * FROM polls WHERE chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[]);
+
+-- name: GetPollOption :one
+SELECT * FROM poll_options WHERE id = $1 AND poll_id = $2;
+
+-- name: GetPollResults :many
+SELECT poll_options.*, COUNT(poll_votes.user_id) AS votes
+FROM poll_options
+LEFT JOIN poll_votes ON poll_votes.option_id = poll_options.id
+WHERE poll_options.poll_id = ANY(sqlc.arg('poll_ids')::uuid[])
+GROUP BY poll_options.id
+ORDER BY poll_options.poll_id, poll_options.position;
+
+-- name: GetUserPollVotes :many
+SELECT * FROM poll_votes
+WHERE user_id = $1 AND poll_id = ANY(sqlc.arg('poll_ids')::uuid[]);
+
+-- name: CreatePollVote :execrows
+INSERT INTO poll_votes(poll_id, user_id, option_id, created_at)
+VALUES($1, $2, $3, NOW())
+ON CONFLICT (poll_id, user_id) DO NOTHING;
+
+-- name: GetClosedPollsToNotify :many
+-- locks the closed polls so other server instances skip them while the voters get notified. the poll of a chirp in
+-- the trash waits until the chirp is restored, or purged with it
+SELECT * FROM polls
+WHERE closes_at <= sqlc.arg('now')::timestamp AND closed_notified_at IS NULL
+AND EXISTS (SELECT 1 FROM chirps WHERE chirps.id = polls.chirp_id AND chirps.deleted_at IS NULL)
+ORDER BY closes_at ASC
+LIMIT sqlc.arg('max_polls')
+FOR UPDATE SKIP LOCKED;
+
+-- name: MarkPollNotified :exec
+UPDATE polls SET closed_notified_at = NOW() WHERE id = $1;
@@ -4,8 +4,10 @@ INSERT INTO refresh_tokens(token,
     updated_at, 
     user_id, 
     expires_at, 
-    revoked_at)
-VALUES ($1, NOW(), NOW(), $2,  $3, NULL)
+    revoked_at,
+    user_agent,
+    ip)
+VALUES ($1, NOW(), NOW(), $2,  $3, NULL, $4, $5)
 RETURNING *;
 
 -- name: SetRevokedAtToken :exec
@@ -14,9 +16,66 @@ SET revoked_at = NOW(),
 updated_at = NOW()
 WHERE token = $1;
 
--- name: GetUserFromRefreshToken :one
-SELECT users.* FROM users
-JOIN refresh_tokens ON users.id = refresh_tokens.user_id
-WHERE refresh_tokens.token = $1
+-- name: UseRefreshToken :one
+-- only first-party refresh tokens (sessions), third-party apps refresh through the oauth token endpoint
+UPDATE refresh_tokens
+SET last_used_at = NOW(), ip = $2
+WHERE token = $1
+AND client_id IS NULL
 AND revoked_at IS NULL
-AND expires_at > NOW();
\ No newline at end of file
+AND expires_at > NOW()
+RETURNING *;
+
+-- name: CreateOAuthRefreshToken :one
+INSERT INTO refresh_tokens(token, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scopes, grant_id)
+VALUES ($1, NOW(), NOW(), $2, $3, NULL, $4, $5, $6)
+RETURNING *;
+
+-- name: UseOAuthRefreshToken :one
+-- oauth refresh tokens can only be used once, the client is given a new one of the same grant
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE token = $1
+AND client_id = sqlc.arg('client_id')::text
+AND revoked_at IS NULL
+AND expires_at > NOW()
+RETURNING *;
+
+-- name: RevokeOAuthGrant :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE grant_id = sqlc.arg('grant_id')::uuid AND revoked_at IS NULL;
+
+-- name: GetRefreshToken :one
+SELECT * FROM refresh_tokens WHERE token = $1;
+
+-- name: RevokeOAuthRefreshToken :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE token = $1 AND client_id = sqlc.arg('client_id')::text AND revoked_at IS NULL;
+
+-- name: GetSessions :many
+SELECT * FROM refresh_tokens
+WHERE user_id = $1
+AND client_id IS NULL
+AND revoked_at IS NULL
+AND expires_at > NOW()
+ORDER BY COALESCE(last_used_at, created_at) DESC;
+
+-- name: RevokeSession :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND user_id = $2 AND client_id IS NULL AND revoked_at IS NULL;
+
+-- name: RevokeOtherSessions :many
+-- log out everywhere else, every session of the user but the current one
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND id <> sqlc.arg('current_id') AND client_id IS NULL AND revoked_at IS NULL
+RETURNING id;
+
+-- name: RevokeUserRefreshTokens :exec
+-- every session of the user and every refresh token given to oauth clients
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
@@ -0,0 +1,18 @@
+-- name: RevokeToken :exec
+INSERT INTO revoked_tokens(id, created_at, expires_at)
+VALUES($1, NOW(), $2)
+ON CONFLICT (id) DO NOTHING;
+
+-- name: GetRevokedTokens :many
+SELECT * FROM revoked_tokens WHERE expires_at > NOW();
+
+-- name: PurgeRevokedTokens :exec
+DELETE FROM revoked_tokens WHERE expires_at <= NOW();
+
+-- name: SetTokensValidAfter :exec
+UPDATE users SET tokens_valid_after = $2 WHERE id = $1;
+
+-- name: GetTokensValidAfter :many
+-- only the users whose revocation can still apply to an unexpired token
+SELECT id, tokens_valid_after FROM users
+WHERE tokens_valid_after > sqlc.arg('since')::timestamp;
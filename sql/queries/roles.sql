@@ -0,0 +1,18 @@
+-- name: GetUserRoles :many
+SELECT role FROM user_roles
+WHERE user_id = $1
+ORDER BY role;
+
+-- name: GetUserPermissions :many
+SELECT DISTINCT role_permissions.permission FROM role_permissions
+JOIN user_roles ON user_roles.role = role_permissions.role
+WHERE user_roles.user_id = $1
+ORDER BY role_permissions.permission;
+
+-- name: AssignUserRole :exec
+INSERT INTO user_roles(user_id, role, created_at)
+VALUES($1, $2, NOW())
+ON CONFLICT (user_id, role) DO NOTHING;
+
+-- name: RemoveUserRole :execrows
+DELETE FROM user_roles WHERE user_id = $1 AND role = $2;
@@ -0,0 +1,13 @@
+-- name: GetSubscription :one
+SELECT * FROM subscriptions WHERE user_id = $1;
+
+-- name: UpsertSubscription :one
+INSERT INTO subscriptions(id, created_at, updated_at, user_id, plan, status, current_period_end, cancel_at, last_event_at)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4, $5, $6)
+ON CONFLICT (user_id) DO UPDATE
+SET plan = EXCLUDED.plan, status = EXCLUDED.status, current_period_end = EXCLUDED.current_period_end,
+    cancel_at = EXCLUDED.cancel_at, last_event_at = EXCLUDED.last_event_at, updated_at = NOW()
+RETURNING *;
+
+-- name: SetChirpyRedUntil :exec
+UPDATE users SET chirpy_red_until = $2 WHERE id = $1;
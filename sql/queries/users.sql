@@ -9,13 +9,58 @@ DELETE FROM users;
 -- name: GetUserByEmail :one
 SELECT * FROM users WHERE email = $1;
 
--- name: UpgradeToChirpyRed :exec
-UPDATE users
-SET is_chirpy_red = TRUE
-WHERE id = $1;
+-- name: GetUserByID :one
+SELECT * FROM users WHERE id = $1;
+
+-- name: UpdateUserEmail :one
+UPDATE users SET email = $2, updated_at = NOW() WHERE id = $1
+RETURNING *;
+
+-- name: ChangeUserPassword :one
+UPDATE users SET hashed_password = $2, updated_at = NOW() WHERE id = $1
+RETURNING *;
+
+-- name: UpdateUserPassword :exec
+-- replaces an outdated hash of the same password, so updated_at doesn't change
+UPDATE users SET hashed_password = $2 WHERE id = $1;
 
--- name: UpdateUserPassEmail :one
+-- name: UpdateUserProfile :one
 UPDATE users
-SET email = $1, hashed_password = $2, updated_at = NOW()
-WHERE id = $3
-RETURNING *;
\ No newline at end of file
+SET handle = $1, display_name = $2, bio = $3, avatar_url = $4, updated_at = NOW()
+WHERE id = $5
+RETURNING *;
+
+-- name: GetProfileByHandle :one
+SELECT id, created_at, handle, display_name, bio, avatar_url,
+    (SELECT COUNT(*) FROM follows WHERE follows.followee_id = users.id) AS followers_count,
+    (SELECT COUNT(*) FROM follows WHERE follows.follower_id = users.id) AS following_count,
+    (SELECT COUNT(*) FROM chirps WHERE chirps.user_id = users.id AND chirps.deleted_at IS NULL) AS chirps_count
+FROM users
+WHERE LOWER(handle) = LOWER(sqlc.arg('handle')) AND delete_after IS NULL;
+
+-- name: GetAuthors :many
+SELECT id, handle, display_name, avatar_url FROM users
+WHERE id = ANY(sqlc.arg('ids')::uuid[]);
+
+-- name: GetUsers :many
+SELECT * FROM users
+ORDER BY created_at ASC
+LIMIT $1 OFFSET $2;
+
+-- name: DeleteUser :execrows
+DELETE FROM users WHERE id = $1;
+
+-- name: ScheduleUserDeletion :one
+UPDATE users SET delete_after = $2, updated_at = NOW()
+WHERE id = $1 AND delete_after IS NULL
+RETURNING *;
+
+-- name: RestoreUser :one
+-- an account can be restored until it's purged
+UPDATE users SET delete_after = NULL, updated_at = NOW()
+WHERE id = $1 AND delete_after > NOW()
+RETURNING *;
+
+-- name: PurgeDeletedUsers :execrows
+-- everything of the users goes with them through the ON DELETE CASCADE foreign keys
+DELETE FROM users WHERE delete_after <= NOW();
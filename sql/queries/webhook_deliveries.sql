@@ -0,0 +1,45 @@
+-- name: CreateWebhookDeliveries :execrows
+-- queues the event for every enabled endpoint of the user that subscribed to it
+INSERT INTO webhook_deliveries(id, created_at, endpoint_id, event, payload, status, attempts, next_attempt_at)
+SELECT gen_random_uuid(), NOW(), webhook_endpoints.id, sqlc.arg('event')::text, sqlc.arg('payload')::text, 'pending', 0, NOW()
+FROM webhook_endpoints
+WHERE webhook_endpoints.user_id = sqlc.arg('user_id')
+AND webhook_endpoints.disabled_at IS NULL
+AND sqlc.arg('event')::text = ANY(webhook_endpoints.events);
+
+-- name: ClaimWebhookDeliveries :many
+-- the due deliveries are leased until lease_until, so they aren't sent twice while they're in flight
+UPDATE webhook_deliveries
+SET next_attempt_at = sqlc.arg('lease_until')
+FROM webhook_endpoints
+WHERE webhook_endpoints.id = webhook_deliveries.endpoint_id
+AND webhook_deliveries.id IN (
+    SELECT d.id FROM webhook_deliveries d
+    JOIN webhook_endpoints e ON e.id = d.endpoint_id
+    WHERE d.status = 'pending' AND d.next_attempt_at <= NOW() AND e.disabled_at IS NULL
+    ORDER BY d.next_attempt_at
+    LIMIT sqlc.arg('limit')
+    FOR UPDATE OF d SKIP LOCKED
+)
+RETURNING webhook_deliveries.id, webhook_deliveries.endpoint_id, webhook_deliveries.event, webhook_deliveries.payload,
+    webhook_deliveries.attempts, webhook_endpoints.url, webhook_endpoints.secret;
+
+-- name: CompleteWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET status = 'delivered', attempts = attempts + 1, last_attempt_at = NOW(), response_status = $2,
+    last_error = '', delivered_at = NOW()
+WHERE id = $1;
+
+-- name: FailWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET status = $2, attempts = attempts + 1, next_attempt_at = $3, last_attempt_at = NOW(), response_status = $4, last_error = $5
+WHERE id = $1;
+
+-- name: GetWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE endpoint_id = $1
+ORDER BY created_at DESC
+LIMIT $2 OFFSET $3;
+
+-- name: PurgeWebhookDeliveries :execrows
+DELETE FROM webhook_deliveries WHERE status <> 'pending' AND created_at < $1;
@@ -0,0 +1,38 @@
+-- name: CreateWebhookEndpoint :one
+INSERT INTO webhook_endpoints(id, created_at, updated_at, user_id, client_id, url, secret, events)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: GetWebhookEndpoints :many
+-- an app only sees the endpoints it registered, the user sees all of them
+SELECT * FROM webhook_endpoints
+WHERE user_id = sqlc.arg('user_id')
+AND (client_id = sqlc.narg('client_id') OR sqlc.narg('client_id') IS NULL)
+ORDER BY created_at;
+
+-- name: GetWebhookEndpoint :one
+SELECT * FROM webhook_endpoints
+WHERE id = sqlc.arg('id') AND user_id = sqlc.arg('user_id')
+AND (client_id = sqlc.narg('client_id') OR sqlc.narg('client_id') IS NULL);
+
+-- name: UpdateWebhookEndpoint :one
+UPDATE webhook_endpoints
+SET url = $2, events = $3, failure_count = $4, disabled_at = $5, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteWebhookEndpoint :execrows
+DELETE FROM webhook_endpoints
+WHERE id = sqlc.arg('id') AND user_id = sqlc.arg('user_id')
+AND (client_id = sqlc.narg('client_id') OR sqlc.narg('client_id') IS NULL);
+
+-- name: RecordWebhookEndpointSuccess :exec
+UPDATE webhook_endpoints SET failure_count = 0 WHERE id = $1;
+
+-- name: RecordWebhookEndpointFailure :one
+-- the endpoint is disabled when it reaches max_failures, the pending deliveries wait until it's enabled again
+UPDATE webhook_endpoints
+SET failure_count = failure_count + 1,
+    disabled_at = CASE WHEN failure_count + 1 >= sqlc.arg('max_failures')::integer THEN COALESCE(disabled_at, NOW()) ELSE disabled_at END
+WHERE id = sqlc.arg('id')
+RETURNING *;
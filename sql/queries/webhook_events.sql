@@ -0,0 +1,49 @@
+-- name: CreateWebhookEvent :execrows
+-- 0 rows means the event was already received
+INSERT INTO webhook_events(id, created_at, event, user_id, payload, sent_at, status, attempts, next_attempt_at)
+VALUES ($1, NOW(), $2, $3, $4, $5, 'pending', 0, NOW())
+ON CONFLICT (id) DO NOTHING;
+
+-- name: ClaimWebhookEvent :one
+-- the oldest due event whose user has no earlier pending event (even one waiting for a retry),
+-- so the events of a user are processed in the order they happened (sent_at). failed events don't hold back the next ones
+SELECT * FROM webhook_events e
+WHERE e.status = 'pending' AND e.next_attempt_at <= NOW()
+AND NOT EXISTS (
+    SELECT 1 FROM webhook_events earlier
+    WHERE earlier.user_id = e.user_id AND earlier.status = 'pending'
+    AND (earlier.sent_at, earlier.created_at) < (e.sent_at, e.created_at)
+)
+ORDER BY e.sent_at, e.created_at
+LIMIT 1
+FOR UPDATE SKIP LOCKED;
+
+-- name: CompleteWebhookEvent :exec
+UPDATE webhook_events
+SET status = 'processed', attempts = attempts + 1, last_error = '', processed_at = NOW()
+WHERE id = $1;
+
+-- name: FailWebhookEvent :exec
+UPDATE webhook_events
+SET status = $2, attempts = attempts + 1, next_attempt_at = $3, last_error = $4
+WHERE id = $1;
+
+-- name: GetWebhookEvent :one
+SELECT * FROM webhook_events WHERE id = $1;
+
+-- name: GetWebhookEventsByStatus :many
+SELECT * FROM webhook_events
+WHERE status = $1
+ORDER BY created_at DESC
+LIMIT $2 OFFSET $3;
+
+-- name: ReplayWebhookEvent :one
+-- the event gets all its attempts back
+UPDATE webhook_events
+SET status = 'pending', attempts = 0, next_attempt_at = NOW(), last_error = ''
+WHERE id = $1 AND status = 'failed'
+RETURNING *;
+
+-- name: PurgeWebhookEvents :execrows
+-- failed and pending events are kept until they're processed
+DELETE FROM webhook_events WHERE status = 'processed' AND created_at < $1;
@@ -1,7 +1,7 @@
 -- +goose Up
 ALTER TABLE users
-ADD COLUMN hashed_password TEXT NOT NULL DEFAULT "unset";
+ADD COLUMN hashed_password TEXT NOT NULL DEFAULT 'unset';
 
 -- +goose Down
 ALTER TABLE users
-DROP COLUMN hashed_password
\ No newline at end of file
+DROP COLUMN hashed_password;
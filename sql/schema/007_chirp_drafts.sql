@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE chirp_drafts(
+    id uuid PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    body TEXT NOT NULL,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    publish_at TIMESTAMP
+);
+
+CREATE INDEX chirp_drafts_publish_at_idx ON chirp_drafts(publish_at) WHERE publish_at IS NOT NULL;
+
+-- +goose Down
+DROP TABLE chirp_drafts;
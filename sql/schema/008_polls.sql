@@ -0,0 +1,29 @@
+-- +goose Up
+CREATE TABLE polls(
+    id uuid PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    chirp_id uuid NOT NULL UNIQUE REFERENCES chirps(id) ON DELETE CASCADE,
+    closes_at TIMESTAMP NOT NULL,
+    closed_notified_at TIMESTAMP
+);
+
+CREATE TABLE poll_options(
+    id uuid PRIMARY KEY,
+    poll_id uuid NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    text TEXT NOT NULL,
+    UNIQUE(poll_id, position)
+);
+
+CREATE TABLE poll_votes(
+    poll_id uuid NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    option_id uuid NOT NULL REFERENCES poll_options(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY(poll_id, user_id)
+);
+
+-- +goose Down
+DROP TABLE poll_votes;
+DROP TABLE poll_options;
+DROP TABLE polls;
@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE collections(
+    id uuid PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    UNIQUE(user_id, name)
+);
+
+-- chirp_id has no foreign key on purpose: a bookmark outlives its chirp and shows up as unavailable
+CREATE TABLE bookmarks(
+    collection_id uuid NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+    chirp_id uuid NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY(collection_id, chirp_id)
+);
+
+-- +goose Down
+DROP TABLE bookmarks;
+DROP TABLE collections;
@@ -0,0 +1,34 @@
+-- +goose Up
+CREATE TABLE roles(
+    name TEXT PRIMARY KEY
+);
+
+CREATE TABLE permissions(
+    name TEXT PRIMARY KEY
+);
+
+CREATE TABLE role_permissions(
+    role TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    permission TEXT NOT NULL REFERENCES permissions(name) ON DELETE CASCADE,
+    PRIMARY KEY(role, permission)
+);
+
+CREATE TABLE user_roles(
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY(user_id, role)
+);
+
+INSERT INTO roles(name) VALUES ('admin'), ('moderator');
+INSERT INTO permissions(name) VALUES ('chirps:delete_any'), ('users:manage');
+INSERT INTO role_permissions(role, permission) VALUES
+    ('admin', 'chirps:delete_any'),
+    ('admin', 'users:manage'),
+    ('moderator', 'chirps:delete_any');
+
+-- +goose Down
+DROP TABLE user_roles;
+DROP TABLE role_permissions;
+DROP TABLE permissions;
+DROP TABLE roles;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- first-party refresh tokens are the sessions of the user, one per device they logged in from
+ALTER TABLE refresh_tokens
+ADD COLUMN id uuid NOT NULL UNIQUE DEFAULT gen_random_uuid(), -- the token itself is a secret, this id is exposed instead
+ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+ADD COLUMN ip TEXT NOT NULL DEFAULT '',
+ADD COLUMN last_used_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP COLUMN id,
+DROP COLUMN user_agent,
+DROP COLUMN ip,
+DROP COLUMN last_used_at;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- access tokens of the user issued before this time are revoked (e.g. after a password change)
+ALTER TABLE users
+ADD COLUMN tokens_valid_after TIMESTAMP;
+
+-- revoked access tokens (jti) and sessions (sid), kept until the tokens would have expired anyway
+CREATE TABLE revoked_tokens(
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE revoked_tokens;
+ALTER TABLE users
+DROP COLUMN tokens_valid_after;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- email changes waiting for a confirmation from the new address, the old address gets a link to undo them
+CREATE TABLE email_changes(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    old_email TEXT NOT NULL,
+    new_email TEXT NOT NULL,
+    confirm_token_hash TEXT UNIQUE NOT NULL,
+    undo_token_hash TEXT UNIQUE NOT NULL,
+    expires_at TIMESTAMP NOT NULL, -- of the confirmation link
+    undo_expires_at TIMESTAMP NOT NULL,
+    confirmed_at TIMESTAMP,
+    undone_at TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE email_changes;
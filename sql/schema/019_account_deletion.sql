@@ -0,0 +1,26 @@
+-- +goose Up
+-- accounts scheduled for deletion can be restored until delete_after, then they are purged
+ALTER TABLE users
+ADD COLUMN delete_after TIMESTAMP;
+
+CREATE INDEX users_delete_after_idx ON users(delete_after) WHERE delete_after IS NOT NULL;
+
+-- personal data exports, the archive is generated in the background
+CREATE TABLE data_exports(
+    id uuid PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending', -- pending, ready or failed
+    archive BYTEA, -- zip archive of json files, set once ready
+    completed_at TIMESTAMP,
+    expires_at TIMESTAMP -- the archive is purged after this time
+);
+
+-- a user has at most one export being generated
+CREATE UNIQUE INDEX data_exports_pending_idx ON data_exports(user_id) WHERE status = 'pending';
+
+-- +goose Down
+DROP TABLE data_exports;
+DROP INDEX users_delete_after_idx;
+ALTER TABLE users
+DROP COLUMN delete_after;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- ids of the processed polka events, a replayed event is rejected
+CREATE TABLE webhook_events(
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE webhook_events;
@@ -0,0 +1,36 @@
+-- +goose Up
+-- chirpy red subscriptions, updated from the polka events
+CREATE TABLE subscriptions(
+    id uuid PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id uuid NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    plan TEXT NOT NULL,
+    status TEXT NOT NULL, -- active, past_due or canceled
+    current_period_end TIMESTAMP NOT NULL,
+    cancel_at TIMESTAMP -- a canceled subscription ends at this time
+);
+
+-- derived from the subscription whenever it changes, the user is chirpy red until this time
+ALTER TABLE users
+ADD COLUMN chirpy_red_until TIMESTAMP;
+
+-- users upgraded before subscriptions existed get a month, as if they had just subscribed
+INSERT INTO subscriptions(id, created_at, updated_at, user_id, plan, status, current_period_end)
+SELECT gen_random_uuid(), NOW(), NOW(), id, 'chirpy_red', 'active', NOW() + INTERVAL '30 days'
+FROM users WHERE is_chirpy_red;
+
+-- the period and the one day leeway of active subscriptions
+UPDATE users SET chirpy_red_until = NOW() + INTERVAL '31 days'
+WHERE is_chirpy_red;
+
+ALTER TABLE users
+DROP COLUMN is_chirpy_red;
+
+-- +goose Down
+ALTER TABLE users
+ADD COLUMN is_chirpy_red BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE users SET is_chirpy_red = TRUE WHERE chirpy_red_until > NOW();
+ALTER TABLE users
+DROP COLUMN chirpy_red_until;
+DROP TABLE subscriptions;
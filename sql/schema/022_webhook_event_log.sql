@@ -0,0 +1,37 @@
+-- +goose Up
+-- every polka event is stored when it's received and processed later by a worker, in order per user.
+-- a failing event is retried with a backoff and ends up failed (the dead letter state) after too many attempts
+ALTER TABLE webhook_events
+ADD COLUMN event TEXT NOT NULL DEFAULT '',
+ADD COLUMN user_id uuid,
+ADD COLUMN payload TEXT NOT NULL DEFAULT '',
+ADD COLUMN sent_at TIMESTAMP NOT NULL DEFAULT NOW(),
+-- the events recorded so far were processed when they were received
+ADD COLUMN status TEXT NOT NULL DEFAULT 'processed',
+ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+ADD COLUMN last_error TEXT NOT NULL DEFAULT '',
+ADD COLUMN processed_at TIMESTAMP;
+
+UPDATE webhook_events SET sent_at = created_at, processed_at = created_at;
+
+CREATE INDEX webhook_events_pending_idx ON webhook_events(user_id, sent_at) WHERE status = 'pending';
+CREATE INDEX webhook_events_status_idx ON webhook_events(status, created_at);
+
+INSERT INTO permissions(name) VALUES ('webhooks:manage');
+INSERT INTO role_permissions(role, permission) VALUES ('admin', 'webhooks:manage');
+
+-- +goose Down
+DELETE FROM permissions WHERE name = 'webhooks:manage';
+DROP INDEX webhook_events_status_idx;
+DROP INDEX webhook_events_pending_idx;
+ALTER TABLE webhook_events
+DROP COLUMN processed_at,
+DROP COLUMN last_error,
+DROP COLUMN next_attempt_at,
+DROP COLUMN attempts,
+DROP COLUMN status,
+DROP COLUMN sent_at,
+DROP COLUMN payload,
+DROP COLUMN user_id,
+DROP COLUMN event;
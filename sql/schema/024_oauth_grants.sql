@@ -0,0 +1,12 @@
+-- +goose Up
+-- the refresh tokens of an oauth client are rotated on every use, the tokens of one authorization share its grant
+-- id, so revoking the grant revokes every one of them and the access tokens they were exchanged for
+ALTER TABLE refresh_tokens
+ADD COLUMN grant_id uuid;
+
+CREATE INDEX refresh_tokens_grant_id_idx ON refresh_tokens(grant_id);
+
+-- +goose Down
+DROP INDEX refresh_tokens_grant_id_idx;
+ALTER TABLE refresh_tokens
+DROP COLUMN grant_id;
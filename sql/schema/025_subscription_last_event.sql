@@ -0,0 +1,11 @@
+-- +goose Up
+-- the time of the last polka event applied to the subscription, polka can send the events of a user out of order
+-- and an event older than this one would undo a later change
+ALTER TABLE subscriptions
+ADD COLUMN last_event_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00'; -- no event applied yet
+
+UPDATE subscriptions SET last_event_at = updated_at;
+
+-- +goose Down
+ALTER TABLE subscriptions
+DROP COLUMN last_event_at;
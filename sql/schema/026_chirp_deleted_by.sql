@@ -0,0 +1,12 @@
+-- +goose Up
+-- who moved the chirp to the trash, the author or a moderator. only the author can restore the chirps they deleted,
+-- a chirp removed by a moderator stays removed
+ALTER TABLE chirps
+ADD COLUMN deleted_by uuid;
+
+-- the chirps trashed before could only be restored by their author
+UPDATE chirps SET deleted_by = user_id WHERE deleted_at IS NOT NULL;
+
+-- +goose Down
+ALTER TABLE chirps
+DROP COLUMN deleted_by;
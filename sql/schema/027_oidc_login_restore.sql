@@ -0,0 +1,9 @@
+-- +goose Up
+-- a login started to restore an account scheduled for deletion, the users without a password can only restore
+-- their account by logging in with the provider
+ALTER TABLE oidc_logins
+ADD COLUMN restore BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE oidc_logins
+DROP COLUMN restore;
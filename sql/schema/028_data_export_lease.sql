@@ -0,0 +1,9 @@
+-- +goose Up
+-- a pending export is leased while its archive is generated, so the other servers skip it without the generation
+-- holding a transaction
+ALTER TABLE data_exports
+ADD COLUMN lease_until TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE data_exports
+DROP COLUMN lease_until;
@@ -0,0 +1,7 @@
+// Package schema embeds the goose migrations of the postgres database, so the binary can apply them itself
+package schema
+
+import "embed"
+
+//go:embed *.sql
+var Migrations embed.FS
@@ -0,0 +1,436 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/h0dy/http-server/internal/database"
+	_ "github.com/lib/pq"
+	"github.com/pressly/goose/v3"
+)
+
+// sqlcModels are the models sqlc generates from the migrations, one per table
+var sqlcModels = []any{
+	database.ApiToken{},
+	database.Bookmark{},
+	database.Chirp{},
+	database.ChirpDraft{},
+	database.Collection{},
+	database.DataExport{},
+	database.EmailChange{},
+	database.Follow{},
+	database.Notification{},
+	database.OauthClient{},
+	database.OauthCode{},
+	database.OidcLogin{},
+	database.Permission{},
+	database.Poll{},
+	database.PollOption{},
+	database.PollVote{},
+	database.RefreshToken{},
+	database.RevokedToken{},
+	database.Role{},
+	database.RolePermission{},
+	database.Subscription{},
+	database.User{},
+	database.UserIdentity{},
+	database.UserRole{},
+	database.WebhookDelivery{},
+	database.WebhookEndpoint{},
+	database.WebhookEvent{},
+}
+
+// sqlcTypes are the go types of the columns in the sqlc models, when they're nullable and when they aren't
+var sqlcTypes = map[string][2]string{
+	"uuid":      {"uuid.NullUUID", "uuid.UUID"},
+	"text":      {"sql.NullString", "string"},
+	"timestamp": {"sql.NullTime", "time.Time"},
+	"bool":      {"sql.NullBool", "bool"},
+	"int4":      {"sql.NullInt32", "int32"},
+	"bytea":     {"[]uint8", "[]uint8"},
+	"text[]":    {"[]string", "[]string"},
+}
+
+// schema is what the migrations are checked on: the columns of the tables in their order, and the indexes
+type schema struct {
+	Tables  map[string][]column
+	Indexes map[string]string // the table of every index
+}
+
+type column struct {
+	Name    string
+	Type    string // the postgres name of the type, e.g. int4 for INTEGER, with [] for an array
+	NotNull bool
+}
+
+// TestMigrationsLint checks the mistakes in the migrations that would otherwise only show up when they're applied
+func TestMigrationsLint(t *testing.T) {
+	for _, file := range migrationFiles(t) {
+		src, err := fs.ReadFile(Migrations, file.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, problem := range lintMigration(string(src)) {
+			t.Errorf("%v: %v", file.path, problem)
+		}
+	}
+}
+
+func TestLintMigration(t *testing.T) {
+	tests := []struct {
+		name         string
+		src          string
+		wantProblems int
+	}{
+		{
+			name: "Up and down",
+			src:  "-- +goose Up\nALTER TABLE users\nADD COLUMN bio TEXT NOT NULL DEFAULT ''; -- shown on the profile\n\n-- +goose Down\nALTER TABLE users\nDROP COLUMN bio;\n",
+		},
+		{name: "Quoted identifier", src: "-- +goose Up\nCREATE TABLE \"users\"(id uuid PRIMARY KEY);\n-- +goose Down\nDROP TABLE \"users\";\n"},
+		{name: "Unfinished up", src: "-- +goose Up\nDROP TABLE users\n-- +goose Down\n", wantProblems: 1},
+		{name: "Unfinished down", src: "-- +goose Up\n-- +goose Down\nDROP TABLE users -- no semicolon;", wantProblems: 1},
+		{name: "Quoted default", src: "-- +goose Up\nALTER TABLE users ADD COLUMN bio TEXT NOT NULL DEFAULT \"\";\n-- +goose Down\n", wantProblems: 1},
+		{name: "Quoted lowercase default", src: "-- +goose Up\nALTER TABLE users ADD COLUMN status TEXT default \"pending\";\n-- +goose Down\n", wantProblems: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if problems := lintMigration(tt.src); len(problems) != tt.wantProblems {
+				t.Errorf("lintMigration() = %q, want %d problems", problems, tt.wantProblems)
+			}
+		})
+	}
+}
+
+// quotedDefault matches a default in double quotes, postgres reads it as a column and rejects it
+var quotedDefault = regexp.MustCompile(`(?i)\bDEFAULT\s+"`)
+
+// lintMigration func returns the mistakes of a goose migration: a default in double quotes instead of single quotes,
+// and a statement without a semicolon at the end of a section, which goose would run with the next section
+func lintMigration(src string) []string {
+	var problems []string
+	section := ""
+	pending := false // the last statement has no semicolon yet
+	for i, line := range strings.Split(src, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if annotation, ok := strings.CutPrefix(trimmed, "-- +goose"); ok {
+			if pending {
+				problems = append(problems, fmt.Sprintf("the %v section ends without a semicolon before line %d", section, i+1))
+			}
+			section = strings.TrimSpace(annotation)
+			pending = false
+			continue
+		}
+		code, _, _ := strings.Cut(trimmed, "--")
+		code = strings.TrimSpace(code)
+		if code == "" {
+			continue
+		}
+		if quotedDefault.MatchString(code) {
+			problems = append(problems, fmt.Sprintf("line %d: the default is in double quotes, use single quotes for a string", i+1))
+		}
+		pending = !strings.HasSuffix(code, ";")
+	}
+	if pending {
+		problems = append(problems, fmt.Sprintf("the %v section ends without a semicolon at the end of the migration", section))
+	}
+	return problems
+}
+
+// TestMigrationsPostgres applies the migrations to a database it creates on the server of TEST_DB_URL, and drops after.
+// the ci workflow provides the server, so the test can't be skipped there
+func TestMigrationsPostgres(t *testing.T) {
+	dbURL := os.Getenv("TEST_DB_URL")
+	if dbURL == "" && os.Getenv("CI") != "" {
+		t.Fatal("TEST_DB_URL must be set in ci, the migrations would never be applied")
+	}
+	if dbURL == "" {
+		t.Skip("TEST_DB_URL isn't set, run a postgres and set it to apply the migrations")
+	}
+	testMigrations(t, newPostgresDB(t, dbURL))
+}
+
+// testMigrations func applies every migration, checking that its down migration undoes it and that it can be
+// applied again after that. the schema of the last one has to match the sqlc models, and the down migrations
+// have to empty the database
+func testMigrations(t *testing.T, db *postgresDB) {
+	ctx := context.Background()
+	files := migrationFiles(t)
+
+	empty := currentSchema(t, db)
+	for _, file := range files {
+		before := currentSchema(t, db)
+		if err := db.apply(ctx, file.version, true); err != nil {
+			t.Fatalf("couldn't apply %v: %v", file.path, err)
+		}
+		after := currentSchema(t, db)
+		if err := db.apply(ctx, file.version, false); err != nil {
+			t.Fatalf("couldn't roll back %v: %v", file.path, err)
+		}
+		for _, diff := range before.diff(currentSchema(t, db)) {
+			t.Errorf("the down migration of %v doesn't undo it: %v", file.path, diff)
+		}
+		if err := db.apply(ctx, file.version, true); err != nil {
+			t.Fatalf("couldn't apply %v after its down migration: %v", file.path, err)
+		}
+		for _, diff := range after.diff(currentSchema(t, db)) {
+			t.Errorf("%v changed the schema differently after its down migration: %v", file.path, diff)
+		}
+	}
+
+	checkSQLCModels(t, currentSchema(t, db))
+
+	for _, file := range slices.Backward(files) {
+		if err := db.apply(ctx, file.version, false); err != nil {
+			t.Fatalf("couldn't roll back %v: %v", file.path, err)
+		}
+	}
+	for _, diff := range empty.diff(currentSchema(t, db)) {
+		t.Errorf("the down migrations didn't empty the database: %v", diff)
+	}
+}
+
+func currentSchema(t *testing.T, db *postgresDB) schema {
+	t.Helper()
+	sch, err := db.schema(context.Background())
+	if err != nil {
+		t.Fatalf("couldn't read the schema: %v", err)
+	}
+	return sch
+}
+
+// checkSQLCModels func compares the tables with the models sqlc generated, a migration changed without running
+// sqlc generate (or sqlc reading the migrations differently than postgres) shows up as a difference
+func checkSQLCModels(t *testing.T, sch schema) {
+	t.Helper()
+	models := map[string]reflect.Type{}
+	for _, model := range sqlcModels {
+		typ := reflect.TypeOf(model)
+		models[typ.Name()] = typ
+	}
+
+	for table, columns := range sch.Tables {
+		name := sqlcStructName(table)
+		model, ok := models[name]
+		if !ok {
+			t.Errorf("table %v has no sqlc model %v, run sqlc generate and add it to sqlcModels", table, name)
+			continue
+		}
+		delete(models, name)
+
+		want := make([]string, 0, len(columns))
+		for _, col := range columns {
+			goType, ok := sqlcTypes[col.Type]
+			if !ok {
+				t.Errorf("column %v of %v has the type %v that isn't in sqlcTypes", col.Name, table, col.Type)
+				continue
+			}
+			nullable := 0
+			if col.NotNull {
+				nullable = 1
+			}
+			want = append(want, sqlcFieldName(col.Name)+" "+goType[nullable])
+		}
+		got := make([]string, 0, model.NumField())
+		for i := range model.NumField() {
+			field := model.Field(i)
+			got = append(got, field.Name+" "+field.Type.String())
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("sqlc model %v has the fields %v, want %v from the columns of %v", name, got, want, table)
+		}
+	}
+	for name := range models {
+		t.Errorf("sqlc model %v has no table", name)
+	}
+}
+
+// sqlcStructName func returns the name sqlc gives the model of a table, e.g. WebhookDelivery for webhook_deliveries
+func sqlcStructName(table string) string {
+	words := strings.Split(table, "_")
+	last := words[len(words)-1]
+	if singular, ok := strings.CutSuffix(last, "ies"); ok {
+		words[len(words)-1] = singular + "y"
+	} else {
+		words[len(words)-1] = strings.TrimSuffix(last, "s")
+	}
+	return sqlcFieldName(strings.Join(words, "_"))
+}
+
+// sqlcFieldName func returns the name sqlc gives the field of a column, e.g. UserID for user_id
+func sqlcFieldName(col string) string {
+	var name strings.Builder
+	for _, word := range strings.Split(col, "_") {
+		if word == "id" {
+			name.WriteString("ID")
+			continue
+		}
+		name.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return name.String()
+}
+
+// diff func describes how got differs from sch. the order of the columns isn't compared,
+// a down migration can't put a column it adds back where it was
+func (sch schema) diff(got schema) []string {
+	var diffs []string
+	for table, columns := range sch.Tables {
+		if gotColumns, ok := got.Tables[table]; !ok {
+			diffs = append(diffs, fmt.Sprintf("table %v is missing", table))
+		} else if !slices.Equal(sortedColumns(gotColumns), sortedColumns(columns)) {
+			diffs = append(diffs, fmt.Sprintf("table %v has the columns %v, want %v", table, gotColumns, columns))
+		}
+	}
+	for table := range got.Tables {
+		if _, ok := sch.Tables[table]; !ok {
+			diffs = append(diffs, fmt.Sprintf("unexpected table %v", table))
+		}
+	}
+	for index, table := range sch.Indexes {
+		if gotTable, ok := got.Indexes[index]; !ok {
+			diffs = append(diffs, fmt.Sprintf("index %v is missing", index))
+		} else if gotTable != table {
+			diffs = append(diffs, fmt.Sprintf("index %v is on %v, want %v", index, gotTable, table))
+		}
+	}
+	for index := range got.Indexes {
+		if _, ok := sch.Indexes[index]; !ok {
+			diffs = append(diffs, fmt.Sprintf("unexpected index %v", index))
+		}
+	}
+	slices.Sort(diffs)
+	return diffs
+}
+
+func sortedColumns(columns []column) []column {
+	return slices.SortedFunc(slices.Values(columns), func(a, b column) int { return strings.Compare(a.Name, b.Name) })
+}
+
+type migrationFile struct {
+	version int64
+	path    string
+}
+
+// migrationFiles func returns the embedded migrations in the order of their versions
+func migrationFiles(t *testing.T) []migrationFile {
+	t.Helper()
+	paths, err := fs.Glob(Migrations, "*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make([]migrationFile, 0, len(paths))
+	for _, path := range paths {
+		version, err := goose.NumericComponent(path)
+		if err != nil {
+			t.Fatalf("migration %v has no version: %v", path, err)
+		}
+		files = append(files, migrationFile{version: version, path: path})
+	}
+	slices.SortFunc(files, func(a, b migrationFile) int { return int(a.version - b.version) })
+	return files
+}
+
+// postgresDB applies the migrations with goose, to a database of its own
+type postgresDB struct {
+	db       *sql.DB
+	migrator *goose.Provider
+}
+
+// newPostgresDB func creates an empty database on the server of dbURL, it's dropped when the test ends
+func newPostgresDB(t *testing.T, dbURL string) *postgresDB {
+	t.Helper()
+	server, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("couldn't open the database: %v", err)
+	}
+	name := "chirpy_migrations_" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	if _, err := server.Exec("CREATE DATABASE " + name); err != nil {
+		server.Close()
+		t.Fatalf("couldn't create the database: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := server.Exec("DROP DATABASE " + name); err != nil {
+			t.Errorf("couldn't drop the database %v: %v", name, err)
+		}
+		server.Close()
+	})
+
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		t.Fatalf("TEST_DB_URL isn't a url: %v", err)
+	}
+	u.Path = "/" + name
+	db, err := sql.Open("postgres", u.String())
+	if err != nil {
+		t.Fatalf("couldn't open the database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := goose.NewProvider(goose.DialectPostgres, db, Migrations)
+	if err != nil {
+		t.Fatalf("couldn't load the migrations: %v", err)
+	}
+	return &postgresDB{db: db, migrator: migrator}
+}
+
+func (db *postgresDB) apply(ctx context.Context, version int64, up bool) error {
+	_, err := db.migrator.ApplyVersion(ctx, version, up)
+	return err
+}
+
+func (db *postgresDB) schema(ctx context.Context) (schema, error) {
+	sch := schema{Tables: map[string][]column{}, Indexes: map[string]string{}}
+	rows, err := db.db.QueryContext(ctx, `
+		SELECT table_name, column_name, udt_name, is_nullable = 'NO'
+		FROM information_schema.columns
+		WHERE table_schema = 'public' AND table_name <> 'goose_db_version'
+		ORDER BY table_name, ordinal_position
+	`)
+	if err != nil {
+		return schema{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table string
+		var col column
+		if err := rows.Scan(&table, &col.Name, &col.Type, &col.NotNull); err != nil {
+			return schema{}, err
+		}
+		// the types of arrays are named after the type of their elements, _text for text[]
+		if elem, ok := strings.CutPrefix(col.Type, "_"); ok {
+			col.Type = elem + "[]"
+		}
+		sch.Tables[table] = append(sch.Tables[table], col)
+	}
+	if err := rows.Err(); err != nil {
+		return schema{}, err
+	}
+
+	rows, err = db.db.QueryContext(ctx, `
+		SELECT indexname, tablename FROM pg_indexes
+		WHERE schemaname = 'public' AND tablename <> 'goose_db_version'
+	`)
+	if err != nil {
+		return schema{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var index, table string
+		if err := rows.Scan(&index, &table); err != nil {
+			return schema{}, err
+		}
+		sch.Indexes[index] = table
+	}
+	return sch, rows.Err()
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/database"
+)
+
+// chirpy red subscriptions follow the polka events: user.upgraded starts (or restarts) a subscription,
+// subscription.renewed extends it to its new period end, subscription.payment_failed makes it past due,
+// subscription.canceled ends it at cancel_at (the end of the paid period by default)
+// and user.downgraded ends it right away. polka can send the events out of order, an event older than the last one
+// applied to the subscription is skipped
+
+const (
+	subscriptionActive   = "active"
+	subscriptionPastDue  = "past_due" // the renewal payment failed, polka retries it during the grace period
+	subscriptionCanceled = "canceled"
+
+	chirpyRedPlan = "chirpy_red"
+
+	subscriptionPeriod      = 30 * 24 * time.Hour // used when polka doesn't send the end of the period
+	subscriptionLeeway      = 24 * time.Hour      // the renewal event of an active subscription can come a bit late
+	subscriptionGracePeriod = 7 * 24 * time.Hour  // a past due subscription stays chirpy red this long after its period
+)
+
+var (
+	errNoSubscription = errors.New("the user has no subscription")
+	errStaleEvent     = errors.New("the subscription already applied a later event")
+)
+
+// polkaEvent is a webhook event sent by polka
+type polkaEvent struct {
+	ID        string         `json:"id"`
+	Event     string         `json:"event"`
+	CreatedAt *time.Time     `json:"created_at"` // when it happened, the same for every attempt to send it
+	Data      polkaEventData `json:"data"`
+}
+
+type polkaEventData struct {
+	UserID           uuid.UUID  `json:"user_id"`
+	Plan             string     `json:"plan"`
+	CurrentPeriodEnd *time.Time `json:"current_period_end"`
+	CancelAt         *time.Time `json:"cancel_at"`
+}
+
+// applyPolkaEvent func returns the subscription after the event that happened at now, current is nil when the user
+// has no subscription yet. changed is false for events that don't concern subscriptions
+func applyPolkaEvent(current *database.Subscription, event polkaEvent, now time.Time) (next database.Subscription, changed bool, err error) {
+	next = database.Subscription{UserID: event.Data.UserID, Plan: chirpyRedPlan}
+	if current != nil {
+		next = *current
+		// events of the same second are applied in the order they're processed
+		if isSubscriptionEvent(event.Event) && now.Before(current.LastEventAt) {
+			return database.Subscription{}, false, errStaleEvent
+		}
+	} else if event.Event != "user.upgraded" && isSubscriptionEvent(event.Event) {
+		return database.Subscription{}, false, errNoSubscription
+	}
+	next.LastEventAt = now
+	if event.Data.Plan != "" {
+		next.Plan = event.Data.Plan
+	}
+
+	switch event.Event {
+	case "user.upgraded":
+		next.Status = subscriptionActive
+		next.CurrentPeriodEnd = now.Add(subscriptionPeriod)
+		if event.Data.CurrentPeriodEnd != nil {
+			next.CurrentPeriodEnd = event.Data.CurrentPeriodEnd.UTC()
+		}
+		next.CancelAt = sql.NullTime{}
+	case "subscription.renewed":
+		// without the new period end, the next period starts where the current one ends (or now if it's over)
+		periodStart := next.CurrentPeriodEnd
+		if periodStart.Before(now) {
+			periodStart = now
+		}
+		next.Status = subscriptionActive
+		next.CurrentPeriodEnd = periodStart.Add(subscriptionPeriod)
+		if event.Data.CurrentPeriodEnd != nil {
+			next.CurrentPeriodEnd = event.Data.CurrentPeriodEnd.UTC()
+		}
+		next.CancelAt = sql.NullTime{}
+	case "subscription.payment_failed":
+		next.Status = subscriptionPastDue
+	case "subscription.canceled":
+		next.Status = subscriptionCanceled
+		next.CancelAt = sql.NullTime{Time: next.CurrentPeriodEnd, Valid: true}
+		if event.Data.CancelAt != nil {
+			next.CancelAt.Time = event.Data.CancelAt.UTC()
+		}
+	case "user.downgraded":
+		next.Status = subscriptionCanceled
+		next.CancelAt = sql.NullTime{Time: now, Valid: true}
+	default:
+		return database.Subscription{}, false, nil
+	}
+	return next, true, nil
+}
+
+// polkaEventTime func returns when the event happened, so the events of a user are ordered the same however polka
+// sends them. polka signs every attempt when it's sent, so the timestamp of the signature is only used when the event
+// doesn't say, and an event can't have happened after it was signed
+func polkaEventTime(event polkaEvent, signedAt time.Time) time.Time {
+	if event.CreatedAt == nil || event.CreatedAt.After(signedAt) {
+		return signedAt
+	}
+	return event.CreatedAt.UTC()
+}
+
+func isSubscriptionEvent(event string) bool {
+	switch event {
+	case "user.upgraded", "user.downgraded", "subscription.renewed", "subscription.payment_failed", "subscription.canceled":
+		return true
+	}
+	return false
+}
+
+// chirpyRedUntil func returns until when the subscription makes its user chirpy red, the zero time if it doesn't
+func chirpyRedUntil(sub database.Subscription) time.Time {
+	switch sub.Status {
+	case subscriptionActive:
+		return sub.CurrentPeriodEnd.Add(subscriptionLeeway)
+	case subscriptionPastDue:
+		return sub.CurrentPeriodEnd.Add(subscriptionGracePeriod)
+	case subscriptionCanceled:
+		if sub.CancelAt.Valid && sub.CancelAt.Time.Before(sub.CurrentPeriodEnd) {
+			return sub.CancelAt.Time
+		}
+		return sub.CurrentPeriodEnd
+	}
+	return time.Time{}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/database"
+)
+
+func TestApplyPolkaEvent(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	userID := uuid.New()
+	periodEnd := now.Add(10 * 24 * time.Hour)
+	newPeriodEnd := now.Add(40 * 24 * time.Hour)
+	cancelAt := now.Add(5 * 24 * time.Hour)
+
+	active := &database.Subscription{UserID: userID, Plan: chirpyRedPlan, Status: subscriptionActive, CurrentPeriodEnd: periodEnd}
+	expired := &database.Subscription{UserID: userID, Plan: chirpyRedPlan, Status: subscriptionActive, CurrentPeriodEnd: now.Add(-time.Hour)}
+	canceled := &database.Subscription{
+		UserID:           userID,
+		Plan:             chirpyRedPlan,
+		Status:           subscriptionCanceled,
+		CurrentPeriodEnd: periodEnd,
+		CancelAt:         sql.NullTime{Time: periodEnd, Valid: true},
+	}
+
+	event := func(name string, data polkaEventData) polkaEvent {
+		data.UserID = userID
+		return polkaEvent{ID: "evt_1", Event: name, Data: data}
+	}
+
+	tests := []struct {
+		name        string
+		current     *database.Subscription
+		event       polkaEvent
+		wantStatus  string
+		wantEnd     time.Time
+		wantCancel  sql.NullTime
+		wantChanged bool
+		wantErr     error
+	}{
+		{
+			name:        "Upgrade without a subscription",
+			event:       event("user.upgraded", polkaEventData{}),
+			wantStatus:  subscriptionActive,
+			wantEnd:     now.Add(subscriptionPeriod),
+			wantChanged: true,
+		},
+		{
+			name:        "Upgrade with the period end",
+			event:       event("user.upgraded", polkaEventData{CurrentPeriodEnd: &newPeriodEnd}),
+			wantStatus:  subscriptionActive,
+			wantEnd:     newPeriodEnd,
+			wantChanged: true,
+		},
+		{
+			name:        "Upgrade restarts a canceled subscription",
+			current:     canceled,
+			event:       event("user.upgraded", polkaEventData{}),
+			wantStatus:  subscriptionActive,
+			wantEnd:     now.Add(subscriptionPeriod),
+			wantChanged: true,
+		},
+		{
+			name:        "Renewal with the period end",
+			current:     active,
+			event:       event("subscription.renewed", polkaEventData{CurrentPeriodEnd: &newPeriodEnd}),
+			wantStatus:  subscriptionActive,
+			wantEnd:     newPeriodEnd,
+			wantChanged: true,
+		},
+		{
+			name:        "Renewal extends the current period",
+			current:     active,
+			event:       event("subscription.renewed", polkaEventData{}),
+			wantStatus:  subscriptionActive,
+			wantEnd:     periodEnd.Add(subscriptionPeriod),
+			wantChanged: true,
+		},
+		{
+			name:        "Renewal of a period that's over starts now",
+			current:     expired,
+			event:       event("subscription.renewed", polkaEventData{}),
+			wantStatus:  subscriptionActive,
+			wantEnd:     now.Add(subscriptionPeriod),
+			wantChanged: true,
+		},
+		{
+			name:        "Payment failed",
+			current:     active,
+			event:       event("subscription.payment_failed", polkaEventData{}),
+			wantStatus:  subscriptionPastDue,
+			wantEnd:     periodEnd,
+			wantChanged: true,
+		},
+		{
+			name:        "Cancellation at the end of the period",
+			current:     active,
+			event:       event("subscription.canceled", polkaEventData{}),
+			wantStatus:  subscriptionCanceled,
+			wantEnd:     periodEnd,
+			wantCancel:  sql.NullTime{Time: periodEnd, Valid: true},
+			wantChanged: true,
+		},
+		{
+			name:        "Cancellation at a given time",
+			current:     active,
+			event:       event("subscription.canceled", polkaEventData{CancelAt: &cancelAt}),
+			wantStatus:  subscriptionCanceled,
+			wantEnd:     periodEnd,
+			wantCancel:  sql.NullTime{Time: cancelAt, Valid: true},
+			wantChanged: true,
+		},
+		{
+			name:        "Downgrade ends the subscription now",
+			current:     active,
+			event:       event("user.downgraded", polkaEventData{}),
+			wantStatus:  subscriptionCanceled,
+			wantEnd:     periodEnd,
+			wantCancel:  sql.NullTime{Time: now, Valid: true},
+			wantChanged: true,
+		},
+		{
+			name:    "Renewal without a subscription",
+			event:   event("subscription.renewed", polkaEventData{}),
+			wantErr: errNoSubscription,
+		},
+		{
+			name:    "Cancellation without a subscription",
+			event:   event("subscription.canceled", polkaEventData{}),
+			wantErr: errNoSubscription,
+		},
+		{
+			name:    "Unknown event",
+			current: active,
+			event:   event("user.followed", polkaEventData{}),
+		},
+		{
+			name:    "Event older than the last one applied",
+			current: &database.Subscription{UserID: userID, Plan: chirpyRedPlan, Status: subscriptionActive, CurrentPeriodEnd: periodEnd, LastEventAt: now.Add(time.Second)},
+			event:   event("subscription.canceled", polkaEventData{}),
+			wantErr: errStaleEvent,
+		},
+		{
+			name:        "Event of the same time as the last one applied",
+			current:     &database.Subscription{UserID: userID, Plan: chirpyRedPlan, Status: subscriptionActive, CurrentPeriodEnd: periodEnd, LastEventAt: now},
+			event:       event("subscription.canceled", polkaEventData{}),
+			wantStatus:  subscriptionCanceled,
+			wantEnd:     periodEnd,
+			wantCancel:  sql.NullTime{Time: periodEnd, Valid: true},
+			wantChanged: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, changed, err := applyPolkaEvent(tt.current, tt.event, now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("applyPolkaEvent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if changed != tt.wantChanged {
+				t.Fatalf("applyPolkaEvent() changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if !changed {
+				return
+			}
+			if next.UserID != userID || next.Plan != chirpyRedPlan || !next.LastEventAt.Equal(now) {
+				t.Errorf("applyPolkaEvent() = %+v, want the chirpy red subscription of the user with the event applied at %v", next, now)
+			}
+			if next.Status != tt.wantStatus {
+				t.Errorf("status = %v, want %v", next.Status, tt.wantStatus)
+			}
+			if !next.CurrentPeriodEnd.Equal(tt.wantEnd) {
+				t.Errorf("current period end = %v, want %v", next.CurrentPeriodEnd, tt.wantEnd)
+			}
+			if next.CancelAt.Valid != tt.wantCancel.Valid || !next.CancelAt.Time.Equal(tt.wantCancel.Time) {
+				t.Errorf("cancel at = %v, want %v", next.CancelAt, tt.wantCancel)
+			}
+		})
+	}
+
+	// the event doesn't change the subscription it's given
+	if _, _, err := applyPolkaEvent(active, event("subscription.payment_failed", polkaEventData{}), now); err != nil || active.Status != subscriptionActive {
+		t.Errorf("applyPolkaEvent() changed the current subscription to %+v", active)
+	}
+}
+
+func TestApplyPolkaEventsOutOfOrder(t *testing.T) {
+	upgradedAt := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	canceledAt := upgradedAt.Add(time.Minute)
+	userID := uuid.New()
+	upgraded := polkaEvent{ID: "evt_1", Event: "user.upgraded", Data: polkaEventData{UserID: userID}}
+	canceled := polkaEvent{ID: "evt_2", Event: "subscription.canceled", Data: polkaEventData{UserID: userID}}
+	// the user subscribed before, so the cancellation doesn't wait for the upgrade
+	previous := &database.Subscription{
+		UserID:           userID,
+		Plan:             chirpyRedPlan,
+		Status:           subscriptionCanceled,
+		CurrentPeriodEnd: upgradedAt.Add(-time.Hour),
+		CancelAt:         sql.NullTime{Time: upgradedAt.Add(-time.Hour), Valid: true},
+		LastEventAt:      upgradedAt.Add(-24 * time.Hour),
+	}
+
+	tests := []struct {
+		name  string
+		order []polkaEvent
+	}{
+		{name: "In order", order: []polkaEvent{upgraded, canceled}},
+		{name: "Cancellation first", order: []polkaEvent{canceled, upgraded}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := *previous
+			for _, event := range tt.order {
+				at := upgradedAt
+				if event.ID == canceled.ID {
+					at = canceledAt
+				}
+				next, changed, err := applyPolkaEvent(&sub, event, at)
+				if errors.Is(err, errStaleEvent) {
+					continue
+				}
+				if err != nil || !changed {
+					t.Fatalf("applyPolkaEvent(%v) = %v, %v, want the subscription changed", event.Event, changed, err)
+				}
+				sub = next
+			}
+			if sub.Status != subscriptionCanceled || !sub.LastEventAt.Equal(canceledAt) {
+				t.Errorf("subscription = %+v, want it canceled by the last event", sub)
+			}
+			if until := chirpyRedUntil(sub); !until.Before(canceledAt.Add(subscriptionPeriod)) {
+				t.Errorf("chirpy red until %v, want the canceled period end", until)
+			}
+		})
+	}
+}
+
+func TestPolkaEventTime(t *testing.T) {
+	createdAt := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	signedAt := createdAt.Add(time.Minute) // a retry
+	future := signedAt.Add(time.Second)
+
+	tests := []struct {
+		name      string
+		createdAt *time.Time
+		want      time.Time
+	}{
+		{name: "Created before it was signed", createdAt: &createdAt, want: createdAt},
+		{name: "Without the creation time", want: signedAt},
+		{name: "Created after it was signed", createdAt: &future, want: signedAt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := polkaEvent{ID: "evt_1", Event: "subscription.canceled", CreatedAt: tt.createdAt}
+			if got := polkaEventTime(event, signedAt); !got.Equal(tt.want) {
+				t.Errorf("polkaEventTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChirpyRedUntil(t *testing.T) {
+	periodEnd := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	cancelAt := periodEnd.Add(-5 * 24 * time.Hour)
+
+	tests := []struct {
+		name string
+		sub  database.Subscription
+		want time.Time
+	}{
+		{
+			name: "Active until the renewal is late",
+			sub:  database.Subscription{Status: subscriptionActive, CurrentPeriodEnd: periodEnd},
+			want: periodEnd.Add(subscriptionLeeway),
+		},
+		{
+			name: "Past due until the grace period is over",
+			sub:  database.Subscription{Status: subscriptionPastDue, CurrentPeriodEnd: periodEnd},
+			want: periodEnd.Add(subscriptionGracePeriod),
+		},
+		{
+			name: "Canceled until the cancellation",
+			sub:  database.Subscription{Status: subscriptionCanceled, CurrentPeriodEnd: periodEnd, CancelAt: sql.NullTime{Time: cancelAt, Valid: true}},
+			want: cancelAt,
+		},
+		{
+			name: "Canceled after the paid period",
+			sub:  database.Subscription{Status: subscriptionCanceled, CurrentPeriodEnd: periodEnd, CancelAt: sql.NullTime{Time: periodEnd.Add(time.Hour), Valid: true}},
+			want: periodEnd,
+		},
+		{
+			name: "Unknown status",
+			sub:  database.Subscription{Status: "paused", CurrentPeriodEnd: periodEnd},
+			want: time.Time{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chirpyRedUntil(tt.sub); !got.Equal(tt.want) {
+				t.Errorf("chirpyRedUntil() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
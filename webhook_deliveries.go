@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/database"
+	"github.com/h0dy/http-server/internal/mail"
+	"github.com/h0dy/http-server/internal/store"
+	"github.com/h0dy/http-server/internal/webhook"
+)
+
+// events sent to the webhook endpoints of a user
+const (
+	webhookChirpCreated    = "chirp.created"    // the user posted a chirp (or a scheduled draft got published)
+	webhookChirpDeleted    = "chirp.deleted"    // a chirp of the user was moved to the trash
+	webhookFollowerCreated = "follower.created" // someone followed the user
+	webhookChirpMentioned  = "chirp.mentioned"  // someone mentioned the user (@handle) in a chirp
+)
+
+var webhookEventTypes = []string{webhookChirpCreated, webhookChirpDeleted, webhookFollowerCreated, webhookChirpMentioned}
+
+// mentionRegex matches the @handle mentions of a chirp, chirpMentions checks what comes before them
+var mentionRegex = regexp.MustCompile(`@([a-zA-Z0-9_]+)`)
+
+var errLocalNetwork = errors.New("webhooks can't be sent to the local network")
+
+// newWebhookClient func returns the client sending the webhooks. validateWebhookURL only checks the ip literals, a
+// hostname can still resolve to the local network (or be changed to after the endpoint was created), so every address
+// is checked again once resolved, right before connecting to it
+func newWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isLocalNetworkIP(ip) {
+				return fmt.Errorf("%w: %v", errLocalNetwork, address)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // the proxy would connect to the endpoint instead of the dialer
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		// a redirect counts as a failed delivery, the url of the endpoint has to be updated
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+}
+
+const (
+	chirpyTimestampHeader = "X-Chirpy-Timestamp" // unix time the webhook was sent at
+	chirpySignatureHeader = "X-Chirpy-Signature" // v1=<hex HMAC-SHA256 of "<timestamp>.<body>"> with the secret of the endpoint
+	chirpyEventHeader     = "X-Chirpy-Event"
+	chirpyDeliveryHeader  = "X-Chirpy-Delivery" // id of the delivery, the same on every attempt
+
+	webhookDeliveryPending   = "pending"
+	webhookDeliveryDelivered = "delivered"
+	webhookDeliveryFailed    = "failed"
+
+	webhookDeliveryTimeout     = 10 * time.Second
+	webhookDeliveryLease       = 2 * time.Minute // longer than a batch can take, the deliveries are sent in parallel
+	webhookDeliveryBatchSize   = 20
+	webhookDeliveryMaxAttempts = 10 // a delivery is failed after this many attempts, about 6 hours after the event
+	webhookDeliveryRetryBase   = time.Minute
+	webhookDeliveryRetryMax    = 2 * time.Hour
+	webhookDeliveryRetention   = 30 * 24 * time.Hour // how long the delivery log is kept
+
+	webhookEndpointMaxFailures = 20 // failed attempts in a row before the endpoint is disabled
+)
+
+// webhookPayload is the body of the webhooks sent to the endpoints
+type webhookPayload struct {
+	ID        uuid.UUID `json:"id"` // the same for every endpoint the event is sent to, receivers can use it to ignore duplicates
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+type webhookChirpData struct {
+	Chirp webhookChirp `json:"chirp"`
+}
+
+type webhookChirp struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Body      string    `json:"body"`
+	UserID    uuid.UUID `json:"user_id"`
+}
+
+func webhookChirpFromDB(chirp database.Chirp) webhookChirpData {
+	return webhookChirpData{Chirp: webhookChirp{
+		ID:        chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		Body:      chirp.Body,
+		UserID:    chirp.UserID,
+	}}
+}
+
+type webhookFollowerData struct {
+	Follower *Author `json:"follower"`
+}
+
+// enqueueWebhook func queues the event for the endpoints of the user that subscribed to it. it's called in the
+// transaction of the change, so the event is only sent if the change is saved
+func enqueueWebhook(ctx context.Context, q store.Webhooks, userID uuid.UUID, event string, data any) error {
+	payload, err := json.Marshal(webhookPayload{
+		ID:        uuid.New(),
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't encode the %v webhook: %v", event, err)
+	}
+	if _, err := q.CreateWebhookDeliveries(ctx, database.CreateWebhookDeliveriesParams{
+		Event:   event,
+		Payload: string(payload),
+		UserID:  userID,
+	}); err != nil {
+		return fmt.Errorf("couldn't queue the %v webhook: %v", event, err)
+	}
+	return nil
+}
+
+// chirpMentions func returns the handles mentioned in the body, lowercased and without duplicates. an @ inside a word
+// (an email address) isn't a mention, nor is a word that can't be a handle
+func chirpMentions(body string) []string {
+	handles := []string{}
+	for _, match := range mentionRegex.FindAllStringSubmatchIndex(body, -1) {
+		if match[0] > 0 && isHandleChar(body[match[0]-1]) {
+			continue
+		}
+		handle := strings.ToLower(body[match[2]:match[3]])
+		if handleRegex.MatchString(handle) && !slices.Contains(handles, handle) {
+			handles = append(handles, handle)
+		}
+	}
+	return handles
+}
+
+func isHandleChar(c byte) bool {
+	return c == '_' || c == '@' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// mentionWebhooks is what enqueueMentionWebhooks needs, the store or the queries of a transaction
+type mentionWebhooks interface {
+	GetProfileByHandle(ctx context.Context, handle string) (database.GetProfileByHandleRow, error)
+	store.Webhooks
+}
+
+// enqueueMentionWebhooks func queues the chirp.mentioned event for the users mentioned in the chirp, the handles
+// nobody has are ignored and so are the authors mentioning themselves
+func enqueueMentionWebhooks(ctx context.Context, q mentionWebhooks, chirp database.Chirp) error {
+	for _, handle := range chirpMentions(chirp.Body) {
+		profile, err := q.GetProfileByHandle(ctx, handle)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't retrieve the mentioned user @%v: %v", handle, err)
+		}
+		if profile.ID == chirp.UserID {
+			continue
+		}
+		if err := enqueueWebhook(ctx, q, profile.ID, webhookChirpMentioned, webhookChirpFromDB(chirp)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliverWebhooks func sends a batch of the due deliveries in parallel
+func (cfg *apiConfig) deliverWebhooks(ctx context.Context) {
+	deliveries, err := cfg.store.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{
+		LeaseUntil: time.Now().UTC().Add(webhookDeliveryLease),
+		Limit:      webhookDeliveryBatchSize,
+	})
+	if err != nil {
+		log.Printf("error in claiming webhook deliveries: %v", err)
+		return
+	}
+
+	wg := sync.WaitGroup{}
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cfg.deliverWebhook(ctx, delivery)
+		}()
+	}
+	wg.Wait()
+}
+
+// deliverWebhook func makes an attempt at a delivery and saves its outcome,
+// a failed attempt is retried with a backoff and counts toward disabling the endpoint
+func (cfg *apiConfig) deliverWebhook(ctx context.Context, delivery database.ClaimWebhookDeliveriesRow) {
+	statusCode, sendErr := sendWebhookDelivery(ctx, cfg.webhookSender, delivery, time.Now())
+	responseStatus := sql.NullInt32{Int32: int32(statusCode), Valid: statusCode != 0}
+
+	if sendErr == nil {
+		if err := cfg.store.CompleteWebhookDelivery(ctx, database.CompleteWebhookDeliveryParams{
+			ID:             delivery.ID,
+			ResponseStatus: responseStatus,
+		}); err != nil {
+			log.Printf("couldn't complete webhook delivery %v: %v", delivery.ID, err)
+		}
+		if err := cfg.store.RecordWebhookEndpointSuccess(ctx, delivery.EndpointID); err != nil {
+			log.Printf("couldn't update webhook endpoint %v: %v", delivery.EndpointID, err)
+		}
+		return
+	}
+
+	status, nextAttemptAt := webhookDeliveryRetry(delivery.Attempts+1, time.Now().UTC())
+	if err := cfg.store.FailWebhookDelivery(ctx, database.FailWebhookDeliveryParams{
+		ID:             delivery.ID,
+		Status:         status,
+		NextAttemptAt:  nextAttemptAt,
+		ResponseStatus: responseStatus,
+		LastError:      sendErr.Error(),
+	}); err != nil {
+		log.Printf("couldn't save the failure of webhook delivery %v: %v", delivery.ID, err)
+	}
+	endpoint, err := cfg.store.RecordWebhookEndpointFailure(ctx, database.RecordWebhookEndpointFailureParams{
+		MaxFailures: webhookEndpointMaxFailures,
+		ID:          delivery.EndpointID,
+	})
+	if err != nil {
+		log.Printf("couldn't update webhook endpoint %v: %v", delivery.EndpointID, err)
+		return
+	}
+	// the failure count only reaches the max once, later attempts find the endpoint disabled
+	if endpoint.FailureCount == webhookEndpointMaxFailures {
+		log.Printf("disabled webhook endpoint %v after %d failed attempts", endpoint.ID, endpoint.FailureCount)
+		cfg.notifyWebhookEndpointDisabled(ctx, endpoint)
+	}
+}
+
+// sendWebhookDelivery func posts the payload of a delivery to its endpoint
+func sendWebhookDelivery(ctx context.Context, sender webhook.Sender, delivery database.ClaimWebhookDeliveriesRow, now time.Time) (int, error) {
+	header := http.Header{}
+	header.Set(chirpyEventHeader, delivery.Event)
+	header.Set(chirpyDeliveryHeader, delivery.ID.String())
+	return sender.Send(ctx, delivery.Url, delivery.Secret, []byte(delivery.Payload), header, now)
+}
+
+// webhookDeliveryRetry func returns the status of a delivery after its failed attempt, and when it's attempted next
+func webhookDeliveryRetry(attempts int32, now time.Time) (status string, nextAttemptAt time.Time) {
+	if attempts >= webhookDeliveryMaxAttempts {
+		return webhookDeliveryFailed, now
+	}
+	return webhookDeliveryPending, now.Add(webhook.Backoff(int(attempts), webhookDeliveryRetryBase, webhookDeliveryRetryMax))
+}
+
+// notifyWebhookEndpointDisabled func tells the user their endpoint was disabled, a notice that couldn't be sent is only logged
+func (cfg *apiConfig) notifyWebhookEndpointDisabled(ctx context.Context, endpoint database.WebhookEndpoint) {
+	user, err := cfg.store.GetUserByID(ctx, endpoint.UserID)
+	if err != nil {
+		log.Printf("couldn't retrieve the owner of webhook endpoint %v: %v", endpoint.ID, err)
+		return
+	}
+	if err := cfg.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy webhook was disabled",
+		Body: fmt.Sprintf(
+			"Your webhook endpoint %v was disabled after %d failed deliveries in a row.\n\n"+
+				"Enable it again once it's fixed, the deliveries still pending are sent then.",
+			endpoint.Url, endpoint.FailureCount,
+		),
+	}); err != nil {
+		log.Printf("couldn't send the webhook notice to user %v: %v", user.ID, err)
+	}
+}
+
+func (cfg *apiConfig) purgeWebhookDeliveries(ctx context.Context) {
+	purged, err := cfg.store.PurgeWebhookDeliveries(ctx, time.Now().UTC().Add(-webhookDeliveryRetention))
+	if err != nil {
+		log.Printf("error in purging webhook deliveries: %v", err)
+		return
+	}
+	if purged > 0 {
+		log.Printf("purged %d webhook deliveries", purged)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h0dy/http-server/internal/database"
+	"github.com/h0dy/http-server/internal/webhook"
+)
+
+func TestSendWebhookDelivery(t *testing.T) {
+	userID := uuid.New()
+	payload, err := json.Marshal(webhookPayload{
+		ID:        uuid.New(),
+		Event:     webhookChirpCreated,
+		CreatedAt: time.Now().UTC(),
+		Data:      webhookChirpFromDB(database.Chirp{ID: uuid.New(), Body: "hello", UserID: userID}),
+	})
+	if err != nil {
+		t.Fatalf("couldn't encode the payload: %v", err)
+	}
+	delivery := database.ClaimWebhookDeliveriesRow{
+		ID:      uuid.New(),
+		Event:   webhookChirpCreated,
+		Payload: string(payload),
+		Secret:  "whsec_test",
+	}
+	sender := webhook.Sender{
+		Client:          &http.Client{Timeout: time.Second},
+		TimestampHeader: chirpyTimestampHeader,
+		SignatureHeader: chirpySignatureHeader,
+	}
+
+	// the receiver checks the delivery the way an integration would
+	received := make(chan webhookPayload, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		verifier := webhook.Verifier{Secrets: []string{"whsec_test"}, Tolerance: time.Minute}
+		if err := verifier.Verify(body, r.Header.Get(chirpyTimestampHeader), r.Header.Get(chirpySignatureHeader), time.Now()); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get(chirpyEventHeader) != webhookChirpCreated || r.Header.Get(chirpyDeliveryHeader) != delivery.ID.String() {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		event := webhookPayload{}
+		if err := json.Unmarshal(body, &event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received <- event
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer receiver.Close()
+	delivery.Url = receiver.URL
+
+	status, err := sendWebhookDelivery(context.Background(), sender, delivery, time.Now())
+	if err != nil || status != http.StatusAccepted {
+		t.Fatalf("sendWebhookDelivery() = %d, %v, want 202", status, err)
+	}
+	event := <-received
+	if event.Event != webhookChirpCreated {
+		t.Errorf("received event %v, want %v", event.Event, webhookChirpCreated)
+	}
+
+	// a delivery signed with another secret is rejected by the receiver
+	delivery.Secret = "whsec_other"
+	status, err = sendWebhookDelivery(context.Background(), sender, delivery, time.Now())
+	if err == nil || status != http.StatusUnauthorized {
+		t.Errorf("sendWebhookDelivery() = %d, %v, want 401 and an error", status, err)
+	}
+}
+
+func TestWebhookDeliveryRetry(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		attempts   int32
+		wantStatus string
+		wantNext   time.Time
+	}{
+		{
+			name:       "First failure",
+			attempts:   1,
+			wantStatus: webhookDeliveryPending,
+			wantNext:   now.Add(webhookDeliveryRetryBase),
+		},
+		{
+			name:       "Backoff doubles",
+			attempts:   4,
+			wantStatus: webhookDeliveryPending,
+			wantNext:   now.Add(8 * webhookDeliveryRetryBase),
+		},
+		{
+			name:       "Backoff is capped",
+			attempts:   webhookDeliveryMaxAttempts - 1,
+			wantStatus: webhookDeliveryPending,
+			wantNext:   now.Add(webhookDeliveryRetryMax),
+		},
+		{
+			name:       "Out of attempts",
+			attempts:   webhookDeliveryMaxAttempts,
+			wantStatus: webhookDeliveryFailed,
+			wantNext:   now,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, next := webhookDeliveryRetry(tt.attempts, now)
+			if status != tt.wantStatus {
+				t.Errorf("webhookDeliveryRetry() status = %v, want %v", status, tt.wantStatus)
+			}
+			if !next.Equal(tt.wantNext) {
+				t.Errorf("webhookDeliveryRetry() next attempt = %v, want %v", next, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestWebhookClientLocalNetwork(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the webhook reached the local server")
+	}))
+	defer srv.Close()
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{name: "Hostname resolving to loopback", url: "http://localhost:" + port + "/"},
+		{name: "Loopback ip", url: srv.URL},
+		{name: "Ipv4-mapped loopback ip", url: "http://[::ffff:127.0.0.1]:" + port + "/"},
+	}
+
+	client := newWebhookClient(time.Second)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := client.Get(tt.url)
+			if err == nil {
+				res.Body.Close()
+			}
+			if !errors.Is(err, errLocalNetwork) {
+				t.Errorf("Get(%v) error = %v, want %v", tt.url, err, errLocalNetwork)
+			}
+		})
+	}
+}
+
+func TestChirpMentions(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{name: "No mention", body: "hello world", want: []string{}},
+		{name: "Mentions", body: "@alice, meet @Bob_99!", want: []string{"alice", "bob_99"}},
+		{name: "Duplicates", body: "@alice @ALICE @alice", want: []string{"alice"}},
+		{name: "Email address", body: "mail me at bob@example.com", want: []string{}},
+		{name: "Double at", body: "@@alice", want: []string{}},
+		{name: "Too short", body: "@al", want: []string{}},
+		{name: "Too long", body: "@" + strings.Repeat("a", 21), want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chirpMentions(tt.body); !slices.Equal(got, tt.want) {
+				t.Errorf("chirpMentions(%q) = %v, want %v", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnqueueMentionWebhooks(t *testing.T) {
+	author, alice := uuid.New(), uuid.New()
+	q := &fakeDraftPublisher{handles: map[string]uuid.UUID{"author": author, "alice": alice}}
+	chirp := database.Chirp{ID: uuid.New(), Body: "@author thanks @alice and @nobody", UserID: author}
+	if err := enqueueMentionWebhooks(context.Background(), q, chirp); err != nil {
+		t.Fatalf("enqueueMentionWebhooks() error = %v", err)
+	}
+	// only alice is notified, the author mentioned themselves and nobody has no account
+	if !slices.Equal(q.webhooks, []string{webhookChirpMentioned}) {
+		t.Errorf("queued webhooks = %v, want one %v", q.webhooks, webhookChirpMentioned)
+	}
+}